@@ -7,67 +7,316 @@ import (
 	"math"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/lucasjlepore/fit-analyzer/internal/npower"
+	"github.com/lucasjlepore/fit-analyzer/internal/sentinel"
 	"github.com/tormoder/fit"
 )
 
 const (
 	secondsPerHour = 3600.0
+
+	// heartRateMergeToleranceSeconds bounds how far an external heart-rate sample
+	// may be from a record timestamp and still fill that record's missing HR.
+	heartRateMergeToleranceSeconds = 1.0
+
+	// defaultDecouplingVIThreshold is the variability index above which aerobic
+	// decoupling is not computed; interval sessions make the half-split meaningless.
+	defaultDecouplingVIThreshold = 1.10
+
+	// distanceDivergenceWarnPct is the recorded-vs-GPS distance gap that sets
+	// Analysis.DistanceNote.
+	distanceDivergenceWarnPct = 5.0
+
+	// defaultRepTargetTolerancePct is the ± band around the main-set work target
+	// used for rep-level time-in-target.
+	defaultRepTargetTolerancePct = 5.0
 )
 
 // Config controls optional calculations that require athlete-specific inputs.
 type Config struct {
 	FTPWatts float64
 	WeightKG float64
+
+	// FTPSource labels FTPWatts in Analysis.FTPSource when the caller took it
+	// from the file (e.g. "sport_profile"); empty means "input".
+	FTPSource string
+
+	// FTPIsOverride marks FTPWatts as an explicit user override (fit_analyze
+	// --ftp). Only such an FTP drives power zones ahead of the device's zone
+	// boundaries and FTP, so zones agree with IF/TSS; any other FTPWatts is a
+	// fallback after them.
+	FTPIsOverride bool
+
+	// SportOverride forces the activity sport (e.g. "running", "cycling",
+	// "swimming") when the file's session sport is generic or mislabeled.
+	// Names match FIT sport values case-insensitively, ignoring "_" and spaces.
+	SportOverride string
+
+	// DecouplingVIThreshold overrides the variability index above which power:HR
+	// decoupling is suppressed. Zero uses the 1.10 default.
+	DecouplingVIThreshold float64
+
+	// RepTargetTolerancePct is the ± percentage around the main-set work target
+	// counted as "in target" for MainSetRep.TimeInTargetPct. Zero uses 5%.
+	RepTargetTolerancePct float64
+
+	// CleanGPS drops GPS fixes flagged as teleports from climb detection.
+	// Glitches are always counted and always excluded from the GPS distance;
+	// pipeline also drops them from exported positions when set.
+	CleanGPS bool
+
+	// GPSMaxSpeedMPS overrides the implied speed between fixes above which a
+	// fix is flagged as a glitch. Zero uses 40 m/s (12 m/s for foot sports).
+	GPSMaxSpeedMPS float64
+
+	// PreferGPSDistance reports distance and average speed from the GPS track
+	// (sum of haversine segments) instead of the recorded distance field.
+	PreferGPSDistance bool
+
+	// ThresholdGAPMps is the runner's threshold grade-adjusted speed (m/s) used
+	// for GAP zones. Zero estimates it from the best 30-minute GAP.
+	ThresholdGAPMps float64
+
+	// MainSetGroupingPct is how far (percent of the current set's mean
+	// rep duration or power) a work rep may deviate before it starts a new main set, so
+	// e.g. 3x5m followed by 5x2m is reported as two sets. Zero uses 25%.
+	MainSetGroupingPct float64
+
+	// MinStructureConfidence suppresses inferred workout blocks whose confidence
+	// is below this value, labeling the session as unstructured instead.
+	MinStructureConfidence float64
+
+	// HeartRateSamples fills HR for records that omit heart_rate, e.g. wrist-HR
+	// activities that store beats in dedicated hr messages (global 132).
+	HeartRateSamples []HeartRateSample
+
+	// DeveloperApps carries developer data provenance (globals 206/207) parsed
+	// outside the FIT library; it is copied to Analysis.DeveloperApps and used
+	// to classify PowerSource.
+	DeveloperApps []DeveloperApp
+
+	// DeveloperCadence is cadence logged in developer fields (see
+	// llmexport.DeveloperCadenceSamples). With crank and wheel sensors both
+	// paired it is reported as the wheel stream in Analysis.CadenceStreams.
+	DeveloperCadence []CadenceSample
+
+	// DeviceZones carries the head unit's configured FTP and power zone
+	// boundaries (time_in_zone, global 216) so zone time matches the device.
+	DeviceZones *DevicePowerZones
+
+	// StuckSensorMinSeconds is how long a power, HR, cadence or speed channel
+	// must hold a near-constant non-zero value to be reported in
+	// Analysis.StuckSensors. Zero uses 600 s.
+	StuckSensorMinSeconds float64
+
+	// StuckSensorTolerancePct is the cadence or speed spread allowed within
+	// such a stretch as a percentage of its lowest value; power and HR must
+	// repeat exactly. Zero uses 1%.
+	StuckSensorTolerancePct float64
+
+	// RecoveryHoursPerTSS sets Analysis.RecommendedRecoveryHours per TSS point
+	// before the intensity adjustment. Zero uses 0.24 (100 TSS ≈ 24 h).
+	RecoveryHoursPerTSS float64
+
+	// SportProfile carries the device's sport profile (globals 12 and 7). Its
+	// max HR drives Analysis.HeartRateZones; it is copied to the analysis.
+	SportProfile *SportProfile
+
+	// FTPFromCPModel estimates a missing FTP as critical power from the
+	// 2-parameter model (FTPSource "cp_model") instead of 95% of the best
+	// 20 minutes, falling back to the latter when the model has too few points.
+	FTPFromCPModel bool
+
+	// BestEffortDurationsS lists the durations, in seconds and strictly
+	// ascending, reported in Analysis.BestEfforts; they are added to the power
+	// curve. Empty reports every power curve duration.
+	BestEffortDurationsS []int
+
+	// ExcludeLaps lists 1-based lap numbers (file order) to leave out of
+	// interval detection and workout structure inference, e.g. an accidental
+	// lap press or an aborted rep. The laps remain in the exports.
+	ExcludeLaps []int
+
+	// UseMedianForAverages reports the median instead of the mean in
+	// AvgPowerWatts, AvgHeartRate and AvgCadence, which is robust to spikes
+	// and dropouts. NP, VI, work and lap classification still use means.
+	UseMedianForAverages bool
+
+	// Weather carries the file's weather report and barometer pressure
+	// (globals 128 and 209) parsed outside the FIT library; it is copied to
+	// Analysis.Weather and summarized in the notes.
+	Weather *Weather
+
+	// LapLabels renames lap labels in Analysis.Laps, e.g. {"work": "effort",
+	// "recovery": "rest"}, to localize or match a team's vocabulary. Keys must
+	// be canonical labels (warmup, activation, work, recovery, easy, steady,
+	// cooldown); detection always runs on the canonical names, which renamed
+	// laps keep in CanonicalLabel.
+	LapLabels map[string]string
+}
+
+// DevicePowerZones is the power zone configuration recorded by the device.
+type DevicePowerZones struct {
+	FTPWatts        float64   `json:"ftp_watts,omitempty"`
+	HighBoundariesW []float64 `json:"high_boundaries_w,omitempty"`
+}
+
+// HeartRateSample is a timestamped heart-rate reading sourced outside record messages.
+type HeartRateSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	BPM       float64   `json:"bpm"`
+}
+
+// DeveloperApp identifies an application that wrote developer fields
+// (developer_data_id, global 207) and the fields it described (global 206).
+type DeveloperApp struct {
+	DeveloperDataIndex uint8                `json:"developer_data_index"`
+	ApplicationID      string               `json:"application_id,omitempty"`
+	ApplicationVersion uint32               `json:"application_version,omitempty"`
+	Manufacturer       string               `json:"manufacturer,omitempty"`
+	Fields             []DeveloperFieldInfo `json:"fields,omitempty"`
+}
+
+// DeveloperFieldInfo describes one developer field contributed by an app.
+type DeveloperFieldInfo struct {
+	FieldNumber uint8  `json:"field_number"`
+	Name        string `json:"name,omitempty"`
+	Units       string `json:"units,omitempty"`
+}
+
+// PedalPowerPhase holds record-averaged pedal stroke phase angles in degrees
+// (0 = top dead centre). Phase spans where the leg produces positive torque;
+// peak phase spans where it produces its highest torque.
+type PedalPowerPhase struct {
+	LeftStartDeg      float64 `json:"left_start_deg"`
+	LeftEndDeg        float64 `json:"left_end_deg"`
+	LeftPeakStartDeg  float64 `json:"left_peak_start_deg"`
+	LeftPeakEndDeg    float64 `json:"left_peak_end_deg"`
+	RightStartDeg     float64 `json:"right_start_deg"`
+	RightEndDeg       float64 `json:"right_end_deg"`
+	RightPeakStartDeg float64 `json:"right_peak_start_deg"`
+	RightPeakEndDeg   float64 `json:"right_peak_end_deg"`
+	SampleCount       int     `json:"sample_count"`
 }
 
 // Analysis contains extracted metrics and generated notes for a FIT activity.
 type Analysis struct {
-	FilePath          string           `json:"file_path"`
-	Sport             string           `json:"sport"`
-	SubSport          string           `json:"sub_sport"`
-	StartTime         time.Time        `json:"start_time"`
-	EndTime           time.Time        `json:"end_time"`
-	ElapsedSeconds    float64          `json:"elapsed_seconds"`
-	MovingSeconds     float64          `json:"moving_seconds"`
-	DistanceMeters    float64          `json:"distance_meters"`
-	ElevationGainM    float64          `json:"elevation_gain_m"`
-	ElevationLossM    float64          `json:"elevation_loss_m"`
-	Calories          int              `json:"calories"`
-	AvgSpeedMps       float64          `json:"avg_speed_mps"`
-	MaxSpeedMps       float64          `json:"max_speed_mps"`
-	AvgPowerWatts     float64          `json:"avg_power_watts"`
-	MaxPowerWatts     float64          `json:"max_power_watts"`
-	NormalizedPower   float64          `json:"normalized_power_watts"`
-	VariabilityIndex  float64          `json:"variability_index"`
-	WorkKilojoules    float64          `json:"work_kilojoules"`
-	AvgHeartRate      float64          `json:"avg_heart_rate_bpm"`
-	MaxHeartRate      float64          `json:"max_heart_rate_bpm"`
-	AvgCadence        float64          `json:"avg_cadence_rpm"`
-	MaxCadence        float64          `json:"max_cadence_rpm"`
-	FTPWatts          float64          `json:"ftp_watts"`
-	FTPSource         string           `json:"ftp_source"`
-	WeightKG          float64          `json:"weight_kg,omitempty"`
-	AvgPowerWPerKG    float64          `json:"avg_power_w_per_kg,omitempty"`
-	NPWPerKG          float64          `json:"np_w_per_kg,omitempty"`
-	MaxPowerWPerKG    float64          `json:"max_power_w_per_kg,omitempty"`
-	IntensityFactor   float64          `json:"intensity_factor"`
-	TrainingStress    float64          `json:"training_stress_score"`
-	Best20MinPower    float64          `json:"best_20min_power_watts"`
-	PowerHRDecoupling float64          `json:"power_hr_decoupling_pct"`
-	PowerZones        []ZoneDuration   `json:"power_zones,omitempty"`
-	Laps              []LapSummary     `json:"laps,omitempty"`
-	Intervals         IntervalSummary  `json:"intervals"`
-	WorkoutStructure  WorkoutStructure `json:"workout_structure"`
-	Notes             string           `json:"notes"`
-}
-
-// ZoneDuration stores duration spent in a given FTP-based power zone.
+	FilePath                 string             `json:"file_path"`
+	Sport                    string             `json:"sport"`
+	SportSource              string             `json:"sport_source"`
+	SessionNote              string             `json:"session_note,omitempty"`
+	SubSport                 string             `json:"sub_sport"`
+	IsVirtual                bool               `json:"is_virtual"`
+	Environment              string             `json:"environment"`
+	EnvironmentSource        string             `json:"environment_source"`
+	StartTime                time.Time          `json:"start_time"`
+	EndTime                  time.Time          `json:"end_time"`
+	UTCOffsetSeconds         *int               `json:"utc_offset_seconds,omitempty"` // device local time minus UTC, from activity.local_timestamp
+	ElapsedSeconds           float64            `json:"elapsed_seconds"`
+	MovingSeconds            float64            `json:"moving_seconds"`
+	DistanceMeters           float64            `json:"distance_meters"`
+	DistanceMetersGPS        float64            `json:"distance_meters_gps,omitempty"`
+	DistanceNote             string             `json:"distance_note,omitempty"`
+	ElevationGainM           float64            `json:"elevation_gain_m"`
+	ElevationLossM           float64            `json:"elevation_loss_m"`
+	Calories                 int                `json:"calories"`
+	CarbGrams                float64            `json:"carb_grams_estimate,omitempty"`
+	FatGrams                 float64            `json:"fat_grams_estimate,omitempty"`
+	AvgSpeedMps              float64            `json:"avg_speed_mps"`
+	AvgSpeedSource           string             `json:"avg_speed_source,omitempty"`
+	MaxSpeedMps              float64            `json:"max_speed_mps"`
+	AvgPowerWatts            float64            `json:"avg_power_watts"`
+	MaxPowerWatts            float64            `json:"max_power_watts"`
+	NormalizedPower          float64            `json:"normalized_power_watts"`
+	VariabilityIndex         float64            `json:"variability_index"`
+	WorkKilojoules           float64            `json:"work_kilojoules"`
+	AvgHeartRate             float64            `json:"avg_heart_rate_bpm"`
+	MaxHeartRate             float64            `json:"max_heart_rate_bpm"`
+	AvgCadence               float64            `json:"avg_cadence_rpm"`
+	MedianPowerWatts         float64            `json:"median_power_watts,omitempty"`
+	MedianHeartRate          float64            `json:"median_heart_rate_bpm,omitempty"`
+	MedianCadence            float64            `json:"median_cadence_rpm,omitempty"`
+	AverageMethod            string             `json:"average_method,omitempty"`
+	AverageMeanFallback      []string           `json:"average_mean_fallback,omitempty"` // channels (power, heart_rate, cadence) that kept the mean because their median was 0
+	MaxCadence               float64            `json:"max_cadence_rpm"`
+	TotalCycles              int                `json:"total_cycles,omitempty"`
+	CycleUnit                string             `json:"cycle_unit,omitempty"`
+	AvgStrokeRate            float64            `json:"avg_stroke_rate_per_min,omitempty"`
+	FTPWatts                 float64            `json:"ftp_watts"`
+	FTPSource                string             `json:"ftp_source"`
+	WeightKG                 float64            `json:"weight_kg,omitempty"`
+	AvgPowerWPerKG           float64            `json:"avg_power_w_per_kg,omitempty"`
+	NPWPerKG                 float64            `json:"np_w_per_kg,omitempty"`
+	MaxPowerWPerKG           float64            `json:"max_power_w_per_kg,omitempty"`
+	FTPWPerKG                float64            `json:"ftp_w_per_kg,omitempty"`
+	IntensityFactor          float64            `json:"intensity_factor"`
+	TrainingStress           float64            `json:"training_stress_score"`
+	RecommendedRecoveryHours float64            `json:"recommended_recovery_hours,omitempty"`
+	RecoveryLoad             string             `json:"recovery_load,omitempty"`
+	Best20MinPower           float64            `json:"best_20min_power_watts"`
+	Best20MinReliable        bool               `json:"best_20min_power_reliable"`
+	BestEfforts              []BestEffort       `json:"best_efforts,omitempty"`
+	PowerCurve               []PowerCurvePoint  `json:"power_curve,omitempty"`
+	CriticalPower            float64            `json:"critical_power_watts,omitempty"`
+	WPrimeJoules             float64            `json:"w_prime_joules,omitempty"`
+	PowerHRDecoupling        float64            `json:"power_hr_decoupling_pct"`
+	DecouplingReliable       bool               `json:"power_hr_decoupling_reliable"`
+	DecouplingNote           string             `json:"power_hr_decoupling_note,omitempty"`
+	PowerZones               []ZoneDuration     `json:"power_zones,omitempty"`
+	ZoneSource               string             `json:"zone_source,omitempty"`
+	DeviceTimeInZone         *DeviceTimeInZone  `json:"device_time_in_zone,omitempty"`
+	SportProfile             *SportProfile      `json:"sport_profile,omitempty"`
+	Weather                  *Weather           `json:"weather,omitempty"`
+	HeartRateZones           []HRZoneDuration   `json:"heart_rate_zones,omitempty"`
+	QuadrantAnalysis         *QuadrantAnalysis  `json:"quadrant_analysis,omitempty"`
+	GradeAdjustedSpeedMps    float64            `json:"grade_adjusted_speed_mps,omitempty"`
+	ThresholdGAPMps          float64            `json:"threshold_gap_mps,omitempty"`
+	ThresholdGAPSource       string             `json:"threshold_gap_source,omitempty"`
+	GAPZones                 []PaceZoneDuration `json:"gap_zones,omitempty"`
+	Climbs                   []ClimbSummary     `json:"climbs,omitempty"`
+	GPSGlitchCount           int                `json:"gps_glitch_count"`
+	GPSGlitchTimes           []time.Time        `json:"-"` // timestamps of the flagged fixes, for WithoutGPSGlitches
+	StuckSensors             []string           `json:"stuck_sensors,omitempty"`
+	DeveloperApps            []DeveloperApp     `json:"developer_apps,omitempty"`
+	PedalPowerPhase          *PedalPowerPhase   `json:"pedal_power_phase,omitempty"`
+	BatteryVoltageDropPct    *float64           `json:"battery_voltage_drop_pct,omitempty"` // recording device; see DeviceBattery.VoltageDropPct
+	Batteries                []DeviceBattery    `json:"batteries,omitempty"`
+	PowerSource              string             `json:"power_source,omitempty"`
+	CadenceSource            string             `json:"cadence_source,omitempty"`
+	CadenceSensors           []CadenceSensor    `json:"cadence_sensors,omitempty"`
+	CadenceStreams           []CadenceStream    `json:"cadence_streams,omitempty"`
+	CadenceNote              string             `json:"cadence_note,omitempty"`
+	Laps                     []LapSummary       `json:"laps,omitempty"`
+	ExcludedLaps             []int              `json:"excluded_laps,omitempty"`
+	Intervals                IntervalSummary    `json:"intervals"`
+	WorkoutStructure         WorkoutStructure   `json:"workout_structure"`
+	Notes                    string             `json:"notes"`
+}
+
+// DeviceTimeInZone is the recording device's own zone accounting from the
+// time_in_zone message, for comparison with the computed PowerZones.
+type DeviceTimeInZone struct {
+	HRZoneSeconds            []float64 `json:"hr_zone_seconds,omitempty"`
+	PowerZoneSeconds         []float64 `json:"power_zone_seconds,omitempty"`
+	HRZoneHighBoundariesBPM  []float64 `json:"hr_zone_high_boundaries_bpm,omitempty"`
+	PowerZoneHighBoundariesW []float64 `json:"power_zone_high_boundaries_w,omitempty"`
+}
+
+// ZoneDuration stores duration spent in a given power zone. Zones built from
+// device boundaries also carry watt limits; the open-ended top zone has no
+// MaxWatts or MaxPctFTP. When weight is known each zone also carries its W/kg
+// band; the top zone has no MaxWPerKG.
 type ZoneDuration struct {
 	Zone       string  `json:"zone"`
 	MinPctFTP  float64 `json:"min_pct_ftp"`
 	MaxPctFTP  float64 `json:"max_pct_ftp"`
+	MinWatts   float64 `json:"min_watts,omitempty"`
+	MaxWatts   float64 `json:"max_watts,omitempty"`
+	MinWPerKG  float64 `json:"min_w_per_kg,omitempty"`
+	MaxWPerKG  float64 `json:"max_w_per_kg,omitempty"`
 	Seconds    float64 `json:"seconds"`
 	Percentage float64 `json:"percentage"`
 }
@@ -83,7 +332,10 @@ type LapSummary struct {
 	MaxPowerWatts      float64 `json:"max_power_watts"`
 	AvgHeartRate       float64 `json:"avg_heart_rate_bpm"`
 	AvgCadence         float64 `json:"avg_cadence_rpm"`
+	TotalCycles        int     `json:"total_cycles,omitempty"`
+	Trigger            string  `json:"trigger,omitempty"`
 	Label              string  `json:"label"`
+	CanonicalLabel     string  `json:"canonical_label,omitempty"` // set when Config.LapLabels renamed Label
 }
 
 // IntervalSummary captures the detected interval structure of the workout.
@@ -98,6 +350,24 @@ type IntervalSummary struct {
 	WorkPowerChangePct         float64 `json:"work_power_change_pct"`
 	WorkCadenceChangePct       float64 `json:"work_cadence_change_pct"`
 	WorkHeartRateChange        float64 `json:"work_heart_rate_change_bpm"`
+	AutoLaps                   bool    `json:"auto_laps"`
+	// Source is "power_samples" when the laps were auto-laps and the
+	// intervals and workout structure come from segmenting the power stream;
+	// lap numbers in the structure then count those segments. Empty means the
+	// recorded laps.
+	Source string `json:"source,omitempty"`
+}
+
+type timedSample struct {
+	ts    time.Time
+	value float64
+}
+
+// pedalSample pairs power with a non-zero cadence from the same record.
+type pedalSample struct {
+	ts      time.Time
+	power   float64
+	cadence float64
 }
 
 type recordSeries struct {
@@ -106,6 +376,8 @@ type recordSeries struct {
 	durationSec float64
 
 	powerSamples []float64
+	// powerForNP is power resampled to 1 Hz: readings sharing a second are
+	// averaged and gaps of up to 10 s hold the previous value (npower.Resample1Hz).
 	powerForNP   []float64
 	hrSamples    []float64
 	cadSamples   []float64
@@ -114,32 +386,49 @@ type recordSeries struct {
 	pairedPower []float64
 	pairedHR    []float64
 
+	pedalSamples []pedalSample
+
+	timedPower  []timedSample
+	timedHR     []timedSample
+	climbPoints []climbPoint
+	hasGPS      bool
+
 	lastDistanceMeters float64
 	workKJ             float64
 }
 
-// AnalyzeFile decodes and analyzes an activity FIT file.
+// AnalyzeFile decodes and analyzes an activity FIT file. It reads the file and
+// delegates to AnalyzeBytes with path as the source name.
 func AnalyzeFile(path string, cfg Config) (*Analysis, error) {
-	f, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("open FIT file: %w", err)
+		return nil, fmt.Errorf("read FIT file: %w", err)
 	}
-	defer f.Close()
-
-	return Analyze(f, path, cfg)
+	return AnalyzeBytes(data, path, cfg)
 }
 
-// AnalyzeBytes decodes and analyzes an activity FIT payload directly from memory.
+// AnalyzeBytes decodes and analyzes an activity FIT payload directly from
+// memory, so callers holding bytes need no temp file. sourceName (which may
+// be empty) becomes Analysis.FilePath.
 func AnalyzeBytes(data []byte, sourceName string, cfg Config) (*Analysis, error) {
 	return Analyze(bytes.NewReader(data), sourceName, cfg)
 }
 
+// AnalyzeReader decodes and analyzes an activity FIT payload streamed from r.
+// Analysis.FilePath is empty; use Analyze to name the source.
+func AnalyzeReader(r io.Reader, cfg Config) (*Analysis, error) {
+	return Analyze(r, "", cfg)
+}
+
 // Analyze decodes and analyzes an activity FIT payload from any reader.
 func Analyze(r io.Reader, sourceName string, cfg Config) (*Analysis, error) {
 	decoded, err := fit.Decode(r)
 	if err != nil {
 		return nil, fmt.Errorf("decode FIT payload: %w", err)
 	}
+	if IsMonitoringFileType(decoded.Type()) {
+		return nil, fmt.Errorf("activity FIT expected: %v is a monitoring file (use AnalyzeMonitoring)", decoded.Type())
+	}
 	activity, err := decoded.Activity()
 	if err != nil {
 		return nil, fmt.Errorf("activity FIT expected: %w", err)
@@ -152,17 +441,39 @@ func AnalyzeActivity(activity *fit.ActivityFile, sourceName string, cfg Config)
 	if activity == nil {
 		return nil, fmt.Errorf("activity is required")
 	}
-	if len(activity.Sessions) == 0 {
-		return nil, fmt.Errorf("activity file has no session message")
+	if len(activity.Sessions) == 0 && len(activity.Records) == 0 {
+		return nil, fmt.Errorf("activity file has no session or record messages")
+	}
+	if err := validateBestEffortDurations(cfg.BestEffortDurationsS); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := validateLapLabels(cfg.LapLabels); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	series := buildRecordSeries(activity.Records)
-	session := activity.Sessions[0]
+	series := buildRecordSeries(activity.Records, cfg.HeartRateSamples)
+	session, synthesized := activitySession(activity)
 
 	analysis := &Analysis{
-		FilePath: sourceName,
-		Sport:    fmt.Sprint(session.Sport),
-		SubSport: fmt.Sprint(session.SubSport),
+		FilePath:    sourceName,
+		Sport:       fmt.Sprint(session.Sport),
+		SportSource: "session",
+		SubSport:    fmt.Sprint(session.SubSport),
+		IsVirtual:   session.SubSport == fit.SubSportVirtualActivity,
+	}
+	if synthesized {
+		analysis.SportSource = "default"
+		analysis.SessionNote = "no session message; session metrics synthesized from record data"
+	}
+	sport := session.Sport
+	if strings.TrimSpace(cfg.SportOverride) != "" {
+		override, err := ParseSport(cfg.SportOverride)
+		if err != nil {
+			return nil, err
+		}
+		sport = override
+		analysis.Sport = fmt.Sprint(sport)
+		analysis.SportSource = "override"
 	}
 
 	analysis.StartTime = validTimeOrZero(session.StartTime)
@@ -173,6 +484,9 @@ func AnalyzeActivity(activity *fit.ActivityFile, sourceName string, cfg Config)
 	if analysis.EndTime.IsZero() {
 		analysis.EndTime = series.end
 	}
+	if offset, ok := localUTCOffset(activity.Activity); ok {
+		analysis.UTCOffsetSeconds = &offset
+	}
 
 	analysis.ElapsedSeconds = safePositive(session.GetTotalTimerTimeScaled())
 	if analysis.ElapsedSeconds == 0 {
@@ -186,6 +500,36 @@ func AnalyzeActivity(activity *fit.ActivityFile, sourceName string, cfg Config)
 	if analysis.DistanceMeters == 0 {
 		analysis.DistanceMeters = series.lastDistanceMeters
 	}
+	gpsMaxSpeed := cfg.GPSMaxSpeedMPS
+	if gpsMaxSpeed <= 0 {
+		gpsMaxSpeed = gpsMaxSpeedMPS(sport)
+	}
+	analysis.Environment, analysis.EnvironmentSource = detectEnvironment(session.SubSport, series.hasGPS, analysis.DistanceMeters > 0, activity.DeviceInfos)
+	indoor := analysis.Environment == EnvironmentIndoor
+	fixes := gpsFixes(activity.Records)
+	var glitches []time.Time
+	if !indoor {
+		glitches = detectGPSGlitches(fixes, gpsMaxSpeed)
+	}
+	analysis.GPSGlitchCount = len(glitches)
+	analysis.GPSGlitchTimes = glitches
+	analysis.StuckSensors = detectStuckSensors(activity.Records, cfg.StuckSensorMinSeconds, cfg.StuckSensorTolerancePct, indoor)
+	analysis.DistanceMetersGPS = gpsTrackDistance(fixes, glitches)
+	recordedDistance := analysis.DistanceMeters
+	// Indoor and virtual rides have no or simulated positions, so the
+	// recorded (trainer) distance is authoritative and a GPS divergence says
+	// nothing useful.
+	if !indoor && recordedDistance > 0 && analysis.DistanceMetersGPS > 0 {
+		diff := (recordedDistance - analysis.DistanceMetersGPS) / analysis.DistanceMetersGPS * 100
+		if math.Abs(diff) > distanceDivergenceWarnPct {
+			analysis.DistanceNote = fmt.Sprintf("recorded distance differs from GPS distance by %+.1f%% (check wheel circumference or GPS quality)", diff)
+		}
+	}
+	useGPSDistance := cfg.PreferGPSDistance && !indoor && analysis.DistanceMetersGPS > 0
+	if useGPSDistance {
+		analysis.DistanceMeters = analysis.DistanceMetersGPS
+	}
+
 	analysis.ElevationGainM = safePositive(float64(validUint16(session.TotalAscent)))
 	analysis.ElevationLossM = safePositive(float64(validUint16(session.TotalDescent)))
 	analysis.Calories = int(validUint16(session.TotalCalories))
@@ -194,8 +538,17 @@ func AnalyzeActivity(activity *fit.ActivityFile, sourceName string, cfg Config)
 	if analysis.AvgSpeedMps == 0 {
 		analysis.AvgSpeedMps = safePositive(session.GetAvgSpeedScaled())
 	}
-	if analysis.AvgSpeedMps == 0 && analysis.ElapsedSeconds > 0 {
-		analysis.AvgSpeedMps = analysis.DistanceMeters / analysis.ElapsedSeconds
+	if analysis.AvgSpeedMps > 0 {
+		analysis.AvgSpeedSource = "session"
+	}
+	// Derived speeds use moving time, like the device's own average, so
+	// switching the distance source does not count pauses.
+	if (analysis.AvgSpeedMps == 0 || useGPSDistance) && analysis.MovingSeconds > 0 && analysis.DistanceMeters > 0 {
+		analysis.AvgSpeedMps = analysis.DistanceMeters / analysis.MovingSeconds
+		analysis.AvgSpeedSource = "recorded_distance"
+		if useGPSDistance {
+			analysis.AvgSpeedSource = "gps_distance"
+		}
 	}
 	analysis.MaxSpeedMps = safePositive(session.GetEnhancedMaxSpeedScaled())
 	if analysis.MaxSpeedMps == 0 {
@@ -216,7 +569,7 @@ func AnalyzeActivity(activity *fit.ActivityFile, sourceName string, cfg Config)
 
 	analysis.NormalizedPower = float64(validUint16(session.NormalizedPower))
 	if analysis.NormalizedPower == 0 {
-		analysis.NormalizedPower = normalizedPower(series.powerForNP)
+		analysis.NormalizedPower = npower.Normalized(series.powerForNP)
 	}
 	if analysis.NormalizedPower == 0 {
 		analysis.NormalizedPower = analysis.AvgPowerWatts
@@ -248,10 +601,26 @@ func AnalyzeActivity(activity *fit.ActivityFile, sourceName string, cfg Config)
 		analysis.MaxCadence = maxValue(series.cadSamples)
 	}
 
+	applyTotalCycles(analysis, session, activity.Laps, sport)
+
 	analysis.Best20MinPower = bestRollingPower(series.powerForNP, 20*60)
+	// Less riding time with power makes bestRollingPower fall back to the
+	// ride average.
+	analysis.Best20MinReliable = powerCoveredSeconds(series.timedPower) >= 20*60
+	analysis.PowerCurve = buildPowerCurve(series.powerForNP, cfg.BestEffortDurationsS)
+	if cp, wprime, ok := EstimateCriticalPower(analysis.PowerCurve); ok {
+		analysis.CriticalPower = round2(cp)
+		analysis.WPrimeJoules = math.Round(wprime)
+	}
 	analysis.FTPWatts = safePositive(cfg.FTPWatts)
 	if analysis.FTPWatts > 0 {
 		analysis.FTPSource = "input"
+		if cfg.FTPSource != "" {
+			analysis.FTPSource = cfg.FTPSource
+		}
+	} else if cfg.FTPFromCPModel && analysis.CriticalPower > 0 {
+		analysis.FTPWatts = analysis.CriticalPower
+		analysis.FTPSource = "cp_model"
 	} else {
 		estimated := estimateFTP(series.powerForNP)
 		if estimated > 0 {
@@ -265,33 +634,183 @@ func AnalyzeActivity(activity *fit.ActivityFile, sourceName string, cfg Config)
 	if analysis.AvgPowerWatts > 0 {
 		analysis.VariabilityIndex = analysis.NormalizedPower / analysis.AvgPowerWatts
 	}
+	analysis.MedianPowerWatts = median(series.powerSamples)
+	analysis.MedianHeartRate = median(series.hrSamples)
+	analysis.MedianCadence = median(series.cadSamples)
+	meanPower := analysis.AvgPowerWatts
+	if cfg.UseMedianForAverages {
+		analysis.AverageMethod = "median"
+		for _, ch := range []struct {
+			name   string
+			avg    *float64
+			median float64
+		}{
+			{"power", &analysis.AvgPowerWatts, analysis.MedianPowerWatts},
+			{"heart_rate", &analysis.AvgHeartRate, analysis.MedianHeartRate},
+			{"cadence", &analysis.AvgCadence, analysis.MedianCadence},
+		} {
+			switch {
+			case ch.median > 0:
+				*ch.avg = ch.median
+			case *ch.avg > 0:
+				// A zero median (e.g. mostly coasting) would hide real work.
+				analysis.AverageMeanFallback = append(analysis.AverageMeanFallback, ch.name)
+			}
+		}
+	}
 	if cfg.WeightKG > 0 {
 		analysis.WeightKG = cfg.WeightKG
 		analysis.AvgPowerWPerKG = analysis.AvgPowerWatts / cfg.WeightKG
 		analysis.NPWPerKG = analysis.NormalizedPower / cfg.WeightKG
 		analysis.MaxPowerWPerKG = analysis.MaxPowerWatts / cfg.WeightKG
+		analysis.FTPWPerKG = analysis.FTPWatts / cfg.WeightKG
 	}
+	analysis.BestEfforts = buildBestEfforts(analysis.PowerCurve, cfg.BestEffortDurationsS, cfg.WeightKG)
 	if analysis.FTPWatts > 0 && analysis.NormalizedPower > 0 {
 		analysis.IntensityFactor = analysis.NormalizedPower / analysis.FTPWatts
 	}
+	analysis.CarbGrams, analysis.FatGrams = estimateSubstrateGrams(series.powerForNP, analysis.FTPWatts)
 	if analysis.ElapsedSeconds > 0 && analysis.IntensityFactor > 0 {
 		analysis.TrainingStress = (analysis.ElapsedSeconds / secondsPerHour) * analysis.IntensityFactor * analysis.IntensityFactor * 100.0
 	}
+	if analysis.TrainingStress > 0 {
+		analysis.RecommendedRecoveryHours = recommendedRecoveryHours(analysis.TrainingStress, analysis.IntensityFactor, cfg.RecoveryHoursPerTSS)
+		analysis.RecoveryLoad = recoveryLoadCategory(analysis.TrainingStress)
+	}
 
-	analysis.PowerHRDecoupling = powerHRDecoupling(series.pairedPower, series.pairedHR)
-	analysis.PowerZones = buildPowerZones(series.powerForNP, analysis.FTPWatts)
-	analysis.Laps, analysis.Intervals = summarizeLaps(activity.Laps, analysis.AvgPowerWatts)
-	analysis.WorkoutStructure = InferWorkoutStructure(analysis.Laps, analysis.FTPWatts, analysis.Intervals)
+	viThreshold := cfg.DecouplingVIThreshold
+	if viThreshold <= 0 {
+		viThreshold = defaultDecouplingVIThreshold
+	}
+	if analysis.VariabilityIndex > viThreshold {
+		analysis.DecouplingNote = fmt.Sprintf("suppressed: variability index %.2f exceeds %.2f", analysis.VariabilityIndex, viThreshold)
+	} else {
+		analysis.PowerHRDecoupling, analysis.DecouplingReliable = powerHRDecoupling(series.pairedPower, series.pairedHR)
+		if !analysis.DecouplingReliable {
+			analysis.DecouplingNote = "insufficient paired power/HR samples"
+		}
+	}
+	zoneFTP, zoneBounds, zoneSource := resolveZoneConfig(session, cfg.DeviceZones, analysis.FTPWatts, analysis.FTPSource, cfg.FTPIsOverride)
+	analysis.PowerZones = buildPowerZones(series.powerForNP, zoneFTP, zoneBounds)
+	annotateZoneWPerKG(analysis.PowerZones, zoneFTP, cfg.WeightKG)
+	if cfg.SportProfile != nil {
+		analysis.SportProfile = cfg.SportProfile
+		analysis.HeartRateZones = buildHeartRateZones(series.timedHR, cfg.SportProfile.MaxHeartRateBPM)
+	}
+	analysis.QuadrantAnalysis = buildQuadrantAnalysis(series.pedalSamples, analysis.FTPWatts)
+	if len(analysis.PowerZones) > 0 {
+		analysis.ZoneSource = zoneSource
+	}
+	climbPoints := series.climbPoints
+	if cfg.CleanGPS {
+		climbPoints = withoutGlitchPoints(climbPoints, glitches)
+	}
+	if !indoor && series.hasGPS {
+		analysis.Climbs = detectClimbs(climbPoints, cfg.WeightKG)
+	}
+	if sport == fit.SportRunning && !indoor {
+		applyGradeAdjustedPace(analysis, climbPoints, cfg.ThresholdGAPMps)
+	}
+	excludeLaps := make(map[int]bool, len(cfg.ExcludeLaps))
+	for _, n := range cfg.ExcludeLaps {
+		excludeLaps[n] = true
+	}
+	for idx, lap := range activity.Laps {
+		if lap != nil && excludeLaps[idx+1] {
+			analysis.ExcludedLaps = append(analysis.ExcludedLaps, idx+1)
+		}
+	}
+	analysis.Laps, analysis.Intervals = summarizeLaps(activity.Laps, meanPower, excludeLaps)
+	analysis.WorkoutStructure = inferWorkoutStructure(analysis.Laps, analysis.FTPWatts, analysis.Intervals, cfg.MainSetGroupingPct)
+	structureLaps := activity.Laps
+	if analysis.Intervals.AutoLaps {
+		penalized := math.Max(0.05, analysis.WorkoutStructure.Confidence-autoLapConfidencePenalty)
+		analysis.WorkoutStructure.addConfidence("auto_laps", penalized-analysis.WorkoutStructure.Confidence)
+		// Auto-lap boundaries are arbitrary, so weight the power-stream
+		// segmentation over them: it carries no penalty and wins whenever it
+		// finds work intervals with more confidence.
+		if segments := powerSegmentLaps(series.timedPower, meanPower); len(segments) > 0 {
+			segLaps, segIntervals := summarizeLaps(segments, meanPower, nil)
+			segStructure := inferWorkoutStructure(segLaps, analysis.FTPWatts, segIntervals, cfg.MainSetGroupingPct)
+			if segIntervals.WorkCount > 0 && segStructure.Confidence > analysis.WorkoutStructure.Confidence {
+				segIntervals.AutoLaps = true
+				segIntervals.Source = "power_samples"
+				analysis.Intervals, analysis.WorkoutStructure = segIntervals, segStructure
+				structureLaps = segments
+			}
+		}
+	}
+	suppressLowConfidenceStructure(&analysis.WorkoutStructure, cfg.MinStructureConfidence)
+	repTolerance := cfg.RepTargetTolerancePct
+	if repTolerance <= 0 {
+		repTolerance = defaultRepTargetTolerancePct
+	}
+	for _, set := range analysis.WorkoutStructure.mainSetSummaries() {
+		enrichRepTimeInTarget(set, structureLaps, series.timedPower, repTolerance)
+		enrichRepTorque(set, structureLaps, series.pedalSamples)
+	}
+	analysis.DeveloperApps = cfg.DeveloperApps
+	analysis.PowerSource = detectPowerSource(len(series.powerSamples) > 0, activity.DeviceInfos, cfg.DeveloperApps)
+	analysis.CadenceSource, analysis.CadenceSensors, analysis.CadenceNote = detectCadenceSource(len(series.cadSamples) > 0, activity.DeviceInfos)
+	analysis.CadenceStreams = buildCadenceStreams(analysis.CadenceSensors, series.cadSamples, cfg.DeveloperCadence)
+	if len(analysis.CadenceStreams) > 0 {
+		analysis.CadenceNote = "Crank and wheel-based (trainer) cadence were both recorded; cadence and pedaling metrics use the crank stream, and cadence_streams summarizes each separately."
+	}
+	analysis.Batteries = summarizeBatteries(activity.DeviceInfos)
+	for _, b := range analysis.Batteries {
+		if b.DeviceIndex == uint8(creatorDeviceIndex) {
+			analysis.BatteryVoltageDropPct = b.VoltageDropPct
+		}
+	}
+	analysis.Weather = cfg.Weather
+	applyLapLabels(analysis.Laps, cfg.LapLabels)
 	analysis.Notes = BuildTrainingNotes(analysis)
 
 	return analysis, nil
 }
 
-func buildRecordSeries(records []*fit.RecordMsg) recordSeries {
+// activitySession returns the first session message. Truncated files and some
+// apps write records without a session; an empty session is returned instead
+// so every metric falls back to the record series.
+func activitySession(activity *fit.ActivityFile) (*fit.SessionMsg, bool) {
+	if len(activity.Sessions) > 0 {
+		return activity.Sessions[0], false
+	}
+	session := fit.NewSessionMsg()
+	session.Sport = fit.SportGeneric
+	session.SubSport = fit.SubSportGeneric
+	return session, true
+}
+
+// ParseSport resolves a user-supplied sport name to a FIT sport value.
+func ParseSport(name string) (fit.Sport, error) {
+	want := normalizeSportName(name)
+	if want == "" {
+		return fit.SportInvalid, fmt.Errorf("sport name is required")
+	}
+	for v := fit.SportGeneric; v < fit.SportAll; v++ {
+		label := fmt.Sprint(v)
+		if strings.HasPrefix(label, "Sport(") {
+			continue
+		}
+		if normalizeSportName(label) == want {
+			return v, nil
+		}
+	}
+	return fit.SportInvalid, fmt.Errorf("unknown sport override %q", name)
+}
+
+func normalizeSportName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer("_", "", " ", "", "-", "").Replace(name)
+}
+
+func buildRecordSeries(records []*fit.RecordMsg, extraHR []HeartRateSample) recordSeries {
 	rs := recordSeries{}
 	if len(records) == 0 {
 		return rs
 	}
+	extraHR = sortedHeartRateSamples(extraHR)
 
 	type row struct {
 		ts time.Time
@@ -306,9 +825,21 @@ func buildRecordSeries(records []*fit.RecordMsg) recordSeries {
 		rows = append(rows, row{ts: rec.Timestamp, r: rec})
 	}
 
-	sort.Slice(rows, func(i, j int) bool {
+	sort.SliceStable(rows, func(i, j int) bool {
 		return rows[i].ts.Before(rows[j].ts)
 	})
+	// Re-transmitted records repeat a timestamp, anywhere in the file; fold
+	// each into the first record at that time, as the pipeline's canonical
+	// samples do.
+	merged := rows[:0]
+	for _, entry := range rows {
+		if n := len(merged); n > 0 && !validTimeOrZero(entry.ts).IsZero() && entry.ts.Equal(merged[n-1].ts) {
+			merged[n-1].r = mergeDuplicateRecord(merged[n-1].r, entry.r)
+			continue
+		}
+		merged = append(merged, entry)
+	}
+	rows = merged
 
 	var (
 		haveStart    bool
@@ -333,14 +864,23 @@ func buildRecordSeries(records []*fit.RecordMsg) recordSeries {
 
 		power, hasPower := extractPower(rec)
 		hr, hasHR := extractHeartRate(rec)
+		if !hasHR && !ts.IsZero() {
+			hr, hasHR = HeartRateAt(extraHR, ts)
+		}
 		cadence, hasCadence := extractCadence(rec)
 		speed, hasSpeed := extractSpeed(rec)
 
 		if hasPower {
 			rs.powerSamples = append(rs.powerSamples, power)
+			if !ts.IsZero() {
+				rs.timedPower = append(rs.timedPower, timedSample{ts: ts, value: power})
+			}
 		}
 		if hasHR {
 			rs.hrSamples = append(rs.hrSamples, hr)
+			if !ts.IsZero() {
+				rs.timedHR = append(rs.timedHR, timedSample{ts: ts, value: hr})
+			}
 		}
 		if hasCadence {
 			rs.cadSamples = append(rs.cadSamples, cadence)
@@ -352,11 +892,26 @@ func buildRecordSeries(records []*fit.RecordMsg) recordSeries {
 			rs.pairedPower = append(rs.pairedPower, power)
 			rs.pairedHR = append(rs.pairedHR, hr)
 		}
+		if hasPower && hasCadence && cadence > 0 {
+			rs.pedalSamples = append(rs.pedalSamples, pedalSample{ts: ts, power: power, cadence: cadence})
+		}
 
 		distance := safePositive(rec.GetDistanceScaled())
 		if distance > 0 {
 			lastDistance = distance
 		}
+		if !rec.PositionLat.Invalid() && !rec.PositionLong.Invalid() {
+			rs.hasGPS = true
+		}
+		if alt, ok := extractAltitude(rec); ok && distance > 0 && !ts.IsZero() {
+			rs.climbPoints = append(rs.climbPoints, climbPoint{
+				ts:        ts,
+				distanceM: distance,
+				altitudeM: alt,
+				powerW:    power,
+				hasPower:  hasPower,
+			})
+		}
 
 		if hasPower {
 			if haveLastTS && !ts.IsZero() && ts.After(lastTS) && haveLastPwr {
@@ -364,15 +919,7 @@ func buildRecordSeries(records []*fit.RecordMsg) recordSeries {
 				if delta > 0 && delta <= 5 {
 					workJoules += lastPower * delta
 				}
-
-				missing := int(math.Round(delta)) - 1
-				if missing > 0 && missing <= 30 {
-					for i := 0; i < missing; i++ {
-						rs.powerForNP = append(rs.powerForNP, lastPower)
-					}
-				}
 			}
-			rs.powerForNP = append(rs.powerForNP, power)
 			lastPower = power
 			haveLastPwr = true
 		}
@@ -384,6 +931,17 @@ func buildRecordSeries(records []*fit.RecordMsg) recordSeries {
 	}
 
 	rs.lastDistanceMeters = lastDistance
+	if len(rs.timedPower) > 0 {
+		seconds := make([]float64, len(rs.timedPower))
+		watts := make([]float64, len(rs.timedPower))
+		for i, s := range rs.timedPower {
+			seconds[i] = float64(s.ts.UnixNano()) / float64(time.Second)
+			watts[i] = s.value
+		}
+		rs.powerForNP = npower.Resample1Hz(seconds, watts, nil)
+	} else {
+		rs.powerForNP = rs.powerSamples
+	}
 	if !rs.start.IsZero() && !rs.end.IsZero() && rs.end.After(rs.start) {
 		rs.durationSec = rs.end.Sub(rs.start).Seconds()
 	}
@@ -397,7 +955,10 @@ func buildRecordSeries(records []*fit.RecordMsg) recordSeries {
 	return rs
 }
 
-func summarizeLaps(laps []*fit.LapMsg, sessionAvgPower float64) ([]LapSummary, IntervalSummary) {
+// summarizeLaps labels laps and derives the interval summary. Laps whose
+// 1-based number is in exclude are left out entirely, though their duration
+// still advances the offsets of the laps after them.
+func summarizeLaps(laps []*fit.LapMsg, sessionAvgPower float64, exclude map[int]bool) ([]LapSummary, IntervalSummary) {
 	if len(laps) == 0 {
 		return nil, IntervalSummary{}
 	}
@@ -413,6 +974,10 @@ func summarizeLaps(laps []*fit.LapMsg, sessionAvgPower float64) ([]LapSummary, I
 		if duration == 0 {
 			duration = safePositive(lap.GetTotalElapsedTimeScaled())
 		}
+		if exclude[idx+1] {
+			offset += duration
+			continue
+		}
 
 		avgPower := float64(validUint16(lap.AvgPower))
 		if avgPower > 0 {
@@ -429,6 +994,8 @@ func summarizeLaps(laps []*fit.LapMsg, sessionAvgPower float64) ([]LapSummary, I
 			MaxPowerWatts:      float64(validUint16(lap.MaxPower)),
 			AvgHeartRate:       float64(validUint8(lap.AvgHeartRate)),
 			AvgCadence:         cadenceFromAny(lap.GetAvgCadence()),
+			TotalCycles:        int(validUint32(lap.TotalCycles)),
+			Trigger:            LapTriggerLabel(lap.LapTrigger),
 			Label:              "steady",
 		})
 		offset += duration
@@ -509,6 +1076,7 @@ func summarizeLaps(laps []*fit.LapMsg, sessionAvgPower float64) ([]LapSummary, I
 		WorkCount:       len(workIndices),
 		RecoveryCount:   len(recoveryIndices),
 		ActivationCount: activationCount,
+		AutoLaps:        autoLapped(summaries),
 	}
 
 	workPowers := make([]float64, 0, len(workIndices))
@@ -546,8 +1114,64 @@ func summarizeLaps(laps []*fit.LapMsg, sessionAvgPower float64) ([]LapSummary, I
 	return summaries, intervals
 }
 
-func buildPowerZones(powerSamples []float64, ftp float64) []ZoneDuration {
-	if ftp <= 0 || len(powerSamples) == 0 {
+// resolveZoneConfig picks the FTP and optional watt boundaries for power zones:
+// device zone boundaries first, then the device FTP (time_in_zone or session
+// threshold_power), then the configured FTP, then the estimated one. An
+// explicit override (Config.FTPIsOverride) goes before the device settings.
+// The source is one of "device_zones", "device_ftp", "config_ftp" or
+// "estimated_ftp".
+func resolveZoneConfig(session *fit.SessionMsg, device *DevicePowerZones, ftp float64, ftpSource string, override bool) (float64, []float64, string) {
+	configured := ftp > 0 && ftpSource != "estimated" && ftpSource != "cp_model"
+	if override && configured {
+		return ftp, nil, "config_ftp"
+	}
+	deviceFTP := 0.0
+	var bounds []float64
+	if device != nil {
+		deviceFTP = device.FTPWatts
+		bounds = device.HighBoundariesW
+	}
+	if deviceFTP <= 0 && session != nil {
+		deviceFTP = float64(validUint16(session.ThresholdPower))
+	}
+	switch {
+	case len(bounds) > 0:
+		return deviceFTP, bounds, "device_zones"
+	case deviceFTP > 0:
+		return deviceFTP, nil, "device_ftp"
+	case configured:
+		return ftp, nil, "config_ftp"
+	default:
+		return ftp, nil, "estimated_ftp"
+	}
+}
+
+// annotateZoneWPerKG fills the W/kg band of each zone from its watt limits,
+// or from its percent-of-FTP limits for FTP-relative zones. It does nothing
+// without a weight.
+func annotateZoneWPerKG(zones []ZoneDuration, ftp, weightKG float64) {
+	if weightKG <= 0 {
+		return
+	}
+	for i := range zones {
+		z := &zones[i]
+		minW, maxW := z.MinWatts, z.MaxWatts
+		if minW == 0 && maxW == 0 {
+			minW = z.MinPctFTP / 100.0 * ftp
+			maxW = z.MaxPctFTP / 100.0 * ftp
+		}
+		z.MinWPerKG = round2(minW / weightKG)
+		if i < len(zones)-1 {
+			z.MaxWPerKG = round2(maxW / weightKG)
+		}
+	}
+}
+
+// buildPowerZones buckets power samples into zones. With highBoundsW the zones
+// are the device's own watt ranges (the last zone is open-ended); otherwise the
+// default 7-zone model relative to ftp is used.
+func buildPowerZones(powerSamples []float64, ftp float64, highBoundsW []float64) []ZoneDuration {
+	if len(powerSamples) == 0 || (ftp <= 0 && len(highBoundsW) == 0) {
 		return nil
 	}
 
@@ -556,14 +1180,24 @@ func buildPowerZones(powerSamples []float64, ftp float64) []ZoneDuration {
 		min  float64
 		max  float64
 	}
-	zones := []boundary{
-		{zone: "Z1 Active Recovery", min: 0, max: 55},
-		{zone: "Z2 Endurance", min: 55, max: 75},
-		{zone: "Z3 Tempo", min: 75, max: 90},
-		{zone: "Z4 Threshold", min: 90, max: 105},
-		{zone: "Z5 VO2", min: 105, max: 120},
-		{zone: "Z6 Anaerobic", min: 120, max: 150},
-		{zone: "Z7 Neuromuscular", min: 150, max: 1000},
+	var zones []boundary
+	if len(highBoundsW) > 0 {
+		lowW := 0.0
+		for i, highW := range highBoundsW {
+			zones = append(zones, boundary{zone: fmt.Sprintf("Z%d", i+1), min: lowW, max: highW})
+			lowW = highW
+		}
+		zones = append(zones, boundary{zone: fmt.Sprintf("Z%d", len(highBoundsW)+1), min: lowW, max: math.Inf(1)})
+	} else {
+		zones = []boundary{
+			{zone: "Z1 Active Recovery", min: 0, max: 55},
+			{zone: "Z2 Endurance", min: 55, max: 75},
+			{zone: "Z3 Tempo", min: 75, max: 90},
+			{zone: "Z4 Threshold", min: 90, max: 105},
+			{zone: "Z5 VO2", min: 105, max: 120},
+			{zone: "Z6 Anaerobic", min: 120, max: 150},
+			{zone: "Z7 Neuromuscular", min: 150, max: 1000},
+		}
 	}
 
 	counts := make([]int, len(zones))
@@ -572,9 +1206,12 @@ func buildPowerZones(powerSamples []float64, ftp float64) []ZoneDuration {
 		if p < 0 {
 			continue
 		}
-		percent := (p / ftp) * 100.0
+		value := p
+		if len(highBoundsW) == 0 {
+			value = (p / ftp) * 100.0
+		}
 		for i, z := range zones {
-			if percent >= z.min && percent < z.max {
+			if value >= z.min && value < z.max {
 				counts[i]++
 				total++
 				break
@@ -588,45 +1225,72 @@ func buildPowerZones(powerSamples []float64, ftp float64) []ZoneDuration {
 	out := make([]ZoneDuration, 0, len(zones))
 	for i, z := range zones {
 		seconds := float64(counts[i])
-		out = append(out, ZoneDuration{
+		zd := ZoneDuration{
 			Zone:       z.zone,
 			MinPctFTP:  z.min,
 			MaxPctFTP:  z.max,
 			Seconds:    seconds,
 			Percentage: (seconds / float64(total)) * 100.0,
-		})
+		}
+		if len(highBoundsW) > 0 {
+			zd.MinWatts = z.min
+			zd.MaxWatts = z.max
+			zd.MinPctFTP, zd.MaxPctFTP = 0, 0
+			if ftp > 0 {
+				zd.MinPctFTP = z.min / ftp * 100.0
+				if !math.IsInf(z.max, 1) {
+					zd.MaxPctFTP = z.max / ftp * 100.0
+				}
+			}
+			if math.IsInf(z.max, 1) {
+				zd.MaxWatts = 0
+			}
+		}
+		out = append(out, zd)
 	}
 	return out
 }
 
-func normalizedPower(powerSamples []float64) float64 {
-	if len(powerSamples) == 0 {
-		return 0
-	}
-	if len(powerSamples) < 30 {
-		return average(powerSamples)
-	}
-
-	window := 30
-	sum := 0.0
-	for i := 0; i < window; i++ {
-		sum += powerSamples[i]
-	}
+// Critical power model fit window: efforts of roughly 2 to 12 minutes, where
+// the hyperbolic power-duration relationship holds best.
+const (
+	cpModelMinSeconds = 120
+	cpModelMaxSeconds = 720
+)
 
-	fourthPowerTotal := 0.0
-	count := 0
-	for i := window - 1; i < len(powerSamples); i++ {
-		if i >= window {
-			sum += powerSamples[i] - powerSamples[i-window]
+// EstimateCriticalPower fits the 2-parameter hyperbolic critical power model
+// to the power curve points between 2 and 12 minutes. Work (P·t) is linear in
+// t, W = CP·t + W', so a least-squares regression of work on duration gives
+// CP in watts as the slope and W' in joules as the intercept. It returns
+// ok=false with fewer than three usable points or a non-physical fit
+// (non-positive CP or W').
+func EstimateCriticalPower(curve []PowerCurvePoint) (cp float64, wprime float64, ok bool) {
+	var n, sumT, sumW, sumTT, sumTW float64
+	for _, p := range curve {
+		if p.DurationSeconds < cpModelMinSeconds || p.DurationSeconds > cpModelMaxSeconds || p.WattsBest <= 0 {
+			continue
 		}
-		rolling := sum / float64(window)
-		fourthPowerTotal += math.Pow(rolling, 4)
-		count++
-	}
-	if count == 0 {
-		return average(powerSamples)
-	}
-	return math.Pow(fourthPowerTotal/float64(count), 0.25)
+		t := float64(p.DurationSeconds)
+		w := p.WattsBest * t
+		n++
+		sumT += t
+		sumW += w
+		sumTT += t * t
+		sumTW += t * w
+	}
+	if n < 3 {
+		return 0, 0, false
+	}
+	den := n*sumTT - sumT*sumT
+	if den == 0 {
+		return 0, 0, false
+	}
+	cp = (n*sumTW - sumT*sumW) / den
+	wprime = (sumW - cp*sumT) / n
+	if cp <= 0 || wprime <= 0 {
+		return 0, 0, false
+	}
+	return cp, wprime, true
 }
 
 func estimateFTP(powerSamples []float64) float64 {
@@ -637,6 +1301,24 @@ func estimateFTP(powerSamples []float64) float64 {
 	return best20 * 0.95
 }
 
+// powerCoveredSeconds returns the riding time the power stream covers: each
+// reading counts for the gap to the next one when that gap is at most
+// npower.MaxHoldSeconds (longer gaps are pauses), else for one second. Power
+// without timestamps covers no known time.
+func powerCoveredSeconds(power []timedSample) float64 {
+	covered := 0.0
+	for i := range power {
+		hold := 1.0
+		if i+1 < len(power) {
+			if dt := power[i+1].ts.Sub(power[i].ts).Seconds(); dt <= npower.MaxHoldSeconds {
+				hold = dt
+			}
+		}
+		covered += hold
+	}
+	return covered
+}
+
 func bestRollingPower(powerSamples []float64, seconds int) float64 {
 	if len(powerSamples) == 0 || seconds <= 0 {
 		return 0
@@ -644,63 +1326,132 @@ func bestRollingPower(powerSamples []float64, seconds int) float64 {
 	if len(powerSamples) < seconds {
 		return average(powerSamples)
 	}
-
-	sum := 0.0
-	for i := 0; i < seconds; i++ {
-		sum += powerSamples[i]
-	}
-	best := sum / float64(seconds)
-	for i := seconds; i < len(powerSamples); i++ {
-		sum += powerSamples[i] - powerSamples[i-seconds]
-		current := sum / float64(seconds)
-		if current > best {
-			best = current
-		}
-	}
-	return best
+	return meanMaxPower(powerSamples, []int{seconds})[0]
 }
 
-func powerHRDecoupling(power, hr []float64) float64 {
+// powerHRDecoupling compares the power:HR ratio of the second half of the
+// paired samples with the first. ok is false when there are too few samples
+// or either half lacks power or HR; a valid result may be exactly 0.
+func powerHRDecoupling(power, hr []float64) (pct float64, ok bool) {
 	n := len(power)
 	if n == 0 || n != len(hr) || n < 20 {
-		return 0
+		return 0, false
 	}
 	mid := n / 2
 
 	p1, h1 := average(power[:mid]), average(hr[:mid])
 	p2, h2 := average(power[mid:]), average(hr[mid:])
 	if p1 == 0 || p2 == 0 || h1 == 0 || h2 == 0 {
-		return 0
+		return 0, false
 	}
 
 	firstRatio := p1 / h1
 	secondRatio := p2 / h2
-	if firstRatio == 0 {
-		return 0
+	return ((secondRatio / firstRatio) - 1.0) * 100.0, true
+}
+
+// mergeDuplicateRecord returns a copy of rec with the fields it lacks taken
+// from dup, a record with the same timestamp.
+func mergeDuplicateRecord(rec, dup *fit.RecordMsg) *fit.RecordMsg {
+	out := *rec
+	if sentinel.IsInvalidUint16(out.Power) {
+		out.Power = dup.Power
+	}
+	if sentinel.IsInvalidUint8(out.HeartRate) {
+		out.HeartRate = dup.HeartRate
+	}
+	if sentinel.IsInvalidUint8(out.Cadence) && sentinel.IsInvalidUint16(out.Cadence256) {
+		out.Cadence, out.Cadence256 = dup.Cadence, dup.Cadence256
+	}
+	if sentinel.IsInvalidUint16(out.Speed) && sentinel.IsInvalidUint32(out.EnhancedSpeed) {
+		out.Speed, out.EnhancedSpeed = dup.Speed, dup.EnhancedSpeed
+	}
+	if sentinel.IsInvalidUint32(out.Distance) {
+		out.Distance = dup.Distance
 	}
-	return ((secondRatio / firstRatio) - 1.0) * 100.0
+	if sentinel.IsInvalidUint16(out.Altitude) && sentinel.IsInvalidUint32(out.EnhancedAltitude) {
+		out.Altitude, out.EnhancedAltitude = dup.Altitude, dup.EnhancedAltitude
+	}
+	if out.PositionLat.Invalid() || out.PositionLong.Invalid() {
+		out.PositionLat, out.PositionLong = dup.PositionLat, dup.PositionLong
+	}
+	return &out
 }
 
 func extractPower(rec *fit.RecordMsg) (float64, bool) {
-	if rec.Power == math.MaxUint16 {
+	if sentinel.IsInvalidUint16(rec.Power) {
 		return 0, false
 	}
 	return float64(rec.Power), true
 }
 
+func extractAltitude(rec *fit.RecordMsg) (float64, bool) {
+	alt := rec.GetEnhancedAltitudeScaled()
+	if !isFinite(alt) {
+		alt = rec.GetAltitudeScaled()
+	}
+	return alt, isFinite(alt)
+}
+
 func extractHeartRate(rec *fit.RecordMsg) (float64, bool) {
-	if rec.HeartRate == math.MaxUint8 {
+	if sentinel.IsInvalidUint8(rec.HeartRate) {
 		return 0, false
 	}
 	return float64(rec.HeartRate), true
 }
 
+func sortedHeartRateSamples(samples []HeartRateSample) []HeartRateSample {
+	if len(samples) == 0 {
+		return nil
+	}
+	out := make([]HeartRateSample, 0, len(samples))
+	for _, s := range samples {
+		if s.Timestamp.IsZero() || !isFinite(s.BPM) || s.BPM <= 0 {
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Timestamp.Before(out[j].Timestamp)
+	})
+	return out
+}
+
+// HeartRateAt returns the BPM of the sample nearest to ts, if one lies within
+// heartRateMergeToleranceSeconds (1 s). samples must be sorted by timestamp.
+// The pipeline uses it to fill canonical samples the same way the analyzer
+// fills records.
+func HeartRateAt(samples []HeartRateSample, ts time.Time) (float64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+	i := sort.Search(len(samples), func(i int) bool {
+		return !samples[i].Timestamp.Before(ts)
+	})
+	best := -1
+	bestGap := math.Inf(1)
+	for _, idx := range []int{i - 1, i} {
+		if idx < 0 || idx >= len(samples) {
+			continue
+		}
+		gap := math.Abs(samples[idx].Timestamp.Sub(ts).Seconds())
+		if gap < bestGap {
+			best = idx
+			bestGap = gap
+		}
+	}
+	if best < 0 || bestGap > heartRateMergeToleranceSeconds {
+		return 0, false
+	}
+	return samples[best].BPM, true
+}
+
 func extractCadence(rec *fit.RecordMsg) (float64, bool) {
 	cad256 := safePositive(rec.GetCadence256Scaled())
 	if cad256 > 0 {
 		return cad256, true
 	}
-	if rec.Cadence == math.MaxUint8 {
+	if sentinel.IsInvalidUint8(rec.Cadence) {
 		return 0, false
 	}
 	return float64(rec.Cadence), true
@@ -725,22 +1476,23 @@ func validTimeOrZero(t time.Time) time.Time {
 	return t
 }
 
+// validUint8, validUint16 and validUint32 map FIT invalid sentinels to zero.
 func validUint8(v uint8) uint8 {
-	if v == math.MaxUint8 {
+	if sentinel.IsInvalidUint8(v) {
 		return 0
 	}
 	return v
 }
 
 func validUint16(v uint16) uint16 {
-	if v == math.MaxUint16 {
+	if sentinel.IsInvalidUint16(v) {
 		return 0
 	}
 	return v
 }
 
 func validUint32(v uint32) uint32 {
-	if v == math.MaxUint32 {
+	if sentinel.IsInvalidUint32(v) {
 		return 0
 	}
 	return v
@@ -749,12 +1501,12 @@ func validUint32(v uint32) uint32 {
 func cadenceFromAny(v any) float64 {
 	switch x := v.(type) {
 	case uint8:
-		if x == math.MaxUint8 {
+		if sentinel.IsInvalidUint8(x) {
 			return 0
 		}
 		return float64(x)
 	case uint16:
-		if x == math.MaxUint16 {
+		if sentinel.IsInvalidUint16(x) {
 			return 0
 		}
 		return float64(x)
@@ -789,6 +1541,26 @@ func average(values []float64) float64 {
 	return total / float64(count)
 }
 
+// median returns the middle finite value (mean of the two middle values for
+// an even count), or 0 when there is none.
+func median(values []float64) float64 {
+	sorted := make([]float64, 0, len(values))
+	for _, v := range values {
+		if isFinite(v) {
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
+		return 0
+	}
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
 func maxValue(values []float64) float64 {
 	max := 0.0
 	found := false
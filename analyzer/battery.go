@@ -0,0 +1,122 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/internal/sentinel"
+	"github.com/tormoder/fit"
+)
+
+// creatorDeviceIndex is the device_index of the recording device.
+const creatorDeviceIndex = fit.DeviceIndex(0)
+
+// DeviceBattery summarizes battery readings from device_info messages for one
+// device_index across the ride. VoltageDropPct is the drop in battery voltage
+// between the first and last reading as a percentage of the first. It is not a
+// state-of-charge drain: FIT's device_info carries no state of charge, and
+// battery voltage falls non-linearly with charge.
+type DeviceBattery struct {
+	DeviceIndex    uint8    `json:"device_index"`
+	Device         string   `json:"device,omitempty"`
+	Readings       int      `json:"readings"`
+	StartVoltage   float64  `json:"start_voltage,omitempty"`
+	EndVoltage     float64  `json:"end_voltage,omitempty"`
+	VoltageDropPct *float64 `json:"voltage_drop_pct,omitempty"`
+	StartStatus    string   `json:"start_status,omitempty"`
+	EndStatus      string   `json:"end_status,omitempty"`
+}
+
+type batteryReading struct {
+	ts      time.Time
+	voltage float64
+	status  fit.BatteryStatus
+}
+
+// summarizeBatteries groups device_info battery readings by device_index.
+// Devices without any valid voltage or status reading are skipped.
+func summarizeBatteries(infos []*fit.DeviceInfoMsg) []DeviceBattery {
+	readings := make(map[fit.DeviceIndex][]batteryReading)
+	names := make(map[fit.DeviceIndex]string)
+	for _, info := range infos {
+		if info == nil || sentinel.IsInvalidUint8(uint8(info.DeviceIndex)) {
+			continue
+		}
+		if name := deviceName(info); name != "" {
+			names[info.DeviceIndex] = name
+		}
+		voltage := info.GetBatteryVoltageScaled()
+		status := info.BatteryStatus
+		if math.IsNaN(voltage) && (status == fit.BatteryStatusInvalid || status == fit.BatteryStatusUnknown) {
+			continue
+		}
+		readings[info.DeviceIndex] = append(readings[info.DeviceIndex], batteryReading{
+			ts:      validTimeOrZero(info.Timestamp),
+			voltage: voltage,
+			status:  status,
+		})
+	}
+
+	indexes := make([]fit.DeviceIndex, 0, len(readings))
+	for idx := range readings {
+		indexes = append(indexes, idx)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	out := make([]DeviceBattery, 0, len(indexes))
+	for _, idx := range indexes {
+		rs := readings[idx]
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].ts.Before(rs[j].ts) })
+		b := DeviceBattery{
+			DeviceIndex: uint8(idx),
+			Device:      names[idx],
+			Readings:    len(rs),
+		}
+		var first, last *batteryReading
+		for i := range rs {
+			if math.IsNaN(rs[i].voltage) {
+				continue
+			}
+			if first == nil {
+				first = &rs[i]
+			}
+			last = &rs[i]
+		}
+		if first != nil {
+			b.StartVoltage = round2(first.voltage)
+			b.EndVoltage = round2(last.voltage)
+			if first != last && first.voltage > 0 {
+				drop := round2((first.voltage - last.voltage) / first.voltage * 100)
+				b.VoltageDropPct = &drop
+			}
+		}
+		b.StartStatus = batteryStatusLabel(rs[0].status)
+		b.EndStatus = batteryStatusLabel(rs[len(rs)-1].status)
+		out = append(out, b)
+	}
+	return out
+}
+
+func batteryStatusLabel(status fit.BatteryStatus) string {
+	if status == fit.BatteryStatusInvalid {
+		return ""
+	}
+	return strings.TrimPrefix(fmt.Sprint(status), "BatteryStatus")
+}
+
+func deviceName(info *fit.DeviceInfoMsg) string {
+	if name := strings.TrimSpace(info.ProductName); name != "" {
+		return name
+	}
+	if info.Manufacturer == fit.ManufacturerInvalid {
+		return ""
+	}
+	return fmt.Sprint(info.Manufacturer)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
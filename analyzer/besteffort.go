@@ -0,0 +1,45 @@
+package analyzer
+
+import "fmt"
+
+// BestEffort is the best mean power sustained for one duration.
+type BestEffort struct {
+	DurationSeconds int     `json:"duration_s"`
+	Watts           float64 `json:"watts"`
+	WattsPerKG      float64 `json:"watts_per_kg,omitempty"`
+}
+
+// validateBestEffortDurations rejects non-positive or unsorted durations.
+func validateBestEffortDurations(durations []int) error {
+	for i, d := range durations {
+		if d <= 0 {
+			return fmt.Errorf("best effort duration %d s must be positive", d)
+		}
+		if i > 0 && d <= durations[i-1] {
+			return fmt.Errorf("best effort durations must be strictly ascending (%d s after %d s)", d, durations[i-1])
+		}
+	}
+	return nil
+}
+
+// buildBestEfforts reads best efforts off the power curve: every point, or only
+// the requested durations when given. Durations longer than the ride are not
+// on the curve and so are omitted rather than reported as the ride average.
+func buildBestEfforts(curve []PowerCurvePoint, durations []int, weightKG float64) []BestEffort {
+	want := make(map[int]bool, len(durations))
+	for _, d := range durations {
+		want[d] = true
+	}
+	var out []BestEffort
+	for _, p := range curve {
+		if len(want) > 0 && !want[p.DurationSeconds] {
+			continue
+		}
+		effort := BestEffort{DurationSeconds: p.DurationSeconds, Watts: p.WattsBest}
+		if weightKG > 0 {
+			effort.WattsPerKG = round2(p.WattsBest / weightKG)
+		}
+		out = append(out, effort)
+	}
+	return out
+}
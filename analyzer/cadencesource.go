@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/internal/sentinel"
+	"github.com/tormoder/fit"
+)
+
+// Cadence source classifications for Analysis.CadenceSource and
+// CadenceSensor.Source.
+const (
+	CadenceSourceCrank = "crank"
+	CadenceSourceWheel = "wheel"
+)
+
+// BLE device_type values for cadence-capable sensors (FIT profile
+// ble_device_type); bike power and bike trainer are in powersource.go.
+const (
+	bleDeviceTypeBikeSpeedCadence = 3
+	bleDeviceTypeBikeCadence      = 5
+)
+
+// CadenceSensor is one paired device able to report cycling cadence. Crank
+// sensors (cadence pods, speed/cadence combos, crank and pedal power meters)
+// count crank revolutions; wheel sensors (smart trainers) estimate cadence
+// from wheel or flywheel speed.
+type CadenceSensor struct {
+	DeviceIndex uint8  `json:"device_index"`
+	Device      string `json:"device,omitempty"`
+	Source      string `json:"source"`
+}
+
+// CadenceSample is one cadence reading logged outside the record cadence
+// field, e.g. in a trainer app's developer field.
+type CadenceSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	RPM       float64   `json:"rpm"`
+}
+
+// CadenceStream summarizes one of two cadence streams recorded side by side.
+type CadenceStream struct {
+	Source  string  `json:"source"` // crank|wheel
+	Field   string  `json:"field"`  // record.cadence|developer_field
+	Samples int     `json:"samples"`
+	AvgRPM  float64 `json:"avg_rpm"`
+	MaxRPM  float64 `json:"max_rpm"`
+}
+
+// detectCadenceSource lists the paired cadence sensors from device_info and
+// picks the source cadence is attributed to. Crank cadence is preferred: when
+// a crank sensor is paired, cadence and the pedaling metrics derived from it
+// are attributed to the crank and the trainer's wheel-based estimate is not
+// counted as a second cadence stream. Wheel-based cadence is only reported as
+// the source when no crank sensor is paired. Files without cadence, or
+// without an identifiable cycling cadence sensor, return "" and no note.
+func detectCadenceSource(hasCadence bool, infos []*fit.DeviceInfoMsg) (string, []CadenceSensor, string) {
+	if !hasCadence {
+		return "", nil, ""
+	}
+	byIndex := make(map[fit.DeviceIndex]CadenceSensor)
+	for _, info := range infos {
+		if info == nil || sentinel.IsInvalidUint8(uint8(info.DeviceIndex)) {
+			continue
+		}
+		source := cadenceSensorSource(info)
+		if source == "" {
+			continue
+		}
+		sensor := byIndex[info.DeviceIndex]
+		sensor.DeviceIndex = uint8(info.DeviceIndex)
+		sensor.Source = source
+		if name := deviceName(info); name != "" {
+			sensor.Device = name
+		}
+		byIndex[info.DeviceIndex] = sensor
+	}
+	if len(byIndex) == 0 {
+		return "", nil, ""
+	}
+
+	sensors := make([]CadenceSensor, 0, len(byIndex))
+	var crank, wheel bool
+	for _, s := range byIndex {
+		sensors = append(sensors, s)
+		crank = crank || s.Source == CadenceSourceCrank
+		wheel = wheel || s.Source == CadenceSourceWheel
+	}
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].DeviceIndex < sensors[j].DeviceIndex })
+
+	switch {
+	case crank && wheel:
+		return CadenceSourceCrank, sensors, "Crank and wheel-based (trainer) cadence sensors were both paired; cadence and pedaling metrics are attributed to the crank sensor and the trainer estimate is not counted separately."
+	case crank:
+		return CadenceSourceCrank, sensors, ""
+	default:
+		return CadenceSourceWheel, sensors, "Cadence comes from the trainer's wheel/flywheel estimate rather than a crank sensor; treat cadence-based pedaling metrics as approximate."
+	}
+}
+
+// cadenceSensorSource classifies a device_info entry as a crank or wheel
+// cadence source, or "" when the device does not report cycling cadence.
+func cadenceSensorSource(info *fit.DeviceInfoMsg) string {
+	switch info.SourceType {
+	case fit.SourceTypeAntplus:
+		switch fit.AntplusDeviceType(info.DeviceType) {
+		case fit.AntplusDeviceTypeBikeCadence, fit.AntplusDeviceTypeBikeSpeedCadence, fit.AntplusDeviceTypeBikePower:
+			return CadenceSourceCrank
+		case fit.AntplusDeviceTypeFitnessEquipment:
+			return CadenceSourceWheel
+		}
+	case fit.SourceTypeBluetoothLowEnergy:
+		switch info.DeviceType {
+		case bleDeviceTypeBikeCadence, bleDeviceTypeBikeSpeedCadence, bleDeviceTypeBikePower:
+			return CadenceSourceCrank
+		case bleDeviceTypeBikeTrainer:
+			return CadenceSourceWheel
+		}
+	}
+	return ""
+}
+
+// buildCadenceStreams reports the record cadence and a developer-field
+// cadence separately when both a crank and a wheel sensor are paired and both
+// streams were recorded. Record cadence belongs to the preferred crank sensor,
+// so the developer-field stream is attributed to the wheel (trainer) sensor.
+// It returns nil when only one stream exists.
+func buildCadenceStreams(sensors []CadenceSensor, recordCadence []float64, extra []CadenceSample) []CadenceStream {
+	if len(recordCadence) == 0 || len(extra) == 0 {
+		return nil
+	}
+	var crank, wheel bool
+	for _, s := range sensors {
+		crank = crank || s.Source == CadenceSourceCrank
+		wheel = wheel || s.Source == CadenceSourceWheel
+	}
+	if !crank || !wheel {
+		return nil
+	}
+	extraRPM := make([]float64, len(extra))
+	for i, s := range extra {
+		extraRPM[i] = s.RPM
+	}
+	return []CadenceStream{
+		{Source: CadenceSourceCrank, Field: "record.cadence", Samples: len(recordCadence), AvgRPM: round2(average(recordCadence)), MaxRPM: maxValue(recordCadence)},
+		{Source: CadenceSourceWheel, Field: "developer_field", Samples: len(extraRPM), AvgRPM: round2(average(extraRPM)), MaxRPM: maxValue(extraRPM)},
+	}
+}
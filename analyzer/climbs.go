@@ -0,0 +1,191 @@
+package analyzer
+
+import (
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// Climb detection mirrors raceplan's route thresholds so recorded rides and
+// planned courses agree on what counts as a climb.
+const (
+	minClimbLengthM       = 600.0
+	minClimbGainM         = 30.0
+	minClimbAvgGradePct   = 2.5
+	climbStartGradePct    = 3.0
+	climbContinueGradePct = 1.0
+	climbDipToleranceM    = 200.0
+	climbMinStepM         = 10.0
+)
+
+// Climb categories use the common length × grade score (length in meters
+// multiplied by average grade in percent). A climb is assigned the highest
+// category whose minimum score it reaches:
+//
+//	HC    >= 80000  (e.g. 10 km at 8%)
+//	Cat 1 >= 64000  (e.g. 8 km at 8%)
+//	Cat 2 >= 32000  (e.g. 4 km at 8%)
+//	Cat 3 >= 16000  (e.g. 2 km at 8%)
+//	Cat 4 >= 8000   (e.g. 1 km at 8%)
+//
+// Climbs below the Cat 4 score are reported as "uncategorized".
+var climbCategoryThresholds = []struct {
+	category string
+	minScore float64
+}{
+	{"HC", 80000},
+	{"Cat 1", 64000},
+	{"Cat 2", 32000},
+	{"Cat 3", 16000},
+	{"Cat 4", 8000},
+}
+
+// ClimbSummary is one sustained climb detected from recorded distance and altitude.
+type ClimbSummary struct {
+	Index           int     `json:"index"`
+	StartDistanceM  float64 `json:"start_distance_m"`
+	EndDistanceM    float64 `json:"end_distance_m"`
+	LengthM         float64 `json:"length_m"`
+	GainM           float64 `json:"gain_m"`
+	AvgGradePct     float64 `json:"avg_grade_pct"`
+	MaxGradePct     float64 `json:"max_grade_pct"`
+	Score           float64 `json:"score"`
+	Category        string  `json:"category"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	VAM             float64 `json:"vam_m_per_hour,omitempty"`
+	AvgPowerWatts   float64 `json:"avg_power_watts,omitempty"`
+	WPerKG          float64 `json:"w_per_kg,omitempty"`
+}
+
+type climbPoint struct {
+	ts        time.Time
+	distanceM float64
+	altitudeM float64
+	powerW    float64
+	hasPower  bool
+}
+
+// detectClimbs finds sustained climbs in distance-ordered record points and
+// categorizes them. W/kg is only set when weightKG is known.
+func detectClimbs(points []climbPoint, weightKG float64) []ClimbSummary {
+	if len(points) < 2 {
+		return nil
+	}
+
+	var climbs []ClimbSummary
+	start := -1
+	gain := 0.0
+	maxGrade := 0.0
+	dipDistance := 0.0
+	prev := 0
+	for i := 1; i < len(points); i++ {
+		// Compare against the last point at least climbMinStepM behind so 1 Hz
+		// records with small distance steps still resolve a usable grade.
+		deltaDist := points[i].distanceM - points[prev].distanceM
+		if deltaDist < climbMinStepM && i < len(points)-1 {
+			continue
+		}
+		deltaAlt := points[i].altitudeM - points[prev].altitudeM
+		grade := 0.0
+		if deltaDist > 0 {
+			grade = 100 * deltaAlt / deltaDist
+		}
+		from := prev
+		prev = i
+		if start == -1 {
+			if grade >= climbStartGradePct && deltaAlt > 0 {
+				start = from
+				gain = deltaAlt
+				maxGrade = grade
+				dipDistance = 0
+			}
+			continue
+		}
+
+		if deltaAlt > 0 {
+			gain += deltaAlt
+		}
+		if grade > maxGrade {
+			maxGrade = grade
+		}
+		if grade < climbContinueGradePct {
+			dipDistance += deltaDist
+		} else {
+			dipDistance = 0
+		}
+		if dipDistance <= climbDipToleranceM && i < len(points)-1 {
+			continue
+		}
+
+		if climb, ok := summarizeClimb(points[start:i+1], gain, maxGrade, weightKG); ok {
+			climb.Index = len(climbs) + 1
+			climbs = append(climbs, climb)
+		}
+		start = -1
+		gain = 0
+		maxGrade = 0
+		dipDistance = 0
+	}
+	return climbs
+}
+
+func summarizeClimb(segment []climbPoint, gain, maxGrade, weightKG float64) (ClimbSummary, bool) {
+	first := segment[0]
+	last := segment[len(segment)-1]
+	lengthM := last.distanceM - first.distanceM
+	if lengthM < minClimbLengthM || gain < minClimbGainM {
+		return ClimbSummary{}, false
+	}
+	avgGrade := 100 * gain / lengthM
+	if avgGrade < minClimbAvgGradePct {
+		return ClimbSummary{}, false
+	}
+
+	climb := ClimbSummary{
+		StartDistanceM: first.distanceM,
+		EndDistanceM:   last.distanceM,
+		LengthM:        lengthM,
+		GainM:          gain,
+		AvgGradePct:    avgGrade,
+		MaxGradePct:    maxGrade,
+		Score:          lengthM * avgGrade,
+	}
+	climb.Category = climbCategory(climb.Score)
+
+	climb.DurationSeconds = last.ts.Sub(first.ts).Seconds()
+	if climb.DurationSeconds > 0 {
+		climb.VAM = gain / climb.DurationSeconds * secondsPerHour
+	}
+
+	powers := make([]float64, 0, len(segment))
+	for _, p := range segment {
+		if p.hasPower {
+			powers = append(powers, p.powerW)
+		}
+	}
+	climb.AvgPowerWatts = average(powers)
+	if weightKG > 0 && climb.AvgPowerWatts > 0 {
+		climb.WPerKG = climb.AvgPowerWatts / weightKG
+	}
+	return climb, true
+}
+
+func climbCategory(score float64) string {
+	for _, t := range climbCategoryThresholds {
+		if score >= t.minScore {
+			return t.category
+		}
+	}
+	return "uncategorized"
+}
+
+// isIndoorSubSport reports whether altitude in the file is simulated or absent,
+// in which case climbs are not meaningful.
+func isIndoorSubSport(sub fit.SubSport) bool {
+	switch sub {
+	case fit.SubSportIndoorCycling, fit.SubSportVirtualActivity, fit.SubSportTreadmill,
+		fit.SubSportIndoorRowing, fit.SubSportIndoorRunning, fit.SubSportIndoorWalking:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package analyzer
+
+import (
+	"math"
+
+	"github.com/tormoder/fit"
+)
+
+// cycleUnit labels session/lap total_cycles for the given sport. On foot a
+// cycle is a stride (two steps), for walking as for running.
+func cycleUnit(sport fit.Sport) string {
+	switch sport {
+	case fit.SportRowing, fit.SportSwimming, fit.SportPaddling, fit.SportStandUpPaddleboarding, fit.SportKayaking:
+		return "strokes"
+	case fit.SportRunning, fit.SportWalking, fit.SportHiking:
+		return "strides"
+	case fit.SportCycling, fit.SportEBiking:
+		return "revolutions"
+	default:
+		return "cycles"
+	}
+}
+
+// applyTotalCycles sets TotalCycles from the session, falling back to the sum
+// of lap counts, and derives AvgStrokeRate per minute of moving time.
+func applyTotalCycles(analysis *Analysis, session *fit.SessionMsg, laps []*fit.LapMsg, sport fit.Sport) {
+	total := int(validUint32(session.TotalCycles))
+	if total == 0 {
+		for _, lap := range laps {
+			if lap != nil {
+				total += int(validUint32(lap.TotalCycles))
+			}
+		}
+	}
+	if total == 0 {
+		return
+	}
+	analysis.TotalCycles = total
+	analysis.CycleUnit = cycleUnit(sport)
+	if analysis.MovingSeconds > 0 {
+		analysis.AvgStrokeRate = math.Round(float64(total)/(analysis.MovingSeconds/60)*10) / 10
+	}
+}
@@ -0,0 +1,43 @@
+package analyzer
+
+import "github.com/tormoder/fit"
+
+// Environment classifications for Analysis.Environment.
+const (
+	EnvironmentIndoor  = "indoor"
+	EnvironmentOutdoor = "outdoor"
+)
+
+// detectEnvironment classifies the ride as indoor or outdoor and names the
+// evidence: "sub_sport" for indoor/virtual sub sports, "trainer_no_gps" when a
+// smart trainer is paired and the file has distance but no GPS (trainer files
+// often leave sub_sport generic), otherwise "default" outdoor.
+//
+// Indoors, AnalyzeFile skips the derivations that assume a real road: GPS
+// glitch detection, the recorded-vs-GPS distance check, PreferGPSDistance,
+// climb detection, grade-adjusted pace and stuck-speed detection (ERG-mode
+// trainers report a flat simulated speed). Trainer distance and speed are
+// used as recorded.
+func detectEnvironment(sub fit.SubSport, hasGPS, hasDistance bool, infos []*fit.DeviceInfoMsg) (string, string) {
+	if isIndoorSubSport(sub) {
+		return EnvironmentIndoor, "sub_sport"
+	}
+	if !hasGPS && hasDistance {
+		for _, info := range infos {
+			if info != nil && isTrainerDevice(info) {
+				return EnvironmentIndoor, "trainer_no_gps"
+			}
+		}
+	}
+	return EnvironmentOutdoor, "default"
+}
+
+func isTrainerDevice(info *fit.DeviceInfoMsg) bool {
+	switch info.SourceType {
+	case fit.SourceTypeAntplus:
+		return fit.AntplusDeviceType(info.DeviceType) == fit.AntplusDeviceTypeFitnessEquipment
+	case fit.SourceTypeBluetoothLowEnergy:
+		return info.DeviceType == bleDeviceTypeBikeTrainer
+	}
+	return false
+}
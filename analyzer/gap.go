@@ -0,0 +1,171 @@
+package analyzer
+
+import "math"
+
+const (
+	// gapMaxGrade clamps grades to the range covered by Minetti's cost curve.
+	gapMaxGrade = 0.45
+	// gapMaxStepSeconds drops segments spanning pauses or recording gaps.
+	gapMaxStepSeconds = 30.0
+	// gapThresholdWindowSeconds is the best-effort window used to estimate
+	// threshold GAP when none is configured.
+	gapThresholdWindowSeconds = 30 * 60
+)
+
+// PaceZoneDuration stores time spent in a zone defined as a percentage of
+// threshold speed. Higher percentages are faster.
+type PaceZoneDuration struct {
+	Zone            string  `json:"zone"`
+	MinPctThreshold float64 `json:"min_pct_threshold"`
+	MaxPctThreshold float64 `json:"max_pct_threshold"`
+	Seconds         float64 `json:"seconds"`
+	Percentage      float64 `json:"percentage"`
+}
+
+type gapSample struct {
+	speedMPS float64
+	seconds  float64
+}
+
+// minettiCostFactor returns the metabolic cost of running at grade (a fraction,
+// e.g. 0.05 for 5%) relative to flat ground (Minetti et al., 2002).
+func minettiCostFactor(grade float64) float64 {
+	i := math.Max(-gapMaxGrade, math.Min(gapMaxGrade, grade))
+	cost := 155.4*math.Pow(i, 5) - 30.4*math.Pow(i, 4) - 43.3*math.Pow(i, 3) + 46.3*i*i + 19.5*i + 3.6
+	return cost / 3.6
+}
+
+// gradeAdjustedSeries converts distance/altitude points into grade-adjusted
+// speed segments. Segments span at least climbMinStepM so 1 Hz altitude noise
+// does not dominate the grade.
+func gradeAdjustedSeries(points []climbPoint) []gapSample {
+	if len(points) < 2 {
+		return nil
+	}
+	out := make([]gapSample, 0, len(points))
+	prev := 0
+	for i := 1; i < len(points); i++ {
+		deltaDist := points[i].distanceM - points[prev].distanceM
+		if deltaDist < climbMinStepM {
+			continue
+		}
+		dt := points[i].ts.Sub(points[prev].ts).Seconds()
+		deltaAlt := points[i].altitudeM - points[prev].altitudeM
+		prev = i
+		if dt <= 0 || dt > gapMaxStepSeconds {
+			continue
+		}
+		speed := deltaDist / dt
+		out = append(out, gapSample{
+			speedMPS: speed * minettiCostFactor(deltaAlt/deltaDist),
+			seconds:  dt,
+		})
+	}
+	return out
+}
+
+// applyGradeAdjustedPace fills GAP metrics and zones for outdoor runs with
+// altitude data. thresholdMPS of zero falls back to the best 30-minute GAP.
+func applyGradeAdjustedPace(a *Analysis, points []climbPoint, thresholdMPS float64) {
+	series := gradeAdjustedSeries(points)
+	if len(series) == 0 {
+		return
+	}
+	a.GradeAdjustedSpeedMps = averageGAP(series)
+	switch {
+	case thresholdMPS > 0:
+		a.ThresholdGAPMps = thresholdMPS
+		a.ThresholdGAPSource = "input"
+	default:
+		if best := bestGAP(series, gapThresholdWindowSeconds); best > 0 {
+			a.ThresholdGAPMps = best
+			a.ThresholdGAPSource = "estimated"
+		}
+	}
+	a.GAPZones = buildPaceZones(series, a.ThresholdGAPMps)
+}
+
+// averageGAP is the time-weighted mean grade-adjusted speed.
+func averageGAP(samples []gapSample) float64 {
+	dist := 0.0
+	secs := 0.0
+	for _, s := range samples {
+		dist += s.speedMPS * s.seconds
+		secs += s.seconds
+	}
+	if secs == 0 {
+		return 0
+	}
+	return dist / secs
+}
+
+// bestGAP returns the best time-weighted mean GAP over any window of at least
+// windowSeconds, or 0 when the series is shorter than the window.
+func bestGAP(samples []gapSample, windowSeconds float64) float64 {
+	best := 0.0
+	start := 0
+	dist := 0.0
+	secs := 0.0
+	for _, s := range samples {
+		dist += s.speedMPS * s.seconds
+		secs += s.seconds
+		for secs-samples[start].seconds >= windowSeconds {
+			dist -= samples[start].speedMPS * samples[start].seconds
+			secs -= samples[start].seconds
+			start++
+		}
+		if secs >= windowSeconds && dist/secs > best {
+			best = dist / secs
+		}
+	}
+	return best
+}
+
+// buildPaceZones buckets time by speed as a percentage of threshold speed.
+func buildPaceZones(samples []gapSample, thresholdMPS float64) []PaceZoneDuration {
+	if thresholdMPS <= 0 || len(samples) == 0 {
+		return nil
+	}
+
+	type boundary struct {
+		zone string
+		min  float64
+		max  float64
+	}
+	zones := []boundary{
+		{zone: "Z1 Recovery", min: 0, max: 78},
+		{zone: "Z2 Endurance", min: 78, max: 88},
+		{zone: "Z3 Tempo", min: 88, max: 95},
+		{zone: "Z4 Threshold", min: 95, max: 102},
+		{zone: "Z5 VO2", min: 102, max: 110},
+		{zone: "Z6 Anaerobic", min: 110, max: 1000},
+	}
+
+	seconds := make([]float64, len(zones))
+	total := 0.0
+	for _, s := range samples {
+		percent := (s.speedMPS / thresholdMPS) * 100.0
+		for i, z := range zones {
+			if percent >= z.min && percent < z.max {
+				seconds[i] += s.seconds
+				total += s.seconds
+				break
+			}
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	out := make([]PaceZoneDuration, 0, len(zones))
+	for i, z := range zones {
+		out = append(out, PaceZoneDuration{
+			Zone:            z.zone,
+			MinPctThreshold: z.min,
+			MaxPctThreshold: z.max,
+			Seconds:         seconds[i],
+			Percentage:      (seconds[i] / total) * 100.0,
+		})
+	}
+	return out
+}
@@ -0,0 +1,147 @@
+package analyzer
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+const (
+	earthRadiusM = 6371000.0
+
+	// Implied speeds between consecutive GPS fixes above these limits are
+	// treated as teleports rather than real movement.
+	defaultGPSMaxSpeedMPS = 40.0
+	footGPSMaxSpeedMPS    = 12.0
+)
+
+// gpsMaxSpeedMPS returns the plausible top speed for a sport.
+func gpsMaxSpeedMPS(sport fit.Sport) float64 {
+	switch sport {
+	case fit.SportRunning, fit.SportWalking, fit.SportHiking, fit.SportSwimming:
+		return footGPSMaxSpeedMPS
+	default:
+		return defaultGPSMaxSpeedMPS
+	}
+}
+
+type gpsFix struct {
+	ts       time.Time
+	lat, lon float64
+}
+
+// gpsFixes returns the time-ordered valid position fixes from records.
+func gpsFixes(records []*fit.RecordMsg) []gpsFix {
+	fixes := make([]gpsFix, 0, len(records))
+	for _, rec := range records {
+		if rec == nil || rec.PositionLat.Invalid() || rec.PositionLong.Invalid() {
+			continue
+		}
+		ts := validTimeOrZero(rec.Timestamp)
+		if ts.IsZero() {
+			continue
+		}
+		fixes = append(fixes, gpsFix{ts: ts, lat: rec.PositionLat.Degrees(), lon: rec.PositionLong.Degrees()})
+	}
+	sort.SliceStable(fixes, func(i, j int) bool {
+		return fixes[i].ts.Before(fixes[j].ts)
+	})
+	return fixes
+}
+
+// detectGPSGlitches returns the timestamps of fixes whose implied speed from
+// the previous accepted fix exceeds maxSpeedMPS. Flagged fixes are not used as
+// the reference for the next comparison, so a single bad point does not also
+// flag the good point that follows it.
+func detectGPSGlitches(fixes []gpsFix, maxSpeedMPS float64) []time.Time {
+	var glitches []time.Time
+	prev := 0
+	for i := 1; i < len(fixes); i++ {
+		dt := fixes[i].ts.Sub(fixes[prev].ts).Seconds()
+		if dt <= 0 {
+			continue
+		}
+		dist := haversineMeters(fixes[prev].lat, fixes[prev].lon, fixes[i].lat, fixes[i].lon)
+		if dist/dt > maxSpeedMPS {
+			glitches = append(glitches, fixes[i].ts)
+			continue
+		}
+		prev = i
+	}
+	return glitches
+}
+
+// gpsTrackDistance sums haversine segments between fixes, skipping glitches.
+func gpsTrackDistance(fixes []gpsFix, glitches []time.Time) float64 {
+	bad := glitchSet(glitches)
+	total := 0.0
+	prev := -1
+	for i, f := range fixes {
+		if _, ok := bad[f.ts.UnixNano()]; ok {
+			continue
+		}
+		if prev >= 0 {
+			total += haversineMeters(fixes[prev].lat, fixes[prev].lon, f.lat, f.lon)
+		}
+		prev = i
+	}
+	return total
+}
+
+func glitchSet(glitches []time.Time) map[int64]struct{} {
+	bad := make(map[int64]struct{}, len(glitches))
+	for _, ts := range glitches {
+		bad[ts.UnixNano()] = struct{}{}
+	}
+	return bad
+}
+
+// withoutGlitchPoints drops climb points recorded at flagged GPS fixes.
+func withoutGlitchPoints(points []climbPoint, glitches []time.Time) []climbPoint {
+	if len(glitches) == 0 {
+		return points
+	}
+	bad := glitchSet(glitches)
+	out := make([]climbPoint, 0, len(points))
+	for _, p := range points {
+		if _, ok := bad[p.ts.UnixNano()]; ok {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// WithoutGPSGlitches returns records minus those at the fixes flagged in
+// Analysis.GPSGlitchTimes, so exported tracks skip the teleports. It returns
+// records unchanged when nothing was flagged.
+func WithoutGPSGlitches(records []*fit.RecordMsg, glitches []time.Time) []*fit.RecordMsg {
+	if len(glitches) == 0 {
+		return records
+	}
+	bad := glitchSet(glitches)
+	out := make([]*fit.RecordMsg, 0, len(records))
+	for _, rec := range records {
+		if rec != nil && !rec.PositionLat.Invalid() && !rec.PositionLong.Invalid() {
+			if _, ok := bad[rec.Timestamp.UnixNano()]; ok {
+				continue
+			}
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1 *= math.Pi / 180
+	lon1 *= math.Pi / 180
+	lat2 *= math.Pi / 180
+	lon2 *= math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := lon2 - lon1
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return earthRadiusM * c
+}
@@ -0,0 +1,80 @@
+package analyzer
+
+// SportProfile is the on-device configuration for the activity's sport: the
+// sport message (global 12) names the profile and zones_target (global 7)
+// carries its FTP and heart-rate limits.
+type SportProfile struct {
+	Sport                 string  `json:"sport,omitempty"`
+	SubSport              string  `json:"sub_sport,omitempty"`
+	Name                  string  `json:"name,omitempty"`
+	FTPWatts              float64 `json:"ftp_watts,omitempty"`
+	MaxHeartRateBPM       float64 `json:"max_heart_rate_bpm,omitempty"`
+	ThresholdHeartRateBPM float64 `json:"threshold_heart_rate_bpm,omitempty"`
+}
+
+// HRZoneDuration stores time spent in a heart-rate zone defined as a
+// percentage of max HR.
+type HRZoneDuration struct {
+	Zone        string  `json:"zone"`
+	MinPctMaxHR float64 `json:"min_pct_max_hr"`
+	MaxPctMaxHR float64 `json:"max_pct_max_hr"`
+	MinBPM      float64 `json:"min_bpm"`
+	MaxBPM      float64 `json:"max_bpm,omitempty"`
+	Seconds     float64 `json:"seconds"`
+	Percentage  float64 `json:"percentage"`
+}
+
+// hrZoneMaxHoldSeconds is the longest gap to the next HR sample credited to
+// a reading; longer gaps (pauses, dropouts) credit one second.
+const hrZoneMaxHoldSeconds = 10.0
+
+// buildHeartRateZones distributes time over the common five-zone %max-HR
+// model. Each reading holds until the next one (up to hrZoneMaxHoldSeconds,
+// else one second), so smart-recorded files count seconds, not records.
+// Readings below 50% of max HR are not counted; the top zone is open-ended.
+func buildHeartRateZones(hrSamples []timedSample, maxHR float64) []HRZoneDuration {
+	if len(hrSamples) == 0 || maxHR <= 0 {
+		return nil
+	}
+	bounds := []float64{50, 60, 70, 80, 90}
+	names := []string{"Z1 Very Light", "Z2 Light", "Z3 Moderate", "Z4 Hard", "Z5 Maximum"}
+
+	seconds := make([]float64, len(bounds))
+	total := 0.0
+	for i, s := range hrSamples {
+		dt := 1.0
+		if i+1 < len(hrSamples) {
+			if gap := hrSamples[i+1].ts.Sub(s.ts).Seconds(); gap > 0 && gap <= hrZoneMaxHoldSeconds {
+				dt = gap
+			}
+		}
+		pct := s.value / maxHR * 100.0
+		for z := len(bounds) - 1; z >= 0; z-- {
+			if pct >= bounds[z] {
+				seconds[z] += dt
+				total += dt
+				break
+			}
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	out := make([]HRZoneDuration, 0, len(bounds))
+	for i, low := range bounds {
+		z := HRZoneDuration{
+			Zone:        names[i],
+			MinPctMaxHR: low,
+			MinBPM:      round2(maxHR * low / 100.0),
+			Seconds:     seconds[i],
+			Percentage:  seconds[i] / total * 100.0,
+		}
+		if i+1 < len(bounds) {
+			z.MaxPctMaxHR = bounds[i+1]
+			z.MaxBPM = round2(maxHR * bounds[i+1] / 100.0)
+		}
+		out = append(out, z)
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// canonicalLapLabels is the vocabulary summarizeLaps assigns; interval and
+// structure detection always compare against these names.
+var canonicalLapLabels = []string{"warmup", "activation", "work", "recovery", "easy", "steady", "cooldown"}
+
+// validateLapLabels checks that every Config.LapLabels key is a canonical lap
+// label and every replacement is non-empty.
+func validateLapLabels(names map[string]string) error {
+	for from, to := range names {
+		known := false
+		for _, label := range canonicalLapLabels {
+			if from == label {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown lap label %q (expected %s)", from, strings.Join(canonicalLapLabels, "|"))
+		}
+		if strings.TrimSpace(to) == "" {
+			return fmt.Errorf("lap label %q has an empty replacement", from)
+		}
+	}
+	return nil
+}
+
+// applyLapLabels renames lap labels for output once detection is done. A
+// renamed lap keeps its canonical label in CanonicalLabel.
+func applyLapLabels(laps []LapSummary, names map[string]string) {
+	for i := range laps {
+		name, ok := names[laps[i].Label]
+		if !ok || name == laps[i].Label {
+			continue
+		}
+		laps[i].CanonicalLabel = laps[i].Label
+		laps[i].Label = strings.TrimSpace(name)
+	}
+}
+
+// LabelKind returns the canonical label (work, recovery, ...) of a lap whose
+// Label may have been renamed through Config.LapLabels.
+func (l LapSummary) LabelKind() string {
+	if l.CanonicalLabel != "" {
+		return l.CanonicalLabel
+	}
+	return l.Label
+}
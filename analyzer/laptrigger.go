@@ -0,0 +1,42 @@
+package analyzer
+
+import "github.com/tormoder/fit"
+
+// autoLapConfidencePenalty is subtracted from lap-based workout structure
+// confidence when laps come from the device's auto-lap rather than the rider
+// or a workout, since lap boundaries then say nothing about interval
+// boundaries. Structure inferred from power segments is not penalized.
+const autoLapConfidencePenalty = 0.3
+
+var lapTriggerLabels = map[fit.LapTrigger]string{
+	fit.LapTriggerManual:           "manual",
+	fit.LapTriggerTime:             "time",
+	fit.LapTriggerDistance:         "distance",
+	fit.LapTriggerPositionStart:    "position_start",
+	fit.LapTriggerPositionLap:      "position_lap",
+	fit.LapTriggerPositionWaypoint: "position_waypoint",
+	fit.LapTriggerPositionMarked:   "position_marked",
+	fit.LapTriggerSessionEnd:       "session_end",
+	fit.LapTriggerFitnessEquipment: "fitness_equipment",
+}
+
+// LapTriggerLabel returns the snake_case lap_trigger name, or "" when absent.
+func LapTriggerLabel(t fit.LapTrigger) string {
+	return lapTriggerLabels[t]
+}
+
+// autoLapped reports whether every lap that closed mid-ride was triggered by
+// time, distance or position. The final session_end lap is ignored.
+func autoLapped(laps []LapSummary) bool {
+	auto := 0
+	for _, lap := range laps {
+		switch lap.Trigger {
+		case "time", "distance", "position_start", "position_lap", "position_waypoint", "position_marked":
+			auto++
+		case "session_end":
+		default:
+			return false
+		}
+	}
+	return auto > 0
+}
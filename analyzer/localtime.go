@@ -0,0 +1,50 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+// localUTCOffset derives the recording device's UTC offset from the activity
+// message's local_timestamp, which the decoder returns as the same instant as
+// timestamp in a fixed zone carrying the difference. Offsets are rounded to
+// the quarter hour; ok is false when either time is missing or the offset is
+// outside ±14 h. The device records one offset per file, so a ride
+// crossing a DST change reports the offset in force when it ended.
+func localUTCOffset(msg *fit.ActivityMsg) (seconds int, ok bool) {
+	if msg == nil {
+		return 0, false
+	}
+	ts, local := validTimeOrZero(msg.Timestamp), validTimeOrZero(msg.LocalTimestamp)
+	if ts.IsZero() || local.IsZero() {
+		return 0, false
+	}
+	_, zoneOffset := local.Zone()
+	offset := (time.Duration(zoneOffset) * time.Second).Round(15 * time.Minute)
+	if offset < -14*time.Hour || offset > 14*time.Hour {
+		return 0, false
+	}
+	return int(offset.Seconds()), true
+}
+
+// LocalZone returns a fixed zone named like "UTC-07:00" for offsetSeconds, or
+// time.UTC when offsetSeconds is nil.
+func LocalZone(offsetSeconds *int) *time.Location {
+	if offsetSeconds == nil {
+		return time.UTC
+	}
+	off := *offsetSeconds
+	sign := '+'
+	if off < 0 {
+		sign, off = '-', -off
+	}
+	return time.FixedZone(fmt.Sprintf("UTC%c%02d:%02d", sign, off/3600, off%3600/60), *offsetSeconds)
+}
+
+// LocalStartTime returns StartTime in the file's local time (UTCOffsetSeconds),
+// or in UTC when the file does not record its offset.
+func (a *Analysis) LocalStartTime() time.Time {
+	return a.StartTime.In(LocalZone(a.UTCOffsetSeconds))
+}
@@ -0,0 +1,189 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/internal/sentinel"
+	"github.com/tormoder/fit"
+)
+
+// MonitoringConfig carries monitoring data the FIT library does not decode:
+// heart rate (monitoring field 27) and the device's resting HR (global 211).
+type MonitoringConfig struct {
+	HeartRateSamples []HeartRateSample
+	RestingHeartRate float64
+}
+
+// MonitoringSummary is a daily wellness summary built from a monitoring FIT file.
+type MonitoringSummary struct {
+	FilePath          string               `json:"file_path"`
+	FileType          string               `json:"file_type"`
+	StartTime         time.Time            `json:"start_time"`
+	EndTime           time.Time            `json:"end_time"`
+	TotalSteps        int                  `json:"total_steps"`
+	TotalCalories     float64              `json:"total_calories_kcal"`
+	ActiveCalories    float64              `json:"active_calories_kcal"`
+	ActiveTimeSeconds float64              `json:"active_time_s"`
+	DistanceMeters    float64              `json:"distance_m"`
+	RestingHeartRate  float64              `json:"resting_heart_rate_bpm,omitempty"`
+	RestingHRSource   string               `json:"resting_heart_rate_source,omitempty"`
+	ActivityTypes     []MonitoringActivity `json:"activity_types,omitempty"`
+	HeartRate         []HeartRateSample    `json:"heart_rate,omitempty"`
+}
+
+// MonitoringActivity holds the day's accumulated totals for one activity type.
+type MonitoringActivity struct {
+	ActivityType      string  `json:"activity_type"`
+	Steps             int     `json:"steps,omitempty"`
+	Cycles            float64 `json:"cycles,omitempty"`
+	Calories          float64 `json:"calories_kcal"`
+	ActiveTimeSeconds float64 `json:"active_time_s"`
+	DistanceMeters    float64 `json:"distance_m"`
+}
+
+// IsMonitoringFileType reports whether t is a monitoring (wellness) file type,
+// which Analyze rejects and AnalyzeMonitoring handles.
+func IsMonitoringFileType(t fit.FileType) bool {
+	switch t {
+	case fit.FileTypeMonitoringA, fit.FileTypeMonitoringB, fit.FileTypeMonitoringDaily:
+		return true
+	}
+	return false
+}
+
+// AnalyzeMonitoringFile decodes and summarizes a monitoring FIT file.
+func AnalyzeMonitoringFile(path string, cfg MonitoringConfig) (*MonitoringSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open FIT file: %w", err)
+	}
+	defer f.Close()
+
+	return AnalyzeMonitoring(f, path, cfg)
+}
+
+// AnalyzeMonitoringBytes summarizes a monitoring FIT payload directly from memory.
+func AnalyzeMonitoringBytes(data []byte, sourceName string, cfg MonitoringConfig) (*MonitoringSummary, error) {
+	return AnalyzeMonitoring(bytes.NewReader(data), sourceName, cfg)
+}
+
+// AnalyzeMonitoring decodes and summarizes a monitoring FIT payload from any reader.
+func AnalyzeMonitoring(r io.Reader, sourceName string, cfg MonitoringConfig) (*MonitoringSummary, error) {
+	decoded, err := fit.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("decode FIT payload: %w", err)
+	}
+	var monitorings []*fit.MonitoringMsg
+	switch decoded.Type() {
+	case fit.FileTypeMonitoringA:
+		file, err := decoded.MonitoringA()
+		if err != nil {
+			return nil, fmt.Errorf("monitoring FIT expected: %w", err)
+		}
+		monitorings = file.Monitorings
+	case fit.FileTypeMonitoringB:
+		file, err := decoded.MonitoringB()
+		if err != nil {
+			return nil, fmt.Errorf("monitoring FIT expected: %w", err)
+		}
+		monitorings = file.Monitorings
+	case fit.FileTypeMonitoringDaily:
+		file, err := decoded.MonitoringDaily()
+		if err != nil {
+			return nil, fmt.Errorf("monitoring FIT expected: %w", err)
+		}
+		monitorings = file.Monitorings
+	default:
+		return nil, fmt.Errorf("monitoring FIT expected: file type is %v", decoded.Type())
+	}
+	return summarizeMonitoring(monitorings, decoded.Type(), sourceName, cfg), nil
+}
+
+// summarizeMonitoring folds monitoring messages into daily totals. Calories,
+// cycles, distance and active time accumulate per activity type within the
+// file, so each type contributes its largest value. Steps are the raw cycles
+// of walking and running; active calories exclude the sedentary type, which
+// carries the resting burn.
+func summarizeMonitoring(monitorings []*fit.MonitoringMsg, fileType fit.FileType, sourceName string, cfg MonitoringConfig) *MonitoringSummary {
+	summary := &MonitoringSummary{
+		FilePath: sourceName,
+		FileType: fmt.Sprint(fileType),
+	}
+	byType := make(map[fit.ActivityType]*MonitoringActivity)
+	var order []fit.ActivityType
+	currentType := fit.ActivityTypeGeneric
+	for _, m := range monitorings {
+		if m == nil {
+			continue
+		}
+		if ts := validTimeOrZero(m.Timestamp); !ts.IsZero() {
+			if summary.StartTime.IsZero() || ts.Before(summary.StartTime) {
+				summary.StartTime = ts
+			}
+			if ts.After(summary.EndTime) {
+				summary.EndTime = ts
+			}
+		}
+		if m.ActivityType != fit.ActivityTypeInvalid {
+			currentType = m.ActivityType
+		}
+		acc, ok := byType[currentType]
+		if !ok {
+			acc = &MonitoringActivity{ActivityType: fmt.Sprint(currentType)}
+			byType[currentType] = acc
+			order = append(order, currentType)
+		}
+		if !sentinel.IsInvalidUint16(m.Calories) {
+			acc.Calories = math.Max(acc.Calories, float64(m.Calories))
+		}
+		if cycles := m.GetCyclesScaled(); isFinite(cycles) {
+			acc.Cycles = math.Max(acc.Cycles, cycles)
+			if currentType == fit.ActivityTypeWalking || currentType == fit.ActivityTypeRunning {
+				acc.Steps = max(acc.Steps, int(m.Cycles))
+			}
+		}
+		if dist := m.GetDistanceScaled(); isFinite(dist) {
+			acc.DistanceMeters = math.Max(acc.DistanceMeters, dist)
+		}
+		if active := m.GetActiveTimeScaled(); isFinite(active) {
+			acc.ActiveTimeSeconds = math.Max(acc.ActiveTimeSeconds, active)
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i] < order[j] })
+	for _, t := range order {
+		acc := byType[t]
+		if acc.Steps > 0 {
+			acc.Cycles = 0
+		}
+		acc.DistanceMeters = round2(acc.DistanceMeters)
+		summary.TotalSteps += acc.Steps
+		summary.TotalCalories += acc.Calories
+		if t != fit.ActivityTypeSedentary {
+			summary.ActiveCalories += acc.Calories
+		}
+		summary.ActiveTimeSeconds += acc.ActiveTimeSeconds
+		summary.DistanceMeters += acc.DistanceMeters
+		summary.ActivityTypes = append(summary.ActivityTypes, *acc)
+	}
+
+	summary.HeartRate = sortedHeartRateSamples(cfg.HeartRateSamples)
+	if cfg.RestingHeartRate > 0 {
+		summary.RestingHeartRate = cfg.RestingHeartRate
+		summary.RestingHRSource = "device"
+	} else if len(summary.HeartRate) > 0 {
+		lowest := summary.HeartRate[0].BPM
+		for _, s := range summary.HeartRate {
+			lowest = math.Min(lowest, s.BPM)
+		}
+		summary.RestingHeartRate = lowest
+		summary.RestingHRSource = "lowest_sample"
+	}
+	return summary
+}
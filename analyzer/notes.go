@@ -21,16 +21,25 @@ func BuildTrainingNotes(a *Analysis) string {
 		a.SubSport,
 	)
 	if !a.StartTime.IsZero() {
-		fmt.Fprintf(&b, "Start: %s\n", a.StartTime.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(&b, "Start: %s\n", a.LocalStartTime().Format("2006-01-02 15:04:05 MST"))
+	}
+	if a.IsVirtual {
+		fmt.Fprintf(
+			&b,
+			"Duration %s | Virtual distance %.1f km (simulated, device-reported)\n",
+			formatDuration(a.ElapsedSeconds),
+			a.DistanceMeters/1000.0,
+		)
+	} else {
+		fmt.Fprintf(
+			&b,
+			"Duration %s | Distance %.1f km | Elevation +%.0f/-%0.f m\n",
+			formatDuration(a.ElapsedSeconds),
+			a.DistanceMeters/1000.0,
+			a.ElevationGainM,
+			a.ElevationLossM,
+		)
 	}
-	fmt.Fprintf(
-		&b,
-		"Duration %s | Distance %.1f km | Elevation +%.0f/-%0.f m\n",
-		formatDuration(a.ElapsedSeconds),
-		a.DistanceMeters/1000.0,
-		a.ElevationGainM,
-		a.ElevationLossM,
-	)
 
 	fmt.Fprintf(
 		&b,
@@ -41,6 +50,16 @@ func BuildTrainingNotes(a *Analysis) string {
 		a.WorkKilojoules,
 		a.VariabilityIndex,
 	)
+	if a.WeightKG > 0 {
+		fmt.Fprintf(
+			&b,
+			"W/kg %.2f avg / %.2f NP / %.2f max | Weight %.1f kg\n",
+			a.AvgPowerWPerKG,
+			a.NPWPerKG,
+			a.MaxPowerWPerKG,
+			a.WeightKG,
+		)
+	}
 	fmt.Fprintf(
 		&b,
 		"HR %.0f avg / %.0f max bpm | Cadence %.0f avg / %.0f max rpm | Speed %.1f avg / %.1f max km/h\n",
@@ -51,6 +70,17 @@ func BuildTrainingNotes(a *Analysis) string {
 		mpsToKmh(a.AvgSpeedMps),
 		mpsToKmh(a.MaxSpeedMps),
 	)
+	if a.AverageMethod == "median" {
+		b.WriteString("Averages (power, HR, cadence) are medians; NP, VI and work use means by definition.\n")
+		if len(a.AverageMeanFallback) > 0 {
+			fmt.Fprintf(&b, "Median was 0 for %s, so the mean is reported there.\n", strings.ReplaceAll(strings.Join(a.AverageMeanFallback, ", "), "_", " "))
+		}
+	}
+	if a.Weather != nil {
+		if w := describeWeather(a.Weather); w != "" {
+			fmt.Fprintf(&b, "Weather: %s\n", w)
+		}
+	}
 
 	if a.FTPWatts > 0 {
 		fmt.Fprintf(
@@ -64,13 +94,19 @@ func BuildTrainingNotes(a *Analysis) string {
 	} else {
 		fmt.Fprintf(&b, "Load IF/TSS unavailable (FTP not provided and could not be estimated)\n")
 	}
+	if a.RecommendedRecoveryHours > 0 {
+		fmt.Fprintf(&b, "Recovery: ~%.0f h before the next hard session (%s load)\n", a.RecommendedRecoveryHours, strings.ReplaceAll(a.RecoveryLoad, "_", " "))
+	}
+	if a.PowerSource == PowerSourceEstimated {
+		b.WriteString("Power source: estimated (no power meter detected); treat IF/TSS as approximate.\n")
+	}
 	if a.Best20MinPower > 0 {
 		fmt.Fprintf(&b, "Best 20 min power: %.0f W\n", a.Best20MinPower)
 	}
-	if a.PowerHRDecoupling != 0 && a.VariabilityIndex <= 1.10 {
+	if a.DecouplingReliable {
 		fmt.Fprintf(&b, "Power:HR decoupling: %+.1f%%\n", a.PowerHRDecoupling)
-	} else if a.VariabilityIndex > 1.10 {
-		fmt.Fprintf(&b, "Power:HR decoupling: not reliable for high-variability sessions (VI %.2f)\n", a.VariabilityIndex)
+	} else if a.DecouplingNote != "" {
+		fmt.Fprintf(&b, "Power:HR decoupling: not reliable (%s)\n", a.DecouplingNote)
 	}
 	if a.FTPSource == "estimated" && a.Intervals.WorkCount > 0 {
 		b.WriteString("FTP note: estimated from best 20-minute power; use --ftp for more accurate IF/TSS and zone time on interval workouts.\n")
@@ -84,10 +120,11 @@ func BuildTrainingNotes(a *Analysis) string {
 			}
 			fmt.Fprintf(
 				&b,
-				"- %s: %s (%.1f%%)\n",
+				"- %s: %s (%.1f%%)%s\n",
 				z.Zone,
 				formatDuration(z.Seconds),
 				z.Percentage,
+				formatZoneWPerKG(z),
 			)
 		}
 	}
@@ -132,19 +169,29 @@ func BuildTrainingNotes(a *Analysis) string {
 			a.WorkoutStructure.CanonicalLabel,
 			a.WorkoutStructure.Confidence*100.0,
 		)
-		if a.WorkoutStructure.MainSet != nil {
+		for _, set := range a.WorkoutStructure.mainSets() {
 			fmt.Fprintf(
 				&b,
 				"- Main set execution: %s, drift %+.1f%% power / %+.1f%% cadence / %+0.f bpm HR.\n",
-				a.WorkoutStructure.MainSet.Prescription,
-				a.WorkoutStructure.MainSet.PowerDriftPct,
-				a.WorkoutStructure.MainSet.CadenceDriftPct,
-				a.WorkoutStructure.MainSet.HeartRateDriftBPM,
+				set.Prescription,
+				set.PowerDriftPct,
+				set.CadenceDriftPct,
+				set.HeartRateDriftBPM,
 			)
 		}
 	}
 
 	b.WriteString("\nCoaching Notes\n")
+	if note := targetComplianceNote(a); note != "" {
+		b.WriteString("- ")
+		b.WriteString(note)
+		b.WriteByte('\n')
+	}
+	if note := windNote(a); note != "" {
+		b.WriteString("- ")
+		b.WriteString(note)
+		b.WriteByte('\n')
+	}
 	b.WriteString("- ")
 	b.WriteString(coachingAssessment(a))
 	b.WriteString("\n- ")
@@ -170,11 +217,15 @@ func BuildTrainingSummaryMarkdown(a *Analysis) string {
 	}
 	b.WriteString("\n")
 	if !a.StartTime.IsZero() {
-		fmt.Fprintf(&b, "- Start: %s\n", a.StartTime.Format("2006-01-02 15:04:05 MST"))
+		fmt.Fprintf(&b, "- Start: %s\n", a.LocalStartTime().Format("2006-01-02 15:04:05 MST"))
 	}
 	fmt.Fprintf(&b, "- Duration: %s\n", formatDuration(a.ElapsedSeconds))
-	fmt.Fprintf(&b, "- Distance: %.1f km\n", a.DistanceMeters/1000.0)
-	fmt.Fprintf(&b, "- Elevation: +%.0f m / -%.0f m\n", a.ElevationGainM, a.ElevationLossM)
+	if a.IsVirtual {
+		fmt.Fprintf(&b, "- Distance: %.1f km (virtual)\n", a.DistanceMeters/1000.0)
+	} else {
+		fmt.Fprintf(&b, "- Distance: %.1f km\n", a.DistanceMeters/1000.0)
+		fmt.Fprintf(&b, "- Elevation: +%.0f m / -%.0f m\n", a.ElevationGainM, a.ElevationLossM)
+	}
 	if a.WeightKG > 0 {
 		fmt.Fprintf(&b, "- Weight: %.1f kg\n", a.WeightKG)
 	}
@@ -183,9 +234,23 @@ func BuildTrainingSummaryMarkdown(a *Analysis) string {
 	fmt.Fprintf(&b, "- Average power: %.0f W\n", a.AvgPowerWatts)
 	fmt.Fprintf(&b, "- Normalized power: %.0f W\n", a.NormalizedPower)
 	fmt.Fprintf(&b, "- Max power: %.0f W\n", a.MaxPowerWatts)
+	if len(a.PowerCurve) > 0 {
+		points := make([]string, 0, len(a.PowerCurve))
+		for _, p := range a.PowerCurve {
+			points = append(points, fmt.Sprintf("%s %.0f W", shortDuration(float64(p.DurationSeconds)), p.WattsBest))
+		}
+		fmt.Fprintf(&b, "- Power curve: %s\n", strings.Join(points, ", "))
+	}
+	if a.CriticalPower > 0 {
+		fmt.Fprintf(&b, "- Critical power (2-12 min model): %.0f W, W' %.1f kJ\n", a.CriticalPower, a.WPrimeJoules/1000.0)
+	}
 	if a.WeightKG > 0 {
 		fmt.Fprintf(&b, "- Average W/kg: %.2f\n", a.AvgPowerWPerKG)
 		fmt.Fprintf(&b, "- NP W/kg: %.2f\n", a.NPWPerKG)
+		fmt.Fprintf(&b, "- Max W/kg: %.2f\n", a.MaxPowerWPerKG)
+		if a.FTPWPerKG > 0 {
+			fmt.Fprintf(&b, "- FTP W/kg: %.2f\n", a.FTPWPerKG)
+		}
 	}
 	fmt.Fprintf(&b, "- Work: %.0f kJ\n", a.WorkKilojoules)
 	fmt.Fprintf(&b, "- Variability index: %.2f\n", a.VariabilityIndex)
@@ -194,11 +259,28 @@ func BuildTrainingSummaryMarkdown(a *Analysis) string {
 		fmt.Fprintf(&b, "- Intensity factor: %.2f\n", a.IntensityFactor)
 		fmt.Fprintf(&b, "- TSS-like load: %.0f\n", a.TrainingStress)
 	}
+	if a.PowerSource != "" {
+		fmt.Fprintf(&b, "- Power source: %s\n", a.PowerSource)
+	}
+	if a.PowerSource == PowerSourceEstimated {
+		b.WriteString("- Caveat: power is estimated rather than measured, so IF and TSS are approximate.\n")
+	}
 
 	b.WriteString("\n## Physiology\n")
 	fmt.Fprintf(&b, "- Heart rate: %.0f avg / %.0f max bpm\n", a.AvgHeartRate, a.MaxHeartRate)
 	fmt.Fprintf(&b, "- Cadence: %.0f avg / %.0f max rpm\n", a.AvgCadence, a.MaxCadence)
-	fmt.Fprintf(&b, "- Speed: %.1f avg / %.1f max km/h\n", mpsToKmh(a.AvgSpeedMps), mpsToKmh(a.MaxSpeedMps))
+	if a.CadenceSource != "" {
+		fmt.Fprintf(&b, "- Cadence source: %s\n", a.CadenceSource)
+	}
+	if a.CadenceNote != "" {
+		fmt.Fprintf(&b, "- Caveat: %s\n", a.CadenceNote)
+	}
+	if a.TotalCycles > 0 && a.CycleUnit != "revolutions" {
+		fmt.Fprintf(&b, "- Total %s: %d (%.1f per min)\n", a.CycleUnit, a.TotalCycles, a.AvgStrokeRate)
+	}
+	if !a.IsVirtual {
+		fmt.Fprintf(&b, "- Speed: %.1f avg / %.1f max km/h\n", mpsToKmh(a.AvgSpeedMps), mpsToKmh(a.MaxSpeedMps))
+	}
 
 	b.WriteString("\n## Intervals\n")
 	if a.Intervals.WorkCount > 0 {
@@ -214,17 +296,30 @@ func BuildTrainingSummaryMarkdown(a *Analysis) string {
 	} else {
 		b.WriteString("- No repeating hard interval structure was confidently detected.\n")
 	}
+	if a.Intervals.AutoLaps {
+		b.WriteString("- Laps are device auto-laps (time/distance/position), so lap-based interval detection is low confidence.\n")
+	}
+	if len(a.ExcludedLaps) > 0 {
+		laps := make([]string, 0, len(a.ExcludedLaps))
+		for _, n := range a.ExcludedLaps {
+			laps = append(laps, fmt.Sprint(n))
+		}
+		fmt.Fprintf(&b, "- Excluded laps (ignored for interval and structure detection): %s\n", strings.Join(laps, ", "))
+	}
 
 	if a.WorkoutStructure.CanonicalLabel != "" {
 		b.WriteString("\n## Workout Structure\n")
 		fmt.Fprintf(&b, "- Label: %s\n", a.WorkoutStructure.CanonicalLabel)
 		fmt.Fprintf(&b, "- Confidence: %.0f%%\n", a.WorkoutStructure.Confidence*100.0)
-		if a.WorkoutStructure.MainSet != nil {
-			fmt.Fprintf(&b, "- Main set: %s\n", a.WorkoutStructure.MainSet.Prescription)
+		for _, set := range a.WorkoutStructure.mainSets() {
+			fmt.Fprintf(&b, "- Main set: %s\n", set.Prescription)
 		}
 	}
 
 	b.WriteString("\n## Coaching Takeaways\n")
+	if note := targetComplianceNote(a); note != "" {
+		fmt.Fprintf(&b, "- %s\n", note)
+	}
 	fmt.Fprintf(&b, "- %s\n", coachingAssessment(a))
 	fmt.Fprintf(&b, "- %s\n", nextSessionSuggestion(a))
 
@@ -251,6 +346,38 @@ func coachingAssessment(a *Analysis) string {
 	return "Aerobic load appears manageable and supports base development."
 }
 
+// targetComplianceNote summarizes main-set time in target for virtual rides,
+// where the trainer holds the prescribed targets and compliance is a cleaner
+// execution signal than speed or terrain.
+func targetComplianceNote(a *Analysis) string {
+	if a == nil || !a.IsVirtual || a.WorkoutStructure.MainSet == nil {
+		return ""
+	}
+	total := 0.0
+	count := 0
+	for _, set := range a.WorkoutStructure.mainSets() {
+		for _, rep := range set.RepsDetail {
+			if rep.TimeInTargetPct == nil {
+				continue
+			}
+			total += *rep.TimeInTargetPct
+			count++
+		}
+	}
+	if count == 0 {
+		return ""
+	}
+	mean := total / float64(count)
+	switch {
+	case mean >= 90:
+		return fmt.Sprintf("Virtual workout: main-set reps held target %.0f%% of the time on average; target compliance was excellent.", mean)
+	case mean >= 75:
+		return fmt.Sprintf("Virtual workout: main-set reps held target %.0f%% of the time on average; minor deviations from prescribed power.", mean)
+	default:
+		return fmt.Sprintf("Virtual workout: main-set reps held target only %.0f%% of the time on average; targets may be set too high or ERG control was inconsistent.", mean)
+	}
+}
+
 func nextSessionSuggestion(a *Analysis) string {
 	if a == nil {
 		return "No recommendation available."
@@ -290,3 +417,14 @@ func mpsToKmh(v float64) float64 {
 	}
 	return v * 3.6
 }
+
+// formatZoneWPerKG renders a zone's W/kg band, or nothing without a weight.
+func formatZoneWPerKG(z ZoneDuration) string {
+	switch {
+	case z.MaxWPerKG > 0:
+		return fmt.Sprintf(" [%.2f-%.2f W/kg]", z.MinWPerKG, z.MaxWPerKG)
+	case z.MinWPerKG > 0:
+		return fmt.Sprintf(" [%.2f+ W/kg]", z.MinWPerKG)
+	}
+	return ""
+}
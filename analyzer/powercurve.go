@@ -0,0 +1,85 @@
+package analyzer
+
+import "sort"
+
+// defaultPowerCurveDurationsS are the standard mean-maximal power durations:
+// sprint, anaerobic, VO2max, threshold and endurance anchors. Rides longer
+// than an hour also get every further whole hour that fits.
+var defaultPowerCurveDurationsS = []int{1, 5, 15, 30, 60, 120, 300, 600, 1200, 3600}
+
+// PowerCurvePoint is the best mean power held for one duration.
+type PowerCurvePoint struct {
+	DurationSeconds int     `json:"duration_s"`
+	WattsBest       float64 `json:"watts_best"`
+}
+
+// buildPowerCurve returns the mean-maximal power curve of a 1 Hz power stream
+// for defaultPowerCurveDurationsS, each whole hour past 3600 s that fits and
+// any extra durations (Config.BestEffortDurationsS). Durations longer than the
+// stream are skipped rather than reported as the ride average, as are
+// durations with no positive best.
+func buildPowerCurve(power []float64, extra []int) []PowerCurvePoint {
+	n := len(power)
+	seen := make(map[int]bool)
+	var durations []int
+	add := func(d int) {
+		if d > 0 && d <= n && !seen[d] {
+			seen[d] = true
+			durations = append(durations, d)
+		}
+	}
+	for _, d := range defaultPowerCurveDurationsS {
+		add(d)
+	}
+	for d := 7200; d <= n; d += 3600 {
+		add(d)
+	}
+	for _, d := range extra {
+		add(d)
+	}
+	if len(durations) == 0 {
+		return nil
+	}
+	sort.Ints(durations)
+
+	best := meanMaxPower(power, durations)
+	out := make([]PowerCurvePoint, 0, len(durations))
+	for k, d := range durations {
+		if best[k] <= 0 {
+			continue
+		}
+		out = append(out, PowerCurvePoint{DurationSeconds: d, WattsBest: round2(best[k])})
+	}
+	return out
+}
+
+// meanMaxPower returns the best mean power for each of the ascending
+// durations, none longer than the stream. Every duration is evaluated in one
+// pass over a prefix-sum array, so long rides cost one subtraction per sample
+// and duration instead of re-summing each window.
+func meanMaxPower(power []float64, durations []int) []float64 {
+	n := len(power)
+	prefix := make([]float64, n+1)
+	for i, p := range power {
+		prefix[i+1] = prefix[i] + p
+	}
+	bestSums := make([]float64, len(durations))
+	for k, d := range durations {
+		bestSums[k] = prefix[d]
+	}
+	for end := 1; end <= n; end++ {
+		for k, d := range durations {
+			if d > end {
+				break
+			}
+			if sum := prefix[end] - prefix[end-d]; sum > bestSums[k] {
+				bestSums[k] = sum
+			}
+		}
+	}
+	best := make([]float64, len(durations))
+	for k, d := range durations {
+		best[k] = bestSums[k] / float64(d)
+	}
+	return best
+}
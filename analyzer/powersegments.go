@@ -0,0 +1,89 @@
+package analyzer
+
+import (
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+const (
+	// segmentSmoothingSeconds is the centered rolling window used to decide
+	// whether each power sample belongs to a hard or an easy segment.
+	segmentSmoothingSeconds = 30.0
+	// minSegmentSeconds folds shorter hard/easy runs into the previous
+	// segment, so surges and freewheeling do not split an interval.
+	minSegmentSeconds = 30.0
+)
+
+// powerSegmentLaps splits the power stream into synthetic laps at sustained
+// changes between hard (smoothed power at least 1.2x sessionAvgPower, the
+// threshold summarizeLaps labels work with) and easy riding. Auto-lap
+// boundaries say nothing about intervals, so the analyzer infers structure
+// from these segments instead. It returns nil with fewer than three segments.
+func powerSegmentLaps(power []timedSample, sessionAvgPower float64) []*fit.LapMsg {
+	if len(power) < 2 || sessionAvgPower <= 0 {
+		return nil
+	}
+	hardThreshold := sessionAvgPower * 1.20
+	half := time.Duration(segmentSmoothingSeconds / 2 * float64(time.Second))
+
+	hard := make([]bool, len(power))
+	lo, hi := 0, 0
+	sum := 0.0
+	for i, s := range power {
+		for hi < len(power) && !power[hi].ts.After(s.ts.Add(half)) {
+			sum += power[hi].value
+			hi++
+		}
+		for power[lo].ts.Before(s.ts.Add(-half)) {
+			sum -= power[lo].value
+			lo++
+		}
+		hard[i] = sum/float64(hi-lo) >= hardThreshold
+	}
+
+	// Runs of equal state as [start, end) sample ranges; short runs join the
+	// run before them.
+	var runs [][2]int
+	start := 0
+	for i := 1; i <= len(power); i++ {
+		if i < len(power) && hard[i] == hard[start] {
+			continue
+		}
+		n := len(runs)
+		short := power[i-1].ts.Sub(power[start].ts).Seconds()+1 < minSegmentSeconds
+		switch {
+		case n > 0 && (short || hard[runs[n-1][0]] == hard[start]):
+			runs[n-1][1] = i
+		default:
+			runs = append(runs, [2]int{start, i})
+		}
+		start = i
+	}
+	if len(runs) < 3 {
+		return nil
+	}
+
+	laps := make([]*fit.LapMsg, 0, len(runs))
+	for _, r := range runs {
+		lapStart := power[r[0]].ts
+		lapEnd := power[r[1]-1].ts.Add(time.Second)
+		if r[1] < len(power) {
+			lapEnd = power[r[1]].ts
+		}
+		total, peak := 0.0, 0.0
+		for _, s := range power[r[0]:r[1]] {
+			total += s.value
+			peak = max(peak, s.value)
+		}
+		lap := fit.NewLapMsg()
+		lap.StartTime = lapStart
+		lap.Timestamp = lapEnd
+		lap.TotalElapsedTime = uint32(lapEnd.Sub(lapStart).Milliseconds())
+		lap.TotalTimerTime = lap.TotalElapsedTime
+		lap.AvgPower = uint16(total/float64(r[1]-r[0]) + 0.5)
+		lap.MaxPower = uint16(peak + 0.5)
+		laps = append(laps, lap)
+	}
+	return laps
+}
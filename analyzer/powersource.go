@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"strings"
+
+	"github.com/tormoder/fit"
+)
+
+// Power source classifications for Analysis.PowerSource.
+const (
+	PowerSourceMeter     = "power_meter"
+	PowerSourceEstimated = "estimated"
+	PowerSourceUnknown   = "unknown"
+)
+
+// BLE device_type values for power-capable sensors (FIT profile ble_device_type).
+// The FIT library only types ANT+ device_type values.
+const (
+	bleDeviceTypeBikePower   = 2
+	bleDeviceTypeBikeTrainer = 7
+)
+
+// detectPowerSource classifies where record power came from, using
+// device_info source and device types first. A paired power meter or smart
+// trainer means "power_meter". Power recorded while device_info lists other
+// paired ANT+/BLE sensors but no power-capable one was not measured by a
+// sensor, since head units list every sensor they pair, so it is "estimated";
+// so is power alongside a developer field reporting power (named for power or
+// in watts) with no paired meter. Files whose device_info lists no sensors
+// and no power developer field are "unknown"; files without power data
+// return "".
+func detectPowerSource(hasPower bool, infos []*fit.DeviceInfoMsg, apps []DeveloperApp) string {
+	if !hasPower {
+		return ""
+	}
+	sensors := 0
+	for _, info := range infos {
+		if info == nil {
+			continue
+		}
+		if isPowerDevice(info) {
+			return PowerSourceMeter
+		}
+		if isPairedSensor(info) {
+			sensors++
+		}
+	}
+	if sensors > 0 {
+		return PowerSourceEstimated
+	}
+	for _, app := range apps {
+		for _, f := range app.Fields {
+			if isPowerDeveloperField(f) {
+				return PowerSourceEstimated
+			}
+		}
+	}
+	return PowerSourceUnknown
+}
+
+// isPairedSensor reports whether info describes an external ANT+ or BLE
+// sensor rather than the recording device itself.
+func isPairedSensor(info *fit.DeviceInfoMsg) bool {
+	switch info.SourceType {
+	case fit.SourceTypeAntplus, fit.SourceTypeBluetoothLowEnergy, fit.SourceTypeAnt, fit.SourceTypeBluetooth:
+		return true
+	}
+	return false
+}
+
+func isPowerDeveloperField(f DeveloperFieldInfo) bool {
+	units := strings.ToLower(strings.TrimSpace(f.Units))
+	return strings.Contains(strings.ToLower(f.Name), "power") || units == "w" || units == "watts"
+}
+
+func isPowerDevice(info *fit.DeviceInfoMsg) bool {
+	switch info.SourceType {
+	case fit.SourceTypeAntplus:
+		switch fit.AntplusDeviceType(info.DeviceType) {
+		case fit.AntplusDeviceTypeBikePower, fit.AntplusDeviceTypeFitnessEquipment:
+			return true
+		}
+	case fit.SourceTypeBluetoothLowEnergy:
+		return info.DeviceType == bleDeviceTypeBikePower || info.DeviceType == bleDeviceTypeBikeTrainer
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package analyzer
+
+import "math"
+
+const (
+	// quadrantCrankLengthM is the crank length assumed for circumferential
+	// pedal velocity; FIT activity records do not carry it.
+	quadrantCrankLengthM = 0.1725
+	// quadrantThresholdCadenceRPM is the cadence assumed at FTP when deriving
+	// the quadrant thresholds.
+	quadrantThresholdCadenceRPM = 90.0
+)
+
+// QuadrantAnalysis splits pedaling samples by average effective pedal force
+// (AEPF) and circumferential pedal velocity (CPV) relative to the values at
+// FTP and the threshold cadence. Percentages are of pedaling samples only.
+type QuadrantAnalysis struct {
+	ThresholdAEPFN      float64 `json:"threshold_aepf_n"`
+	ThresholdCPVMps     float64 `json:"threshold_cpv_mps"`
+	ThresholdCadenceRPM float64 `json:"threshold_cadence_rpm"`
+	CrankLengthM        float64 `json:"crank_length_m"`
+	HighForceHighVelPct float64 `json:"q1_high_force_high_velocity_pct"`
+	HighForceLowVelPct  float64 `json:"q2_high_force_low_velocity_pct"`
+	LowForceLowVelPct   float64 `json:"q3_low_force_low_velocity_pct"`
+	LowForceHighVelPct  float64 `json:"q4_low_force_high_velocity_pct"`
+	PedalingSampleCount int     `json:"pedaling_sample_count"`
+}
+
+// pedalVelocity converts cadence to circumferential pedal velocity in m/s.
+func pedalVelocity(cadenceRPM float64) float64 {
+	return cadenceRPM * quadrantCrankLengthM * 2 * math.Pi / 60.0
+}
+
+// buildQuadrantAnalysis classifies paired power/cadence samples into the four
+// force/velocity quadrants. It returns nil without FTP or pedaling samples.
+func buildQuadrantAnalysis(samples []pedalSample, ftp float64) *QuadrantAnalysis {
+	if ftp <= 0 || len(samples) == 0 {
+		return nil
+	}
+	thresholdCPV := pedalVelocity(quadrantThresholdCadenceRPM)
+	thresholdAEPF := ftp / thresholdCPV
+
+	var counts [4]int
+	for _, s := range samples {
+		cpv := pedalVelocity(s.cadence)
+		aepf := s.power / cpv
+		highForce := aepf >= thresholdAEPF
+		highVel := cpv >= thresholdCPV
+		switch {
+		case highForce && highVel:
+			counts[0]++
+		case highForce:
+			counts[1]++
+		case highVel:
+			counts[3]++
+		default:
+			counts[2]++
+		}
+	}
+
+	total := float64(len(samples))
+	pct := func(n int) float64 { return round2(float64(n) / total * 100.0) }
+	return &QuadrantAnalysis{
+		ThresholdAEPFN:      round2(thresholdAEPF),
+		ThresholdCPVMps:     round2(thresholdCPV),
+		ThresholdCadenceRPM: quadrantThresholdCadenceRPM,
+		CrankLengthM:        quadrantCrankLengthM,
+		HighForceHighVelPct: pct(counts[0]),
+		HighForceLowVelPct:  pct(counts[1]),
+		LowForceLowVelPct:   pct(counts[2]),
+		LowForceHighVelPct:  pct(counts[3]),
+		PedalingSampleCount: len(samples),
+	}
+}
@@ -0,0 +1,48 @@
+package analyzer
+
+import "math"
+
+const (
+	// defaultRecoveryHoursPerTSS maps load to rest: 100 TSS ≈ 24 h, matching
+	// the common guidance that <150 TSS is recovered by the next day, 150-300
+	// by the second and 300-450 takes two to three days.
+	defaultRecoveryHoursPerTSS = 0.24
+
+	// recoveryReferenceIF is the intensity at which the TSS-based hours apply
+	// unchanged; harder sessions scale up and easier ones down, within
+	// recoveryIFScaleMin..recoveryIFScaleMax.
+	recoveryReferenceIF = 0.80
+	recoveryIFScaleMin  = 0.85
+	recoveryIFScaleMax  = 1.20
+)
+
+// recoveryLoadCategory buckets TSS into the usual recovery tiers.
+func recoveryLoadCategory(tss float64) string {
+	switch {
+	case tss < 150:
+		return "low"
+	case tss < 300:
+		return "moderate"
+	case tss < 450:
+		return "high"
+	default:
+		return "very_high"
+	}
+}
+
+// recommendedRecoveryHours estimates rest before the next hard session as
+// TSS × hoursPerTSS, scaled by IF/0.80 (clamped to 0.85-1.20) so that the same
+// load ridden at higher intensity needs longer. It returns 0 without TSS.
+func recommendedRecoveryHours(tss, intensityFactor, hoursPerTSS float64) float64 {
+	if tss <= 0 {
+		return 0
+	}
+	if hoursPerTSS <= 0 {
+		hoursPerTSS = defaultRecoveryHoursPerTSS
+	}
+	scale := 1.0
+	if intensityFactor > 0 {
+		scale = math.Min(recoveryIFScaleMax, math.Max(recoveryIFScaleMin, intensityFactor/recoveryReferenceIF))
+	}
+	return math.Round(tss * hoursPerTSS * scale)
+}
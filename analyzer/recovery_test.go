@@ -0,0 +1,94 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/internal/fittest"
+	"github.com/tormoder/fit"
+)
+
+func TestRecoveryLoadCategoryTiers(t *testing.T) {
+	for _, tc := range []struct {
+		tss  float64
+		want string
+	}{
+		{1, "low"},
+		{149, "low"},
+		{150, "moderate"},
+		{299, "moderate"},
+		{300, "high"},
+		{449, "high"},
+		{450, "very_high"},
+		{800, "very_high"},
+	} {
+		if got := recoveryLoadCategory(tc.tss); got != tc.want {
+			t.Errorf("TSS %.0f: load %q want %q", tc.tss, got, tc.want)
+		}
+	}
+}
+
+func TestRecommendedRecoveryHours(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		tss, ifactor, hr float64
+		want             float64
+	}{
+		{"no TSS", 0, 0.9, 0, 0},
+		{"reference IF", 100, 0.80, 0, 24},
+		{"missing IF is unscaled", 100, 0, 0, 24},
+		{"IF scales inside the clamp", 100, 0.90, 0, 27},
+		{"easy ride clamps at 0.85", 100, 0.50, 0, 20},
+		{"hard ride clamps at 1.20", 100, 1.20, 0, 29},
+		{"tier boundary 150", 150, 0.80, 0, 36},
+		{"tier boundary 300", 300, 0.80, 0, 72},
+		{"tier boundary 450", 450, 0.80, 0, 108},
+		{"configured hours per TSS", 100, 0.80, 0.5, 50},
+		{"negative hours per TSS uses default", 100, 0.80, -1, 24},
+	} {
+		if got := recommendedRecoveryHours(tc.tss, tc.ifactor, tc.hr); got != tc.want {
+			t.Errorf("%s: %v h want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAnalyzeActivityRecoveryNeedsTSS(t *testing.T) {
+	encode := func(withPower bool) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+			for i := 0; i <= 3600; i++ {
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+				rec.HeartRate = 150
+				if withPower {
+					rec.Power = 250
+				}
+				activity.Records = append(activity.Records, rec)
+			}
+		})
+	}
+
+	a, err := AnalyzeBytes(encode(true), "power.fit", Config{FTPWatts: 250})
+	if err != nil {
+		t.Fatalf("AnalyzeBytes() error: %v", err)
+	}
+	// One hour at FTP is 100 TSS at IF 1.0: 24 h scaled by the 1.20 clamp.
+	if a.RecommendedRecoveryHours != 29 || a.RecoveryLoad != "low" {
+		t.Fatalf("expected 29 h of low-load recovery, got %v h %q (TSS %.1f)", a.RecommendedRecoveryHours, a.RecoveryLoad, a.TrainingStress)
+	}
+	if want := "Recovery: ~29 h before the next hard session (low load)\n"; !strings.Contains(BuildTrainingNotes(a), want) {
+		t.Fatalf("notes missing %q:\n%s", want, BuildTrainingNotes(a))
+	}
+
+	a, err = AnalyzeBytes(encode(false), "hr.fit", Config{})
+	if err != nil {
+		t.Fatalf("AnalyzeBytes() error: %v", err)
+	}
+	if a.TrainingStress != 0 || a.RecommendedRecoveryHours != 0 || a.RecoveryLoad != "" {
+		t.Fatalf("expected no recovery estimate without TSS, got %v h %q (TSS %.1f)", a.RecommendedRecoveryHours, a.RecoveryLoad, a.TrainingStress)
+	}
+	if strings.Contains(BuildTrainingNotes(a), "Recovery:") {
+		t.Fatalf("notes should omit recovery without TSS:\n%s", BuildTrainingNotes(a))
+	}
+}
@@ -3,19 +3,30 @@ package analyzer
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/tormoder/fit"
 )
 
 const workoutStructureSchemaVersion = "workout_structure_v1"
 
 // WorkoutStructure is an LLM-oriented semantic view of the session.
+// ConfidenceFactors breaks Confidence down into each heuristic's contribution.
+// MainSet summarizes every main-set rep together. MainSets lists the sets in
+// order: one entry (equal to MainSet) for homogeneous sessions, or one per set
+// when the work reps form distinct sets (e.g. 3x5m then 5x2m).
 type WorkoutStructure struct {
-	SchemaVersion  string          `json:"schema_version"`
-	Confidence     float64         `json:"confidence"`
-	CanonicalLabel string          `json:"canonical_label"`
-	Blocks         []WorkoutBlock  `json:"blocks,omitempty"`
-	Openers        *OpenersSummary `json:"openers,omitempty"`
-	MainSet        *MainSetSummary `json:"main_set,omitempty"`
+	SchemaVersion     string             `json:"schema_version"`
+	Confidence        float64            `json:"confidence"`
+	ConfidenceFactors map[string]float64 `json:"confidence_factors,omitempty"`
+	CanonicalLabel    string             `json:"canonical_label"`
+	Suppressed        bool               `json:"suppressed,omitempty"`
+	Blocks            []WorkoutBlock     `json:"blocks,omitempty"`
+	Openers           *OpenersSummary    `json:"openers,omitempty"`
+	MainSet           *MainSetSummary    `json:"main_set,omitempty"`
+	MainSets          []MainSetSummary   `json:"main_sets,omitempty"`
 }
 
 // WorkoutBlock represents one contiguous session block.
@@ -56,30 +67,41 @@ type MainSetSummary struct {
 	CadenceDriftPct         float64      `json:"cadence_drift_pct"`
 	HeartRateDriftBPM       float64      `json:"heart_rate_drift_bpm"`
 	Prescription            string       `json:"prescription"`
+	AvgTorqueNm             float64      `json:"avg_torque_nm,omitempty"`
 	RepsDetail              []MainSetRep `json:"reps_detail,omitempty"`
 }
 
 // MainSetRep stores rep-level execution metrics.
 type MainSetRep struct {
-	Rep                     int     `json:"rep"`
-	WorkLap                 int     `json:"work_lap"`
-	RecoveryLap             int     `json:"recovery_lap,omitempty"`
-	WorkDurationSeconds     float64 `json:"work_duration_seconds"`
-	RecoveryDurationSeconds float64 `json:"recovery_duration_seconds,omitempty"`
-	WorkPowerWatts          float64 `json:"work_power_watts"`
-	RecoveryPowerWatts      float64 `json:"recovery_power_watts,omitempty"`
-	WorkPctFTP              float64 `json:"work_pct_ftp,omitempty"`
-	RecoveryPctFTP          float64 `json:"recovery_pct_ftp,omitempty"`
-	WorkVsTargetPct         float64 `json:"work_vs_target_pct,omitempty"`
-	RecoveryVsTargetPct     float64 `json:"recovery_vs_target_pct,omitempty"`
+	Rep                     int      `json:"rep"`
+	WorkLap                 int      `json:"work_lap"`
+	RecoveryLap             int      `json:"recovery_lap,omitempty"`
+	WorkDurationSeconds     float64  `json:"work_duration_seconds"`
+	RecoveryDurationSeconds float64  `json:"recovery_duration_seconds,omitempty"`
+	WorkPowerWatts          float64  `json:"work_power_watts"`
+	RecoveryPowerWatts      float64  `json:"recovery_power_watts,omitempty"`
+	WorkPctFTP              float64  `json:"work_pct_ftp,omitempty"`
+	RecoveryPctFTP          float64  `json:"recovery_pct_ftp,omitempty"`
+	WorkVsTargetPct         float64  `json:"work_vs_target_pct,omitempty"`
+	RecoveryVsTargetPct     float64  `json:"recovery_vs_target_pct,omitempty"`
+	TimeInTargetPct         *float64 `json:"time_in_target_pct,omitempty"`
+	AvgTorqueNm             float64  `json:"avg_torque_nm,omitempty"`
 }
 
+// defaultMainSetGroupingPct is how far (in percent of the current set's mean
+// rep duration or power) a work rep may deviate before it starts a new set.
+const defaultMainSetGroupingPct = 25.0
+
 // InferWorkoutStructure converts lap-level labels into explicit workout blocks and prescriptions.
 func InferWorkoutStructure(laps []LapSummary, ftp float64, intervals IntervalSummary) WorkoutStructure {
+	return inferWorkoutStructure(laps, ftp, intervals, defaultMainSetGroupingPct)
+}
+
+func inferWorkoutStructure(laps []LapSummary, ftp float64, intervals IntervalSummary, groupingTolerancePct float64) WorkoutStructure {
 	ws := WorkoutStructure{
 		SchemaVersion: workoutStructureSchemaVersion,
-		Confidence:    0.25,
 	}
+	ws.addConfidence("base", 0.25)
 	if len(laps) == 0 {
 		ws.CanonicalLabel = "unable to infer workout structure (no lap data)"
 		return ws
@@ -110,7 +132,7 @@ func InferWorkoutStructure(laps []LapSummary, ftp float64, intervals IntervalSum
 		}
 		if warmupEnd >= 0 {
 			addBlock("warmup", 0, warmupEnd, "Aerobic warmup before intensity")
-			ws.Confidence += 0.08
+			ws.addConfidence("warmup", 0.08)
 		}
 	}
 
@@ -122,23 +144,38 @@ func InferWorkoutStructure(laps []LapSummary, ftp float64, intervals IntervalSum
 			openerEnd,
 			fmt.Sprintf("%dx%s on/%s easy primer efforts", openers.Reps, shortDuration(openers.OnDurationSeconds), shortDuration(openers.OffDurationSeconds)),
 		)
-		ws.Confidence += 0.16
+		ws.addConfidence("openers", 0.16)
 	}
 
 	if mainStart >= 0 {
+		windows := splitMainSetWindows(laps, mainStart, mainEnd, groupingTolerancePct)
 		mainSummary := buildMainSetSummary(laps, mainStart, mainEnd, ftp, intervals)
-		ws.MainSet = &mainSummary
-		addBlock("main_set", mainStart, mainEnd, mainSummary.Prescription)
-		ws.Confidence += 0.36
-		if mainSummary.Reps >= 4 {
-			ws.Confidence += 0.08
+		if len(windows) == 1 {
+			ws.MainSets = []MainSetSummary{mainSummary}
+			ws.MainSet = &ws.MainSets[0]
+		} else {
+			for _, w := range windows {
+				ws.MainSets = append(ws.MainSets, buildMainSetSummary(laps, w[0], w[1], ftp, windowIntervals(laps, w[0], w[1])))
+			}
+			ws.MainSet = &mainSummary
+		}
+		for i, w := range windows {
+			addBlock("main_set", w[0], w[1], ws.MainSets[i].Prescription)
+		}
+		ws.addConfidence("main_set", 0.36)
+		reps := 0
+		for _, set := range ws.mainSets() {
+			reps += set.Reps
+		}
+		if reps >= 4 {
+			ws.addConfidence("main_set_reps", 0.08)
 		}
 	}
 
 	cooldownStart, cooldownEnd := detectCooldownWindow(laps, mainEnd)
 	if cooldownStart >= 0 && cooldownEnd >= cooldownStart {
 		addBlock("cooldown", cooldownStart, cooldownEnd, "Easy cooldown to finish the session")
-		ws.Confidence += 0.08
+		ws.addConfidence("cooldown", 0.08)
 	}
 
 	// Keep all laps represented; remaining unlabeled chunks become "steady" blocks.
@@ -157,16 +194,63 @@ func InferWorkoutStructure(laps []LapSummary, ftp float64, intervals IntervalSum
 	}
 
 	if len(ws.Blocks) >= 3 {
-		ws.Confidence += 0.05
+		ws.addConfidence("block_count", 0.05)
 	}
 	if ws.Confidence > 0.99 {
-		ws.Confidence = 0.99
+		ws.addConfidence("cap", 0.99-ws.Confidence)
 	}
 
 	ws.CanonicalLabel = buildCanonicalStructureLabel(ws)
 	return ws
 }
 
+// addConfidence adjusts Confidence by delta and records the contribution
+// under name in ConfidenceFactors.
+func (ws *WorkoutStructure) addConfidence(name string, delta float64) {
+	if ws.ConfidenceFactors == nil {
+		ws.ConfidenceFactors = make(map[string]float64)
+	}
+	ws.ConfidenceFactors[name] += delta
+	ws.Confidence += delta
+}
+
+// mainSets returns a pointer to each entry of MainSets.
+func (ws *WorkoutStructure) mainSets() []*MainSetSummary {
+	if len(ws.MainSets) == 0 {
+		return nil
+	}
+	out := make([]*MainSetSummary, len(ws.MainSets))
+	for i := range ws.MainSets {
+		out[i] = &ws.MainSets[i]
+	}
+	return out
+}
+
+// mainSetSummaries returns every distinct main-set summary: each of MainSets,
+// plus MainSet when the session split into several sets and MainSet is the
+// separate all-reps summary.
+func (ws *WorkoutStructure) mainSetSummaries() []*MainSetSummary {
+	sets := ws.mainSets()
+	if ws.MainSet != nil && (len(sets) == 0 || sets[0] != ws.MainSet) {
+		sets = append(sets, ws.MainSet)
+	}
+	return sets
+}
+
+// suppressLowConfidenceStructure drops inferred blocks when confidence is below
+// minConfidence, keeping the confidence value so consumers can see why.
+func suppressLowConfidenceStructure(ws *WorkoutStructure, minConfidence float64) {
+	if minConfidence <= 0 || ws.Confidence >= minConfidence {
+		return
+	}
+	ws.Blocks = nil
+	ws.Openers = nil
+	ws.MainSet = nil
+	ws.MainSets = nil
+	ws.Suppressed = true
+	ws.CanonicalLabel = fmt.Sprintf("unstructured ride (structure confidence %.2f below %.2f)", ws.Confidence, minConfidence)
+}
+
 func detectMainSetWindow(laps []LapSummary) (int, int) {
 	workIdx := make([]int, 0)
 	for i, lap := range laps {
@@ -185,20 +269,114 @@ func detectMainSetWindow(laps []LapSummary) (int, int) {
 	return start, end
 }
 
+// splitMainSetWindows groups the work reps of the main-set window into
+// consecutive sets whose rep durations and average powers both stay within
+// tolerancePct of the set's running means, returning each set's [start, end] lap range (ending on the
+// recovery after its last rep, if any). Laps between sets belong to none. It
+// returns the whole window when the reps are homogeneous or any set would
+// have a single rep, so one odd rep (e.g. an aborted interval) never splits.
+func splitMainSetWindows(laps []LapSummary, start, end int, tolerancePct float64) [][2]int {
+	whole := [][2]int{{start, end}}
+	if tolerancePct <= 0 {
+		tolerancePct = defaultMainSetGroupingPct
+	}
+	within := func(v, mean float64) bool {
+		return mean > 0 && math.Abs(v-mean)/mean*100 <= tolerancePct
+	}
+	var groups [][]int
+	var sumDur, sumPower float64
+	for i := start; i <= end && i < len(laps); i++ {
+		if laps[i].Label != "work" {
+			continue
+		}
+		d, p := laps[i].DurationSeconds, laps[i].AvgPowerWatts
+		if n := len(groups); n > 0 {
+			reps := float64(len(groups[n-1]))
+			if within(d, sumDur/reps) && within(p, sumPower/reps) {
+				groups[n-1] = append(groups[n-1], i)
+				sumDur += d
+				sumPower += p
+				continue
+			}
+		}
+		groups = append(groups, []int{i})
+		sumDur, sumPower = d, p
+	}
+	if len(groups) < 2 {
+		return whole
+	}
+	windows := make([][2]int, 0, len(groups))
+	for g, reps := range groups {
+		if len(reps) < 2 {
+			return whole
+		}
+		last := reps[len(reps)-1]
+		limit := end
+		if g+1 < len(groups) {
+			limit = groups[g+1][0] - 1
+		}
+		if last+1 <= limit && laps[last+1].Label == "recovery" {
+			last++
+		}
+		windows = append(windows, [2]int{reps[0], last})
+	}
+	return windows
+}
+
+// windowIntervals summarizes the work and recovery laps in [start, end] the
+// way summarizeLaps does for the whole ride, so each set reports its own
+// averages and first-to-last drift.
+func windowIntervals(laps []LapSummary, start, end int) IntervalSummary {
+	var workPow, workDur, workCad, workHR, recPow, recDur []float64
+	out := IntervalSummary{}
+	for i := start; i <= end && i < len(laps); i++ {
+		lap := laps[i]
+		switch lap.Label {
+		case "work":
+			out.WorkCount++
+			workPow = append(workPow, lap.AvgPowerWatts)
+			workDur = append(workDur, lap.DurationSeconds)
+			if lap.AvgCadence > 0 {
+				workCad = append(workCad, lap.AvgCadence)
+			}
+			if lap.AvgHeartRate > 0 {
+				workHR = append(workHR, lap.AvgHeartRate)
+			}
+		case "recovery":
+			out.RecoveryCount++
+			recPow = append(recPow, lap.AvgPowerWatts)
+			recDur = append(recDur, lap.DurationSeconds)
+		}
+	}
+	out.AvgWorkPowerWatts = average(workPow)
+	out.AvgWorkDurationSeconds = average(workDur)
+	out.AvgRecoveryPowerWatts = average(recPow)
+	out.AvgRecoveryDurationSeconds = average(recDur)
+	out.WorkPowerChangePct = pctChange(firstValue(workPow), lastValue(workPow))
+	out.WorkCadenceChangePct = pctChange(firstValue(workCad), lastValue(workCad))
+	if len(workHR) >= 2 {
+		out.WorkHeartRateChange = lastValue(workHR) - firstValue(workHR)
+	}
+	return out
+}
+
 func detectOpenersWindow(laps []LapSummary, mainStart int, intervals IntervalSummary) (int, int, OpenersSummary) {
 	if mainStart <= 1 {
 		return -1, -1, OpenersSummary{}
 	}
 
 	shortEffortMax := 75.0
-	onDur := make([]float64, 0)
-	offDur := make([]float64, 0)
-	onPow := make([]float64, 0)
-	offPow := make([]float64, 0)
 
-	first := -1
-	last := -1
-	reps := 0
+	// Openers are back-to-back on/off pairs: a pair extends the current run
+	// only when its on lap directly follows the previous off lap, so a stray
+	// spike elsewhere in the warmup starts its own run instead of widening the
+	// window. The longest run wins; ties go to the one nearer the main set.
+	type openerRun struct {
+		first, last                  int
+		onDur, offDur, onPow, offPow []float64
+	}
+	var best, cur openerRun
+	cur.first = -1
 
 	for i := 0; i+1 < mainStart; i++ {
 		on := laps[i]
@@ -209,30 +387,35 @@ func detectOpenersWindow(laps []LapSummary, mainStart int, intervals IntervalSum
 			isOn = on.DurationSeconds <= shortEffortMax && on.AvgPowerWatts >= intervals.AvgWorkPowerWatts*0.90
 		}
 		isOff := off.DurationSeconds <= shortEffortMax && off.AvgPowerWatts > 0 && off.AvgPowerWatts < on.AvgPowerWatts*0.80
+		if !isOn || !isOff {
+			continue
+		}
 
-		if isOn && isOff {
-			if first < 0 {
-				first = i
-			}
-			last = i + 1
-			reps++
-			onDur = append(onDur, on.DurationSeconds)
-			offDur = append(offDur, off.DurationSeconds)
-			onPow = append(onPow, on.AvgPowerWatts)
-			offPow = append(offPow, off.AvgPowerWatts)
-			i++
+		if cur.first < 0 || i != cur.last+1 {
+			cur = openerRun{first: i}
 		}
+		cur.last = i + 1
+		cur.onDur = append(cur.onDur, on.DurationSeconds)
+		cur.offDur = append(cur.offDur, off.DurationSeconds)
+		cur.onPow = append(cur.onPow, on.AvgPowerWatts)
+		cur.offPow = append(cur.offPow, off.AvgPowerWatts)
+		if len(cur.onDur) >= len(best.onDur) {
+			best = cur
+		}
+		// Skip the off lap; the next candidate on lap is i+2.
+		i++
 	}
+	reps := len(best.onDur)
 	if reps < 2 {
 		return -1, -1, OpenersSummary{}
 	}
 
-	return first, last, OpenersSummary{
+	return best.first, best.last, OpenersSummary{
 		Reps:               reps,
-		OnDurationSeconds:  average(onDur),
-		OffDurationSeconds: average(offDur),
-		OnPowerWatts:       average(onPow),
-		OffPowerWatts:      average(offPow),
+		OnDurationSeconds:  average(best.onDur),
+		OffDurationSeconds: average(best.offDur),
+		OnPowerWatts:       average(best.onPow),
+		OffPowerWatts:      average(best.offPow),
 	}
 }
 
@@ -381,11 +564,97 @@ func buildMainSetSummary(laps []LapSummary, start, end int, ftp float64, interva
 	return summary
 }
 
+// enrichRepTimeInTarget sets each rep's share of work-lap power samples that fall
+// within ±tolerancePct of the main-set work target. Samples are matched to the
+// work lap by wall-clock window (lap start_time to lap timestamp).
+func enrichRepTimeInTarget(main *MainSetSummary, laps []*fit.LapMsg, power []timedSample, tolerancePct float64) {
+	if main == nil || main.WorkTargetWatts <= 0 || len(power) == 0 {
+		return
+	}
+	lowW := main.WorkTargetWatts * (1 - tolerancePct/100.0)
+	highW := main.WorkTargetWatts * (1 + tolerancePct/100.0)
+	for i := range main.RepsDetail {
+		rep := &main.RepsDetail[i]
+		start, end, ok := workLapWindow(laps, rep.WorkLap)
+		if !ok {
+			continue
+		}
+		first := sort.Search(len(power), func(k int) bool {
+			return !power[k].ts.Before(start)
+		})
+		total := 0
+		inTarget := 0
+		for k := first; k < len(power) && !power[k].ts.After(end); k++ {
+			total++
+			if power[k].value >= lowW && power[k].value <= highW {
+				inTarget++
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		pct := (float64(inTarget) / float64(total)) * 100.0
+		rep.TimeInTargetPct = &pct
+	}
+}
+
+// enrichRepTorque sets each rep's average crank torque, 60·P/(2π·rpm), from
+// the paired power/cadence samples in its work lap, and the set-level average
+// across reps. Coasting samples never reach the pedal series, so zero cadence
+// cannot blow up the ratio.
+func enrichRepTorque(main *MainSetSummary, laps []*fit.LapMsg, pedal []pedalSample) {
+	if main == nil || len(pedal) == 0 {
+		return
+	}
+	repTorques := make([]float64, 0, len(main.RepsDetail))
+	for i := range main.RepsDetail {
+		rep := &main.RepsDetail[i]
+		start, end, ok := workLapWindow(laps, rep.WorkLap)
+		if !ok {
+			continue
+		}
+		first := sort.Search(len(pedal), func(k int) bool {
+			return !pedal[k].ts.Before(start)
+		})
+		torques := make([]float64, 0, 256)
+		for k := first; k < len(pedal) && !pedal[k].ts.After(end); k++ {
+			torques = append(torques, crankTorque(pedal[k].power, pedal[k].cadence))
+		}
+		if len(torques) == 0 {
+			continue
+		}
+		rep.AvgTorqueNm = round2(average(torques))
+		repTorques = append(repTorques, rep.AvgTorqueNm)
+	}
+	main.AvgTorqueNm = round2(average(repTorques))
+}
+
+// crankTorque converts power (W) at cadence (rpm) to torque in N·m.
+func crankTorque(powerW, cadenceRPM float64) float64 {
+	return 60 * powerW / (2 * math.Pi * cadenceRPM)
+}
+
+// workLapWindow returns the wall-clock window (start_time to timestamp) of the
+// 1-based lap index used by MainSetRep.WorkLap.
+func workLapWindow(laps []*fit.LapMsg, lapIndex int) (time.Time, time.Time, bool) {
+	idx := lapIndex - 1
+	if idx < 0 || idx >= len(laps) || laps[idx] == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start := validTimeOrZero(laps[idx].StartTime)
+	end := validTimeOrZero(laps[idx].Timestamp)
+	if start.IsZero() || end.IsZero() || !end.After(start) {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
 func buildCanonicalStructureLabel(ws WorkoutStructure) string {
 	if len(ws.Blocks) == 0 {
 		return "unclassified session structure"
 	}
 	parts := make([]string, 0, 4)
+	sets := ws.mainSets()
 	for _, b := range ws.Blocks {
 		switch b.BlockType {
 		case "warmup":
@@ -395,11 +664,13 @@ func buildCanonicalStructureLabel(ws WorkoutStructure) string {
 				parts = append(parts, fmt.Sprintf("openers %dx%s/%s", ws.Openers.Reps, shortDuration(ws.Openers.OnDurationSeconds), shortDuration(ws.Openers.OffDurationSeconds)))
 			}
 		case "main_set":
-			if ws.MainSet != nil {
-				if ws.MainSet.WorkPctFTP > 0 {
-					parts = append(parts, fmt.Sprintf("%s (%.0f%% FTP)", ws.MainSet.Prescription, ws.MainSet.WorkPctFTP))
+			if len(sets) > 0 {
+				set := sets[0]
+				sets = sets[1:]
+				if set.WorkPctFTP > 0 {
+					parts = append(parts, fmt.Sprintf("%s (%.0f%% FTP)", set.Prescription, set.WorkPctFTP))
 				} else {
-					parts = append(parts, ws.MainSet.Prescription)
+					parts = append(parts, set.Prescription)
 				}
 			}
 		case "cooldown":
@@ -0,0 +1,101 @@
+package analyzer
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+const (
+	// defaultStuckSensorMinSeconds is how long a channel must hold a constant
+	// non-zero value before it is flagged as a likely sensor fault.
+	defaultStuckSensorMinSeconds = 600.0
+	// defaultStuckSensorTolerancePct is the spread (max − min) allowed within a
+	// constant run, as a percentage of the run's lowest value.
+	defaultStuckSensorTolerancePct = 1.0
+)
+
+// constantRun tracks the longest stretch of a channel whose values stay
+// within a relative tolerance of each other. Zero readings (coasting,
+// stopped) end a run, so only active stretches count.
+type constantRun struct {
+	start, last time.Time
+	min, max    float64
+	active      bool
+	longest     float64
+}
+
+func (r *constantRun) add(ts time.Time, v, tolerancePct float64) {
+	if v <= 0 {
+		r.active = false
+		return
+	}
+	if r.active {
+		lo, hi := min(r.min, v), max(r.max, v)
+		if hi-lo <= lo*tolerancePct/100.0 {
+			r.min, r.max, r.last = lo, hi, ts
+			r.longest = max(r.longest, r.last.Sub(r.start).Seconds())
+			return
+		}
+	}
+	r.start, r.last, r.min, r.max, r.active = ts, ts, v, v, true
+}
+
+// detectStuckSensors returns the channels (power, heart_rate, cadence, speed)
+// that held a constant non-zero value for at least minSeconds, in that order.
+// Power and heart rate must repeat the exact same reading: a steady ERG block
+// or a well-paced ride still jitters by a watt or a beat, while a dropped
+// strap or a meter repeating its last reading does not. Cadence and speed are
+// coarser and may vary within tolerancePct. Speed is skipped when skipSpeed is
+// set, as indoors a trainer in ERG mode reports a legitimately flat simulated
+// speed.
+func detectStuckSensors(records []*fit.RecordMsg, minSeconds, tolerancePct float64, skipSpeed bool) []string {
+	if minSeconds <= 0 {
+		minSeconds = defaultStuckSensorMinSeconds
+	}
+	if tolerancePct <= 0 {
+		tolerancePct = defaultStuckSensorTolerancePct
+	}
+
+	timed := make([]*fit.RecordMsg, 0, len(records))
+	for _, rec := range records {
+		if rec != nil && !validTimeOrZero(rec.Timestamp).IsZero() {
+			timed = append(timed, rec)
+		}
+	}
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].Timestamp.Before(timed[j].Timestamp)
+	})
+
+	channels := []struct {
+		name    string
+		extract func(*fit.RecordMsg) (float64, bool)
+		exact   bool
+	}{
+		{"power", extractPower, true},
+		{"heart_rate", extractHeartRate, true},
+		{"cadence", extractCadence, false},
+		{"speed", extractSpeed, false},
+	}
+	var stuck []string
+	for _, ch := range channels {
+		if skipSpeed && ch.name == "speed" {
+			continue
+		}
+		tolerance := tolerancePct
+		if ch.exact {
+			tolerance = 0
+		}
+		var run constantRun
+		for _, rec := range timed {
+			if v, ok := ch.extract(rec); ok {
+				run.add(rec.Timestamp, v, tolerance)
+			}
+		}
+		if run.longest >= minSeconds {
+			stuck = append(stuck, ch.name)
+		}
+	}
+	return stuck
+}
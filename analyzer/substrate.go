@@ -0,0 +1,71 @@
+package analyzer
+
+const (
+	// grossEfficiency converts mechanical work to metabolic energy; at ~24 %
+	// one kJ of work costs about one kcal, the usual cycling rule of thumb.
+	grossEfficiency = 0.24
+
+	// kcalPerGramCarb and kcalPerGramFat are the energy yields of oxidized
+	// carbohydrate and fat.
+	kcalPerGramCarb = 4.1
+	kcalPerGramFat  = 9.4
+
+	// substrateWindowS smooths power before mapping it to %FTP, since
+	// substrate selection follows sustained intensity, not single-second spikes.
+	substrateWindowS = 30
+)
+
+// carbFractionByPctFTP maps intensity (fraction of FTP) to the share of energy
+// drawn from carbohydrate. The anchors follow the respiratory exchange ratio
+// rising from ~0.80 in easy riding (about a third carbohydrate) to ~1.00 at and
+// above threshold (all carbohydrate); values in between are interpolated.
+var carbFractionByPctFTP = []struct{ pctFTP, carb float64 }{
+	{0.40, 0.35},
+	{0.55, 0.50},
+	{0.75, 0.70},
+	{0.90, 0.85},
+	{1.05, 1.00},
+}
+
+// carbFraction interpolates carbFractionByPctFTP, clamping at both ends.
+func carbFraction(pctFTP float64) float64 {
+	table := carbFractionByPctFTP
+	if pctFTP <= table[0].pctFTP {
+		return table[0].carb
+	}
+	for i := 1; i < len(table); i++ {
+		if pctFTP <= table[i].pctFTP {
+			lo, hi := table[i-1], table[i]
+			return lo.carb + (hi.carb-lo.carb)*(pctFTP-lo.pctFTP)/(hi.pctFTP-lo.pctFTP)
+		}
+	}
+	return table[len(table)-1].carb
+}
+
+// estimateSubstrateGrams integrates a 1 Hz power series into estimated grams of
+// carbohydrate and fat oxidized. Each second's metabolic energy is its work
+// divided by grossEfficiency, split by the carbohydrate share at the 30 s
+// rolling intensity. It returns zeros without FTP or power.
+func estimateSubstrateGrams(power []float64, ftp float64) (carbGrams, fatGrams float64) {
+	if ftp <= 0 || len(power) == 0 {
+		return 0, 0
+	}
+	var carbKcal, fatKcal, windowSum float64
+	for i, p := range power {
+		windowSum += p
+		n := substrateWindowS
+		if i+1 < n {
+			n = i + 1
+		} else if i >= substrateWindowS {
+			windowSum -= power[i-substrateWindowS]
+		}
+		if p <= 0 {
+			continue
+		}
+		kcal := p / grossEfficiency / 4184.0
+		carb := carbFraction(windowSum / float64(n) / ftp)
+		carbKcal += kcal * carb
+		fatKcal += kcal * (1 - carb)
+	}
+	return round2(carbKcal / kcalPerGramCarb), round2(fatKcal / kcalPerGramFat)
+}
@@ -0,0 +1,70 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// strongWindMps is the wind speed (about 20 km/h) above which the coaching
+// notes warn that speed no longer tracks effort.
+const strongWindMps = 5.5
+
+// Weather is the head unit's weather report (weather_conditions, global 128),
+// usually synced from the paired phone, plus the mean barometric pressure
+// from barometer_data (global 209). Fields missing from the file stay nil.
+type Weather struct {
+	Condition                   string   `json:"condition,omitempty"`
+	TemperatureC                *float64 `json:"temperature_c,omitempty"`
+	FeelsLikeC                  *float64 `json:"feels_like_c,omitempty"`
+	RelativeHumidityPct         *float64 `json:"relative_humidity_pct,omitempty"`
+	WindSpeedMps                *float64 `json:"wind_speed_mps,omitempty"`
+	WindDirectionDeg            *float64 `json:"wind_direction_deg,omitempty"` // direction the wind blows from
+	PrecipitationProbabilityPct *float64 `json:"precipitation_probability_pct,omitempty"`
+	Location                    string   `json:"location,omitempty"`
+	BarometricPressureHPa       *float64 `json:"barometric_pressure_hpa,omitempty"`
+}
+
+// describeWeather renders the weather as one notes line, e.g.
+// "PartlyCloudy, 18°C (feels 17°C), humidity 60%, wind 18 km/h from 270°".
+func describeWeather(w *Weather) string {
+	var parts []string
+	if w.Condition != "" {
+		parts = append(parts, w.Condition)
+	}
+	if w.TemperatureC != nil {
+		temp := fmt.Sprintf("%.0f°C", *w.TemperatureC)
+		if w.FeelsLikeC != nil && *w.FeelsLikeC != *w.TemperatureC {
+			temp += fmt.Sprintf(" (feels %.0f°C)", *w.FeelsLikeC)
+		}
+		parts = append(parts, temp)
+	}
+	if w.RelativeHumidityPct != nil {
+		parts = append(parts, fmt.Sprintf("humidity %.0f%%", *w.RelativeHumidityPct))
+	}
+	if w.WindSpeedMps != nil {
+		wind := fmt.Sprintf("wind %.0f km/h", mpsToKmh(*w.WindSpeedMps))
+		if w.WindDirectionDeg != nil {
+			wind += fmt.Sprintf(" from %.0f°", *w.WindDirectionDeg)
+		}
+		parts = append(parts, wind)
+	}
+	if w.PrecipitationProbabilityPct != nil {
+		parts = append(parts, fmt.Sprintf("precipitation %.0f%%", *w.PrecipitationProbabilityPct))
+	}
+	if w.BarometricPressureHPa != nil {
+		parts = append(parts, fmt.Sprintf("pressure %.0f hPa", *w.BarometricPressureHPa))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// windNote explains low outdoor speed at high power on windy days; it returns
+// "" indoors or below strongWindMps.
+func windNote(a *Analysis) string {
+	if a.Weather == nil || a.Weather.WindSpeedMps == nil || *a.Weather.WindSpeedMps < strongWindMps {
+		return ""
+	}
+	if a.Environment == EnvironmentIndoor || a.IsVirtual {
+		return ""
+	}
+	return fmt.Sprintf("Wind was %.0f km/h: headwind sections cost speed at the same power, so judge effort by power rather than speed.", mpsToKmh(*a.Weather.WindSpeedMps))
+}
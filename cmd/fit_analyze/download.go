@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// isFitURL reports whether the --fit value names an http(s) URL rather than a
+// local path.
+func isFitURL(value string) bool {
+	lower := strings.ToLower(value)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// downloadFit fetches a .fit file over http(s). It fails on non-200 responses
+// and on bodies larger than maxBytes, and returns the data with a source file
+// name taken from the URL path.
+func downloadFit(rawURL string, maxBytes int64, timeout time.Duration) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse url: %w", err)
+	}
+	if maxBytes <= 0 {
+		return nil, "", fmt.Errorf("max download bytes must be positive")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("build request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("download %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("download %s: unexpected status %s", u.Redacted(), resp.Status)
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, "", fmt.Errorf("download %s: content length %d exceeds limit of %d bytes", u.Redacted(), resp.ContentLength, maxBytes)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("download %s: %w", u.Redacted(), err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", fmt.Errorf("download %s: body exceeds limit of %d bytes", u.Redacted(), maxBytes)
+	}
+	if len(data) == 0 {
+		return nil, "", fmt.Errorf("download %s: empty body", u.Redacted())
+	}
+
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || name == "" {
+		name = "download.fit"
+	}
+	return data, name, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadFitReturnsBodyAndName(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fitdata"))
+	}))
+	defer srv.Close()
+
+	data, name, err := downloadFit(srv.URL+"/rides/morning.fit", 1024, time.Second)
+	if err != nil {
+		t.Fatalf("downloadFit error: %v", err)
+	}
+	if string(data) != "fitdata" || name != "morning.fit" {
+		t.Fatalf("got %q named %q", data, name)
+	}
+	if _, name, _ := downloadFit(srv.URL, 1024, time.Second); name != "download.fit" {
+		t.Fatalf("expected fallback name, got %q", name)
+	}
+}
+
+func TestDownloadFitRejectsNon200(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, _, err := downloadFit(srv.URL+"/a.fit", 1024, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "unexpected status 404") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestDownloadFitEnforcesSizeLimit(t *testing.T) {
+	body := strings.Repeat("x", 64)
+	declared := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer declared.Close()
+	_, _, err := downloadFit(declared.URL+"/a.fit", 32, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "content length 64 exceeds limit of 32 bytes") {
+		t.Fatalf("expected content length error, got %v", err)
+	}
+
+	// Without a Content-Length the limit applies while reading.
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body[:16]))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(body[16:]))
+	}))
+	defer chunked.Close()
+	_, _, err = downloadFit(chunked.URL+"/a.fit", 32, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "body exceeds limit of 32 bytes") {
+		t.Fatalf("expected body limit error, got %v", err)
+	}
+
+	if _, _, err := downloadFit(declared.URL+"/a.fit", 64, time.Second); err != nil {
+		t.Fatalf("body at the limit should download, got %v", err)
+	}
+}
+
+func TestDownloadFitTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	_, _, err := downloadFit(srv.URL+"/a.fit", 1024, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
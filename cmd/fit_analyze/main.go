@@ -5,19 +5,60 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lucasjlepore/fit-analyzer/pipeline"
 )
 
 func main() {
 	var (
-		fitPath   = flag.String("fit", "", "Path to input .fit file")
-		outDir    = flag.String("out", "", "Output directory")
-		ftp       = flag.Float64("ftp", 0, "FTP override in watts")
-		weightKG  = flag.Float64("weight", 0, "Athlete weight in kg")
-		format    = flag.String("format", "parquet", "Canonical sample format: parquet|csv")
-		overwrite = flag.Bool("overwrite", true, "Allow writing into non-empty output directories")
+		fitPath    = flag.String("fit", "", "Path or http(s) URL of the input .fit file")
+		outDir     = flag.String("out", "", "Output directory")
+		ftp        = flag.Float64("ftp", 0, "FTP override in watts")
+		weightKG   = flag.Float64("weight", 0, "Athlete weight in kg")
+		format     = flag.String("format", "parquet", "Canonical sample format: parquet|csv")
+		overwrite  = flag.Bool("overwrite", true, "Allow writing into non-empty output directories")
+		work       = flag.Bool("include-work", false, "Append a per-sample work_j column to canonical samples")
+		artifacts  = flag.String("artifacts", "", "Comma-separated artifacts to generate (default all): "+strings.Join(pipeline.ArtifactNames, ","))
+		minConf    = flag.Float64("min-structure-confidence", 0, "Suppress inferred workout structure below this confidence (0-1)")
+		validate   = flag.Bool("validate-schema", false, "Validate JSON artifacts against the embedded schemas and fail on violations")
+		tsFormat   = flag.String("timestamp-format", "rfc3339", "Canonical sample timestamps: rfc3339|epoch_ms|both")
+		origin     = flag.String("elapsed-origin", "first_record", "Zero point for elapsed_s: first_record|timer_start|file_start|movement_start (movement_start also drops the pre-roll from activity_summary.json)")
+		moveSpeed  = flag.Float64("movement-speed", 1.0, "Speed in m/s above which a sample counts as moving when detecting movement_start (positive power also counts)")
+		smooth     = flag.Int("smooth-grade", 0, "Centered moving-average window in seconds for grade_pct (raw value kept in grade_raw_pct); 0 disables")
+		layout     = flag.String("layout", "flat", "Output directory layout: flat|nested (samples/, messages/, analysis/)")
+		metrics    = flag.Bool("metrics", false, "Print ingestion metrics (file size, records, warnings, stage timings) in Prometheus text format")
+		cpFTP      = flag.Bool("ftp-cp-model", false, "Without --ftp, estimate FTP as critical power from the 2-12 min power curve instead of 95% of best 20 min power")
+		strictFTP  = flag.Bool("strict-ftp", false, "Fail when --ftp is outside the plausible 50-500 W range instead of warning")
+		npPedal    = flag.Bool("np-exclude-coasting", false, "Base activity summary IF/TSS on NP without zero-power coasting samples (np_w_pedaling)")
+		npMin      = flag.Int("np-min-samples", 30, "Seconds of power needed before np_w is marked reliable (np_reliable); shorter files report the average")
+		powRound   = flag.Float64("target-power-rounding", 5, "Round lap-derived workout step power targets to this many watts (e.g. 1 for ERG files)")
+		pctRound   = flag.Float64("target-pct-rounding", 1, "Round lap-derived workout step targets to this many percent of FTP")
+		audit      = flag.Bool("scaling-audit", false, "Write scaling_audit.json with raw vs scaled sample values per field (debug)")
+		lapLabels  = flag.String("lap-labels", "", "Comma-separated lap label renames, e.g. work=effort,recovery=rest (keys: warmup|activation|work|recovery|easy|steady|cooldown)")
+		setGroup   = flag.Float64("main-set-grouping", 25, "Split the main set into separate sets when a work rep's duration or power differs from the current set's mean by more than this percent")
+		excludeL   = flag.String("exclude-laps", "", "Comma-separated 1-based laps to ignore for interval/structure detection, e.g. 4,7 (still exported)")
+		failOn     = flag.String("fail-on-warnings", "", "Comma-separated warning substrings to treat as errors, e.g. \"file CRC mismatch,leftover trailing bytes\"")
+		metLong    = flag.Bool("metrics-long", false, "Write metrics_long.csv with one metric,value,unit row per scalar summary/analysis metric")
+		geoJSON    = flag.Bool("geojson", false, "Write activity.geojson (RFC 7946 LineString of the GPS track) for Mapbox/Leaflet/QGIS")
+		geoPoints  = flag.Bool("geojson-points", false, "With --geojson, also add one Point feature per GPS fix carrying power and heart rate")
+		reconcile  = flag.Bool("reconciliation", false, "Write reconciliation.json comparing session elapsed/timer/moving times with the record span and timer events")
+		verbose    = flag.Bool("verbose-manifest", false, "Add raw_layout to manifest.json: raw header bytes, data/CRC offsets and stored vs computed CRC bytes")
+		explain    = flag.Bool("explain", false, "Print the ranked FTP candidates and why one was chosen for IF/TSS")
+		maxDL      = flag.Int64("max-download-bytes", 64<<20, "Maximum size of a .fit file downloaded from an http(s) --fit URL")
+		dlTimeout  = flag.Duration("download-timeout", 60*time.Second, "Timeout for downloading an http(s) --fit URL")
+		sport      = flag.String("sport", "", "Force activity sport when the file's sport is generic or wrong (e.g. running, cycling, swimming)")
+		efforts    = flag.String("best-efforts", "", "Comma-separated best-effort durations in seconds, strictly ascending, e.g. 10,20,60 (default: every power curve duration)")
+		cleanGPS   = flag.Bool("clean-gps", false, "Drop GPS fixes flagged as glitches (implausible implied speed) from climbs, track_simplified.json and activity.geojson")
+		stuckMin   = flag.Float64("stuck-sensor-seconds", 600, "Seconds a power, HR, cadence or speed channel must hold a constant non-zero value to be flagged as a stuck sensor")
+		stuckTol   = flag.Float64("stuck-sensor-tolerance", 1, "Cadence/speed spread, as a percent of the lowest value, allowed within a stuck-sensor stretch (power and HR must repeat exactly)")
+		decoupleVI = flag.Float64("decoupling-vi", 1.10, "Suppress power:HR decoupling when the variability index exceeds this value")
+		median     = flag.Bool("median", false, "Report median instead of mean power, HR and cadence averages (robust to sensor glitches)")
+		repTol     = flag.Float64("target-tolerance", 5, "Percent band around main-set rep and workout step power targets counted as time in target")
+		gpsDist    = flag.Bool("prefer-gps-distance", false, "Report outdoor distance and average speed from the GPS track instead of the recorded distance")
+		recHours   = flag.Float64("recovery-hours-per-tss", 0.24, "Hours of recommended recovery per TSS point, before the IF scaling")
 	)
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s --fit input.fit --out outdir [--ftp 223] [--weight 72.5] [--format parquet|csv]\n", filepath.Base(os.Args[0]))
@@ -30,14 +71,79 @@ func main() {
 		os.Exit(2)
 	}
 
+	excludeLaps, err := parseIntList(*excludeL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --exclude-laps: %v\n", err)
+		os.Exit(2)
+	}
+
+	bestEfforts, err := parseIntList(*efforts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --best-efforts: %v\n", err)
+		os.Exit(2)
+	}
+
+	labelNames, err := parseLabelMap(*lapLabels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --lap-labels: %v\n", err)
+		os.Exit(2)
+	}
+
+	var fitData []byte
+	if isFitURL(*fitPath) {
+		data, name, err := downloadFit(*fitPath, *maxDL, *dlTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fit_analyze failed: %v\n", err)
+			os.Exit(1)
+		}
+		fitData = data
+		*fitPath = name
+	}
+
 	result, err := pipeline.Run(pipeline.Options{
-		FitPath:     *fitPath,
-		OutDir:      *outDir,
-		FTPOverride: *ftp,
-		WeightKG:    *weightKG,
-		Format:      *format,
-		Overwrite:   *overwrite,
-		CopySource:  true,
+		FitPath:                 *fitPath,
+		FitData:                 fitData,
+		OutDir:                  *outDir,
+		FTPOverride:             *ftp,
+		WeightKG:                *weightKG,
+		Format:                  *format,
+		Overwrite:               *overwrite,
+		CopySource:              true,
+		SportOverride:           *sport,
+		IncludeWork:             *work,
+		Artifacts:               splitList(*artifacts),
+		MinStructureConfidence:  *minConf,
+		ValidateSchema:          *validate,
+		TimestampFormat:         *tsFormat,
+		ElapsedOrigin:           *origin,
+		SmoothGradeWindowS:      *smooth,
+		Layout:                  *layout,
+		StrictFTP:               *strictFTP,
+		NPExcludeCoasting:       *npPedal,
+		TargetPowerRounding:     *powRound,
+		TargetPctRounding:       *pctRound,
+		ScalingAudit:            *audit,
+		ExcludeLaps:             excludeLaps,
+		FailOnWarnings:          splitList(*failOn),
+		MetricsLong:             *metLong,
+		GeoJSON:                 *geoJSON,
+		GeoJSONPoints:           *geoPoints,
+		Reconciliation:          *reconcile,
+		LapLabels:               labelNames,
+		MainSetGroupingPct:      *setGroup,
+		VerboseManifest:         *verbose,
+		MovementSpeedMPS:        *moveSpeed,
+		FTPFromCPModel:          *cpFTP,
+		NPMinSamples:            *npMin,
+		CleanGPS:                *cleanGPS,
+		BestEffortDurationsS:    bestEfforts,
+		StuckSensorMinSeconds:   *stuckMin,
+		StuckSensorTolerancePct: *stuckTol,
+		DecouplingVIThreshold:   *decoupleVI,
+		UseMedianForAverages:    *median,
+		RepTargetTolerancePct:   *repTol,
+		PreferGPSDistance:       *gpsDist,
+		RecoveryHoursPerTSS:     *recHours,
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "fit_analyze failed: %v\n", err)
@@ -46,19 +152,72 @@ func main() {
 
 	fmt.Printf("fit_analyze complete\n")
 	fmt.Printf("Output dir:          %s\n", result.OutputDir)
-	fmt.Printf("records.jsonl:       %s\n", result.RecordsPath)
-	fmt.Printf("manifest.json:       %s\n", result.ManifestPath)
-	fmt.Printf("canonical samples:   %s\n", result.CanonicalSamplesPath)
-	fmt.Printf("messages index:      %s\n", result.MessagesIndexPath)
-	fmt.Printf("workout structure:   %s\n", result.WorkoutStructurePath)
-	if result.LapSummaryPath != "" {
-		fmt.Printf("lap summary:         %s\n", result.LapSummaryPath)
-	}
-	fmt.Printf("activity summary:    %s\n", result.ActivitySummaryPath)
-	if result.SourceCopyPath != "" {
-		fmt.Printf("source copy:         %s\n", result.SourceCopyPath)
-	}
+	printPath("records.jsonl:       ", result.RecordsPath)
+	printPath("manifest.json:       ", result.ManifestPath)
+	printPath("canonical samples:   ", result.CanonicalSamplesPath)
+	printPath("messages index:      ", result.MessagesIndexPath)
+	printPath("workout structure:   ", result.WorkoutStructurePath)
+	printPath("lap summary:         ", result.LapSummaryPath)
+	printPath("adherence:           ", result.AdherencePath)
+	printPath("tss accumulation:    ", result.TSSAccumulationPath)
+	printPath("simplified track:    ", result.TrackSimplifiedPath)
+	printPath("events:              ", result.EventsPath)
+	printPath("activity summary:    ", result.ActivitySummaryPath)
+	printPath("monitoring summary:  ", result.MonitoringSummaryPath)
+	printPath("llm context:         ", result.LLMContextPath)
+	printPath("scaling audit:       ", result.ScalingAuditPath)
+	printPath("metrics long:        ", result.MetricsLongPath)
+	printPath("geojson:             ", result.GeoJSONPath)
+	printPath("reconciliation:      ", result.ReconciliationPath)
+	printPath("source copy:         ", result.SourceCopyPath)
 	for _, w := range result.Warnings {
 		fmt.Printf("warning:             %s\n", w)
 	}
+	if *explain {
+		fmt.Print(pipeline.ExplainFTP(result.FTPSources, result.FTPUsed, result.AnalysisFTPW))
+	}
+	if *metrics {
+		fmt.Print(result.Metrics.Prometheus())
+	}
+}
+
+func printPath(label, path string) {
+	if path != "" {
+		fmt.Printf("%s%s\n", label, path)
+	}
+}
+
+func splitList(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func parseLabelMap(value string) (map[string]string, error) {
+	var out map[string]string
+	for _, part := range splitList(value) {
+		from, to, ok := strings.Cut(part, "=")
+		from, to = strings.ToLower(strings.TrimSpace(from)), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("%q is not a label=name pair", part)
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[from] = to
+	}
+	return out, nil
+}
+
+func parseIntList(value string) ([]int, error) {
+	var out []int
+	for _, part := range splitList(value) {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q is not a positive integer", part)
+		}
+		out = append(out, n)
+	}
+	return out, nil
 }
@@ -39,11 +39,16 @@ func analyzeFit(_ js.Value, args []js.Value) any {
 	}
 
 	result, err := webapp.AnalyzeBytes(webapp.AnalyzeOptions{
-		SourceFileName: getString(optsArg, "source_file_name", "input.fit"),
-		FitData:        fileBytes,
-		FTPWatts:       getFloat(optsArg, "ftp_w"),
-		WeightKG:       getFloat(optsArg, "weight_kg"),
-		Format:         getString(optsArg, "format", "csv"),
+		SourceFileName:        getString(optsArg, "source_file_name", "input.fit"),
+		FitData:               fileBytes,
+		FTPWatts:              getFloat(optsArg, "ftp_w"),
+		WeightKG:              getFloat(optsArg, "weight_kg"),
+		Format:                getString(optsArg, "format", "csv"),
+		CleanGPS:              getBool(optsArg, "clean_gps"),
+		BestEffortsS:          getIntList(optsArg, "best_effort_durations_s"),
+		RepTargetTolerancePct: getFloat(optsArg, "target_tolerance_pct"),
+		PreferGPSDistance:     getBool(optsArg, "prefer_gps_distance"),
+		RecoveryHoursPerTSS:   getFloat(optsArg, "recovery_hours_per_tss"),
 	})
 	if err != nil {
 		return map[string]any{
@@ -151,6 +156,14 @@ func getFloat(v js.Value, key string) float64 {
 	return out.Float()
 }
 
+func getBool(v js.Value, key string) bool {
+	if v.IsUndefined() || v.IsNull() {
+		return false
+	}
+	out := v.Get(key)
+	return out.Type() == js.TypeBoolean && out.Bool()
+}
+
 func getInt(v js.Value, key string) int {
 	if v.IsUndefined() || v.IsNull() {
 		return 0
@@ -162,6 +175,23 @@ func getInt(v js.Value, key string) int {
 	return out.Int()
 }
 
+func getIntList(v js.Value, key string) []int {
+	if v.IsUndefined() || v.IsNull() {
+		return nil
+	}
+	out := v.Get(key)
+	if out.IsUndefined() || out.IsNull() || out.Type() != js.TypeObject {
+		return nil
+	}
+	values := make([]int, 0, out.Length())
+	for i := 0; i < out.Length(); i++ {
+		if item := out.Index(i); item.Type() == js.TypeNumber {
+			values = append(values, item.Int())
+		}
+	}
+	return values
+}
+
 func stringsToAny(values []string) []any {
 	out := make([]any, len(values))
 	for i, v := range values {
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/lucasjlepore/fit-analyzer/llmexport"
@@ -17,6 +20,12 @@ func main() {
 		copySource   = flag.Bool("copy-source", true, "Copy original FIT file into export directory as source.fit")
 		ftp          = flag.Float64("ftp", 0, "FTP in watts used for semantic structure labels in analysis.json")
 		withAnalysis = flag.Bool("with-analysis", true, "Write analysis.json and workout_structure.json for LLM-friendly semantic labeling")
+		jsonOut      = flag.Bool("json", false, "Emit the export result as JSON")
+		lapRange     = flag.String("laps", "", "Limit records.jsonl to an inclusive 1-based lap range, e.g. 3-5 or 4")
+		splitLaps    = flag.Bool("split-laps", false, "Also write one self-contained records_lap_NN.jsonl per lap (within --laps when set)")
+		prettyRecs   = flag.Bool("pretty-records", false, "Write records.json as a pretty-printed JSON array instead of records.jsonl (debugging)")
+		sortFields   = flag.Bool("sort-fields", false, "Order each record's fields by field number instead of encoded order, for diffing exports across devices")
+		verbose      = flag.Bool("verbose-manifest", false, "Add raw_layout to manifest.json: raw header bytes, data/CRC offsets and stored vs computed CRC bytes")
 	)
 
 	flag.Usage = func() {
@@ -30,27 +39,53 @@ func main() {
 		os.Exit(2)
 	}
 
+	if *prettyRecs {
+		fmt.Fprintln(os.Stderr, "warning: --pretty-records writes a single JSON array; use the default records.jsonl for streaming pipelines")
+	}
+
 	inputPath := flag.Arg(0)
 	if strings.TrimSpace(*outDir) == "" {
 		base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
 		*outDir = filepath.Join(".", "exports", base+"_"+llmexport.ExportFormatVersion)
 	}
 
+	laps, err := parseLapRange(*lapRange)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --laps: %v\n", err)
+		os.Exit(2)
+	}
+
 	result, err := llmexport.ExportFile(inputPath, *outDir, llmexport.ExportOptions{
-		Overwrite:       *overwrite,
-		CopySourceFile:  *copySource,
-		FTPWatts:        *ftp,
-		IncludeAnalysis: *withAnalysis,
+		Overwrite:          *overwrite,
+		CopySourceFile:     *copySource,
+		FTPWatts:           *ftp,
+		IncludeAnalysis:    *withAnalysis,
+		LapRange:           laps,
+		SplitByLap:         *splitLaps,
+		PrettyRecords:      *prettyRecs,
+		SortFieldsByNumber: *sortFields,
+		VerboseManifest:    *verbose,
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "export failed: %v\n", err)
 		os.Exit(1)
 	}
 
+	if *jsonOut {
+		if err := writeJSON(os.Stdout, result); err != nil {
+			fmt.Fprintf(os.Stderr, "json encode failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Printf("Export complete\n")
 	fmt.Printf("Output dir: %s\n", result.OutputDir)
 	fmt.Printf("Manifest:   %s\n", result.ManifestPath)
 	fmt.Printf("Records:    %s\n", result.RecordsPath)
+	if len(result.LapChunkPaths) > 0 {
+		fmt.Printf("Lap chunks: %d (%s ... %s)\n", len(result.LapChunkPaths), filepath.Base(result.LapChunkPaths[0]), filepath.Base(result.LapChunkPaths[len(result.LapChunkPaths)-1]))
+	}
 	if result.AnalysisPath != "" {
 		fmt.Printf("Analysis:   %s\n", result.AnalysisPath)
 	}
@@ -66,3 +101,30 @@ func main() {
 	fmt.Printf("Records:    %d (%d definitions, %d data messages)\n", result.RecordCount, result.DefinitionCount, result.DataMessageCount)
 	fmt.Printf("CRC valid:  header=%t file=%t\n", result.HeaderCRCValid, result.FileCRCValid)
 }
+
+// writeJSON writes result as indented JSON for --json.
+func writeJSON(w io.Writer, result *llmexport.ExportResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+func parseLapRange(value string) ([2]int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return [2]int{}, nil
+	}
+	first, last, found := strings.Cut(value, "-")
+	if !found {
+		last = first
+	}
+	a, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return [2]int{}, err
+	}
+	b, err := strconv.Atoi(strings.TrimSpace(last))
+	if err != nil {
+		return [2]int{}, err
+	}
+	return [2]int{a, b}, nil
+}
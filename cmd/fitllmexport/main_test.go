@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
+)
+
+func TestWriteJSONEmitsExportResult(t *testing.T) {
+	result, err := llmexport.ExportFile(filepath.Join("..", "..", "pipeline", "testdata", "intervals.fit"), t.TempDir(), llmexport.ExportOptions{
+		Overwrite:       true,
+		IncludeAnalysis: true,
+	})
+	if err != nil {
+		t.Fatalf("ExportFile() error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, result); err != nil {
+		t.Fatalf("writeJSON() error: %v", err)
+	}
+	var decoded llmexport.ExportResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if decoded.ManifestPath != result.ManifestPath || decoded.RecordCount != result.RecordCount || decoded.SourceSHA256 != result.SourceSHA256 {
+		t.Fatalf("decoded result %+v does not match %+v", decoded, *result)
+	}
+	if decoded.RecordCount == 0 || decoded.AnalysisPath == "" {
+		t.Fatalf("expected records and an analysis path, got %+v", decoded)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"output_dir", "manifest_path", "records_path", "record_count", "file_crc_valid"} {
+		if _, ok := fields[key]; !ok {
+			t.Fatalf("JSON output missing %q:\n%s", key, buf.String())
+		}
+	}
+}
@@ -11,9 +11,17 @@ import (
 
 func main() {
 	var (
-		ftp      = flag.Float64("ftp", 0, "FTP in watts (optional; if omitted the tool estimates FTP from best 20-minute power)")
-		jsonOut  = flag.Bool("json", false, "Emit full analysis as JSON")
-		showLaps = flag.Bool("laps", false, "Include lap-by-lap summary in text output")
+		ftp        = flag.Float64("ftp", 0, "FTP in watts (optional; if omitted the tool estimates FTP from best 20-minute power)")
+		weightKG   = flag.Float64("weight", 0, "Athlete weight in kg (optional; enables W/kg metrics)")
+		jsonOut    = flag.Bool("json", false, "Emit full analysis as JSON")
+		showLaps   = flag.Bool("laps", false, "Include lap-by-lap summary in text output")
+		sport      = flag.String("sport", "", "Force activity sport when the file's sport is generic or wrong (e.g. running, cycling, swimming)")
+		median     = flag.Bool("median", false, "Report median instead of mean power, HR and cadence averages (robust to sensor glitches)")
+		cleanGPS   = flag.Bool("clean-gps", false, "Drop GPS fixes flagged as glitches from climb detection")
+		decoupleVI = flag.Float64("decoupling-vi", 1.10, "Suppress power:HR decoupling when the variability index exceeds this value")
+		repTol     = flag.Float64("target-tolerance", 5, "Percent band around main-set rep power targets counted as time in target")
+		gpsDist    = flag.Bool("prefer-gps-distance", false, "Report outdoor distance and average speed from the GPS track instead of the recorded distance")
+		recHours   = flag.Float64("recovery-hours-per-tss", 0.24, "Hours of recommended recovery per TSS point, before the IF scaling")
 	)
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <path-to-fit-file>\n", os.Args[0])
@@ -27,7 +35,18 @@ func main() {
 	}
 
 	filePath := flag.Arg(0)
-	analysis, err := analyzer.AnalyzeFile(filePath, analyzer.Config{FTPWatts: *ftp})
+	analysis, err := analyzer.AnalyzeFile(filePath, analyzer.Config{
+		FTPWatts:              *ftp,
+		FTPIsOverride:         *ftp > 0,
+		WeightKG:              *weightKG,
+		SportOverride:         *sport,
+		UseMedianForAverages:  *median,
+		CleanGPS:              *cleanGPS,
+		DecouplingVIThreshold: *decoupleVI,
+		RepTargetTolerancePct: *repTol,
+		PreferGPSDistance:     *gpsDist,
+		RecoveryHoursPerTSS:   *recHours,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "analysis failed: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,70 @@
+// Package fittest builds FIT files for the llmexport and pipeline tests.
+package fittest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/tormoder/fit"
+	"github.com/tormoder/fit/dyncrc16"
+)
+
+// EncodeActivity encodes a FIT activity file whose messages build fills in.
+func EncodeActivity(t testing.TB, build func(activity *fit.ActivityFile)) []byte {
+	t.Helper()
+	return Encode(t, fit.FileTypeActivity, func(file *fit.File) {
+		activity, err := file.Activity()
+		if err != nil {
+			t.Fatalf("activity accessor: %v", err)
+		}
+		build(activity)
+	})
+}
+
+// Encode encodes a FIT file of fileType; build fills in its messages through
+// the typed accessor (file.MonitoringB() and so on).
+func Encode(t testing.TB, fileType fit.FileType, build func(file *fit.File)) []byte {
+	t.Helper()
+	file, err := fit.NewFile(fileType, fit.NewHeader(fit.V20, true))
+	if err != nil {
+		t.Fatalf("new fit file: %v", err)
+	}
+	if build != nil {
+		build(file)
+	}
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, file, binary.LittleEndian); err != nil {
+		t.Fatalf("encode fit: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// RawFIT wraps a hand-built data section in a 14-byte header and file CRC.
+func RawFIT(data []byte) []byte {
+	out := []byte{14, 0x20}
+	out = binary.LittleEndian.AppendUint16(out, 2132)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+	out = append(out, ".FIT"...)
+	out = binary.LittleEndian.AppendUint16(out, dyncrc16.Checksum(out))
+	out = append(out, data...)
+	return binary.LittleEndian.AppendUint16(out, dyncrc16.Checksum(out))
+}
+
+// AppendRaw appends hand-built definition and data messages to the data
+// section of an encoded FIT file, for messages the typed encoder cannot write.
+func AppendRaw(file, raw []byte) []byte {
+	data := append([]byte(nil), file[file[0]:len(file)-2]...)
+	return RawFIT(append(data, raw...))
+}
+
+// ZonesTarget returns a raw zones_target message (global 7, local type 15)
+// with the given max heart rate and functional threshold power.
+func ZonesTarget(maxHR uint8, ftp uint16) []byte {
+	raw := []byte{0x4F, 0, 0, 7, 0, 2,
+		1, 1, 0x02,
+		3, 2, 0x84,
+		0x0F, maxHR,
+	}
+	return binary.LittleEndian.AppendUint16(raw, ftp)
+}
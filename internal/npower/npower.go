@@ -0,0 +1,84 @@
+// Package npower resamples power to 1 Hz and computes normalized power. The
+// analyzer and the pipeline both use it, so analysis.json and
+// activity_summary.json report the same NP for the same file.
+package npower
+
+import "math"
+
+const (
+	// MaxHoldSeconds is the longest gap between readings that is
+	// forward-filled when resampling; longer gaps are pauses and add no
+	// seconds.
+	MaxHoldSeconds = 10.0
+	// WindowSeconds is the NP rolling window. With fewer 1 Hz seconds than
+	// this, Normalized returns the plain average.
+	WindowSeconds = 30
+)
+
+// Resample1Hz resamples power readings taken at ascending times (seconds on
+// any common origin) to 1 Hz. Readings in the same whole second are averaged
+// into one value, which is held for each empty second up to the next reading
+// when that reading is at most MaxHoldSeconds later. When skip is non-nil,
+// readings with skip[i] set advance time but contribute nothing.
+func Resample1Hz(seconds, watts []float64, skip []bool) []float64 {
+	if len(seconds) == 0 || len(seconds) != len(watts) {
+		return nil
+	}
+	out := make([]float64, 0, len(seconds))
+	for i := 0; i < len(seconds); {
+		sec := math.Floor(seconds[i])
+		j := i
+		sum, n := 0.0, 0
+		for ; j < len(seconds) && math.Floor(seconds[j]) == sec; j++ {
+			if skip == nil || !skip[j] {
+				sum += watts[j]
+				n++
+			}
+		}
+		if n > 0 {
+			mean := sum / float64(n)
+			out = append(out, mean)
+			if j < len(seconds) && seconds[j]-seconds[j-1] <= MaxHoldSeconds {
+				for k := sec + 1; k < math.Floor(seconds[j]); k++ {
+					out = append(out, mean)
+				}
+			}
+		}
+		i = j
+	}
+	return out
+}
+
+// Normalized returns the normalized power of a 1 Hz power series: the fourth
+// root of the mean fourth power of its WindowSeconds rolling average.
+func Normalized(power []float64) float64 {
+	if len(power) == 0 {
+		return 0
+	}
+	if len(power) < WindowSeconds {
+		return mean(power)
+	}
+	sum := 0.0
+	for i := 0; i < WindowSeconds; i++ {
+		sum += power[i]
+	}
+	totalFourth := 0.0
+	count := 0
+	for i := WindowSeconds - 1; i < len(power); i++ {
+		if i >= WindowSeconds {
+			sum += power[i] - power[i-WindowSeconds]
+		}
+		roll := sum / WindowSeconds
+		totalFourth += math.Pow(roll, 4)
+		count++
+	}
+	return math.Pow(totalFourth/float64(count), 0.25)
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
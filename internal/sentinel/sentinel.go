@@ -0,0 +1,34 @@
+// Package sentinel holds the FIT base-type invalid-value sentinels shared by
+// analyzer and llmexport. It lives apart from both because llmexport imports
+// analyzer, so analyzer cannot use llmexport's helpers directly.
+package sentinel
+
+// Invalid-value sentinels for FIT base types.
+const (
+	InvalidUint8  uint8  = 0xFF
+	InvalidUint16 uint16 = 0xFFFF
+	InvalidUint32 uint32 = 0xFFFFFFFF
+	InvalidUint64 uint64 = 0xFFFFFFFFFFFFFFFF
+	InvalidSint8  int8   = 0x7F
+	InvalidSint16 int16  = 0x7FFF
+	InvalidSint32 int32  = 0x7FFFFFFF
+	InvalidSint64 int64  = 0x7FFFFFFFFFFFFFFF
+)
+
+// IsInvalidUint8 reports whether v is the uint8/enum invalid sentinel.
+func IsInvalidUint8(v uint8) bool { return v == InvalidUint8 }
+
+// IsInvalidUint16 reports whether v is the uint16 invalid sentinel.
+func IsInvalidUint16(v uint16) bool { return v == InvalidUint16 }
+
+// IsInvalidUint32 reports whether v is the uint32 invalid sentinel.
+func IsInvalidUint32(v uint32) bool { return v == InvalidUint32 }
+
+// IsInvalidSint8 reports whether v is the sint8 invalid sentinel.
+func IsInvalidSint8(v int8) bool { return v == InvalidSint8 }
+
+// IsInvalidSint16 reports whether v is the sint16 invalid sentinel.
+func IsInvalidSint16(v int16) bool { return v == InvalidSint16 }
+
+// IsInvalidSint32 reports whether v is the sint32 invalid sentinel.
+func IsInvalidSint32(v int32) bool { return v == InvalidSint32 }
@@ -0,0 +1,61 @@
+package llmexport
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+)
+
+// DeveloperCadenceSamples returns cadence an app logged in record developer
+// fields whose field_description (global 206) name mentions cadence, e.g. a
+// trainer app recording its own wheel-based estimate next to the head unit's
+// crank cadence. Each reading takes its record's timestamp; zero and invalid
+// readings are skipped. Output is sorted by time.
+func DeveloperCadenceSamples(records []RecordEnvelope) []analyzer.CadenceSample {
+	type devKey struct{ idx, field uint8 }
+	baseTypes := make(map[devKey]int)
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.Data == nil || rec.GlobalMessageNum != fieldDescriptionMessageNum {
+			continue
+		}
+		idx, ok := uint8Field(rec.Data.Fields, 0)
+		if !ok {
+			continue
+		}
+		num, ok := uint8Field(rec.Data.Fields, 1)
+		if !ok {
+			continue
+		}
+		baseType, _ := uint8Field(rec.Data.Fields, 2)
+		if f, ok := findField(rec.Data.Fields, 3); ok && !f.Invalid {
+			if name, ok := f.Decoded.(string); ok && strings.Contains(strings.ToLower(name), "cadence") {
+				baseTypes[devKey{idx, num}] = int(baseType)
+			}
+		}
+	}
+	if len(baseTypes) == 0 {
+		return nil
+	}
+
+	var out []analyzer.CadenceSample
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.Data == nil || rec.GlobalMessageNum != 20 || rec.Data.Flat == nil || rec.Data.Flat.TimestampRaw == 0 {
+			continue
+		}
+		for _, d := range rec.Data.DeveloperFields {
+			baseType, ok := baseTypes[devKey{d.DeveloperDataIdx, d.FieldNumber}]
+			if !ok {
+				continue
+			}
+			if rpm := DecodeDeveloperNumeric(d, baseType); rpm > 0 {
+				out = append(out, analyzer.CadenceSample{Timestamp: FitTimeToUTC(rec.Data.Flat.TimestampRaw), RPM: rpm})
+			}
+			break
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Timestamp.Before(out[j].Timestamp)
+	})
+	return out
+}
@@ -0,0 +1,183 @@
+package llmexport
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/tormoder/fit"
+)
+
+const (
+	fieldDescriptionMessageNum = 206
+	developerDataIDMessageNum  = 207
+)
+
+// DeveloperApps lists the applications that registered developer data
+// (developer_data_id, global 207), each joined to the developer fields it
+// described in field_description (global 206) by developer_data_index.
+// Field descriptions whose index has no developer_data_id still produce an
+// entry so their provenance gap is visible. Output is sorted by index.
+func DeveloperApps(records []RecordEnvelope) []analyzer.DeveloperApp {
+	apps := make(map[uint8]*analyzer.DeveloperApp)
+	appFor := func(idx uint8) *analyzer.DeveloperApp {
+		app, ok := apps[idx]
+		if !ok {
+			app = &analyzer.DeveloperApp{DeveloperDataIndex: idx}
+			apps[idx] = app
+		}
+		return app
+	}
+
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.Data == nil {
+			continue
+		}
+		switch rec.GlobalMessageNum {
+		case developerDataIDMessageNum:
+			idx, ok := uint8Field(rec.Data.Fields, 3)
+			if !ok {
+				continue
+			}
+			app := appFor(idx)
+			if id := bytesField(rec.Data.Fields, 1); len(id) > 0 {
+				app.ApplicationID = formatApplicationID(id)
+			}
+			if f, ok := findField(rec.Data.Fields, 2); ok && !f.Invalid {
+				if v, ok := f.Decoded.(uint16); ok {
+					app.Manufacturer = fmt.Sprint(fit.Manufacturer(v))
+				}
+			}
+			if f, ok := findField(rec.Data.Fields, 4); ok && !f.Invalid {
+				if v, ok := asUint32(f.Decoded); ok {
+					app.ApplicationVersion = v
+				}
+			}
+		case fieldDescriptionMessageNum:
+			idx, ok := uint8Field(rec.Data.Fields, 0)
+			if !ok {
+				continue
+			}
+			num, ok := uint8Field(rec.Data.Fields, 1)
+			if !ok {
+				continue
+			}
+			info := analyzer.DeveloperFieldInfo{FieldNumber: num}
+			if f, ok := findField(rec.Data.Fields, 3); ok {
+				info.Name, _ = f.Decoded.(string)
+			}
+			if f, ok := findField(rec.Data.Fields, 8); ok {
+				info.Units, _ = f.Decoded.(string)
+			}
+			app := appFor(idx)
+			app.Fields = append(app.Fields, info)
+		}
+	}
+	if len(apps) == 0 {
+		return nil
+	}
+
+	out := make([]analyzer.DeveloperApp, 0, len(apps))
+	for _, app := range apps {
+		sort.SliceStable(app.Fields, func(i, j int) bool {
+			return app.Fields[i].FieldNumber < app.Fields[j].FieldNumber
+		})
+		out = append(out, *app)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].DeveloperDataIndex < out[j].DeveloperDataIndex
+	})
+	return out
+}
+
+// DecodeDeveloperNumeric decodes the first element of a developer field value
+// from its FIT base type, in the byte order of the field's definition; array
+// fields carry further elements that are ignored. Integer and float base
+// types are supported. Invalid sentinels, string and byte fields, and values
+// shorter than their base type decode to 0.
+func DecodeDeveloperNumeric(field DeveloperFieldValue, baseRaw int) float64 {
+	bt := decompressBaseType(byte(baseRaw))
+	spec, ok := baseSpecs[bt]
+	if !ok || bt == baseString || bt == baseByte || len(field.DecodedByteValues) < spec.size {
+		return 0
+	}
+	raw := make([]byte, spec.size)
+	for i := range raw {
+		raw[i] = byte(field.DecodedByteValues[i])
+	}
+	var arch binary.ByteOrder = binary.LittleEndian
+	if field.BigEndian {
+		arch = binary.BigEndian
+	}
+	v, invalid := decodeSingleValue(raw, bt, arch)
+	if invalid {
+		return 0
+	}
+	switch x := v.(type) {
+	case uint8:
+		return float64(x)
+	case int8:
+		return float64(x)
+	case uint16:
+		return float64(x)
+	case int16:
+		return float64(x)
+	case uint32:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case float64:
+		return x
+	default: // NaN/Inf labels
+		return 0
+	}
+}
+
+func findField(fields []FieldValue, num uint8) (FieldValue, bool) {
+	for _, f := range fields {
+		if f.FieldNumber == num {
+			return f, true
+		}
+	}
+	return FieldValue{}, false
+}
+
+func uint8Field(fields []FieldValue, num uint8) (uint8, bool) {
+	f, ok := findField(fields, num)
+	if !ok || f.Invalid {
+		return 0, false
+	}
+	v, ok := f.Decoded.(uint8)
+	return v, ok
+}
+
+func bytesField(fields []FieldValue, num uint8) []byte {
+	f, ok := findField(fields, num)
+	if !ok || f.Invalid {
+		return nil
+	}
+	values, ok := f.Decoded.([]int)
+	if !ok {
+		return nil
+	}
+	out := make([]byte, len(values))
+	for i, v := range values {
+		out[i] = byte(v)
+	}
+	return out
+}
+
+// formatApplicationID renders a 16-byte application_id as a UUID string.
+func formatApplicationID(id []byte) string {
+	if len(id) != 16 {
+		return hex.EncodeToString(id)
+	}
+	h := hex.EncodeToString(id)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
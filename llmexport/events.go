@@ -0,0 +1,172 @@
+package llmexport
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	eventMessageNum = 21
+
+	eventEventField     = 0
+	eventEventTypeField = 1
+	eventData16Field    = 2
+	eventDataField      = 3
+	eventGroupField     = 4
+)
+
+// Event is one entry of the event (global 21) timeline with its data payload
+// interpreted according to the event kind.
+type Event struct {
+	TimestampUTC string   `json:"timestamp_utc,omitempty"`
+	Event        string   `json:"event"`
+	EventType    string   `json:"event_type,omitempty"`
+	EventGroup   *uint8   `json:"event_group,omitempty"`
+	RawData      *uint32  `json:"raw_data,omitempty"`
+	Value        *float64 `json:"value,omitempty"`
+	Units        string   `json:"units,omitempty"`
+	Description  string   `json:"description"`
+}
+
+var eventNames = map[uint8]string{
+	0: "timer", 3: "workout", 4: "workout_step", 5: "power_down", 6: "power_up",
+	7: "off_course", 8: "session", 9: "lap", 10: "course_point", 11: "battery",
+	12: "virtual_partner_pace", 13: "hr_high_alert", 14: "hr_low_alert",
+	15: "speed_high_alert", 16: "speed_low_alert", 17: "cad_high_alert",
+	18: "cad_low_alert", 19: "power_high_alert", 20: "power_low_alert",
+	21: "recovery_hr", 22: "battery_low", 23: "time_duration_alert",
+	24: "distance_duration_alert", 25: "calorie_duration_alert", 26: "activity",
+	27: "fitness_equipment", 28: "length", 32: "user_marker", 33: "sport_point",
+	36: "calibration", 42: "front_gear_change", 43: "rear_gear_change",
+	44: "rider_position_change", 45: "elev_high_alert", 46: "elev_low_alert",
+	47: "comm_timeout", 75: "radar_threat_alert",
+}
+
+var eventTypeNames = map[uint8]string{
+	0: "start", 1: "stop", 2: "consecutive_depreciated", 3: "marker", 4: "stop_all",
+	5: "begin_depreciated", 6: "end_depreciated", 7: "end_all_depreciated",
+	8: "stop_disable", 9: "stop_disable_all",
+}
+
+// eventPayload describes what the data field carries for one event kind:
+// a scaled number with units, or an enum decoded through labels.
+type eventPayload struct {
+	scale  float64
+	offset float64
+	units  string
+	labels map[uint32]string
+}
+
+var eventPayloads = map[uint8]eventPayload{
+	0:  {labels: map[uint32]string{0: "manual", 1: "auto", 2: "fitness_equipment"}}, // timer_trigger
+	10: {scale: 1, units: "index"},                                                  // course_point_index
+	11: {scale: 1000, units: "v"},                                                   // battery_level
+	12: {scale: 1000, units: "m/s"},                                                 // virtual_partner_speed
+	13: {scale: 1, units: "bpm"},
+	14: {scale: 1, units: "bpm"},
+	15: {scale: 1000, units: "m/s"},
+	16: {scale: 1000, units: "m/s"},
+	17: {scale: 1, units: "rpm"},
+	18: {scale: 1, units: "rpm"},
+	19: {scale: 1, units: "w"},
+	20: {scale: 1, units: "w"},
+	23: {scale: 1000, units: "s"},
+	24: {scale: 100, units: "m"},
+	25: {scale: 1, units: "kcal"},
+	27: {labels: map[uint32]string{0: "ready", 1: "in_use", 2: "paused", 3: "unknown"}},
+	33: {scale: 1, units: "points"},
+	44: {labels: map[uint32]string{0: "seated", 1: "standing", 2: "transition_to_seated", 3: "transition_to_standing"}},
+	45: {scale: 5, offset: 500, units: "m"},
+	46: {scale: 5, offset: 500, units: "m"},
+	47: {labels: map[uint32]string{0: "wildcard", 1: "pairing_timeout", 2: "connection_lost", 3: "connection_timeout"}},
+}
+
+// Events returns the event timeline in file order. The data field (or data16
+// in older files) is decoded per event kind: alert thresholds in their units,
+// timer triggers and rider positions as labels, and gear changes as
+// front/rear gear numbers and tooth counts.
+func Events(records []RecordEnvelope) []Event {
+	var out []Event
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.GlobalMessageNum != eventMessageNum || rec.Data == nil {
+			continue
+		}
+		code, ok := uint8Field(rec.Data.Fields, eventEventField)
+		if !ok {
+			continue
+		}
+		ev := Event{Event: eventNames[code]}
+		if ev.Event == "" {
+			ev.Event = fmt.Sprintf("event_%d", code)
+		}
+		if ts, ok := recordTimestamp(rec.Data); ok {
+			ev.TimestampUTC = FitTimeToUTC(ts).Format("2006-01-02T15:04:05Z")
+		}
+		if t, ok := uint8Field(rec.Data.Fields, eventEventTypeField); ok {
+			ev.EventType = eventTypeNames[t]
+		}
+		if g, ok := uint8Field(rec.Data.Fields, eventGroupField); ok {
+			ev.EventGroup = &g
+		}
+		if raw, ok := eventData(rec.Data.Fields); ok {
+			ev.RawData = &raw
+		}
+		ev.Description = describeEvent(code, &ev)
+		out = append(out, ev)
+	}
+	return out
+}
+
+// eventData returns the data payload, falling back to data16.
+func eventData(fields []FieldValue) (uint32, bool) {
+	if f, ok := findField(fields, eventDataField); ok && !f.Invalid {
+		if v, ok := f.Decoded.(uint32); ok {
+			return v, true
+		}
+	}
+	if f, ok := findField(fields, eventData16Field); ok && !f.Invalid {
+		if v, ok := f.Decoded.(uint16); ok {
+			return uint32(v), true
+		}
+	}
+	return 0, false
+}
+
+// describeEvent fills Value/Units from the payload table and returns a short
+// human-readable label such as "hr_high_alert @170bpm".
+func describeEvent(code uint8, ev *Event) string {
+	label := ev.Event
+	if ev.EventType != "" {
+		label += " " + ev.EventType
+	}
+	if ev.RawData == nil {
+		return label
+	}
+	raw := *ev.RawData
+	if code == 42 || code == 43 {
+		rearNum, rearTeeth := raw&0xFF, (raw>>8)&0xFF
+		frontNum, frontTeeth := (raw>>16)&0xFF, (raw>>24)&0xFF
+		return fmt.Sprintf("%s front %d (%dT) / rear %d (%dT)", label, frontNum, frontTeeth, rearNum, rearTeeth)
+	}
+	payload, ok := eventPayloads[code]
+	if !ok {
+		return label
+	}
+	if payload.labels != nil {
+		if name, ok := payload.labels[raw]; ok {
+			return fmt.Sprintf("%s (%s)", label, name)
+		}
+		return label
+	}
+	v := float64(raw)/payload.scale - payload.offset
+	ev.Value = &v
+	ev.Units = payload.units
+	return fmt.Sprintf("%s @%s%s", label, formatEventValue(v), payload.units)
+}
+
+func formatEventValue(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
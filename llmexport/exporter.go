@@ -19,7 +19,8 @@ import (
 // ExportFile parses a FIT file and writes an LLM-friendly, lossless export bundle.
 // Output files:
 //   - manifest.json
-//   - records.jsonl
+//   - records.jsonl (records.json when PrettyRecords is set)
+//   - records_lap_NN.jsonl (optional, one per lap)
 //   - source.fit (optional)
 func ExportFile(inputPath, outputDir string, opts ExportOptions) (*ExportResult, error) {
 	if strings.TrimSpace(inputPath) == "" {
@@ -56,19 +57,83 @@ func ExportFile(inputPath, outputDir string, opts ExportOptions) (*ExportResult,
 		return nil, err
 	}
 
+	exported, lapFilter, err := FilterRecordsByLaps(parsed.Records, opts.LapRange)
+	if err != nil {
+		return nil, fmt.Errorf("filter records by lap: %w", err)
+	}
+	// Counts describe the exported records, which a lap filter may narrow.
+	definitionCount := countRecordKind(exported, "definition")
+	dataMessageCount := countRecordKind(exported, "data")
+
 	recordsPath := filepath.Join(outputDir, "records.jsonl")
-	if err := writeJSONL(recordsPath, parsed.Records); err != nil {
+	recordType := "JSONL line-per-FIT-record preserving original order and byte offsets"
+	if opts.SortFieldsByNumber {
+		exported = SortRecordFields(exported)
+	}
+	if opts.PrettyRecords {
+		recordsPath = filepath.Join(outputDir, "records.json")
+		recordType = "Pretty-printed JSON array of FIT records preserving original order and byte offsets"
+		pretty, err := MarshalJSON(exported)
+		if err != nil {
+			return nil, fmt.Errorf("marshal records.json: %w", err)
+		}
+		if err := os.WriteFile(recordsPath, pretty, 0o644); err != nil {
+			return nil, fmt.Errorf("write records.json: %w", err)
+		}
+	} else if err := writeJSONL(recordsPath, exported); err != nil {
 		return nil, fmt.Errorf("write records.jsonl: %w", err)
 	}
+	if opts.SortFieldsByNumber {
+		recordType += "; fields sorted by field number (field_index keeps the encoded position)"
+	}
+
+	var lapChunks []LapChunk
+	var lapChunkPaths []string
+	if opts.SplitByLap {
+		chunks, filters, err := SplitRecordsByLap(parsed.Records, opts.LapRange)
+		if err != nil {
+			return nil, fmt.Errorf("split records by lap: %w", err)
+		}
+		for i, chunk := range chunks {
+			if opts.SortFieldsByNumber {
+				chunk = SortRecordFields(chunk)
+			}
+			name := fmt.Sprintf("records_lap_%02d.jsonl", filters[i].FirstLap)
+			path := filepath.Join(outputDir, name)
+			if err := writeJSONL(path, chunk); err != nil {
+				return nil, fmt.Errorf("write %s: %w", name, err)
+			}
+			lapChunks = append(lapChunks, LapChunk{
+				Path:         name,
+				Lap:          filters[i].FirstLap,
+				StartTimeUTC: filters[i].StartTimeUTC,
+				EndTimeUTC:   filters[i].EndTimeUTC,
+				RecordCount:  len(chunk),
+			})
+			lapChunkPaths = append(lapChunkPaths, path)
+		}
+	}
 
 	analysisPath := ""
 	workoutStructurePath := ""
 	analysisError := ""
+	powerSource := ""
 	if opts.IncludeAnalysis {
-		analysis, err := analyzer.AnalyzeFile(inputPath, analyzer.Config{FTPWatts: opts.FTPWatts})
+		analysis, err := analyzer.AnalyzeFile(inputPath, analyzer.Config{
+			FTPWatts:         opts.FTPWatts,
+			FTPIsOverride:    opts.FTPWatts > 0,
+			HeartRateSamples: HeartRateSamples(parsed.Records),
+			DeveloperApps:    DeveloperApps(parsed.Records),
+			DeviceZones:      DevicePowerZones(parsed.Records),
+			SportProfile:     SportProfile(parsed.Records),
+			Weather:          Weather(parsed.Records),
+		})
 		if err != nil {
 			analysisError = err.Error()
 		} else {
+			powerSource = analysis.PowerSource
+			analysis.PedalPowerPhase = PedalPowerPhase(parsed.Records)
+			analysis.DeviceTimeInZone = DeviceTimeInZone(parsed.Records)
 			analysisPath = filepath.Join(outputDir, "analysis.json")
 			if err := writeJSON(analysisPath, analysis); err != nil {
 				return nil, fmt.Errorf("write analysis.json: %w", err)
@@ -104,13 +169,15 @@ func ExportFile(inputPath, outputDir string, opts ExportOptions) (*ExportResult,
 		AnalysisPath:         analysisPathName,
 		WorkoutStructurePath: workoutStructurePathName,
 		AnalysisError:        analysisError,
-		RecordCount:          len(parsed.Records),
-		DefinitionCount:      parsed.DefinitionCount,
-		DataMessageCount:     parsed.DataMessageCount,
+		PowerSource:          powerSource,
+		RecordCount:          len(exported),
+		DefinitionCount:      definitionCount,
+		DataMessageCount:     dataMessageCount,
 		LeftoverBytes:        parsed.LeftoverBytesCount,
 		FileIdProjection:     fileID,
+		MessageCounts:        MessageCountList(exported),
 		SchemaDescription: SchemaDetails{
-			RecordType: "JSONL line-per-FIT-record preserving original order and byte offsets",
+			RecordType: recordType,
 			Notes: []string{
 				"Lossless: every FIT data record and field payload is exported with raw hex.",
 				"Each line includes decoded values and validity flags without dropping invalid sentinels.",
@@ -120,7 +187,13 @@ func ExportFile(inputPath, outputDir string, opts ExportOptions) (*ExportResult,
 				"analysis.json and workout_structure.json provide semantic block labels for LLM reasoning.",
 			},
 		},
-		Warnings: bundleWarnings,
+		LapFilter: lapFilter,
+		LapChunks: lapChunks,
+		Warnings:  bundleWarnings,
+	}
+	if opts.VerboseManifest {
+		layout := parsed.RawLayout
+		manifest.RawLayout = &layout
 	}
 
 	manifestPath := filepath.Join(outputDir, "manifest.json")
@@ -140,13 +213,14 @@ func ExportFile(inputPath, outputDir string, opts ExportOptions) (*ExportResult,
 		OutputDir:            outputDir,
 		ManifestPath:         manifestPath,
 		RecordsPath:          recordsPath,
+		LapChunkPaths:        lapChunkPaths,
 		AnalysisPath:         analysisPath,
 		WorkoutStructurePath: workoutStructurePath,
 		AnalysisError:        analysisError,
 		SourceCopyPath:       sourceCopyPath,
-		RecordCount:          len(parsed.Records),
-		DefinitionCount:      parsed.DefinitionCount,
-		DataMessageCount:     parsed.DataMessageCount,
+		RecordCount:          len(exported),
+		DefinitionCount:      definitionCount,
+		DataMessageCount:     dataMessageCount,
 		SourceSHA256:         sha,
 		SourceSizeBytes:      int64(len(data)),
 		FileCRCValid:         parsed.FileCRC.Valid,
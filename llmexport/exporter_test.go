@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/lucasjlepore/fit-analyzer/internal/fittest"
 	"github.com/tormoder/fit"
+	"github.com/tormoder/fit/dyncrc16"
 )
 
 func TestParseFITBytesParsesRecords(t *testing.T) {
@@ -42,6 +46,87 @@ func TestParseFITBytesParsesRecords(t *testing.T) {
 	}
 }
 
+func TestExportFileVerboseManifestIncludesRawLayout(t *testing.T) {
+	data := buildTestFIT(t)
+	// Corrupt the stored file CRC so stored and computed bytes differ.
+	data[len(data)-1] ^= 0xFF
+	tmp := t.TempDir()
+	inputPath := filepath.Join(tmp, "sample.fit")
+	if err := os.WriteFile(inputPath, data, 0o644); err != nil {
+		t.Fatalf("write sample fit: %v", err)
+	}
+	result, err := ExportFile(inputPath, filepath.Join(tmp, "export"), ExportOptions{Overwrite: true, VerboseManifest: true})
+	if err != nil {
+		t.Fatalf("ExportFile error: %v", err)
+	}
+	manifestData, err := os.ReadFile(result.ManifestPath)
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		t.Fatalf("unmarshal manifest: %v", err)
+	}
+	layout := manifest.RawLayout
+	if layout == nil {
+		t.Fatal("expected raw_layout in verbose manifest")
+	}
+	if layout.HeaderSize != 14 || layout.DataOffset != 14 || layout.HeaderHex != fmt.Sprintf("%x", data[:14]) {
+		t.Fatalf("unexpected header layout: %+v", layout)
+	}
+	if layout.DataSize != len(data)-16 || layout.FileCRC.Offset != len(data)-2 {
+		t.Fatalf("unexpected data/CRC offsets: %+v", layout)
+	}
+	if layout.HeaderCRC == nil || layout.HeaderCRC.Offset != 12 || layout.HeaderCRC.StoredBytesHex != layout.HeaderCRC.ComputedBytesHex {
+		t.Fatalf("expected matching header CRC bytes at offset 12, got %+v", layout.HeaderCRC)
+	}
+	if layout.FileCRC.StoredBytesHex != fmt.Sprintf("%x", data[len(data)-2:]) || layout.FileCRC.StoredBytesHex == layout.FileCRC.ComputedBytesHex {
+		t.Fatalf("expected corrupted stored file CRC to differ from computed, got %+v", layout.FileCRC)
+	}
+	crc := dyncrc16.Checksum(data[:len(data)-2])
+	if want := fmt.Sprintf("%02x%02x", byte(crc), byte(crc>>8)); layout.FileCRC.ComputedBytesHex != want {
+		t.Fatalf("computed file CRC bytes %q want %q", layout.FileCRC.ComputedBytesHex, want)
+	}
+}
+
+func TestMarshalJSONLIsDeterministicAndOrdered(t *testing.T) {
+	data := buildTestFIT(t)
+
+	render := func() ([]byte, []RecordEnvelope) {
+		bundle, err := ParseBytes(data)
+		if err != nil {
+			t.Fatalf("ParseBytes error: %v", err)
+		}
+		out, err := MarshalJSONL(bundle.Records)
+		if err != nil {
+			t.Fatalf("MarshalJSONL error: %v", err)
+		}
+		return out, bundle.Records
+	}
+
+	first, records := render()
+	second, _ := render()
+	if !bytes.Equal(first, second) {
+		t.Fatal("expected repeated parses to produce byte-identical records.jsonl")
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(first, []byte("\n")), []byte("\n"))
+	if len(lines) != len(records) {
+		t.Fatalf("expected %d jsonl lines, got %d", len(records), len(lines))
+	}
+	prev := -1
+	for i, line := range lines {
+		var env RecordEnvelope
+		if err := json.Unmarshal(line, &env); err != nil {
+			t.Fatalf("line %d: unmarshal: %v", i, err)
+		}
+		if env.RecordIndex <= prev {
+			t.Fatalf("line %d: record_index %d not strictly increasing after %d", i, env.RecordIndex, prev)
+		}
+		prev = env.RecordIndex
+	}
+}
+
 func TestExportFileWritesBundle(t *testing.T) {
 	data := buildTestFIT(t)
 
@@ -87,6 +172,16 @@ func TestExportFileWritesBundle(t *testing.T) {
 	if manifest.RecordCount != result.RecordCount {
 		t.Fatalf("manifest record count mismatch: %d != %d", manifest.RecordCount, result.RecordCount)
 	}
+	if manifest.RawLayout != nil {
+		t.Fatal("raw_layout should only be written with VerboseManifest")
+	}
+	countTotal := 0
+	for _, mc := range manifest.MessageCounts {
+		countTotal += mc.Count
+	}
+	if countTotal != manifest.DataMessageCount {
+		t.Fatalf("message counts total %d != data message count %d", countTotal, manifest.DataMessageCount)
+	}
 
 	recordsData, err := os.ReadFile(result.RecordsPath)
 	if err != nil {
@@ -118,43 +213,889 @@ func TestDecodeSingleValueFormatsNonFiniteFloats(t *testing.T) {
 	}
 }
 
+func TestHeartRateSamplesDecodesHRMessages(t *testing.T) {
+	const anchorRaw = uint32(1_100_000_000)
+	pack12 := func(values ...uint32) []int {
+		out := make([]int, (len(values)*12+7)/8)
+		for k, v := range values {
+			bit := k * 12
+			word := (v & 0xFFF) << (bit % 8)
+			out[bit/8] |= int(word & 0xFF)
+			out[bit/8+1] |= int((word >> 8) & 0xFF)
+		}
+		return out
+	}
+	records := []RecordEnvelope{
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: 132,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: 253, Decoded: anchorRaw},
+				{FieldNumber: 0, Decoded: uint16(0)},
+				{FieldNumber: 9, Decoded: []any{uint32(1024 * 100), uint32(1024 * 101)}},
+				{FieldNumber: 6, Decoded: []any{uint8(120), uint8(121)}},
+			}},
+		},
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: 132,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: 10, Decoded: pack12(1024*102, 1024*103)},
+				{FieldNumber: 6, Decoded: []any{uint8(122), uint8(0xFF)}, InvalidElements: []int{1}},
+			}},
+		},
+	}
+
+	samples := HeartRateSamples(records)
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 hr samples, got %d", len(samples))
+	}
+	anchor := fitTimestampToUTC(anchorRaw)
+	for i, want := range []float64{120, 121, 122} {
+		if samples[i].BPM != want {
+			t.Fatalf("sample %d bpm: got %v want %v", i, samples[i].BPM, want)
+		}
+		if got := samples[i].Timestamp.Sub(anchor); got != time.Duration(i)*time.Second {
+			t.Fatalf("sample %d offset: got %v want %ds", i, got, i)
+		}
+	}
+}
+
 func buildTestFIT(t *testing.T) []byte {
 	t.Helper()
 
-	header := fit.NewHeader(fit.V20, true)
-	file, err := fit.NewFile(fit.FileTypeActivity, header)
+	return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		start := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
+		event := fit.NewEventMsg()
+		event.Timestamp = start
+		event.Event = fit.EventTimer
+		event.EventType = fit.EventTypeStart
+		activity.Events = append(activity.Events, event)
+
+		stop := fit.NewEventMsg()
+		stop.Timestamp = start.Add(10 * time.Minute)
+		stop.Event = fit.EventTimer
+		stop.EventType = fit.EventTypeStop
+		activity.Events = append(activity.Events, stop)
+
+		record := fit.NewRecordMsg()
+		record.Timestamp = start.Add(30 * time.Second)
+		record.HeartRate = 135
+		record.Power = 245
+		record.Cadence = 92
+		activity.Records = append(activity.Records, record)
+
+	})
+}
+
+func TestDeveloperAppsJoinsFieldDescriptions(t *testing.T) {
+	appID := make([]int, 16)
+	for i := range appID {
+		appID[i] = i
+	}
+	records := []RecordEnvelope{
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: 207,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: 1, Decoded: appID},
+				{FieldNumber: 2, Decoded: uint16(fit.ManufacturerGarmin)},
+				{FieldNumber: 3, Decoded: uint8(0)},
+				{FieldNumber: 4, Decoded: uint32(42)},
+			}},
+		},
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: 206,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: 0, Decoded: uint8(0)},
+				{FieldNumber: 1, Decoded: uint8(2)},
+				{FieldNumber: 3, Decoded: "Wind Speed"},
+				{FieldNumber: 8, Decoded: "m/s"},
+			}},
+		},
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: 206,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: 0, Decoded: uint8(1)},
+				{FieldNumber: 1, Decoded: uint8(0)},
+				{FieldNumber: 3, Decoded: "FTP"},
+			}},
+		},
+	}
+
+	apps := DeveloperApps(records)
+	if len(apps) != 2 {
+		t.Fatalf("expected 2 developer apps, got %d", len(apps))
+	}
+	app := apps[0]
+	if app.ApplicationID != "00010203-0405-0607-0809-0a0b0c0d0e0f" {
+		t.Fatalf("unexpected application id %q", app.ApplicationID)
+	}
+	if app.Manufacturer != fit.ManufacturerGarmin.String() || app.ApplicationVersion != 42 {
+		t.Fatalf("unexpected app metadata: %+v", app)
+	}
+	if len(app.Fields) != 1 || app.Fields[0].Name != "Wind Speed" || app.Fields[0].Units != "m/s" {
+		t.Fatalf("unexpected app fields: %+v", app.Fields)
+	}
+	if apps[1].DeveloperDataIndex != 1 || apps[1].ApplicationID != "" || len(apps[1].Fields) != 1 {
+		t.Fatalf("expected orphan field description under index 1, got %+v", apps[1])
+	}
+}
+
+func TestDecodeDeveloperNumericReadsFirstArrayElement(t *testing.T) {
+	large := make([]int, 4096)
+	large[0], large[1] = 265&0xFF, 265>>8
+	for i := 2; i < len(large); i++ {
+		large[i] = 0xFF
+	}
+	if got := DecodeDeveloperNumeric(DeveloperFieldValue{DecodedByteValues: large}, 0x84); got != 265 {
+		t.Fatalf("expected first uint16 element 265, got %v", got)
+	}
+	if got := DecodeDeveloperNumeric(DeveloperFieldValue{DecodedByteValues: []int{0xFF, 0xFF}}, 0x84); got != 0 {
+		t.Fatalf("invalid uint16 sentinel should decode to 0, got %v", got)
+	}
+	if got := DecodeDeveloperNumeric(DeveloperFieldValue{DecodedByteValues: []int{0x09, 0x01, 0, 0}}, 0x8C); got != 265 {
+		t.Fatalf("expected uint32z 265, got %v", got)
+	}
+}
+
+func TestDecodeDeveloperNumericBaseTypesAndByteOrder(t *testing.T) {
+	le := func(b ...int) DeveloperFieldValue { return DeveloperFieldValue{DecodedByteValues: b} }
+	be := func(b ...int) DeveloperFieldValue { return DeveloperFieldValue{DecodedByteValues: b, BigEndian: true} }
+	for _, tc := range []struct {
+		name    string
+		field   DeveloperFieldValue
+		baseRaw int
+		want    float64
+	}{
+		{"uint8", le(90), 0x02, 90},
+		{"uint8 invalid", le(0xFF), 0x02, 0},
+		{"uint8z zero", le(0), 0x0A, 0},
+		{"sint8 negative", le(0xFB), 0x01, -5},
+		{"sint16 negative", le(0x06, 0xFF), 0x83, -250},
+		{"sint16 invalid", le(0xFF, 0x7F), 0x83, 0},
+		{"sint32 negative", le(0x18, 0xFC, 0xFF, 0xFF), 0x85, -1000},
+		{"uint16 big-endian", be(0x01, 0x09), 0x84, 265},
+		{"sint16 big-endian", be(0xFF, 0x06), 0x83, -250},
+		{"uint32 big-endian", be(0, 0, 0x01, 0x09), 0x86, 265},
+		{"uncompressed uint16 code", le(0x09, 0x01), 0x04, 265},
+		{"float32", le(0x00, 0x00, 0x7A, 0x43), 0x88, 250},
+		{"too short for uint16", le(0x09), 0x84, 0},
+		{"string is not numeric", le(0x41), 0x07, 0},
+		{"byte is not numeric", le(0x41), 0x0D, 0},
+	} {
+		if got := DecodeDeveloperNumeric(tc.field, tc.baseRaw); got != tc.want {
+			t.Errorf("%s: got %v want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseRecordsDeveloperFieldByteOrder(t *testing.T) {
+	// A big-endian record definition (global 20) with timestamp and one
+	// 2-byte developer field, followed by one data message.
+	data := []byte{0x60, 0, 1, 0, 20, 1,
+		253, 4, 0x86,
+		1,
+		0, 2, 0,
+	}
+	data = append(data, 0x00)
+	data = binary.BigEndian.AppendUint32(data, 1_000_000_000)
+	data = append(data, 0x01, 0x09)
+
+	out, err := parseFITBytes(fittest.RawFIT(data))
+	if err != nil {
+		t.Fatalf("parseFITBytes error: %v", err)
+	}
+	for _, rec := range out.Records {
+		if rec.RecordKind != "data" {
+			continue
+		}
+		if len(rec.Data.DeveloperFields) != 1 {
+			t.Fatalf("expected one developer field, got %+v", rec.Data.DeveloperFields)
+		}
+		d := rec.Data.DeveloperFields[0]
+		if !d.BigEndian {
+			t.Fatal("developer field should carry the big-endian definition architecture")
+		}
+		if got := DecodeDeveloperNumeric(d, 0x84); got != 265 {
+			t.Fatalf("expected big-endian uint16 265, got %v", got)
+		}
+		return
+	}
+	t.Fatal("no data record parsed")
+}
+
+func TestDecodeMessagesUsesSemanticNames(t *testing.T) {
+	bundle, err := ParseBytes(buildTestFIT(t))
+	if err != nil {
+		t.Fatalf("ParseBytes error: %v", err)
+	}
+	msgs := DecodeMessages(bundle.Records, 20)
+	if len(msgs) == 0 {
+		t.Fatal("expected record messages")
+	}
+	if len(msgs) != MessageCounts(bundle.Records)[20] {
+		t.Fatalf("expected one map per record message, got %d", len(msgs))
+	}
+	if _, ok := msgs[0]["timestamp"]; !ok {
+		t.Fatalf("expected semantic timestamp key, got %v", msgs[0])
+	}
+}
+
+func TestPedalPowerPhaseAveragesScaledAngles(t *testing.T) {
+	phase := func(start, end uint8) []any { return []any{start, end} }
+	records := []RecordEnvelope{
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: 20,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: leftPowerPhaseField, Decoded: phase(250, 128)},
+				{FieldNumber: rightPowerPhaseField, Decoded: phase(0, 64)},
+			}},
+		},
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: 20,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: leftPowerPhaseField, Decoded: phase(6, 128)},
+				{FieldNumber: rightPowerPhaseField, Decoded: phase(0xFF, 0xFF), Invalid: true, InvalidElements: []int{0, 1}},
+			}},
+		},
+		{RecordKind: "data", GlobalMessageNum: 20, Data: &DataRecord{}},
+	}
+
+	got := PedalPowerPhase(records)
+	if got == nil {
+		t.Fatal("expected pedal power phase")
+	}
+	if got.SampleCount != 2 {
+		t.Fatalf("expected 2 samples, got %d", got.SampleCount)
+	}
+	// 250 and 6 raw units straddle top dead centre (351.6 and 8.4 degrees).
+	if got.LeftStartDeg != 0 || got.LeftEndDeg != 180 {
+		t.Fatalf("unexpected left phase %.1f-%.1f", got.LeftStartDeg, got.LeftEndDeg)
+	}
+	if got.RightStartDeg != 0 || got.RightEndDeg != 90 {
+		t.Fatalf("unexpected right phase %.1f-%.1f", got.RightStartDeg, got.RightEndDeg)
+	}
+	if PedalPowerPhase(records[2:]) != nil {
+		t.Fatal("expected nil when no phase fields are present")
+	}
+}
+
+func TestCompressedTimestampsRollOver(t *testing.T) {
+	const anchorRaw = uint32(1_100_000_028) // 5-bit offset 28
+	var data []byte
+	// Local 0: record with timestamp and power; local 1: power only, sent with
+	// compressed timestamp headers.
+	data = append(data, 0x40, 0, 0, 20, 0, 2, 253, 4, 0x86, 7, 2, 0x84)
+	data = append(data, 0x41, 0, 0, 20, 0, 1, 7, 2, 0x84)
+	data = append(data, 0x00)
+	data = binary.LittleEndian.AppendUint32(data, anchorRaw)
+	data = binary.LittleEndian.AppendUint16(data, 200)
+	for _, offset := range []byte{30, 1, 3, 3} {
+		data = append(data, 0x80|1<<5|offset)
+		data = binary.LittleEndian.AppendUint16(data, 210)
+	}
+
+	out, err := parseFITBytes(fittest.RawFIT(data))
 	if err != nil {
-		t.Fatalf("new fit file: %v", err)
+		t.Fatalf("parseFITBytes error: %v", err)
+	}
+	var got []uint32
+	for _, rec := range out.Records {
+		if rec.RecordKind != "data" {
+			continue
+		}
+		if rec.Data.Flat == nil || rec.Data.Flat.TimestampUTC == "" {
+			t.Fatalf("record %d missing flat timestamp", rec.RecordIndex)
+		}
+		got = append(got, rec.Data.Flat.TimestampRaw)
+	}
+	want := []uint32{anchorRaw, anchorRaw + 2, anchorRaw + 5, anchorRaw + 7, anchorRaw + 7}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("record %d: timestamp %d want %d (offset %d)", i, got[i], want[i], int64(got[i])-int64(anchorRaw))
+		}
 	}
+	last := out.Records[len(out.Records)-1].Data.CompressedTimestamp
+	if last == nil || !last.HadReference || last.AbsoluteTimestampUTC != fitTimestampToUTC(anchorRaw+7).Format(time.RFC3339) {
+		t.Fatalf("unexpected compressed timestamp info: %+v", last)
+	}
+}
 
-	activity, err := file.Activity()
+func TestCompressedTimestampWithoutReference(t *testing.T) {
+	data := []byte{0x41, 0, 0, 20, 0, 1, 7, 2, 0x84, 0x80 | 1<<5 | 5, 200, 0}
+	out, err := parseFITBytes(fittest.RawFIT(data))
 	if err != nil {
-		t.Fatalf("activity accessor: %v", err)
+		t.Fatalf("parseFITBytes error: %v", err)
+	}
+	rec := out.Records[len(out.Records)-1]
+	if rec.Data.CompressedTimestamp.HadReference || rec.Data.Flat.TimestampUTC != "" {
+		t.Fatalf("expected no reconstructed timestamp: %+v", rec.Data.CompressedTimestamp)
 	}
+}
 
-	start := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
-	event := fit.NewEventMsg()
-	event.Timestamp = start
-	event.Event = fit.EventTimer
-	event.EventType = fit.EventTypeStart
-	activity.Events = append(activity.Events, event)
+func TestDeviceTimeInZonePrefersSessionMessage(t *testing.T) {
+	tiz := func(ref uint16, hr []any, power []any, powerBounds []any) RecordEnvelope {
+		var invalidBounds []int
+		for i, v := range powerBounds {
+			if v == uint16(0xFFFF) {
+				invalidBounds = append(invalidBounds, i)
+			}
+		}
+		return RecordEnvelope{
+			RecordKind:       "data",
+			GlobalMessageNum: 216,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: 0, Decoded: ref},
+				{FieldNumber: 2, Scaled: hr},
+				{FieldNumber: 5, Scaled: power, InvalidElements: []int{2}},
+				{FieldNumber: 9, Decoded: powerBounds, InvalidElements: invalidBounds},
+				{FieldNumber: 15, Decoded: uint16(250)},
+			}},
+		}
+	}
+	records := []RecordEnvelope{
+		tiz(19, []any{10.0, 20.0}, []any{5.0, 6.0, 0.0}, []any{uint16(140), uint16(190)}),
+		tiz(18, []any{100.0, 200.5}, []any{50.0, 60.0, 0.0}, []any{uint16(137), uint16(187), uint16(0xFFFF)}),
+	}
+	got := DeviceTimeInZone(records)
+	if got == nil {
+		t.Fatal("expected device time in zone")
+	}
+	if len(got.HRZoneSeconds) != 2 || got.HRZoneSeconds[1] != 200.5 {
+		t.Fatalf("unexpected hr zone seconds: %v", got.HRZoneSeconds)
+	}
+	if len(got.PowerZoneSeconds) != 3 || got.PowerZoneSeconds[0] != 50 || got.PowerZoneSeconds[2] != 0 {
+		t.Fatalf("unexpected power zone seconds: %v", got.PowerZoneSeconds)
+	}
+	if len(got.PowerZoneHighBoundariesW) != 2 || got.PowerZoneHighBoundariesW[0] != 137 {
+		t.Fatalf("unexpected power boundaries: %v", got.PowerZoneHighBoundariesW)
+	}
+	zones := DevicePowerZones(records)
+	if zones == nil || zones.FTPWatts != 250 || len(zones.HighBoundariesW) != 2 || zones.HighBoundariesW[1] != 187 {
+		t.Fatalf("unexpected device power zones: %+v", zones)
+	}
+	if DeviceTimeInZone(nil) != nil {
+		t.Fatal("expected nil without time_in_zone messages")
+	}
+}
 
-	stop := fit.NewEventMsg()
-	stop.Timestamp = start.Add(10 * time.Minute)
-	stop.Event = fit.EventTimer
-	stop.EventType = fit.EventTypeStop
-	activity.Events = append(activity.Events, stop)
+func TestDevicePowerZonesDecodesProfileFieldNumbers(t *testing.T) {
+	// time_in_zone with reference_mesg (0), speed_zone_high_boundary (7),
+	// power_zone_high_boundary (9), threshold_heart_rate (13) and
+	// functional_threshold_power (15); 7 and 13 must not be read as power
+	// zones or FTP.
+	data := []byte{0x40, 0, 0, 216, 0, 5,
+		0, 2, 0x84,
+		7, 4, 0x84,
+		9, 6, 0x84,
+		13, 1, 0x02,
+		15, 2, 0x84,
+	}
+	data = append(data, 0x00)
+	data = binary.LittleEndian.AppendUint16(data, 18)
+	for _, v := range []uint16{5000, 9000, 137, 187, 0xFFFF} {
+		data = binary.LittleEndian.AppendUint16(data, v)
+	}
+	data = append(data, 170)
+	data = binary.LittleEndian.AppendUint16(data, 250)
 
-	record := fit.NewRecordMsg()
-	record.Timestamp = start.Add(30 * time.Second)
-	record.HeartRate = 135
-	record.Power = 245
-	record.Cadence = 92
-	activity.Records = append(activity.Records, record)
+	out, err := parseFITBytes(fittest.RawFIT(data))
+	if err != nil {
+		t.Fatalf("parseFITBytes error: %v", err)
+	}
+	zones := DevicePowerZones(out.Records)
+	if zones == nil || zones.FTPWatts != 250 || len(zones.HighBoundariesW) != 2 || zones.HighBoundariesW[0] != 137 || zones.HighBoundariesW[1] != 187 {
+		t.Fatalf("expected FTP 250 W and boundaries [137 187], got %+v", zones)
+	}
+}
 
-	var buf bytes.Buffer
-	if err := fit.Encode(&buf, file, binary.LittleEndian); err != nil {
-		t.Fatalf("encode fit: %v", err)
+func TestWeatherPrefersCurrentReportAndAveragesPressure(t *testing.T) {
+	weather := func(report uint8, temp int8, wind float64) RecordEnvelope {
+		return RecordEnvelope{
+			RecordKind:       "data",
+			GlobalMessageNum: weatherConditionsMessageNum,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: weatherReportField, Decoded: report},
+				{FieldNumber: weatherTemperatureField, Decoded: temp},
+				{FieldNumber: weatherConditionField, Decoded: uint8(fit.WeatherStatusWindy)},
+				{FieldNumber: weatherWindDirField, Decoded: uint16(270)},
+				{FieldNumber: weatherWindSpeedField, Decoded: uint16(wind * 1000), Scaled: wind},
+				{FieldNumber: weatherHumidityField, Decoded: uint8(0xFF), Invalid: true},
+				{FieldNumber: weatherLocationField, Decoded: "Girona\x00"},
+			}},
+		}
+	}
+	records := []RecordEnvelope{
+		weather(1, 25, 2),
+		weather(0, 14, 7.5),
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: barometerDataMessageNum,
+			Data: &DataRecord{Fields: []FieldValue{
+				{FieldNumber: barometerPressureField, Decoded: []any{uint32(101000), uint32(101200), uint32(0xFFFFFFFF)}, InvalidElements: []int{2}},
+			}},
+		},
+	}
+	got := Weather(records)
+	if got == nil || got.TemperatureC == nil || *got.TemperatureC != 14 {
+		t.Fatalf("expected the current report's 14 C, got %+v", got)
+	}
+	if got.WindSpeedMps == nil || *got.WindSpeedMps != 7.5 || got.WindDirectionDeg == nil || *got.WindDirectionDeg != 270 {
+		t.Fatalf("unexpected wind: %+v", got)
+	}
+	if got.RelativeHumidityPct != nil || got.Location != "Girona" || got.Condition != fmt.Sprint(fit.WeatherStatusWindy) {
+		t.Fatalf("unexpected humidity/location/condition: %+v", got)
+	}
+	if got.BarometricPressureHPa == nil || *got.BarometricPressureHPa != 1011 {
+		t.Fatalf("expected mean pressure 1011 hPa, got %v", got.BarometricPressureHPa)
+	}
+	if Weather(nil) != nil {
+		t.Fatal("expected nil without weather or barometer messages")
+	}
+}
+
+func TestSentinelHelpers(t *testing.T) {
+	if !IsInvalidUint8(0xFF) || IsInvalidUint8(0) || !IsInvalidUint16(0xFFFF) || IsInvalidUint16(0xFFFE) {
+		t.Fatal("unexpected unsigned sentinel checks")
+	}
+	if !IsInvalidUint32(0xFFFFFFFF) || IsInvalidUint32(0) {
+		t.Fatal("unexpected uint32 sentinel check")
+	}
+	if !IsInvalidSint8(0x7F) || IsInvalidSint8(-1) || !IsInvalidSint16(0x7FFF) || IsInvalidSint16(-1) || !IsInvalidSint32(0x7FFFFFFF) {
+		t.Fatal("unexpected signed sentinel checks")
+	}
+	if got := FitTimeToUTC(0); !got.Equal(time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected fit epoch: %v", got)
+	}
+	if got := FitTimeToUTC(1_000_000_000).Format(time.RFC3339); got != "2021-09-08T01:46:40Z" {
+		t.Fatalf("unexpected converted timestamp: %s", got)
+	}
+	for _, tc := range []struct {
+		raw     []byte
+		bt      baseType
+		invalid bool
+	}{
+		{[]byte{0xFF}, baseUint8, true},
+		{[]byte{0x7F}, baseSint8, true},
+		{[]byte{0xFF}, baseSint8, false},
+		{[]byte{0xFF, 0xFF}, baseUint16, true},
+		{[]byte{0xFF, 0x7F}, baseSint16, true},
+		{[]byte{0xFF, 0xFF}, baseSint16, false},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF}, baseUint32, true},
+		{[]byte{0xFF, 0xFF, 0xFF, 0x7F}, baseSint32, true},
+	} {
+		if _, invalid := decodeSingleValue(tc.raw, tc.bt, binary.LittleEndian); invalid != tc.invalid {
+			t.Fatalf("decodeSingleValue(%x, %v): invalid %v want %v", tc.raw, tc.bt, invalid, tc.invalid)
+		}
+	}
+}
+
+func TestFilterRecordsByLapsKeepsWindowAndDefinitions(t *testing.T) {
+	def := func(local uint8, global uint16) RecordEnvelope {
+		return RecordEnvelope{RecordKind: "definition", LocalMessageType: local, GlobalMessageNum: global}
+	}
+	data := func(local uint8, global uint16, fields ...FieldValue) RecordEnvelope {
+		return RecordEnvelope{RecordKind: "data", LocalMessageType: local, GlobalMessageNum: global, Data: &DataRecord{Fields: fields}}
+	}
+	ts := func(raw uint32) FieldValue { return FieldValue{FieldNumber: 253, Decoded: raw} }
+	lap := func(start, end uint32) RecordEnvelope {
+		return data(2, 19, FieldValue{FieldNumber: 2, Decoded: start}, ts(end))
+	}
+	records := []RecordEnvelope{
+		def(0, 0), data(0, 0, FieldValue{FieldNumber: 0, Decoded: uint8(4)}),
+		def(1, 20), data(1, 20, ts(100)), data(1, 20, ts(150)), data(1, 20, ts(210)),
+		def(3, 21), data(3, 21, ts(100)),
+		def(2, 19), lap(100, 199), lap(200, 299),
+	}
+
+	got, filter, err := FilterRecordsByLaps(records, [2]int{2, 2})
+	if err != nil {
+		t.Fatalf("FilterRecordsByLaps error: %v", err)
+	}
+	var kinds []string
+	for _, r := range got {
+		kinds = append(kinds, fmt.Sprintf("%s/%d", r.RecordKind, r.GlobalMessageNum))
+	}
+	want := "definition/0 data/0 definition/20 data/20 definition/19 data/19"
+	if strings.Join(kinds, " ") != want {
+		t.Fatalf("unexpected kept records: %v", kinds)
+	}
+	if filter == nil || filter.FirstLap != 2 || filter.SourceRecordCount != len(records) || filter.StartTimeUTC != FitTimeToUTC(200).Format(time.RFC3339) {
+		t.Fatalf("unexpected filter: %+v", filter)
+	}
+
+	if all, filter, err := FilterRecordsByLaps(records, [2]int{}); err != nil || filter != nil || len(all) != len(records) {
+		t.Fatalf("zero range should export everything: %d %+v %v", len(all), filter, err)
+	}
+	if _, _, err := FilterRecordsByLaps(records, [2]int{1, 3}); err == nil {
+		t.Fatal("expected error for lap range beyond file")
+	}
+}
+
+func TestExportFileLapRangeCountsFilteredRecords(t *testing.T) {
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		start := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
+		for i := 0; i < 20; i++ {
+			record := fit.NewRecordMsg()
+			record.Timestamp = start.Add(time.Duration(i) * time.Second)
+			record.Power = 200
+			activity.Records = append(activity.Records, record)
+		}
+		for i := 0; i < 2; i++ {
+			lap := fit.NewLapMsg()
+			lap.StartTime = start.Add(time.Duration(i*10) * time.Second)
+			lap.Timestamp = lap.StartTime.Add(9 * time.Second)
+			activity.Laps = append(activity.Laps, lap)
+		}
+	})
+	tmp := t.TempDir()
+	inputPath := filepath.Join(tmp, "laps.fit")
+	if err := os.WriteFile(inputPath, data, 0o644); err != nil {
+		t.Fatalf("write sample fit: %v", err)
+	}
+
+	result, err := ExportFile(inputPath, filepath.Join(tmp, "export"), ExportOptions{Overwrite: true, LapRange: [2]int{2, 2}})
+	if err != nil {
+		t.Fatalf("ExportFile error: %v", err)
+	}
+	manifestData, err := os.ReadFile(result.ManifestPath)
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		t.Fatalf("unmarshal manifest: %v", err)
+	}
+	if manifest.LapFilter == nil || manifest.RecordCount >= manifest.LapFilter.SourceRecordCount {
+		t.Fatalf("expected a narrowed export, got %d records and filter %+v", manifest.RecordCount, manifest.LapFilter)
+	}
+	if manifest.DefinitionCount+manifest.DataMessageCount != manifest.RecordCount {
+		t.Fatalf("counts %d+%d should add up to the %d exported records", manifest.DefinitionCount, manifest.DataMessageCount, manifest.RecordCount)
+	}
+	records := 0
+	for _, mc := range manifest.MessageCounts {
+		if mc.GlobalMessageNum == 20 {
+			records = mc.Count
+		}
+	}
+	if records != 10 {
+		t.Fatalf("expected the 10 records of lap 2, got %d", records)
+	}
+	if result.DataMessageCount != manifest.DataMessageCount {
+		t.Fatalf("result data message count %d != manifest %d", result.DataMessageCount, manifest.DataMessageCount)
+	}
+}
+
+func TestSplitRecordsByLapRepeatsDefinitions(t *testing.T) {
+	def := func(local uint8, global uint16) RecordEnvelope {
+		return RecordEnvelope{RecordKind: "definition", LocalMessageType: local, GlobalMessageNum: global}
+	}
+	data := func(local uint8, global uint16, fields ...FieldValue) RecordEnvelope {
+		return RecordEnvelope{RecordKind: "data", LocalMessageType: local, GlobalMessageNum: global, Data: &DataRecord{Fields: fields}}
+	}
+	ts := func(raw uint32) FieldValue { return FieldValue{FieldNumber: 253, Decoded: raw} }
+	lap := func(start, end uint32) RecordEnvelope {
+		return data(2, 19, FieldValue{FieldNumber: 2, Decoded: start}, ts(end))
+	}
+	records := []RecordEnvelope{
+		def(0, 0), data(0, 0, FieldValue{FieldNumber: 0, Decoded: uint8(4)}),
+		def(1, 20), data(1, 20, ts(100)), data(1, 20, ts(150)), data(1, 20, ts(210)), data(1, 20, ts(250)),
+		def(2, 19), lap(100, 199), lap(200, 299),
+	}
+
+	chunks, filters, err := SplitRecordsByLap(records, [2]int{})
+	if err != nil {
+		t.Fatalf("SplitRecordsByLap error: %v", err)
+	}
+	if len(chunks) != 2 || filters[0].FirstLap != 1 || filters[1].FirstLap != 2 {
+		t.Fatalf("unexpected chunks: %d %+v", len(chunks), filters)
+	}
+	for i, chunk := range chunks {
+		var kinds []string
+		for _, r := range chunk {
+			kinds = append(kinds, fmt.Sprintf("%s/%d", r.RecordKind, r.GlobalMessageNum))
+		}
+		want := "definition/0 data/0 definition/20 data/20 data/20 definition/19 data/19"
+		if strings.Join(kinds, " ") != want {
+			t.Fatalf("chunk %d: unexpected records %v", i+1, kinds)
+		}
+	}
+
+	if chunks, _, err := SplitRecordsByLap(records, [2]int{2, 2}); err != nil || len(chunks) != 1 {
+		t.Fatalf("expected one chunk within lap range: %d %v", len(chunks), err)
+	}
+	if _, _, err := SplitRecordsByLap(records[:7], [2]int{}); err == nil {
+		t.Fatal("expected error without lap messages")
+	}
+	for _, bad := range [][2]int{{3, 1}, {0, 2}, {-1, 1}, {1, 3}, {2, 1}} {
+		if chunks, filters, err := SplitRecordsByLap(records, bad); err == nil || chunks != nil || filters != nil {
+			t.Fatalf("lap range %v: expected an error, got %d chunks, err %v", bad, len(chunks), err)
+		}
+	}
+
+	// Each chunk matches the single-lap filter, including a definition that
+	// is redefined between laps and a boundary sample shared by both laps.
+	records = []RecordEnvelope{
+		def(0, 0), data(0, 0, FieldValue{FieldNumber: 0, Decoded: uint8(4)}),
+		def(1, 20), data(1, 20, ts(100)), data(1, 20, ts(200)),
+		def(1, 20), data(1, 20, ts(250)),
+		def(2, 19), lap(100, 200), lap(200, 299),
+	}
+	chunks, _, err = SplitRecordsByLap(records, [2]int{})
+	if err != nil {
+		t.Fatalf("SplitRecordsByLap error: %v", err)
+	}
+	for lapNum := 1; lapNum <= 2; lapNum++ {
+		want, _, err := FilterRecordsByLaps(records, [2]int{lapNum, lapNum})
+		if err != nil {
+			t.Fatalf("FilterRecordsByLaps error: %v", err)
+		}
+		if !reflect.DeepEqual(chunks[lapNum-1], want) {
+			t.Fatalf("lap %d chunk differs from FilterRecordsByLaps:\n got %+v\nwant %+v", lapNum, chunks[lapNum-1], want)
+		}
+	}
+}
+
+func TestMonitoringHeartRateSamplesResolveTimestamp16(t *testing.T) {
+	mon := func(fields ...FieldValue) RecordEnvelope {
+		return RecordEnvelope{RecordKind: "data", GlobalMessageNum: 55, Data: &DataRecord{Fields: fields}}
+	}
+	base := uint32(0x0001FFF0)
+	records := []RecordEnvelope{
+		mon(FieldValue{FieldNumber: 253, Decoded: base}, FieldValue{FieldNumber: 1, Decoded: uint16(900)}),
+		mon(FieldValue{FieldNumber: 26, Decoded: uint16(0xFFFC)}, FieldValue{FieldNumber: 27, Decoded: uint8(61)}),
+		mon(FieldValue{FieldNumber: 26, Decoded: uint16(0x0010)}, FieldValue{FieldNumber: 27, Decoded: uint8(58)}),
+		mon(FieldValue{FieldNumber: 26, Decoded: uint16(0x0020)}, FieldValue{FieldNumber: 27, Decoded: uint8(0xFF), Invalid: true}),
+		{RecordKind: "data", GlobalMessageNum: 211, Data: &DataRecord{Fields: []FieldValue{{FieldNumber: 0, Decoded: uint8(52)}}}},
+	}
+	got := MonitoringHeartRateSamples(records)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(got))
+	}
+	if !got[0].Timestamp.Equal(FitTimeToUTC(base+0xC)) || got[0].BPM != 61 {
+		t.Fatalf("unexpected first sample: %+v", got[0])
+	}
+	if !got[1].Timestamp.Equal(FitTimeToUTC(0x00020010)) || got[1].BPM != 58 {
+		t.Fatalf("timestamp_16 rollover not resolved: %+v", got[1])
+	}
+	if resting := MonitoringRestingHeartRate(records); resting != 52 {
+		t.Fatalf("unexpected resting heart rate: %v", resting)
+	}
+}
+
+func TestEventsDecodeDataPayloads(t *testing.T) {
+	event := func(code, kind uint8, fields ...FieldValue) RecordEnvelope {
+		fields = append([]FieldValue{
+			{FieldNumber: 253, Decoded: uint32(1000)},
+			{FieldNumber: 0, Decoded: code},
+			{FieldNumber: 1, Decoded: kind},
+		}, fields...)
+		return RecordEnvelope{RecordKind: "data", GlobalMessageNum: 21, Data: &DataRecord{Fields: fields}}
+	}
+	records := []RecordEnvelope{
+		event(0, 0, FieldValue{FieldNumber: 3, Decoded: uint32(1)}),
+		event(13, 0, FieldValue{FieldNumber: 3, Decoded: uint32(170)}),
+		event(43, 3, FieldValue{FieldNumber: 3, Decoded: uint32(0x34021C05)}),
+		event(14, 0, FieldValue{FieldNumber: 2, Decoded: uint16(95)}),
+		event(9, 4),
+	}
+	got := Events(records)
+	want := []string{
+		"timer start (auto)",
+		"hr_high_alert start @170bpm",
+		"rear_gear_change marker front 2 (52T) / rear 5 (28T)",
+		"hr_low_alert start @95bpm",
+		"lap stop_all",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(got))
+	}
+	for i, w := range want {
+		if got[i].Description != w {
+			t.Fatalf("event %d: got %q, want %q", i, got[i].Description, w)
+		}
+	}
+	if got[1].Value == nil || *got[1].Value != 170 || got[1].Units != "bpm" {
+		t.Fatalf("unexpected hr alert payload: %+v", got[1])
+	}
+	if got[0].TimestampUTC != FitTimeToUTC(1000).Format("2006-01-02T15:04:05Z") {
+		t.Fatalf("unexpected timestamp: %s", got[0].TimestampUTC)
+	}
+}
+
+func TestExportFilePrettyRecordsWritesJSONArray(t *testing.T) {
+	tmp := t.TempDir()
+	inputPath := filepath.Join(tmp, "sample.fit")
+	if err := os.WriteFile(inputPath, buildTestFIT(t), 0o644); err != nil {
+		t.Fatalf("write sample fit: %v", err)
+	}
+
+	result, err := ExportFile(inputPath, filepath.Join(tmp, "export"), ExportOptions{Overwrite: true, PrettyRecords: true})
+	if err != nil {
+		t.Fatalf("ExportFile error: %v", err)
+	}
+	if filepath.Base(result.RecordsPath) != "records.json" {
+		t.Fatalf("unexpected records path: %s", result.RecordsPath)
+	}
+	raw, err := os.ReadFile(result.RecordsPath)
+	if err != nil {
+		t.Fatalf("read records: %v", err)
+	}
+	var records []RecordEnvelope
+	if err := json.Unmarshal(raw, &records); err != nil {
+		t.Fatalf("records.json is not a JSON array: %v", err)
+	}
+	if len(records) != result.RecordCount || !strings.Contains(string(raw), "\n  {") {
+		t.Fatalf("expected %d indented records, got %d", result.RecordCount, len(records))
+	}
+}
+
+func TestParseFITBytesRecoversInconsistentDataSize(t *testing.T) {
+	data := buildTestFIT(t)
+	actual := binary.LittleEndian.Uint32(data[4:8])
+	want, err := parseFITBytes(data)
+	if err != nil {
+		t.Fatalf("parse original: %v", err)
+	}
+
+	// withDataSize rewrites the declared size and re-signs the header and file
+	// CRCs, as a device with a buggy header writer would.
+	withDataSize := func(declared uint32, padding int) []byte {
+		out := append([]byte(nil), data[:len(data)-2]...)
+		binary.LittleEndian.PutUint32(out[4:8], declared)
+		binary.LittleEndian.PutUint16(out[12:14], dyncrc16.Checksum(out[:12]))
+		out = binary.LittleEndian.AppendUint16(out, dyncrc16.Checksum(out))
+		return append(out, make([]byte, padding)...)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		declared uint32
+		padding  int
+		leftover int64
+	}{
+		{name: "overstated", declared: actual + 64},
+		{name: "understated", declared: actual - 7},
+		{name: "padded", declared: actual + 5, padding: 32, leftover: 32},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bundle, err := ParseBytes(withDataSize(tc.declared, tc.padding))
+			if err != nil {
+				t.Fatalf("ParseBytes error: %v", err)
+			}
+			if bundle.Header.DataSize != tc.declared || bundle.Header.DataSizeUsed != actual {
+				t.Fatalf("unexpected data sizes: declared %d used %d", bundle.Header.DataSize, bundle.Header.DataSizeUsed)
+			}
+			if !bundle.FileCRC.Valid || len(bundle.Records) != len(want.Records) || bundle.LeftoverBytesCount != tc.leftover {
+				t.Fatalf("not recovered: crc=%t records=%d leftover=%d", bundle.FileCRC.Valid, len(bundle.Records), bundle.LeftoverBytesCount)
+			}
+			warnings := strings.Join(BuildWarningsFromBundle(bundle), "; ")
+			if !strings.Contains(warnings, "header data_size") {
+				t.Fatalf("expected data size warning, got %q", warnings)
+			}
+		})
+	}
+
+	if bundle, err := ParseBytes(data); err != nil || bundle.Header.DataSizeUsed != actual {
+		t.Fatalf("consistent header changed: %v", err)
+	}
+}
+
+func TestParseFITBytesKeepsDeclaredSizeOnCorruptedCRC(t *testing.T) {
+	// Twenty timestamp+power records. Record 9's power is chosen so the CRC of
+	// everything before record 10 ends in the 0x00 record header byte, and
+	// record 10's timestamp starts with the CRC's other byte: a chance CRC
+	// match at a record boundary, as long rides produce by accident.
+	const records, boundary = 20, 10
+	record := func(ts uint32, power uint16) []byte {
+		out := binary.LittleEndian.AppendUint32([]byte{0x00}, ts)
+		return binary.LittleEndian.AppendUint16(out, power)
+	}
+	build := func(power9 uint16, ts10 uint32) []byte {
+		section := []byte{0x40, 0, 0, 20, 0, 2, 253, 4, 0x86, 7, 2, 0x84}
+		for i := 0; i < records; i++ {
+			ts, power := uint32(1_100_000_000+i), uint16(200)
+			if i == boundary-1 {
+				power = power9
+			}
+			if i == boundary {
+				ts = ts10
+			}
+			section = append(section, record(ts, power)...)
+		}
+		return fittest.RawFIT(section)
+	}
+	end := 14 + 12 + boundary*7
+	var data []byte
+	for p := 0; p <= 0xFFFF && data == nil; p++ {
+		candidate := build(uint16(p), 1_100_000_000+boundary)
+		if crc := dyncrc16.Checksum(candidate[:end]); crc&0xFF == 0 {
+			data = build(uint16(p), 1_100_000_000&^0xFF|uint32(crc>>8))
+		}
+	}
+	if data == nil {
+		t.Fatal("no chance CRC match found")
+	}
+	if binary.LittleEndian.Uint16(data[end:end+2]) != dyncrc16.Checksum(data[:end]) {
+		t.Fatal("fixture does not contain a chance CRC match")
+	}
+	actual := binary.LittleEndian.Uint32(data[4:8])
+	want, err := parseFITBytes(data)
+	if err != nil {
+		t.Fatalf("parse original: %v", err)
+	}
+	for name, corrupt := range map[string]func([]byte){
+		"payload":    func(b []byte) { b[len(b)-3] ^= 0x5A },
+		"stored crc": func(b []byte) { b[len(b)-1] ^= 0xFF },
+	} {
+		t.Run(name, func(t *testing.T) {
+			out := append([]byte(nil), data...)
+			corrupt(out)
+			bundle, err := ParseBytes(out)
+			if err != nil {
+				t.Fatalf("ParseBytes error: %v", err)
+			}
+			if bundle.Header.DataSizeUsed != actual || bundle.FileCRC.Valid || len(bundle.Records) != len(want.Records) {
+				t.Fatalf("expected the full declared size with an invalid CRC, got size %d crc %t records %d", bundle.Header.DataSizeUsed, bundle.FileCRC.Valid, len(bundle.Records))
+			}
+			warnings := strings.Join(BuildWarningsFromBundle(bundle), "; ")
+			if !strings.Contains(warnings, "file CRC mismatch") || strings.Contains(warnings, "header data_size") {
+				t.Fatalf("expected only a CRC mismatch warning, got %q", warnings)
+			}
+		})
+	}
+}
+
+func TestSortRecordFieldsOrdersByNumberWithoutMutatingInput(t *testing.T) {
+	records := []RecordEnvelope{{
+		RecordKind: "data",
+		Data: &DataRecord{Fields: []FieldValue{
+			{FieldIndex: 0, FieldNumber: 253},
+			{FieldIndex: 1, FieldNumber: 7},
+			{FieldIndex: 2, FieldNumber: 3},
+		}},
+	}, {RecordKind: "definition"}}
+
+	sorted := SortRecordFields(records)
+	var got []uint8
+	for _, f := range sorted[0].Data.Fields {
+		got = append(got, f.FieldNumber)
+	}
+	if len(got) != 3 || got[0] != 3 || got[1] != 7 || got[2] != 253 {
+		t.Fatalf("expected fields 3,7,253, got %v", got)
+	}
+	if sorted[0].Data.Fields[0].FieldIndex != 2 {
+		t.Fatalf("field_index should keep the encoded position, got %d", sorted[0].Data.Fields[0].FieldIndex)
+	}
+	if records[0].Data.Fields[0].FieldNumber != 253 {
+		t.Fatal("input records should keep encounter order")
 	}
-	return buf.Bytes()
 }
@@ -0,0 +1,24 @@
+package llmexport
+
+import "sort"
+
+// SortRecordFields returns a copy of records whose data records list Fields by
+// ascending field number. Records are copied rather than sorted in place, so
+// the parsed bundle keeps encounter order; FieldIndex still records each
+// field's encoded position.
+func SortRecordFields(records []RecordEnvelope) []RecordEnvelope {
+	out := make([]RecordEnvelope, len(records))
+	for i, rec := range records {
+		out[i] = rec
+		if rec.Data == nil || len(rec.Data.Fields) < 2 {
+			continue
+		}
+		data := *rec.Data
+		data.Fields = append([]FieldValue(nil), rec.Data.Fields...)
+		sort.SliceStable(data.Fields, func(a, b int) bool {
+			return data.Fields[a].FieldNumber < data.Fields[b].FieldNumber
+		})
+		out[i].Data = &data
+	}
+	return out
+}
@@ -0,0 +1,158 @@
+package llmexport
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+)
+
+const (
+	hrMessageNum            = 132
+	hrEventTimestampScale   = 1024.0
+	hrFractionalTimeScale   = 32768.0
+	hrEventTimestamp12Mask  = 0xFFF
+	hrEventTimestamp12Width = 12
+)
+
+// HeartRateSamples recovers beat-filtered heart rate from hr messages (global 132).
+// Wrist-HR devices often omit heart_rate from record messages and instead batch
+// readings into hr messages whose event timestamps are relative to the most recent
+// hr message carrying an absolute timestamp. Both the uint32 event_timestamp array
+// and the packed event_timestamp_12 encoding are decoded. Output is sorted by time.
+func HeartRateSamples(records []RecordEnvelope) []analyzer.HeartRateSample {
+	var (
+		out         []analyzer.HeartRateSample
+		anchor      time.Time
+		anchorEvent uint32
+		haveAnchor  bool
+		eventAcc    uint32
+	)
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.GlobalMessageNum != hrMessageNum || rec.Data == nil {
+			continue
+		}
+		fields := make(map[uint8]FieldValue, len(rec.Data.Fields))
+		for _, f := range rec.Data.Fields {
+			fields[f.FieldNumber] = f
+		}
+
+		bpms := hrBPMValues(fields[6])
+		events := hrEventTimestamps(fields, &eventAcc, len(bpms))
+		if len(events) == 0 {
+			continue
+		}
+
+		if ts, ok := fields[253]; ok && !ts.Invalid {
+			if raw, ok := asTimestampRaw(ts.Decoded); ok {
+				anchor = fitTimestampToUTC(raw)
+				if frac, ok := fields[0]; ok && !frac.Invalid {
+					if v, ok := frac.Decoded.(uint16); ok {
+						anchor = anchor.Add(time.Duration(float64(v) / hrFractionalTimeScale * float64(time.Second)))
+					}
+				}
+				anchorEvent = events[0]
+				haveAnchor = true
+			}
+		}
+		if !haveAnchor {
+			continue
+		}
+
+		for i, ev := range events {
+			if i >= len(bpms) {
+				break
+			}
+			if bpms[i] <= 0 {
+				continue
+			}
+			offset := float64(int32(ev-anchorEvent)) / hrEventTimestampScale
+			out = append(out, analyzer.HeartRateSample{
+				Timestamp: anchor.Add(time.Duration(offset * float64(time.Second))),
+				BPM:       float64(bpms[i]),
+			})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Timestamp.Before(out[j].Timestamp)
+	})
+	return out
+}
+
+// hrBPMValues returns filtered_bpm values with invalid entries reported as -1.
+func hrBPMValues(f FieldValue) []int {
+	invalid := make(map[int]struct{}, len(f.InvalidElements))
+	for _, idx := range f.InvalidElements {
+		invalid[idx] = struct{}{}
+	}
+	var raw []any
+	switch x := f.Decoded.(type) {
+	case []any:
+		raw = x
+	case nil:
+		return nil
+	default:
+		raw = []any{x}
+	}
+	out := make([]int, 0, len(raw))
+	for i, v := range raw {
+		bpm, ok := v.(uint8)
+		if _, bad := invalid[i]; bad || !ok || bpm == 0 {
+			out = append(out, -1)
+			continue
+		}
+		out = append(out, int(bpm))
+	}
+	return out
+}
+
+// hrEventTimestamps returns raw event timestamps (1/1024 s ticks). The accumulator
+// carries the full 32-bit value across messages so event_timestamp_12 deltas can
+// be expanded, mirroring the FIT SDK component accumulation rules.
+func hrEventTimestamps(fields map[uint8]FieldValue, acc *uint32, want int) []uint32 {
+	if f, ok := fields[9]; ok && !f.Invalid {
+		var raw []any
+		switch x := f.Decoded.(type) {
+		case []any:
+			raw = x
+		default:
+			raw = []any{x}
+		}
+		out := make([]uint32, 0, len(raw))
+		for _, v := range raw {
+			ts, ok := v.(uint32)
+			if !ok || IsInvalidUint32(ts) {
+				continue
+			}
+			*acc = ts
+			out = append(out, ts)
+		}
+		return out
+	}
+
+	f, ok := fields[10]
+	if !ok || f.Invalid {
+		return nil
+	}
+	packed, ok := f.Decoded.([]int)
+	if !ok {
+		return nil
+	}
+	count := len(packed) * 8 / hrEventTimestamp12Width
+	if want > 0 && want < count {
+		count = want
+	}
+	out := make([]uint32, 0, count)
+	for k := 0; k < count; k++ {
+		bit := k * hrEventTimestamp12Width
+		idx := bit / 8
+		if idx+1 >= len(packed) {
+			break
+		}
+		word := uint32(packed[idx]) | uint32(packed[idx+1])<<8
+		v := (word >> (bit % 8)) & hrEventTimestamp12Mask
+		*acc += (v - *acc) & hrEventTimestamp12Mask
+		out = append(out, *acc)
+	}
+	return out
+}
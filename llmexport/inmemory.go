@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/tormoder/fit"
@@ -23,6 +24,7 @@ type ParsedBundle struct {
 	LeftoverBytesCount int64
 	SourceSHA256       string
 	SourceSizeBytes    int64
+	RawLayout          RawLayout
 }
 
 // ParseBytes parses raw FIT bytes into the same record model used by JSONL export.
@@ -42,6 +44,7 @@ func ParseBytes(data []byte) (*ParsedBundle, error) {
 		LeftoverBytesCount: parsed.LeftoverBytesCount,
 		SourceSHA256:       hex.EncodeToString(sum[:]),
 		SourceSizeBytes:    int64(len(data)),
+		RawLayout:          parsed.RawLayout,
 	}, nil
 }
 
@@ -90,6 +93,71 @@ func MarshalJSONL(records []RecordEnvelope) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// DecodeMessages returns one field map per data message with the given global
+// message number, in file order. Keys are semantic field names from
+// semantics.go (or "field_<n>" when unmapped); values are scaled when a scaler
+// exists and decoded otherwise. Invalid fields are omitted.
+func DecodeMessages(records []RecordEnvelope, global uint16) []map[string]any {
+	var out []map[string]any
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.GlobalMessageNum != global || rec.Data == nil {
+			continue
+		}
+		msg := make(map[string]any, len(rec.Data.Fields))
+		for _, f := range rec.Data.Fields {
+			if f.Invalid {
+				continue
+			}
+			name := f.FieldName
+			if name == "" {
+				name = fmt.Sprintf("field_%d", f.FieldNumber)
+			}
+			if f.Scaled != nil {
+				msg[name] = f.Scaled
+			} else {
+				msg[name] = f.Decoded
+			}
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// MessageCounts returns data-message counts keyed by global message number.
+func MessageCounts(records []RecordEnvelope) map[uint16]int {
+	counts := make(map[uint16]int)
+	for _, rec := range records {
+		if rec.RecordKind != "data" {
+			continue
+		}
+		counts[rec.GlobalMessageNum]++
+	}
+	return counts
+}
+
+// MessageCountList renders MessageCounts as a readable list ordered by global message number.
+func MessageCountList(records []RecordEnvelope) []MessageCount {
+	return NamedMessageCounts(MessageCounts(records))
+}
+
+// NamedMessageCounts renders counts keyed by global message number (as from
+// MessageCounts) as a readable list ordered by global message number, for
+// callers that tally data messages in a pass they already make.
+func NamedMessageCounts(counts map[uint16]int) []MessageCount {
+	out := make([]MessageCount, 0, len(counts))
+	for global, count := range counts {
+		out = append(out, MessageCount{
+			GlobalMessageNum:  global,
+			GlobalMessageName: globalMessageName(global),
+			Count:             count,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].GlobalMessageNum < out[j].GlobalMessageNum
+	})
+	return out
+}
+
 // BuildWarningsFromBundle returns deterministic parse-quality warning notes.
 func BuildWarningsFromBundle(bundle *ParsedBundle) []string {
 	if bundle == nil {
@@ -102,6 +170,9 @@ func BuildWarningsFromBundle(bundle *ParsedBundle) []string {
 	if bundle.FileCRC.Present && !bundle.FileCRC.Valid {
 		warnings = append(warnings, "file CRC mismatch")
 	}
+	if bundle.Header.DataSizeUsed != bundle.Header.DataSize {
+		warnings = append(warnings, fmt.Sprintf("header data_size %d inconsistent with file; parsed %d data bytes", bundle.Header.DataSize, bundle.Header.DataSizeUsed))
+	}
 	if bundle.LeftoverBytesCount > 0 {
 		warnings = append(warnings, fmt.Sprintf("leftover trailing bytes detected: %d", bundle.LeftoverBytesCount))
 	}
@@ -0,0 +1,224 @@
+package llmexport
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Lap (global 19) timing fields bounding a lap's window.
+const (
+	lapStartTimeField = 2
+	lapTimestampField = 253
+)
+
+// LapFilter records the lap range applied to records.jsonl.
+type LapFilter struct {
+	FirstLap          int    `json:"first_lap"`
+	LastLap           int    `json:"last_lap"`
+	StartTimeUTC      string `json:"start_time_utc"`
+	EndTimeUTC        string `json:"end_time_utc"`
+	SourceRecordCount int    `json:"source_record_count"`
+}
+
+// FilterRecordsByLaps keeps the data messages timestamped inside the window
+// spanned by laps first..last (1-based, inclusive, in file order), plus
+// untimed data messages such as file_id and field_description that are
+// needed to interpret them. Definition messages are kept only when a retained
+// data message uses them. A zero range returns records unchanged and a nil
+// filter.
+func FilterRecordsByLaps(records []RecordEnvelope, lapRange [2]int) ([]RecordEnvelope, *LapFilter, error) {
+	if lapRange == [2]int{} {
+		return records, nil, nil
+	}
+	first, last := lapRange[0], lapRange[1]
+	if first < 1 || last < first {
+		return nil, nil, fmt.Errorf("invalid lap range %d-%d", first, last)
+	}
+
+	laps, err := lapWindows(records)
+	if err != nil {
+		return nil, nil, err
+	}
+	if last > len(laps) {
+		return nil, nil, fmt.Errorf("lap range %d-%d exceeds %d laps in file", first, last, len(laps))
+	}
+	windowStart, windowEnd := laps[first-1][0], laps[last-1][1]
+
+	keep := make([]bool, len(records))
+	lastDefinition := make(map[uint8]int)
+	for i, rec := range records {
+		if rec.RecordKind == "definition" {
+			lastDefinition[rec.LocalMessageType] = i
+			continue
+		}
+		if rec.Data != nil {
+			if ts, ok := recordTimestamp(rec.Data); ok && (ts < windowStart || ts > windowEnd) {
+				continue
+			}
+		}
+		keep[i] = true
+		if def, ok := lastDefinition[rec.LocalMessageType]; ok {
+			keep[def] = true
+		}
+	}
+
+	out := make([]RecordEnvelope, 0, len(records))
+	for i, rec := range records {
+		if keep[i] {
+			out = append(out, rec)
+		}
+	}
+	return out, &LapFilter{
+		FirstLap:          first,
+		LastLap:           last,
+		StartTimeUTC:      FitTimeToUTC(windowStart).Format("2006-01-02T15:04:05Z"),
+		EndTimeUTC:        FitTimeToUTC(windowEnd).Format("2006-01-02T15:04:05Z"),
+		SourceRecordCount: len(records),
+	}, nil
+}
+
+// LapChunk describes one per-lap records file written by SplitByLap.
+type LapChunk struct {
+	Path         string `json:"path"`
+	Lap          int    `json:"lap"`
+	StartTimeUTC string `json:"start_time_utc"`
+	EndTimeUTC   string `json:"end_time_utc"`
+	RecordCount  int    `json:"record_count"`
+}
+
+// SplitRecordsByLap partitions records into one self-contained chunk per lap
+// within lapRange (every lap when lapRange is zero). Each chunk holds what
+// FilterRecordsByLaps would keep for that single lap: its timed data
+// messages, the untimed messages, and the definitions its data messages
+// need. All chunks are built in one pass over records.
+func SplitRecordsByLap(records []RecordEnvelope, lapRange [2]int) ([][]RecordEnvelope, []LapFilter, error) {
+	laps, err := lapWindows(records)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(laps) == 0 {
+		return nil, nil, fmt.Errorf("file has no lap messages")
+	}
+	first, last := 1, len(laps)
+	if lapRange != [2]int{} {
+		first, last = lapRange[0], lapRange[1]
+	}
+	if first < 1 || last < first {
+		return nil, nil, fmt.Errorf("invalid lap range %d-%d", first, last)
+	}
+	if last > len(laps) {
+		return nil, nil, fmt.Errorf("lap range %d-%d exceeds %d laps in file", first, last, len(laps))
+	}
+	windows := laps[first-1 : last]
+	// Lap windows are normally in time order, which lets a timed message find
+	// its laps by binary search; out-of-order windows are scanned in full.
+	ordered := true
+	for c := 1; c < len(windows); c++ {
+		if windows[c][0] < windows[c-1][0] || windows[c][1] < windows[c-1][1] {
+			ordered = false
+		}
+	}
+
+	kept := make([][]int, len(windows))
+	keptDefinition := make([]map[uint8]int, len(windows))
+	lastDefinition := make(map[uint8]int)
+	keep := func(c, i int, local uint8) {
+		if def, ok := lastDefinition[local]; ok {
+			if keptDefinition[c] == nil {
+				keptDefinition[c] = make(map[uint8]int)
+			}
+			if prev, seen := keptDefinition[c][local]; !seen || prev != def {
+				keptDefinition[c][local] = def
+				kept[c] = append(kept[c], def)
+			}
+		}
+		kept[c] = append(kept[c], i)
+	}
+	for i, rec := range records {
+		if rec.RecordKind == "definition" {
+			lastDefinition[rec.LocalMessageType] = i
+			continue
+		}
+		ts, timed := uint32(0), false
+		if rec.Data != nil {
+			ts, timed = recordTimestamp(rec.Data)
+		}
+		if !timed {
+			for c := range windows {
+				keep(c, i, rec.LocalMessageType)
+			}
+			continue
+		}
+		c := 0
+		if ordered {
+			c = sort.Search(len(windows), func(k int) bool { return windows[k][1] >= ts })
+		}
+		for ; c < len(windows); c++ {
+			if ordered && windows[c][0] > ts {
+				break
+			}
+			if ts >= windows[c][0] && ts <= windows[c][1] {
+				keep(c, i, rec.LocalMessageType)
+			}
+		}
+	}
+
+	chunks := make([][]RecordEnvelope, len(windows))
+	filters := make([]LapFilter, len(windows))
+	for c, indices := range kept {
+		// Definitions are added when first needed, after records that
+		// precede them in the file; restore file order.
+		sort.Ints(indices)
+		chunk := make([]RecordEnvelope, len(indices))
+		for k, idx := range indices {
+			chunk[k] = records[idx]
+		}
+		chunks[c] = chunk
+		filters[c] = LapFilter{
+			FirstLap:          first + c,
+			LastLap:           first + c,
+			StartTimeUTC:      FitTimeToUTC(windows[c][0]).Format("2006-01-02T15:04:05Z"),
+			EndTimeUTC:        FitTimeToUTC(windows[c][1]).Format("2006-01-02T15:04:05Z"),
+			SourceRecordCount: len(records),
+		}
+	}
+	return chunks, filters, nil
+}
+
+// lapWindows returns the [start_time, timestamp] window of each lap message,
+// in file order.
+func lapWindows(records []RecordEnvelope) ([][2]uint32, error) {
+	var laps [][2]uint32
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.GlobalMessageNum != 19 || rec.Data == nil {
+			continue
+		}
+		start, okStart := lapTimeField(rec.Data.Fields, lapStartTimeField)
+		end, okEnd := lapTimeField(rec.Data.Fields, lapTimestampField)
+		if !okStart || !okEnd {
+			return nil, fmt.Errorf("lap %d has no start_time/timestamp window", len(laps)+1)
+		}
+		laps = append(laps, [2]uint32{start, end})
+	}
+	return laps, nil
+}
+
+func lapTimeField(fields []FieldValue, num uint8) (uint32, bool) {
+	f, ok := findField(fields, num)
+	if !ok || f.Invalid {
+		return 0, false
+	}
+	return asTimestampRaw(f.Decoded)
+}
+
+// recordTimestamp returns a data message's absolute timestamp from field 253
+// or, for compressed-timestamp headers, the reconstructed value.
+func recordTimestamp(data *DataRecord) (uint32, bool) {
+	if ts, ok := lapTimeField(data.Fields, lapTimestampField); ok {
+		return ts, true
+	}
+	if ct := data.CompressedTimestamp; ct != nil && ct.HadReference {
+		return ct.AbsoluteTimestampRaw, true
+	}
+	return 0, false
+}
@@ -0,0 +1,63 @@
+package llmexport
+
+import (
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+)
+
+const (
+	monitoringMessageNum       = 55
+	monitoringHRDataMessageNum = 211
+
+	monitoringTimestamp16Field  = 26
+	monitoringHeartRateField    = 27
+	monitoringRestingHRField    = 0
+	monitoringTimestamp16Window = 0x10000
+)
+
+// MonitoringHeartRateSamples extracts the all-day heart rate timeline from
+// monitoring messages (global 55). Most readings carry only timestamp_16, the
+// low 16 bits of the FIT time, which is resolved against the latest full
+// timestamp the same way compressed record headers are.
+func MonitoringHeartRateSamples(records []RecordEnvelope) []analyzer.HeartRateSample {
+	var (
+		out      []analyzer.HeartRateSample
+		last     uint32
+		haveLast bool
+	)
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.GlobalMessageNum != monitoringMessageNum || rec.Data == nil {
+			continue
+		}
+		if ts, ok := recordTimestamp(rec.Data); ok {
+			last, haveLast = ts, true
+		} else if f, ok := findField(rec.Data.Fields, monitoringTimestamp16Field); ok && !f.Invalid && haveLast {
+			if ts16, ok := f.Decoded.(uint16); ok {
+				last += (uint32(ts16) - last) % monitoringTimestamp16Window
+			}
+		}
+		bpm, ok := uint8Field(rec.Data.Fields, monitoringHeartRateField)
+		if !ok || bpm == 0 || !haveLast {
+			continue
+		}
+		out = append(out, analyzer.HeartRateSample{
+			Timestamp: FitTimeToUTC(last),
+			BPM:       float64(bpm),
+		})
+	}
+	return out
+}
+
+// MonitoringRestingHeartRate returns the device's resting heart rate from the
+// last monitoring_hr_data message (global 211), or 0 when none is recorded.
+func MonitoringRestingHeartRate(records []RecordEnvelope) float64 {
+	resting := 0.0
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.GlobalMessageNum != monitoringHRDataMessageNum || rec.Data == nil {
+			continue
+		}
+		if bpm, ok := uint8Field(rec.Data.Fields, monitoringRestingHRField); ok && bpm > 0 {
+			resting = float64(bpm)
+		}
+	}
+	return resting
+}
@@ -100,6 +100,7 @@ type parseState struct {
 	definitions    map[uint8]localDefinitionState
 	lastTimestamp  uint32
 	lastTimeOffset int32
+	haveTimestamp  bool
 	records        []RecordEnvelope
 }
 
@@ -113,6 +114,7 @@ type parseOutput struct {
 	StoredFileCRC      uint16
 	ComputedFileCRC    uint16
 	LeftoverBytesCount int64
+	RawLayout          RawLayout
 }
 
 func parseFITBytes(data []byte) (*parseOutput, error) {
@@ -125,6 +127,8 @@ func parseFITBytes(data []byte) (*parseOutput, error) {
 		return nil, err
 	}
 
+	dataSize = resolveDataSize(data, dataStart, dataSize)
+	header.DataSizeUsed = dataSize
 	required := int(dataStart) + int(dataSize) + 2
 	if len(data) < required {
 		return nil, fmt.Errorf("fit file truncated: have %d bytes, need at least %d", len(data), required)
@@ -162,9 +166,89 @@ func parseFITBytes(data []byte) (*parseOutput, error) {
 		StoredFileCRC:      storedFileCRC,
 		ComputedFileCRC:    computedFileCRC,
 		LeftoverBytesCount: leftover,
+		RawLayout:          rawLayout(data, dataStart, dataSize, computedFileCRC),
 	}, nil
 }
 
+// rawLayout records where the header, data section and CRCs sit in data.
+// The header CRC is computed even when the stored value is 0 (unset), so the
+// expected bytes are always available for comparison.
+func rawLayout(data []byte, dataStart, dataSize uint32, computedFileCRC uint16) RawLayout {
+	crcEnd := int(dataStart + dataSize)
+	layout := RawLayout{
+		HeaderHex:  hex.EncodeToString(data[:dataStart]),
+		HeaderSize: int(dataStart),
+		DataOffset: int(dataStart),
+		DataSize:   int(dataSize),
+		FileCRC: RawCRCBytes{
+			Offset:           crcEnd,
+			StoredBytesHex:   hex.EncodeToString(data[crcEnd : crcEnd+2]),
+			ComputedBytesHex: crcBytesHex(computedFileCRC),
+		},
+	}
+	if dataStart == headerSizeCRC {
+		layout.HeaderCRC = &RawCRCBytes{
+			Offset:           headerSizeNoCRC,
+			StoredBytesHex:   hex.EncodeToString(data[headerSizeNoCRC:headerSizeCRC]),
+			ComputedBytesHex: crcBytesHex(dyncrc16.Checksum(data[:headerSizeNoCRC])),
+		}
+	}
+	return layout
+}
+
+func crcBytesHex(crc uint16) string {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], crc)
+	return hex.EncodeToString(b[:])
+}
+
+// resolveDataSize returns the number of data bytes to parse. The header's
+// DataSize is trusted when the file CRC after it validates, and also when it
+// ends exactly at the file's last two bytes: then a mismatch is corruption,
+// reported as a file CRC mismatch, not a wrong header. Only when the declared
+// size overruns the file or disagrees with its length is the first offset
+// whose trailing CRC validates and whose preceding bytes parse as whole
+// records used. When none does, the declared size is kept if it fits in the
+// file and the file length minus the CRC is used if it does not.
+func resolveDataSize(data []byte, dataStart, declared uint32) uint32 {
+	parses := func(end int) bool {
+		ps := &parseState{
+			dataOffset:  int(dataStart),
+			fileData:    data[dataStart:end],
+			definitions: make(map[uint8]localDefinitionState),
+		}
+		return ps.parseRecords() == nil
+	}
+	declaredEnd := int(dataStart) + int(declared)
+	fits := declaredEnd+2 <= len(data)
+	if fits {
+		// A zero "CRC" also matches any end that follows a valid CRC and
+		// zero padding, so only trust it when the records parse.
+		stored := binary.LittleEndian.Uint16(data[declaredEnd : declaredEnd+2])
+		if stored == dyncrc16.Checksum(data[:declaredEnd]) && (stored != 0 || parses(declaredEnd)) {
+			return declared
+		}
+	}
+	tailEnd := len(data) - 2
+	if (fits && declaredEnd == tailEnd) || tailEnd <= int(dataStart) {
+		return declared
+	}
+
+	crc := dyncrc16.New()
+	crc.Write(data[:dataStart+1])
+	for end := int(dataStart) + 1; end <= tailEnd; end++ {
+		if end != declaredEnd && crc.Sum16() == binary.LittleEndian.Uint16(data[end:end+2]) && parses(end) {
+			return uint32(end) - dataStart
+		}
+		crc.Write(data[end : end+1])
+	}
+
+	if fits {
+		return declared
+	}
+	return uint32(tailEnd) - dataStart
+}
+
 func parseHeader(data []byte) (HeaderInfo, CRCCheck, uint32, uint32, error) {
 	size := data[0]
 	if size != headerSizeNoCRC && size != headerSizeCRC {
@@ -406,9 +490,11 @@ func (ps *parseState) parseDataRecord(recordIndex, startOffset, pos int, headerB
 		offset := headerByte & compressedTimeMask
 		info := &CompressedTimestampInfo{
 			Offset5bit:   offset,
-			HadReference: ps.lastTimestamp != 0,
+			HadReference: ps.haveTimestamp,
 		}
-		if ps.lastTimestamp != 0 {
+		if ps.haveTimestamp {
+			// The 5-bit offset counts seconds modulo 32 from the last full
+			// timestamp; masking the difference handles the 31 -> 0 rollover.
 			timeOffset := int32(offset)
 			ps.lastTimestamp += uint32((timeOffset - ps.lastTimeOffset) & int32(compressedTimeMask))
 			ps.lastTimeOffset = timeOffset
@@ -429,6 +515,7 @@ func (ps *parseState) parseDataRecord(recordIndex, startOffset, pos int, headerB
 			if ts, ok := asTimestampRaw(value.Decoded); ok {
 				ps.lastTimestamp = ts
 				ps.lastTimeOffset = int32(ts & compressedTimeMask)
+				ps.haveTimestamp = true
 				value.Timestamp = &TimeProjection{
 					Raw: ts,
 					UTC: fitTimestampToUTC(ts).Format(time.RFC3339),
@@ -439,6 +526,10 @@ func (ps *parseState) parseDataRecord(recordIndex, startOffset, pos int, headerB
 	}
 	if def.globalMessageNum == 20 {
 		dataRecord.Flat = buildRecordFlat(dataRecord.Fields)
+		if ct := dataRecord.CompressedTimestamp; ct != nil && ct.HadReference && dataRecord.Flat.TimestampUTC == "" {
+			dataRecord.Flat.TimestampRaw = ct.AbsoluteTimestampRaw
+			dataRecord.Flat.TimestampUTC = ct.AbsoluteTimestampUTC
+		}
 	}
 
 	if len(def.devFields) > 0 {
@@ -455,6 +546,7 @@ func (ps *parseState) parseDataRecord(recordIndex, startOffset, pos int, headerB
 				DeveloperDataIdx:  ddf.developerDataIdx,
 				RawHex:            hex.EncodeToString(raw),
 				DecodedByteValues: bytesToInts(raw),
+				BigEndian:         def.arch == binary.BigEndian,
 			})
 		}
 	}
@@ -522,7 +614,7 @@ func decodeField(raw []byte, def fieldDefState, arch binary.ByteOrder, global ui
 	if bt == baseByte {
 		field.DecodedType = "bytes"
 		field.Decoded = bytesToInts(raw)
-		field.Invalid = allBytes(raw, 0xFF)
+		field.Invalid = allBytes(raw, InvalidUint8)
 		field.IsArray = len(raw) > 1
 		return field
 	}
@@ -558,9 +650,25 @@ func decodeField(raw []byte, def fieldDefState, arch binary.ByteOrder, global ui
 		field.DecodedType = "array"
 		field.IsArray = true
 	}
-	if meta.scaler != nil && count == 1 && len(invalidElements) == 0 {
-		if scaled, ok := meta.scaler(field.Decoded); ok {
-			field.Scaled = scaled
+	if meta.scaler != nil && len(invalidElements) == 0 {
+		if count == 1 {
+			if scaled, ok := meta.scaler(field.Decoded); ok {
+				field.Scaled = scaled
+			}
+		} else {
+			// Array fields (e.g. power phase start/end angles) scale per element.
+			scaled := make([]any, 0, count)
+			for _, v := range values {
+				sv, ok := meta.scaler(v)
+				if !ok {
+					scaled = nil
+					break
+				}
+				scaled = append(scaled, sv)
+			}
+			if scaled != nil {
+				field.Scaled = scaled
+			}
 		}
 	}
 	return field
@@ -570,39 +678,39 @@ func decodeSingleValue(raw []byte, bt baseType, arch binary.ByteOrder) (any, boo
 	switch bt {
 	case baseEnum:
 		v := raw[0]
-		return v, v == 0xFF
+		return v, IsInvalidUint8(v)
 	case baseSint8:
 		v := int8(raw[0])
-		return v, v == int8(0x7F)
+		return v, IsInvalidSint8(v)
 	case baseUint8:
 		v := raw[0]
-		return v, v == 0xFF
+		return v, IsInvalidUint8(v)
 	case baseSint16:
 		v := int16(arch.Uint16(raw))
-		return v, v == int16(0x7FFF)
+		return v, IsInvalidSint16(v)
 	case baseUint16:
 		v := arch.Uint16(raw)
-		return v, v == 0xFFFF
+		return v, IsInvalidUint16(v)
 	case baseSint32:
 		v := int32(arch.Uint32(raw))
-		return v, v == int32(0x7FFFFFFF)
+		return v, IsInvalidSint32(v)
 	case baseUint32:
 		v := arch.Uint32(raw)
-		return v, v == 0xFFFFFFFF
+		return v, IsInvalidUint32(v)
 	case baseFloat32:
 		bits := arch.Uint32(raw)
 		v := float64(math.Float32frombits(bits))
 		if math.IsNaN(v) || math.IsInf(v, 0) {
-			return nonFiniteFloatLabel(v), bits == 0xFFFFFFFF
+			return nonFiniteFloatLabel(v), IsInvalidUint32(bits)
 		}
-		return v, bits == 0xFFFFFFFF
+		return v, IsInvalidUint32(bits)
 	case baseFloat64:
 		bits := arch.Uint64(raw)
 		v := math.Float64frombits(bits)
 		if math.IsNaN(v) || math.IsInf(v, 0) {
-			return nonFiniteFloatLabel(v), bits == 0xFFFFFFFFFFFFFFFF
+			return nonFiniteFloatLabel(v), bits == InvalidUint64
 		}
-		return v, bits == 0xFFFFFFFFFFFFFFFF
+		return v, bits == InvalidUint64
 	case baseUint8z:
 		v := raw[0]
 		return v, v == 0x00
@@ -614,10 +722,10 @@ func decodeSingleValue(raw []byte, bt baseType, arch binary.ByteOrder) (any, boo
 		return v, v == 0x00000000
 	case baseSint64:
 		v := int64(arch.Uint64(raw))
-		return v, v == int64(0x7FFFFFFFFFFFFFFF)
+		return v, v == InvalidSint64
 	case baseUint64:
 		v := arch.Uint64(raw)
-		return v, v == 0xFFFFFFFFFFFFFFFF
+		return v, v == InvalidUint64
 	case baseUint64z:
 		v := arch.Uint64(raw)
 		return v, v == 0x0000000000000000
@@ -627,20 +735,19 @@ func decodeSingleValue(raw []byte, bt baseType, arch binary.ByteOrder) (any, boo
 }
 
 func fitTimestampToUTC(ts uint32) time.Time {
-	base := time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
-	return base.Add(time.Duration(ts) * time.Second)
+	return FitTimeToUTC(ts)
 }
 
 func asTimestampRaw(v any) (uint32, bool) {
 	switch x := v.(type) {
 	case uint32:
-		if x == 0xFFFFFFFF {
+		if IsInvalidUint32(x) {
 			return 0, false
 		}
 		return x, true
 	case []any:
 		if len(x) > 0 {
-			if y, ok := x[0].(uint32); ok && y != 0xFFFFFFFF {
+			if y, ok := x[0].(uint32); ok && !IsInvalidUint32(y) {
 				return y, true
 			}
 		}
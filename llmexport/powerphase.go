@@ -0,0 +1,110 @@
+package llmexport
+
+import (
+	"math"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+)
+
+// Record (global 20) power phase fields; each is a [start, end] angle pair.
+const (
+	leftPowerPhaseField      = 69
+	leftPowerPhasePeakField  = 70
+	rightPowerPhaseField     = 71
+	rightPowerPhasePeakField = 72
+)
+
+// circularMean accumulates angles on the unit circle so that averaging 350 and
+// 10 degrees yields 0 rather than 180.
+type circularMean struct {
+	sin, cos float64
+	n        int
+}
+
+func (c *circularMean) add(deg float64) {
+	rad := deg * math.Pi / 180
+	c.sin += math.Sin(rad)
+	c.cos += math.Cos(rad)
+	c.n++
+}
+
+func (c circularMean) degrees() float64 {
+	if c.n == 0 {
+		return 0
+	}
+	deg := math.Atan2(c.sin, c.cos) * 180 / math.Pi
+	if deg < 0 {
+		deg += 360
+	}
+	return math.Round(deg*10) / 10
+}
+
+// PedalPowerPhase averages the record-level left/right power phase and peak
+// power phase start/end angles. It returns nil when no record carries a valid
+// phase field, as only advanced dual-sided power meters record them.
+func PedalPowerPhase(records []RecordEnvelope) *analyzer.PedalPowerPhase {
+	fields := []uint8{leftPowerPhaseField, leftPowerPhasePeakField, rightPowerPhaseField, rightPowerPhasePeakField}
+	starts := make([]circularMean, len(fields))
+	ends := make([]circularMean, len(fields))
+	samples := 0
+
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.GlobalMessageNum != 20 || rec.Data == nil {
+			continue
+		}
+		found := false
+		for i, num := range fields {
+			f, ok := findField(rec.Data.Fields, num)
+			if !ok {
+				continue
+			}
+			start, end, ok := phaseAngles(f)
+			if !ok {
+				continue
+			}
+			starts[i].add(start)
+			ends[i].add(end)
+			found = true
+		}
+		if found {
+			samples++
+		}
+	}
+	if samples == 0 {
+		return nil
+	}
+	return &analyzer.PedalPowerPhase{
+		LeftStartDeg:      starts[0].degrees(),
+		LeftEndDeg:        ends[0].degrees(),
+		LeftPeakStartDeg:  starts[1].degrees(),
+		LeftPeakEndDeg:    ends[1].degrees(),
+		RightStartDeg:     starts[2].degrees(),
+		RightEndDeg:       ends[2].degrees(),
+		RightPeakStartDeg: starts[3].degrees(),
+		RightPeakEndDeg:   ends[3].degrees(),
+		SampleCount:       samples,
+	}
+}
+
+// phaseAngles returns the start/end angles in degrees from a power phase field,
+// using the scaled values when available and scaling raw units otherwise.
+func phaseAngles(f FieldValue) (float64, float64, bool) {
+	if f.Invalid || len(f.InvalidElements) > 0 {
+		return 0, 0, false
+	}
+	values, ok := f.Scaled.([]any)
+	scale := 1.0
+	if !ok {
+		values, ok = f.Decoded.([]any)
+		scale = powerPhaseScale
+	}
+	if !ok || len(values) < 2 {
+		return 0, 0, false
+	}
+	start := floatPointer(values[0])
+	end := floatPointer(values[1])
+	if start == nil || end == nil {
+		return 0, 0, false
+	}
+	return *start / scale, *end / scale, true
+}
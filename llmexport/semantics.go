@@ -14,7 +14,9 @@ type fieldSemantic struct {
 	scaler func(decoded any) (any, bool)
 }
 
-var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+// powerPhaseScale converts raw power phase angles (256 units per revolution,
+// i.e. 128/180 units per degree) to degrees.
+const powerPhaseScale = 128.0 / 180.0
 
 var semanticsByMessage = map[uint16]map[uint8]fieldSemantic{
 	0: { // file_id
@@ -26,12 +28,25 @@ var semanticsByMessage = map[uint16]map[uint8]fieldSemantic{
 		5: {name: "number"},
 		8: {name: "product_name"},
 	},
+	7: { // zones_target
+		1: {name: "max_heart_rate", units: "bpm"},
+		2: {name: "threshold_heart_rate", units: "bpm"},
+		3: {name: "functional_threshold_power", units: "w"},
+		5: {name: "hr_calc_type"},
+		7: {name: "pwr_calc_type"},
+	},
+	12: { // sport
+		0: {name: "sport"},
+		1: {name: "sub_sport"},
+		3: {name: "name"},
+	},
 	18: { // session
 		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
 		2:   {name: "start_time", units: "s_since_fit_epoch", scaler: scaleTimestamp},
 		7:   {name: "total_elapsed_time", units: "s", scaler: scaleBy(1000, 0)},
 		8:   {name: "total_timer_time", units: "s", scaler: scaleBy(1000, 0)},
 		9:   {name: "total_distance", units: "m", scaler: scaleBy(100, 0)},
+		10:  {name: "total_cycles", units: "cycles"},
 		14:  {name: "avg_speed", units: "m/s", scaler: scaleBy(1000, 0)},
 		15:  {name: "max_speed", units: "m/s", scaler: scaleBy(1000, 0)},
 		16:  {name: "avg_heart_rate", units: "bpm"},
@@ -43,6 +58,10 @@ var semanticsByMessage = map[uint16]map[uint8]fieldSemantic{
 		24:  {name: "total_calories", units: "kcal"},
 		48:  {name: "normalized_power", units: "w"},
 		57:  {name: "threshold_power", units: "w"},
+		116: {name: "avg_left_power_phase", units: "deg", scaler: scaleBy(powerPhaseScale, 0)},
+		117: {name: "avg_left_power_phase_peak", units: "deg", scaler: scaleBy(powerPhaseScale, 0)},
+		118: {name: "avg_right_power_phase", units: "deg", scaler: scaleBy(powerPhaseScale, 0)},
+		119: {name: "avg_right_power_phase_peak", units: "deg", scaler: scaleBy(powerPhaseScale, 0)},
 	},
 	19: { // lap
 		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
@@ -50,6 +69,7 @@ var semanticsByMessage = map[uint16]map[uint8]fieldSemantic{
 		7:   {name: "total_elapsed_time", units: "s", scaler: scaleBy(1000, 0)},
 		8:   {name: "total_timer_time", units: "s", scaler: scaleBy(1000, 0)},
 		9:   {name: "total_distance", units: "m", scaler: scaleBy(100, 0)},
+		10:  {name: "total_cycles", units: "cycles"},
 		13:  {name: "avg_speed", units: "m/s", scaler: scaleBy(1000, 0)},
 		14:  {name: "max_speed", units: "m/s", scaler: scaleBy(1000, 0)},
 		15:  {name: "avg_heart_rate", units: "bpm"},
@@ -58,6 +78,7 @@ var semanticsByMessage = map[uint16]map[uint8]fieldSemantic{
 		18:  {name: "max_cadence", units: "rpm"},
 		19:  {name: "avg_power", units: "w"},
 		20:  {name: "max_power", units: "w"},
+		24:  {name: "lap_trigger"},
 		42:  {name: "total_work", units: "j"},
 	},
 	20: { // record
@@ -70,6 +91,10 @@ var semanticsByMessage = map[uint16]map[uint8]fieldSemantic{
 		7:   {name: "power", units: "w"},
 		9:   {name: "grade", units: "%", scaler: scaleBy(100, 0)},
 		13:  {name: "temperature", units: "c"},
+		69:  {name: "left_power_phase", units: "deg", scaler: scaleBy(powerPhaseScale, 0)},
+		70:  {name: "left_power_phase_peak", units: "deg", scaler: scaleBy(powerPhaseScale, 0)},
+		71:  {name: "right_power_phase", units: "deg", scaler: scaleBy(powerPhaseScale, 0)},
+		72:  {name: "right_power_phase_peak", units: "deg", scaler: scaleBy(powerPhaseScale, 0)},
 	},
 	21: { // event
 		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
@@ -98,6 +123,74 @@ var semanticsByMessage = map[uint16]map[uint8]fieldSemantic{
 		7:   {name: "intensity"},
 		8:   {name: "notes"},
 	},
+	55: { // monitoring
+		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
+		0:   {name: "device_index"},
+		1:   {name: "calories", units: "kcal"},
+		2:   {name: "distance", units: "m", scaler: scaleBy(100, 0)},
+		3:   {name: "cycles", units: "cycles", scaler: scaleBy(2, 0)},
+		4:   {name: "active_time", units: "s", scaler: scaleBy(1000, 0)},
+		5:   {name: "activity_type"},
+		6:   {name: "activity_subtype"},
+		19:  {name: "active_calories", units: "kcal"},
+		24:  {name: "current_activity_type_intensity"},
+		26:  {name: "timestamp_16", units: "s"},
+		27:  {name: "heart_rate", units: "bpm"},
+	},
+	103: { // monitoring_info
+		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
+		0:   {name: "local_timestamp", units: "s"},
+		1:   {name: "activity_type"},
+		3:   {name: "cycles_to_distance", units: "m/cycle", scaler: scaleBy(5000, 0)},
+		4:   {name: "cycles_to_calories", units: "kcal/cycle", scaler: scaleBy(5000, 0)},
+		5:   {name: "resting_metabolic_rate", units: "kcal/day"},
+	},
+	128: { // weather_conditions
+		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
+		0:   {name: "weather_report"},
+		1:   {name: "temperature", units: "c"},
+		2:   {name: "condition"},
+		3:   {name: "wind_direction", units: "deg"},
+		4:   {name: "wind_speed", units: "m/s", scaler: scaleBy(1000, 0)},
+		5:   {name: "precipitation_probability", units: "%"},
+		6:   {name: "temperature_feels_like", units: "c"},
+		7:   {name: "relative_humidity", units: "%"},
+		8:   {name: "location"},
+		9:   {name: "observed_at_time", units: "s_since_fit_epoch", scaler: scaleTimestamp},
+		12:  {name: "day_of_week"},
+		13:  {name: "high_temperature", units: "c"},
+		14:  {name: "low_temperature", units: "c"},
+	},
+	132: { // hr
+		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
+		0:   {name: "fractional_timestamp", units: "s", scaler: scaleBy(32768, 0)},
+		1:   {name: "time256", units: "s", scaler: scaleBy(256, 0)},
+		6:   {name: "filtered_bpm", units: "bpm"},
+		9:   {name: "event_timestamp", units: "s", scaler: scaleBy(1024, 0)},
+		10:  {name: "event_timestamp_12", units: "s"},
+	},
+	209: { // barometer_data
+		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
+		0:   {name: "timestamp_ms", units: "ms"},
+		1:   {name: "sample_time_offset", units: "ms"},
+		2:   {name: "baro_pres", units: "pa"},
+	},
+	211: { // monitoring_hr_data
+		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
+		0:   {name: "resting_heart_rate", units: "bpm"},
+		1:   {name: "current_day_resting_heart_rate", units: "bpm"},
+	},
+	216: { // time_in_zone
+		253: {name: "timestamp", units: "s_since_fit_epoch", scaler: scaleTimestamp},
+		0:   {name: "reference_mesg"},
+		1:   {name: "reference_index"},
+		2:   {name: "time_in_hr_zone", units: "s", scaler: scaleBy(1000, 0)},
+		5:   {name: "time_in_power_zone", units: "s", scaler: scaleBy(1000, 0)},
+		6:   {name: "hr_zone_high_boundary", units: "bpm"},
+		9:   {name: "power_zone_high_boundary", units: "w"},
+		13:  {name: "threshold_heart_rate", units: "bpm"},
+		15:  {name: "functional_threshold_power", units: "w"},
+	},
 	206: { // field_description
 		0: {name: "developer_data_index"},
 		1: {name: "field_definition_number"},
@@ -164,10 +257,10 @@ func scaleTimestamp(decoded any) (any, bool) {
 	default:
 		return nil, false
 	}
-	if raw == 0xFFFFFFFF {
+	if IsInvalidUint32(raw) {
 		return nil, false
 	}
-	return fitEpoch.Add(time.Duration(raw) * time.Second).UTC().Format(time.RFC3339), true
+	return FitTimeToUTC(raw).Format(time.RFC3339), true
 }
 
 func invalidRuleForBase(base BaseTypeInfo) string {
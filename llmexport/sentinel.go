@@ -0,0 +1,46 @@
+package llmexport
+
+import (
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/internal/sentinel"
+)
+
+// FitEpoch is the zero point of FIT timestamps (1989-12-31T00:00:00Z).
+var FitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Invalid-value sentinels for FIT base types, re-exported from
+// internal/sentinel so analyzer and llmexport share one definition.
+const (
+	InvalidUint8  = sentinel.InvalidUint8
+	InvalidUint16 = sentinel.InvalidUint16
+	InvalidUint32 = sentinel.InvalidUint32
+	InvalidUint64 = sentinel.InvalidUint64
+	InvalidSint8  = sentinel.InvalidSint8
+	InvalidSint16 = sentinel.InvalidSint16
+	InvalidSint32 = sentinel.InvalidSint32
+	InvalidSint64 = sentinel.InvalidSint64
+)
+
+// IsInvalidUint8 reports whether v is the uint8/enum invalid sentinel.
+func IsInvalidUint8(v uint8) bool { return sentinel.IsInvalidUint8(v) }
+
+// IsInvalidUint16 reports whether v is the uint16 invalid sentinel.
+func IsInvalidUint16(v uint16) bool { return sentinel.IsInvalidUint16(v) }
+
+// IsInvalidUint32 reports whether v is the uint32 invalid sentinel.
+func IsInvalidUint32(v uint32) bool { return sentinel.IsInvalidUint32(v) }
+
+// IsInvalidSint8 reports whether v is the sint8 invalid sentinel.
+func IsInvalidSint8(v int8) bool { return sentinel.IsInvalidSint8(v) }
+
+// IsInvalidSint16 reports whether v is the sint16 invalid sentinel.
+func IsInvalidSint16(v int16) bool { return sentinel.IsInvalidSint16(v) }
+
+// IsInvalidSint32 reports whether v is the sint32 invalid sentinel.
+func IsInvalidSint32(v int32) bool { return sentinel.IsInvalidSint32(v) }
+
+// FitTimeToUTC converts a raw FIT timestamp (seconds since FitEpoch) to UTC.
+func FitTimeToUTC(raw uint32) time.Time {
+	return FitEpoch.Add(time.Duration(raw) * time.Second)
+}
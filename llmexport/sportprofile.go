@@ -0,0 +1,70 @@
+package llmexport
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/tormoder/fit"
+)
+
+const (
+	zonesTargetMessageNum = 7
+	sportMessageNum       = 12
+
+	zonesTargetMaxHRField       = 1
+	zonesTargetThresholdHRField = 2
+	zonesTargetFTPField         = 3
+
+	sportSportField    = 0
+	sportSubSportField = 1
+	sportNameField     = 3
+)
+
+// SportProfile returns the device's sport profile for the activity. The
+// sport message (global 12) identifies the profile; its FTP and HR limits
+// live in the zones_target message (global 7) written alongside it. It
+// returns nil when neither message is present.
+func SportProfile(records []RecordEnvelope) *analyzer.SportProfile {
+	var profile *analyzer.SportProfile
+	ensure := func() *analyzer.SportProfile {
+		if profile == nil {
+			profile = &analyzer.SportProfile{}
+		}
+		return profile
+	}
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.Data == nil {
+			continue
+		}
+		switch rec.GlobalMessageNum {
+		case sportMessageNum:
+			p := ensure()
+			if v, ok := uint8Field(rec.Data.Fields, sportSportField); ok {
+				p.Sport = fmt.Sprint(fit.Sport(v))
+			}
+			if v, ok := uint8Field(rec.Data.Fields, sportSubSportField); ok {
+				p.SubSport = fmt.Sprint(fit.SubSport(v))
+			}
+			if f, ok := findField(rec.Data.Fields, sportNameField); ok && !f.Invalid {
+				if name, ok := f.Decoded.(string); ok {
+					p.Name = strings.TrimRight(name, "\x00")
+				}
+			}
+		case zonesTargetMessageNum:
+			p := ensure()
+			if v, ok := uint8Field(rec.Data.Fields, zonesTargetMaxHRField); ok && v > 0 {
+				p.MaxHeartRateBPM = float64(v)
+			}
+			if v, ok := uint8Field(rec.Data.Fields, zonesTargetThresholdHRField); ok && v > 0 {
+				p.ThresholdHeartRateBPM = float64(v)
+			}
+			if f, ok := findField(rec.Data.Fields, zonesTargetFTPField); ok && !f.Invalid {
+				if v, ok := f.Decoded.(uint16); ok && v > 0 {
+					p.FTPWatts = float64(v)
+				}
+			}
+		}
+	}
+	return profile
+}
@@ -20,6 +20,28 @@ type ExportOptions struct {
 
 	// IncludeAnalysis writes LLM-friendly semantic summary files (analysis.json + workout_structure.json).
 	IncludeAnalysis bool
+
+	// LapRange limits records.jsonl to the records within laps [first, last]
+	// (1-based, inclusive). The zero value exports every record.
+	LapRange [2]int
+
+	// SplitByLap additionally writes one records_lap_NN.jsonl per lap (within
+	// LapRange when set), each repeating the definitions its records need.
+	SplitByLap bool
+
+	// PrettyRecords writes records.json as an indented JSON array instead of
+	// records.jsonl. Meant for hand inspection; it cannot be streamed.
+	PrettyRecords bool
+
+	// SortFieldsByNumber orders each data record's Fields by field number in
+	// the exported records, for stable diffs across devices that encode fields
+	// differently. FieldIndex still gives the encoded position; parsing is
+	// unaffected.
+	SortFieldsByNumber bool
+
+	// VerboseManifest adds raw_layout to manifest.json: the raw header bytes,
+	// data section and CRC offsets, and stored vs computed CRC bytes.
+	VerboseManifest bool
 }
 
 // ExportResult describes generated files.
@@ -27,6 +49,7 @@ type ExportResult struct {
 	OutputDir            string   `json:"output_dir"`
 	ManifestPath         string   `json:"manifest_path"`
 	RecordsPath          string   `json:"records_path"`
+	LapChunkPaths        []string `json:"lap_chunk_paths,omitempty"`
 	AnalysisPath         string   `json:"analysis_path,omitempty"`
 	WorkoutStructurePath string   `json:"workout_structure_path,omitempty"`
 	AnalysisError        string   `json:"analysis_error,omitempty"`
@@ -44,26 +67,38 @@ type ExportResult struct {
 
 // Manifest captures export metadata and pointers to exported files.
 type Manifest struct {
-	FormatVersion        string        `json:"format_version"`
-	GeneratedAt          time.Time     `json:"generated_at"`
-	SourceFile           string        `json:"source_file"`
-	SourceFileName       string        `json:"source_file_name"`
-	SourceSHA256         string        `json:"source_sha256"`
-	SourceSizeBytes      int64         `json:"source_size_bytes"`
-	Header               HeaderInfo    `json:"header"`
-	HeaderCRC            CRCCheck      `json:"header_crc"`
-	FileCRC              CRCCheck      `json:"file_crc"`
-	RecordsPath          string        `json:"records_path"`
-	AnalysisPath         string        `json:"analysis_path,omitempty"`
-	WorkoutStructurePath string        `json:"workout_structure_path,omitempty"`
-	AnalysisError        string        `json:"analysis_error,omitempty"`
-	RecordCount          int           `json:"record_count"`
-	DefinitionCount      int           `json:"definition_count"`
-	DataMessageCount     int           `json:"data_message_count"`
-	LeftoverBytes        int64         `json:"leftover_bytes"`
-	FileIdProjection     *FileIDInfo   `json:"file_id_projection,omitempty"`
-	SchemaDescription    SchemaDetails `json:"schema_description"`
-	Warnings             []string      `json:"warnings,omitempty"`
+	FormatVersion        string         `json:"format_version"`
+	GeneratedAt          time.Time      `json:"generated_at"`
+	SourceFile           string         `json:"source_file"`
+	SourceFileName       string         `json:"source_file_name"`
+	SourceSHA256         string         `json:"source_sha256"`
+	SourceSizeBytes      int64          `json:"source_size_bytes"`
+	Header               HeaderInfo     `json:"header"`
+	HeaderCRC            CRCCheck       `json:"header_crc"`
+	FileCRC              CRCCheck       `json:"file_crc"`
+	RecordsPath          string         `json:"records_path"`
+	AnalysisPath         string         `json:"analysis_path,omitempty"`
+	WorkoutStructurePath string         `json:"workout_structure_path,omitempty"`
+	AnalysisError        string         `json:"analysis_error,omitempty"`
+	PowerSource          string         `json:"power_source,omitempty"`
+	RecordCount          int            `json:"record_count"`
+	DefinitionCount      int            `json:"definition_count"`
+	DataMessageCount     int            `json:"data_message_count"`
+	LeftoverBytes        int64          `json:"leftover_bytes"`
+	FileIdProjection     *FileIDInfo    `json:"file_id_projection,omitempty"`
+	MessageCounts        []MessageCount `json:"message_counts,omitempty"`
+	SchemaDescription    SchemaDetails  `json:"schema_description"`
+	LapFilter            *LapFilter     `json:"lap_filter,omitempty"`
+	LapChunks            []LapChunk     `json:"lap_chunks,omitempty"`
+	RawLayout            *RawLayout     `json:"raw_layout,omitempty"`
+	Warnings             []string       `json:"warnings,omitempty"`
+}
+
+// MessageCount is the number of data messages seen for one global message number.
+type MessageCount struct {
+	GlobalMessageNum  uint16 `json:"global_message_num"`
+	GlobalMessageName string `json:"global_message_name"`
+	Count             int    `json:"count"`
 }
 
 // SchemaDetails documents the record shape for downstream applications.
@@ -78,6 +113,7 @@ type HeaderInfo struct {
 	ProtocolVersion uint8  `json:"protocol_version"`
 	ProfileVersion  uint16 `json:"profile_version"`
 	DataSize        uint32 `json:"data_size"`
+	DataSizeUsed    uint32 `json:"data_size_used"` // differs from DataSize when the header value is inconsistent with the file
 	DataType        string `json:"data_type"`
 }
 
@@ -90,6 +126,27 @@ type CRCCheck struct {
 	ValidationStyle string `json:"validation_style"`
 }
 
+// RawLayout is the byte-level layout of the source file: the raw header and
+// the offsets of the data section and CRCs. Offsets are from the start of the
+// file. It is only written to the manifest on request (verbose manifest), for
+// diagnosing parse issues and checking tooling against the FIT spec.
+type RawLayout struct {
+	HeaderHex  string       `json:"header_hex"`
+	HeaderSize int          `json:"header_size"`
+	DataOffset int          `json:"data_offset"`
+	DataSize   int          `json:"data_size"`            // bytes parsed, i.e. header.data_size_used
+	HeaderCRC  *RawCRCBytes `json:"header_crc,omitempty"` // nil for 12-byte headers
+	FileCRC    RawCRCBytes  `json:"file_crc"`
+}
+
+// RawCRCBytes locates a CRC and gives its stored and computed values as the
+// two little-endian bytes they occupy in the file, in hex.
+type RawCRCBytes struct {
+	Offset           int    `json:"offset"`
+	StoredBytesHex   string `json:"stored_bytes_hex"`
+	ComputedBytesHex string `json:"computed_bytes_hex"`
+}
+
 // FileIDInfo is a convenience projection from the file_id message.
 type FileIDInfo struct {
 	Type         string `json:"type"`
@@ -222,4 +279,5 @@ type DeveloperFieldValue struct {
 	DeveloperDataIdx  uint8  `json:"developer_data_index"`
 	RawHex            string `json:"raw_hex"`
 	DecodedByteValues []int  `json:"decoded_byte_values"`
+	BigEndian         bool   `json:"big_endian,omitempty"` // definition architecture; multi-byte values are little-endian otherwise
 }
@@ -0,0 +1,116 @@
+package llmexport
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/tormoder/fit"
+)
+
+const (
+	weatherConditionsMessageNum = 128
+	barometerDataMessageNum     = 209
+)
+
+// weather_conditions (global 128) and barometer_data (global 209) field numbers.
+const (
+	weatherReportField      = 0
+	weatherTemperatureField = 1
+	weatherConditionField   = 2
+	weatherWindDirField     = 3
+	weatherWindSpeedField   = 4
+	weatherPrecipProbField  = 5
+	weatherFeelsLikeField   = 6
+	weatherHumidityField    = 7
+	weatherLocationField    = 8
+	barometerPressureField  = 2
+)
+
+const (
+	// weatherReportCurrent marks current conditions; 1 and 2 are forecasts.
+	weatherReportCurrent = 0
+	// minPlausibleBarometricPa drops pressure samples below 300 hPa (higher
+	// than Everest), which are sensor dropouts rather than altitude.
+	minPlausibleBarometricPa = 30000.0
+)
+
+// Weather returns the file's weather report: the last current-conditions
+// weather_conditions message (global 128), or the first forecast when the file
+// has no current report, plus the mean pressure of all barometer_data
+// (global 209) samples. It returns nil when neither message is present.
+func Weather(records []RecordEnvelope) *analyzer.Weather {
+	var current, forecast []FieldValue
+	var pressureSum float64
+	var pressureN int
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.Data == nil {
+			continue
+		}
+		switch rec.GlobalMessageNum {
+		case weatherConditionsMessageNum:
+			if report, ok := uint8Field(rec.Data.Fields, weatherReportField); ok && report != weatherReportCurrent {
+				if forecast == nil {
+					forecast = rec.Data.Fields
+				}
+				continue
+			}
+			current = rec.Data.Fields
+		case barometerDataMessageNum:
+			f, ok := findField(rec.Data.Fields, barometerPressureField)
+			if !ok || f.Invalid {
+				continue
+			}
+			for _, v := range arrayValues(f) {
+				if v != nil && *v >= minPlausibleBarometricPa {
+					pressureSum += *v
+					pressureN++
+				}
+			}
+		}
+	}
+	fields := current
+	if fields == nil {
+		fields = forecast
+	}
+	if fields == nil && pressureN == 0 {
+		return nil
+	}
+
+	w := &analyzer.Weather{}
+	if fields != nil {
+		if v, ok := uint8Field(fields, weatherConditionField); ok {
+			w.Condition = fmt.Sprint(fit.WeatherStatus(v))
+		}
+		w.TemperatureC = weatherValue(fields, weatherTemperatureField, math.Inf(-1), math.Inf(1))
+		w.FeelsLikeC = weatherValue(fields, weatherFeelsLikeField, math.Inf(-1), math.Inf(1))
+		w.RelativeHumidityPct = weatherValue(fields, weatherHumidityField, 0, 100)
+		w.WindSpeedMps = weatherValue(fields, weatherWindSpeedField, 0, math.Inf(1))
+		w.WindDirectionDeg = weatherValue(fields, weatherWindDirField, 0, 360)
+		w.PrecipitationProbabilityPct = weatherValue(fields, weatherPrecipProbField, 0, 100)
+		if f, ok := findField(fields, weatherLocationField); ok && !f.Invalid {
+			if s, ok := f.Decoded.(string); ok {
+				w.Location = strings.TrimRight(s, "\x00")
+			}
+		}
+	}
+	if pressureN > 0 {
+		hPa := math.Round(pressureSum/float64(pressureN)/100*10) / 10
+		w.BarometricPressureHPa = &hPa
+	}
+	return w
+}
+
+// weatherValue returns a valid scaled field value within [lo, hi], else nil.
+func weatherValue(fields []FieldValue, num uint8, lo, hi float64) *float64 {
+	f, ok := findField(fields, num)
+	if !ok || f.Invalid {
+		return nil
+	}
+	v := scaledOrRawFloat(f)
+	if v == nil || *v < lo || *v > hi {
+		return nil
+	}
+	return v
+}
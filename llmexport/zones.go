@@ -0,0 +1,137 @@
+package llmexport
+
+import "github.com/lucasjlepore/fit-analyzer/analyzer"
+
+const (
+	timeInZoneMessageNum = 216
+	sessionMessageNum    = 18
+)
+
+// time_in_zone (global 216) field numbers.
+const (
+	tizReferenceMesg          = 0
+	tizTimeInHRZone           = 2
+	tizTimeInPowerZone        = 5
+	tizHRZoneHighBoundary     = 6
+	tizPowerZoneHighBoundary  = 9
+	tizFunctionalThresholdPwr = 15
+)
+
+// DevicePowerZones returns the device's configured FTP and power zone high
+// boundaries from time_in_zone (global 216). The session-level message is
+// preferred over lap-level ones. It returns nil when neither value is present.
+func DevicePowerZones(records []RecordEnvelope) *analyzer.DevicePowerZones {
+	return preferredTimeInZone(records, func(fields []FieldValue) *analyzer.DevicePowerZones {
+		zones := &analyzer.DevicePowerZones{}
+		if f, ok := findField(fields, tizFunctionalThresholdPwr); ok && !f.Invalid {
+			if v := floatPointer(f.Decoded); v != nil && *v > 0 {
+				zones.FTPWatts = *v
+			}
+		}
+		if f, ok := findField(fields, tizPowerZoneHighBoundary); ok && !f.Invalid {
+			zones.HighBoundariesW = zoneBoundaries(f)
+		}
+		if zones.FTPWatts == 0 && len(zones.HighBoundariesW) == 0 {
+			return nil
+		}
+		return zones
+	})
+}
+
+// DeviceTimeInZone returns the device's own HR and power zone time accounting
+// from time_in_zone (global 216), preferring the session-level message. It
+// returns nil when the file carries no zone times.
+func DeviceTimeInZone(records []RecordEnvelope) *analyzer.DeviceTimeInZone {
+	return preferredTimeInZone(records, func(fields []FieldValue) *analyzer.DeviceTimeInZone {
+		tiz := &analyzer.DeviceTimeInZone{}
+		if f, ok := findField(fields, tizTimeInHRZone); ok && !f.Invalid {
+			tiz.HRZoneSeconds = zoneTimes(f)
+		}
+		if f, ok := findField(fields, tizTimeInPowerZone); ok && !f.Invalid {
+			tiz.PowerZoneSeconds = zoneTimes(f)
+		}
+		if f, ok := findField(fields, tizHRZoneHighBoundary); ok && !f.Invalid {
+			tiz.HRZoneHighBoundariesBPM = zoneBoundaries(f)
+		}
+		if f, ok := findField(fields, tizPowerZoneHighBoundary); ok && !f.Invalid {
+			tiz.PowerZoneHighBoundariesW = zoneBoundaries(f)
+		}
+		if len(tiz.HRZoneSeconds) == 0 && len(tiz.PowerZoneSeconds) == 0 {
+			return nil
+		}
+		return tiz
+	})
+}
+
+// preferredTimeInZone applies extract to each time_in_zone message and returns
+// the session-level result, or the first non-nil one when no session-level
+// message yields a value.
+func preferredTimeInZone[T any](records []RecordEnvelope, extract func([]FieldValue) *T) *T {
+	var first *T
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.GlobalMessageNum != timeInZoneMessageNum || rec.Data == nil {
+			continue
+		}
+		v := extract(rec.Data.Fields)
+		if v == nil {
+			continue
+		}
+		ref, _ := findField(rec.Data.Fields, tizReferenceMesg)
+		if r := floatPointer(ref.Decoded); r != nil && uint16(*r) == sessionMessageNum {
+			return v
+		}
+		if first == nil {
+			first = v
+		}
+	}
+	return first
+}
+
+// arrayValues returns the scaled elements of an array field (or the single
+// value of a one-element field), with nil for invalid elements.
+func arrayValues(f FieldValue) []*float64 {
+	invalid := make(map[int]struct{}, len(f.InvalidElements))
+	for _, idx := range f.InvalidElements {
+		invalid[idx] = struct{}{}
+	}
+	source := f.Decoded
+	if f.Scaled != nil {
+		source = f.Scaled
+	}
+	values, ok := source.([]any)
+	if !ok {
+		values = []any{source}
+	}
+	out := make([]*float64, len(values))
+	for i, raw := range values {
+		if _, bad := invalid[i]; !bad {
+			out[i] = floatPointer(raw)
+		}
+	}
+	return out
+}
+
+// zoneBoundaries returns strictly increasing valid boundaries from an array
+// field, stopping at the first invalid or non-increasing element.
+func zoneBoundaries(f FieldValue) []float64 {
+	var out []float64
+	for _, v := range arrayValues(f) {
+		if v == nil || *v <= 0 || (len(out) > 0 && *v <= out[len(out)-1]) {
+			break
+		}
+		out = append(out, *v)
+	}
+	return out
+}
+
+// zoneTimes returns seconds per zone, counting invalid elements as zero.
+func zoneTimes(f FieldValue) []float64 {
+	values := arrayValues(f)
+	out := make([]float64, len(values))
+	for i, v := range values {
+		if v != nil && *v > 0 {
+			out[i] = *v
+		}
+	}
+	return out
+}
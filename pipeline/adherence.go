@@ -0,0 +1,85 @@
+package pipeline
+
+import "math"
+
+// AdherenceReport aggregates per-step compliance into a session-level verdict
+// for structured workouts. Only steps with a power target and observed power
+// are counted.
+type AdherenceReport struct {
+	StepsEvaluated      int     `json:"steps_evaluated"`
+	StepsHit            int     `json:"steps_hit"`
+	StepsOver           int     `json:"steps_over"`
+	StepsUnder          int     `json:"steps_under"`
+	MeanTimeInTargetPct float64 `json:"mean_time_in_target_pct"`
+	TargetEnergyKJ      float64 `json:"target_energy_kj"`
+	ObservedEnergyKJ    float64 `json:"observed_energy_kj"`
+	EnergyRatioPct      float64 `json:"energy_ratio_pct,omitempty"`
+	Verdict             string  `json:"verdict"`
+}
+
+// WorkoutAdherence summarizes how closely observed power followed the step
+// targets. A step is hit when its average power falls inside the target range
+// and over/under otherwise; target energy uses the range midpoint. It returns
+// nil when no step has both a target and observed power.
+func WorkoutAdherence(steps []WorkoutStep) *AdherenceReport {
+	report := &AdherenceReport{}
+	titTotal := 0.0
+	titCount := 0
+	for _, step := range steps {
+		if step.TargetLowW == nil || step.TargetHighW == nil || step.ObservedAvgPowerW == nil {
+			continue
+		}
+		low, high := *step.TargetLowW, *step.TargetHighW
+		if low <= 0 || high <= 0 {
+			continue
+		}
+		if low > high {
+			low, high = high, low
+		}
+		avg := *step.ObservedAvgPowerW
+		report.StepsEvaluated++
+		switch {
+		case avg > high:
+			report.StepsOver++
+		case avg < low:
+			report.StepsUnder++
+		default:
+			report.StepsHit++
+		}
+		if step.TimeInTargetPct != nil {
+			titTotal += *step.TimeInTargetPct
+			titCount++
+		}
+		if step.DurationS != nil && *step.DurationS > 0 {
+			report.TargetEnergyKJ += (low + high) / 2 * *step.DurationS / 1000.0
+			report.ObservedEnergyKJ += avg * *step.DurationS / 1000.0
+		}
+	}
+	if report.StepsEvaluated == 0 {
+		return nil
+	}
+	if titCount > 0 {
+		report.MeanTimeInTargetPct = titTotal / float64(titCount)
+	}
+	if report.TargetEnergyKJ > 0 {
+		report.EnergyRatioPct = report.ObservedEnergyKJ / report.TargetEnergyKJ * 100.0
+	}
+	report.TargetEnergyKJ = math.Round(report.TargetEnergyKJ*10) / 10
+	report.ObservedEnergyKJ = math.Round(report.ObservedEnergyKJ*10) / 10
+	report.Verdict = adherenceVerdict(report)
+	return report
+}
+
+func adherenceVerdict(r *AdherenceReport) string {
+	hitPct := float64(r.StepsHit) / float64(r.StepsEvaluated) * 100.0
+	switch {
+	case hitPct >= 80 && r.MeanTimeInTargetPct >= 70:
+		return "on_target"
+	case r.StepsOver > r.StepsUnder && hitPct < 80:
+		return "over_target"
+	case r.StepsUnder > r.StepsOver && hitPct < 80:
+		return "under_target"
+	default:
+		return "mixed"
+	}
+}
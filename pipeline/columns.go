@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Canonical sample timestamp formats accepted by BytesOptions.TimestampFormat.
+const (
+	TimestampRFC3339 = "rfc3339"  // ts_utc_iso only (default)
+	TimestampEpochMS = "epoch_ms" // ts_epoch_ms replaces ts_utc_iso
+	TimestampBoth    = "both"     // ts_utc_iso plus a trailing ts_epoch_ms column
+)
+
+// canonicalColumn describes one canonical sample column for both the CSV and
+// parquet encoders so the two formats always share names and order.
+type canonicalColumn struct {
+	name    string
+	parquet string // parquet-go metadata type clause, e.g. "type=DOUBLE"
+	csv     func(s CanonicalSample) string
+	value   func(s CanonicalSample) any
+}
+
+// resolveTimestampFormat normalizes a timestamp format option.
+func resolveTimestampFormat(format string) (string, error) {
+	f := strings.ToLower(strings.TrimSpace(format))
+	switch f {
+	case "":
+		return TimestampRFC3339, nil
+	case TimestampRFC3339, TimestampEpochMS, TimestampBoth:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported timestamp format %q (expected %s|%s|%s)", format, TimestampRFC3339, TimestampEpochMS, TimestampBoth)
+	}
+}
+
+// canonicalColumns returns the ordered column set for samples. Optional
+// columns (work_j, grade_raw_pct, ts_epoch_ms for "both") are appended after the fixed set so
+// positional readers of the default layout keep working.
+func canonicalColumns(samples []CanonicalSample, timestampFormat string) []canonicalColumn {
+	float := func(name string, get func(CanonicalSample) *float64) canonicalColumn {
+		return canonicalColumn{
+			name:    name,
+			parquet: "type=DOUBLE",
+			csv:     func(s CanonicalSample) string { return formatFloatPtr(get(s)) },
+			value:   func(s CanonicalSample) any { return valueOrNaN(get(s)) },
+		}
+	}
+	boolean := func(name string, get func(CanonicalSample) bool) canonicalColumn {
+		return canonicalColumn{
+			name:    name,
+			parquet: "type=BOOLEAN",
+			csv:     func(s CanonicalSample) string { return strconv.FormatBool(get(s)) },
+			value:   func(s CanonicalSample) any { return get(s) },
+		}
+	}
+	integer := func(name string, get func(CanonicalSample) int64) canonicalColumn {
+		return canonicalColumn{
+			name:    name,
+			parquet: "type=INT64",
+			csv:     func(s CanonicalSample) string { return strconv.FormatInt(get(s), 10) },
+			value:   func(s CanonicalSample) any { return get(s) },
+		}
+	}
+	iso := canonicalColumn{
+		name:    "ts_utc_iso",
+		parquet: "type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY",
+		csv:     func(s CanonicalSample) string { return s.TSUTCISO },
+		value:   func(s CanonicalSample) any { return s.TSUTCISO },
+	}
+	epochMS := integer("ts_epoch_ms", func(s CanonicalSample) int64 { return s.Timestamp.UnixMilli() })
+
+	cols := make([]canonicalColumn, 0, 19)
+	if timestampFormat == TimestampEpochMS {
+		cols = append(cols, epochMS)
+	} else {
+		cols = append(cols, iso)
+	}
+	cols = append(cols,
+		canonicalColumn{
+			name:    "elapsed_s",
+			parquet: "type=DOUBLE",
+			csv:     func(s CanonicalSample) string { return formatFloat(s.ElapsedS) },
+			value:   func(s CanonicalSample) any { return s.ElapsedS },
+		},
+		float("power_w", func(s CanonicalSample) *float64 { return s.PowerW }),
+		float("hr_bpm", func(s CanonicalSample) *float64 { return s.HRBPM }),
+		float("cadence_rpm", func(s CanonicalSample) *float64 { return s.CadenceRPM }),
+		float("speed_mps", func(s CanonicalSample) *float64 { return s.SpeedMPS }),
+		float("distance_m", func(s CanonicalSample) *float64 { return s.DistanceM }),
+		float("altitude_m", func(s CanonicalSample) *float64 { return s.AltitudeM }),
+		float("temperature_c", func(s CanonicalSample) *float64 { return s.TemperatureC }),
+		float("grade_pct", func(s CanonicalSample) *float64 { return s.GradePct }),
+		boolean("valid_power", func(s CanonicalSample) bool { return s.ValidPower }),
+		boolean("valid_hr", func(s CanonicalSample) bool { return s.ValidHR }),
+		boolean("valid_cadence", func(s CanonicalSample) bool { return s.ValidCadence }),
+		integer("file_offset", func(s CanonicalSample) int64 { return s.FileOffset }),
+		integer("record_index", func(s CanonicalSample) int64 { return int64(s.RecordIndex) }),
+	)
+	if hasWorkColumn(samples) {
+		cols = append(cols, float("work_j", func(s CanonicalSample) *float64 { return s.WorkJ }))
+	}
+	if hasGradeRawColumn(samples) {
+		cols = append(cols, float("grade_raw_pct", func(s CanonicalSample) *float64 { return s.GradeRawPct }))
+	}
+	if timestampFormat == TimestampBoth {
+		cols = append(cols, epochMS)
+	}
+	return cols
+}
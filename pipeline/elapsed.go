@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
+	"github.com/tormoder/fit"
+)
+
+// Elapsed origins accepted by BytesOptions.ElapsedOrigin.
+const (
+	ElapsedOriginFirstRecord = "first_record"   // first record message (default)
+	ElapsedOriginTimerStart  = "timer_start"    // first timer start event
+	ElapsedOriginFileStart   = "file_start"     // file_id time_created
+	ElapsedOriginMovement    = "movement_start" // first sample moving or pedaling
+)
+
+// defaultMovementSpeedMPS is the speed above which a sample counts as moving
+// for movement_start detection.
+const defaultMovementSpeedMPS = 1.0
+
+// resolveElapsedOrigin normalizes an elapsed origin option.
+func resolveElapsedOrigin(origin string) (string, error) {
+	o := strings.ToLower(strings.TrimSpace(origin))
+	switch o {
+	case "":
+		return ElapsedOriginFirstRecord, nil
+	case ElapsedOriginFirstRecord, ElapsedOriginTimerStart, ElapsedOriginFileStart, ElapsedOriginMovement:
+		return o, nil
+	default:
+		return "", fmt.Errorf("unsupported elapsed origin %q (expected %s|%s|%s|%s)", origin, ElapsedOriginFirstRecord, ElapsedOriginTimerStart, ElapsedOriginFileStart, ElapsedOriginMovement)
+	}
+}
+
+// elapsedOriginTime returns the zero point for elapsed_s. It reports false when
+// the requested marker is missing from the file, in which case callers keep the
+// first-record origin.
+func elapsedOriginTime(records []llmexport.RecordEnvelope, origin string) (time.Time, bool) {
+	switch origin {
+	case ElapsedOriginTimerStart:
+		for _, msg := range llmexport.DecodeMessages(records, 21) {
+			event, _ := msg["event"].(uint8)
+			eventType, _ := msg["event_type"].(uint8)
+			if fit.Event(event) != fit.EventTimer || fit.EventType(eventType) != fit.EventTypeStart {
+				continue
+			}
+			if ts, ok := parseMessageTime(msg["timestamp"]); ok {
+				return ts, true
+			}
+		}
+	case ElapsedOriginFileStart:
+		for _, msg := range llmexport.DecodeMessages(records, 0) {
+			if ts, ok := parseMessageTime(msg["time_created"]); ok {
+				return ts, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// movementStartIndex returns the index of the first sample whose speed exceeds
+// speedMPS (0 means 1.0 m/s) or whose valid power is positive, i.e. the true
+// activity start after any stationary "bike on" pre-roll, or -1 when the rider
+// never moves or pedals.
+func movementStartIndex(samples []CanonicalSample, speedMPS float64) int {
+	if speedMPS <= 0 {
+		speedMPS = defaultMovementSpeedMPS
+	}
+	for i, s := range samples {
+		if s.SpeedMPS != nil && *s.SpeedMPS > speedMPS {
+			return i
+		}
+		if s.ValidPower && s.PowerW != nil && *s.PowerW > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// rebaseElapsed recomputes elapsed_s relative to origin. Samples recorded
+// before origin get negative elapsed values.
+func rebaseElapsed(samples []CanonicalSample, origin time.Time) {
+	for i := range samples {
+		samples[i].ElapsedS = samples[i].Timestamp.Sub(origin).Seconds()
+	}
+}
+
+func parseMessageTime(v any) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
@@ -0,0 +1,241 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/tormoder/fit"
+)
+
+// EncodeMeta describes the activity written by EncodeFIT.
+type EncodeMeta struct {
+	// Sport names the session sport as accepted by --sport (e.g. cycling,
+	// running); empty means cycling.
+	Sport string
+	// TimeCreated is the file_id creation time; zero uses the first sample.
+	TimeCreated time.Time
+	// LapStartTimes splits the samples into laps at these instants (the first
+	// lap always starts at the first sample); empty writes a single lap.
+	LapStartTimes []time.Time
+}
+
+// EncodeFIT writes canonical samples, e.g. after trimming, repairing or
+// merging, back to a FIT activity file with file_id, one record per sample,
+// laps, a session and an activity message. Lap and session totals are
+// recomputed from the samples. Samples must be timestamp-ordered, as
+// BuildCanonicalSamples returns them. Positions are not part of canonical
+// samples and are not written. The encoder computes the header and file CRCs.
+func EncodeFIT(samples []CanonicalSample, meta EncodeMeta) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples to encode")
+	}
+	sport := fit.SportCycling
+	if strings.TrimSpace(meta.Sport) != "" {
+		s, err := analyzer.ParseSport(meta.Sport)
+		if err != nil {
+			return nil, err
+		}
+		sport = s
+	}
+
+	file, err := fit.NewFile(fit.FileTypeActivity, fit.NewHeader(fit.V20, true))
+	if err != nil {
+		return nil, fmt.Errorf("new fit file: %w", err)
+	}
+	file.FileId.TimeCreated = meta.TimeCreated
+	if file.FileId.TimeCreated.IsZero() {
+		file.FileId.TimeCreated = samples[0].Timestamp
+	}
+	activity, err := file.Activity()
+	if err != nil {
+		return nil, fmt.Errorf("activity accessor: %w", err)
+	}
+
+	boundaries := append([]time.Time(nil), meta.LapStartTimes...)
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+
+	var lap, session encodeTotals
+	lap.reset(samples[0])
+	session.reset(samples[0])
+	next := 0
+	for next < len(boundaries) && !boundaries[next].After(samples[0].Timestamp) {
+		next++
+	}
+	for i, s := range samples {
+		if i > 0 && next < len(boundaries) && !s.Timestamp.Before(boundaries[next]) {
+			activity.Laps = append(activity.Laps, lap.lapMsg(sport, s.Timestamp))
+			lap.reset(s)
+			for next < len(boundaries) && !boundaries[next].After(s.Timestamp) {
+				next++
+			}
+		}
+		activity.Records = append(activity.Records, recordMsgFromSample(s))
+		lap.add(s)
+		session.add(s)
+	}
+	last := samples[len(samples)-1]
+	activity.Laps = append(activity.Laps, lap.lapMsg(sport, last.Timestamp))
+
+	sessionMsg := session.sessionMsg(sport, last.Timestamp)
+	sessionMsg.NumLaps = uint16(len(activity.Laps))
+	activity.Sessions = append(activity.Sessions, sessionMsg)
+
+	act := fit.NewActivityMsg()
+	act.Timestamp = last.Timestamp
+	act.TotalTimerTime = sessionMsg.TotalTimerTime
+	act.NumSessions = 1
+	activity.Activity = act
+
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, file, binary.LittleEndian); err != nil {
+		return nil, fmt.Errorf("encode fit: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// recordMsgFromSample maps a canonical sample onto a record message; missing
+// or invalid values stay at the FIT invalid sentinels.
+func recordMsgFromSample(s CanonicalSample) *fit.RecordMsg {
+	rec := fit.NewRecordMsg()
+	rec.Timestamp = s.Timestamp
+	if s.ValidPower && s.PowerW != nil {
+		rec.Power = uint16(clampFloat(math.Round(*s.PowerW), 0, math.MaxUint16-1))
+	}
+	if s.ValidHR && s.HRBPM != nil {
+		rec.HeartRate = uint8(clampFloat(math.Round(*s.HRBPM), 0, math.MaxUint8-1))
+	}
+	if s.ValidCadence && s.CadenceRPM != nil {
+		rec.Cadence = uint8(clampFloat(math.Round(*s.CadenceRPM), 0, math.MaxUint8-1))
+	}
+	if s.SpeedMPS != nil {
+		rec.Speed = uint16(clampFloat(math.Round(*s.SpeedMPS*1000), 0, math.MaxUint16-1))
+	}
+	if s.DistanceM != nil {
+		rec.Distance = uint32(clampFloat(math.Round(*s.DistanceM*100), 0, math.MaxUint32-1))
+	}
+	if s.AltitudeM != nil {
+		rec.Altitude = uint16(clampFloat(math.Round((*s.AltitudeM+500)*5), 0, math.MaxUint16-1))
+	}
+	if s.TemperatureC != nil {
+		rec.Temperature = int8(clampFloat(math.Round(*s.TemperatureC), math.MinInt8, math.MaxInt8-1))
+	}
+	if s.GradePct != nil {
+		rec.Grade = int16(clampFloat(math.Round(*s.GradePct*100), math.MinInt16, math.MaxInt16-1))
+	}
+	return rec
+}
+
+// encodeTotals accumulates the lap/session aggregates EncodeFIT recomputes.
+type encodeTotals struct {
+	first                 CanonicalSample
+	power, hr, cadence    float64
+	nPower, nHR, nCadence int
+	maxPower, maxHR       float64
+	firstDist, lastDist   float64
+	haveDist              bool
+}
+
+func (t *encodeTotals) reset(first CanonicalSample) {
+	*t = encodeTotals{first: first}
+}
+
+func (t *encodeTotals) add(s CanonicalSample) {
+	if s.ValidPower && s.PowerW != nil {
+		t.power += *s.PowerW
+		t.nPower++
+		t.maxPower = math.Max(t.maxPower, *s.PowerW)
+	}
+	if s.ValidHR && s.HRBPM != nil {
+		t.hr += *s.HRBPM
+		t.nHR++
+		t.maxHR = math.Max(t.maxHR, *s.HRBPM)
+	}
+	if s.ValidCadence && s.CadenceRPM != nil {
+		t.cadence += *s.CadenceRPM
+		t.nCadence++
+	}
+	if s.DistanceM != nil {
+		if !t.haveDist {
+			t.firstDist = *s.DistanceM
+			t.haveDist = true
+		}
+		t.lastDist = *s.DistanceM
+	}
+}
+
+// lapMsg closes the accumulated span at end, the next lap's first sample or
+// the final sample, so consecutive laps tile the session without gaps.
+func (t *encodeTotals) lapMsg(sport fit.Sport, end time.Time) *fit.LapMsg {
+	lap := fit.NewLapMsg()
+	lap.StartTime = t.first.Timestamp
+	lap.Timestamp = end
+	lap.TotalElapsedTime = t.durationMS(end)
+	lap.TotalTimerTime = lap.TotalElapsedTime
+	lap.Sport = sport
+	lap.LapTrigger = fit.LapTriggerManual
+	if t.haveDist {
+		lap.TotalDistance = t.distanceCM()
+	}
+	if t.nPower > 0 {
+		lap.AvgPower, lap.MaxPower = t.avgPower(), uint16(math.Round(t.maxPower))
+	}
+	if t.nHR > 0 {
+		lap.AvgHeartRate, lap.MaxHeartRate = t.avgHR(), uint8(math.Round(t.maxHR))
+	}
+	if t.nCadence > 0 {
+		lap.AvgCadence = t.avgCadence()
+	}
+	return lap
+}
+
+func (t *encodeTotals) sessionMsg(sport fit.Sport, end time.Time) *fit.SessionMsg {
+	session := fit.NewSessionMsg()
+	session.StartTime = t.first.Timestamp
+	session.Timestamp = end
+	session.TotalElapsedTime = t.durationMS(end)
+	session.TotalTimerTime = session.TotalElapsedTime
+	session.Sport = sport
+	if t.haveDist {
+		session.TotalDistance = t.distanceCM()
+	}
+	if t.nPower > 0 {
+		session.AvgPower, session.MaxPower = t.avgPower(), uint16(math.Round(t.maxPower))
+	}
+	if t.nHR > 0 {
+		session.AvgHeartRate, session.MaxHeartRate = t.avgHR(), uint8(math.Round(t.maxHR))
+	}
+	if t.nCadence > 0 {
+		session.AvgCadence = t.avgCadence()
+	}
+	return session
+}
+
+func (t *encodeTotals) durationMS(end time.Time) uint32 {
+	return uint32(math.Round(end.Sub(t.first.Timestamp).Seconds() * 1000))
+}
+
+func (t *encodeTotals) distanceCM() uint32 {
+	return uint32(math.Round(math.Max(0, t.lastDist-t.firstDist) * 100))
+}
+
+func (t *encodeTotals) avgPower() uint16 {
+	return uint16(math.Round(t.power / float64(t.nPower)))
+}
+
+func (t *encodeTotals) avgHR() uint8 {
+	return uint8(math.Round(t.hr / float64(t.nHR)))
+}
+
+func (t *encodeTotals) avgCadence() uint8 {
+	return uint8(math.Round(t.cadence / float64(t.nCadence)))
+}
+
+func clampFloat(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"text/tabwriter"
+)
+
+// ExplainFTP renders the ranked FTP candidates and the chosen one as a
+// human-readable table, for the fit_analyze --explain flag. Candidates are
+// listed in ranking order (source priority, then confidence). The "Why" line
+// gives the ranking rule that put the chosen candidate first; analysisFTPW is
+// the FTP the analyzer used for IF/TSS and zones (0 if unknown), and a
+// mismatch with the chosen FTP is flagged.
+func ExplainFTP(sources []FTPCandidate, used *FTPCandidate, analysisFTPW float64) string {
+	var b strings.Builder
+	if len(sources) == 0 {
+		b.WriteString("FTP candidates: none found; IF/TSS unavailable\n")
+		return b.String()
+	}
+	b.WriteString("FTP candidates (ranked):\n")
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  #\tsource\tftp_w\tconfidence\tmessage\treason")
+	for i, c := range sources {
+		fmt.Fprintf(tw, "  %d\t%s\t%.0f\t%.2f\t%s\t%s\n", i+1, c.Source, c.FTPW, c.Confidence, dashIfEmpty(c.Message), dashIfEmpty(c.Reason))
+	}
+	tw.Flush()
+	if used != nil {
+		fmt.Fprintf(&b, "FTP used: %.0f W from %s\n", used.FTPW, used.Source)
+		fmt.Fprintf(&b, "Why: %s\n", ftpRankingReason(sources))
+		if analysisFTPW > 0 && math.Abs(analysisFTPW-used.FTPW) >= 0.5 {
+			fmt.Fprintf(&b, "Mismatch: the analyzer computed IF/TSS and zones with %.0f W, not the %.0f W used here\n", analysisFTPW, used.FTPW)
+		}
+	}
+	return b.String()
+}
+
+func dashIfEmpty(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
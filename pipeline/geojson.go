@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
+	"github.com/tormoder/fit"
+)
+
+// GeoJSONFeatureCollection is an RFC 7946 FeatureCollection for activity.geojson.
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"` // FeatureCollection
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is one RFC 7946 Feature.
+type GeoJSONFeature struct {
+	Type       string          `json:"type"` // Feature
+	Geometry   GeoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// GeoJSONGeometry is a Point ([lng, lat]) or LineString ([[lng, lat], ...]).
+type GeoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// buildActivityGeoJSON returns the GPS track as one LineString feature with
+// activity properties and, when withPoints is set, one Point feature per fix
+// carrying its timestamp and valid power/heart rate. Coordinates are
+// [longitude, latitude] as RFC 7946 requires, rounded to 5 decimals. It
+// returns nil when the file has fewer than two valid positions.
+func buildActivityGeoJSON(records []*fit.RecordMsg, sourceName string, withPoints bool) *GeoJSONFeatureCollection {
+	line := make([][2]float64, 0, len(records))
+	var points []GeoJSONFeature
+	var start, end time.Time
+	for _, rec := range records {
+		if rec == nil || rec.PositionLat.Invalid() || rec.PositionLong.Invalid() {
+			continue
+		}
+		coord := [2]float64{roundCoord(rec.PositionLong.Degrees()), roundCoord(rec.PositionLat.Degrees())}
+		line = append(line, coord)
+		if start.IsZero() {
+			start = rec.Timestamp
+		}
+		end = rec.Timestamp
+		if !withPoints {
+			continue
+		}
+		props := map[string]any{"ts_utc_iso": rec.Timestamp.UTC().Format(time.RFC3339)}
+		if !llmexport.IsInvalidUint16(rec.Power) {
+			props["power_w"] = rec.Power
+		}
+		if !llmexport.IsInvalidUint8(rec.HeartRate) {
+			props["hr_bpm"] = rec.HeartRate
+		}
+		points = append(points, GeoJSONFeature{
+			Type:       "Feature",
+			Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: coord},
+			Properties: props,
+		})
+	}
+	if len(line) < 2 {
+		return nil
+	}
+
+	track := GeoJSONFeature{
+		Type:     "Feature",
+		Geometry: GeoJSONGeometry{Type: "LineString", Coordinates: line},
+		Properties: map[string]any{
+			"source":      sourceName,
+			"start_ts":    start.UTC().Format(time.RFC3339),
+			"end_ts":      end.UTC().Format(time.RFC3339),
+			"point_count": len(line),
+		},
+	}
+	return &GeoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: append([]GeoJSONFeature{track}, points...),
+	}
+}
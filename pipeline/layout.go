@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Output layouts accepted by Options.Layout.
+const (
+	LayoutFlat   = "flat"   // every artifact directly in OutDir (default)
+	LayoutNested = "nested" // samples/, messages/ and analysis/ subdirectories
+)
+
+// resolveLayout normalizes an output layout option.
+func resolveLayout(layout string) (string, error) {
+	l := strings.ToLower(strings.TrimSpace(layout))
+	switch l {
+	case "":
+		return LayoutFlat, nil
+	case LayoutFlat, LayoutNested:
+		return l, nil
+	default:
+		return "", fmt.Errorf("unsupported layout %q (expected %s|%s)", layout, LayoutFlat, LayoutNested)
+	}
+}
+
+// artifactRelPath returns where an artifact file lives under OutDir. In the
+// nested layout sample-level data goes to samples/, the lossless message
+// export to messages/, and derived summaries to analysis/; the source copy
+// stays at the root.
+func artifactRelPath(name, layout string) string {
+	if layout != LayoutNested {
+		return name
+	}
+	switch {
+	case name == "source.fit":
+		return name
+	case strings.HasPrefix(name, "canonical_samples."), name == "track_simplified.json", name == "activity.geojson":
+		return filepath.Join("samples", name)
+	case name == "records.jsonl", name == "messages_index.json", name == "manifest.json", name == "scaling_audit.json":
+		return filepath.Join("messages", name)
+	default:
+		return filepath.Join("analysis", name)
+	}
+}
@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+)
+
+// llmContextEffortDurations are the best-effort windows listed in llm_context.md.
+var llmContextEffortDurations = []float64{5, 60, 5 * 60, 20 * 60}
+
+// BuildLLMContextMarkdown renders one compact markdown document combining the
+// activity summary, workout steps (planned vs observed), lap table and best
+// power efforts. It is meant to be pasted into an LLM as-is, so raw sample data
+// is never included and numbers are rounded to what a coach would quote.
+func BuildLLMContextMarkdown(analysis *analyzer.Analysis, summary ActivitySummaryFile, workout WorkoutStructureFile, laps LapSummaryFile, samples []CanonicalSample) string {
+	var b strings.Builder
+	b.WriteString("# Activity Context\n\n")
+
+	b.WriteString("## Summary\n")
+	if analysis != nil {
+		fmt.Fprintf(&b, "- Sport: %s", analysis.Sport)
+		if analysis.SubSport != "" && analysis.SubSport != "Generic" {
+			fmt.Fprintf(&b, " (%s)", analysis.SubSport)
+		}
+		b.WriteString("\n")
+		if !analysis.StartTime.IsZero() {
+			fmt.Fprintf(&b, "- Start: %s\n", analysis.LocalStartTime().Format("2006-01-02 15:04 MST"))
+		}
+	}
+	fmt.Fprintf(&b, "- Duration: %s\n", formatClock(summary.DurationS))
+	fmt.Fprintf(&b, "- Power: %.0f avg / %.0f NP / %.0f max W\n", summary.AvgPowerW, summary.NPW, summary.MaxPowerW)
+	if summary.NPWPerKG != nil {
+		fmt.Fprintf(&b, "- W/kg: %.2f avg / %.2f NP\n", valueOrZero(summary.AvgPowerWPerKG), *summary.NPWPerKG)
+	}
+	if summary.AvgHRBPM > 0 {
+		fmt.Fprintf(&b, "- HR: %.0f avg / %.0f max bpm\n", summary.AvgHRBPM, summary.MaxHRBPM)
+	}
+	if summary.AvgCadenceRPM > 0 {
+		fmt.Fprintf(&b, "- Cadence: %.0f avg rpm\n", summary.AvgCadenceRPM)
+	}
+	fmt.Fprintf(&b, "- Work: %.0f kJ\n", summary.TotalWorkKJ)
+	if summary.FTPWUsed != nil {
+		fmt.Fprintf(&b, "- FTP: %.0f W", *summary.FTPWUsed)
+		if summary.IF != nil && summary.TSSLike != nil {
+			fmt.Fprintf(&b, " | IF %.2f | TSS %.0f", *summary.IF, *summary.TSSLike)
+		}
+		b.WriteString("\n")
+	}
+	if analysis != nil && analysis.WorkoutStructure.CanonicalLabel != "" {
+		fmt.Fprintf(&b, "- Structure: %s (confidence %.0f%%)\n", analysis.WorkoutStructure.CanonicalLabel, analysis.WorkoutStructure.Confidence*100.0)
+	}
+
+	if len(workout.Steps) > 0 {
+		b.WriteString("\n## Workout Steps (planned vs observed)\n")
+		b.WriteString("| # | Step | Duration | Target | Avg W | NP W | In target |\n")
+		b.WriteString("|---|---|---|---|---|---|---|\n")
+		for _, step := range workout.Steps {
+			name := step.StepName
+			if name == "" {
+				name = step.Source
+			}
+			fmt.Fprintf(
+				&b,
+				"| %d | %s | %s | %s | %s | %s | %s |\n",
+				step.StepIndex,
+				name,
+				formatClock(valueOrZero(step.DurationS)),
+				stepTargetLabel(step),
+				formatRounded(step.ObservedAvgPowerW, "%.0f"),
+				formatRounded(step.ObservedNPW, "%.0f"),
+				formatRounded(step.TimeInTargetPct, "%.0f%%"),
+			)
+		}
+	}
+
+	if len(laps.Laps) > 0 {
+		b.WriteString("\n## Laps\n")
+		b.WriteString("| Lap | Duration | Avg W | Max W | Avg HR | Cadence |\n")
+		b.WriteString("|---|---|---|---|---|---|\n")
+		for _, lap := range laps.Laps {
+			fmt.Fprintf(
+				&b,
+				"| %d | %s | %.0f | %.0f | %.0f | %.0f |\n",
+				lap.LapIndex,
+				formatClock(lap.ElapsedS),
+				lap.AvgPowerW,
+				lap.MaxPowerW,
+				lap.AvgHRBPM,
+				lap.AvgCadenceRPM,
+			)
+		}
+	}
+
+	efforts := make([]string, 0, len(llmContextEffortDurations))
+	for _, d := range llmContextEffortDurations {
+		if watts := bestSamplePower(samples, d); watts > 0 {
+			efforts = append(efforts, fmt.Sprintf("- %s: %.0f W", formatClock(d), watts))
+		}
+	}
+	if len(efforts) > 0 {
+		b.WriteString("\n## Best Efforts\n")
+		b.WriteString(strings.Join(efforts, "\n"))
+		b.WriteString("\n")
+	}
+
+	if len(summary.Warnings) > 0 {
+		b.WriteString("\n## Data Notes\n")
+		for _, w := range summary.Warnings {
+			fmt.Fprintf(&b, "- %s\n", w)
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// bestSamplePower returns the best mean power over samples whose elapsed time
+// falls within any trailing window of windowS seconds, or 0 when the activity
+// is shorter than the window.
+func bestSamplePower(samples []CanonicalSample, windowS float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	best := 0.0
+	start := 0
+	sum := 0.0
+	for i, s := range samples {
+		sum += valueOrZero(s.PowerW)
+		for samples[start].ElapsedS <= s.ElapsedS-windowS {
+			sum -= valueOrZero(samples[start].PowerW)
+			start++
+		}
+		if s.ElapsedS-samples[0].ElapsedS < windowS-1 {
+			continue
+		}
+		if mean := sum / float64(i-start+1); mean > best {
+			best = mean
+		}
+	}
+	return best
+}
+
+func stepTargetLabel(step WorkoutStep) string {
+	switch {
+	case step.TargetLowPctFTP != nil && step.TargetHighPctFTP != nil && *step.TargetLowPctFTP != *step.TargetHighPctFTP:
+		return fmt.Sprintf("%.0f-%.0f%% FTP", *step.TargetLowPctFTP, *step.TargetHighPctFTP)
+	case step.TargetLowPctFTP != nil:
+		return fmt.Sprintf("%.0f%% FTP", *step.TargetLowPctFTP)
+	case step.TargetLowW != nil && step.TargetHighW != nil && *step.TargetLowW != *step.TargetHighW:
+		return fmt.Sprintf("%.0f-%.0f W", *step.TargetLowW, *step.TargetHighW)
+	case step.TargetLowW != nil:
+		return fmt.Sprintf("%.0f W", *step.TargetLowW)
+	default:
+		return "-"
+	}
+}
+
+func formatRounded(v *float64, format string) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf(format, *v)
+}
+
+// formatClock renders seconds as h:mm:ss or m:ss.
+func formatClock(seconds float64) string {
+	s := int(seconds + 0.5)
+	if s <= 0 {
+		return "0:00"
+	}
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, (s%3600)/60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+func valueOrZero(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
+	"github.com/tormoder/fit"
+)
+
+const (
+	// mergeToleranceSeconds bounds how far a secondary record may be from a
+	// primary record and still supply its missing channels.
+	mergeToleranceSeconds = 1.0
+	// mergeMinOverlapPct is the share of primary records that must have a
+	// secondary match before the merge is considered well aligned.
+	mergeMinOverlapPct = 50.0
+)
+
+// MergeResult is the output of MergeByTimestamp.
+type MergeResult struct {
+	Data           []byte   `json:"-"`
+	PrimaryRecords int      `json:"primary_records"`
+	MatchedRecords int      `json:"matched_records"`
+	OverlapPct     float64  `json:"overlap_pct"`
+	FilledPower    int      `json:"filled_power"`
+	FilledHR       int      `json:"filled_hr"`
+	FilledCadence  int      `json:"filled_cadence"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// MergeByTimestamp overlays two recordings of the same session, e.g. GPS from
+// a watch (primary) and power from a head unit (secondary). Each primary record
+// is matched to the nearest secondary record by UTC timestamp within 1s, and
+// power, heart rate and cadence missing from the primary are filled from the
+// match. The primary's sessions, laps and positions are kept. This is distinct
+// from joining sequential split rides: both files must cover the same time.
+func MergeByTimestamp(primary, secondary []byte) (*MergeResult, error) {
+	if len(primary) == 0 || len(secondary) == 0 {
+		return nil, fmt.Errorf("primary and secondary fit bytes are required")
+	}
+	primaryFile, err := fit.Decode(bytes.NewReader(primary))
+	if err != nil {
+		return nil, fmt.Errorf("decode primary fit: %w", err)
+	}
+	primaryActivity, err := primaryFile.Activity()
+	if err != nil {
+		return nil, fmt.Errorf("primary activity expected: %w", err)
+	}
+	secondaryActivity, err := decodeActivityBytes(secondary)
+	if err != nil {
+		return nil, fmt.Errorf("decode secondary activity: %w", err)
+	}
+
+	donors := make([]*fit.RecordMsg, 0, len(secondaryActivity.Records))
+	for _, rec := range secondaryActivity.Records {
+		if rec != nil && !rec.Timestamp.IsZero() && !fit.IsBaseTime(rec.Timestamp) {
+			donors = append(donors, rec)
+		}
+	}
+	sort.SliceStable(donors, func(i, j int) bool {
+		return donors[i].Timestamp.Before(donors[j].Timestamp)
+	})
+
+	res := &MergeResult{}
+	for _, rec := range primaryActivity.Records {
+		if rec == nil {
+			continue
+		}
+		res.PrimaryRecords++
+		donor := nearestRecord(donors, rec.Timestamp)
+		if donor == nil {
+			continue
+		}
+		res.MatchedRecords++
+		if llmexport.IsInvalidUint16(rec.Power) && !llmexport.IsInvalidUint16(donor.Power) {
+			rec.Power = donor.Power
+			res.FilledPower++
+		}
+		if llmexport.IsInvalidUint8(rec.HeartRate) && !llmexport.IsInvalidUint8(donor.HeartRate) {
+			rec.HeartRate = donor.HeartRate
+			res.FilledHR++
+		}
+		if llmexport.IsInvalidUint8(rec.Cadence) && !llmexport.IsInvalidUint8(donor.Cadence) {
+			rec.Cadence = donor.Cadence
+			res.FilledCadence++
+		}
+	}
+	if res.PrimaryRecords == 0 {
+		return nil, fmt.Errorf("primary fit has no record messages")
+	}
+	res.OverlapPct = float64(res.MatchedRecords) / float64(res.PrimaryRecords) * 100.0
+	if res.MatchedRecords == 0 {
+		return nil, fmt.Errorf("fit files do not overlap in time (no records within %.0fs)", mergeToleranceSeconds)
+	}
+	if res.OverlapPct < mergeMinOverlapPct {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("poor overlap: only %.0f%% of primary records matched the secondary file", res.OverlapPct))
+	}
+	if res.FilledPower+res.FilledHR+res.FilledCadence == 0 {
+		res.Warnings = append(res.Warnings, "secondary file supplied no missing channels")
+	}
+
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, primaryFile, binary.LittleEndian); err != nil {
+		return nil, fmt.Errorf("encode merged fit: %w", err)
+	}
+	res.Data = buf.Bytes()
+	return res, nil
+}
+
+// nearestRecord returns the record closest to ts within mergeToleranceSeconds.
+func nearestRecord(sorted []*fit.RecordMsg, ts time.Time) *fit.RecordMsg {
+	if len(sorted) == 0 || ts.IsZero() {
+		return nil
+	}
+	i := sort.Search(len(sorted), func(i int) bool {
+		return !sorted[i].Timestamp.Before(ts)
+	})
+	var best *fit.RecordMsg
+	bestDelta := mergeToleranceSeconds
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(sorted) {
+			continue
+		}
+		delta := math.Abs(sorted[j].Timestamp.Sub(ts).Seconds())
+		if delta <= bestDelta {
+			best = sorted[j]
+			bestDelta = delta
+		}
+	}
+	return best
+}
@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunMetrics captures ingestion health for one pipeline run.
+type RunMetrics struct {
+	FileBytes      int     `json:"file_bytes"`
+	Records        int     `json:"records"`
+	Warnings       int     `json:"warnings"`
+	ParseSeconds   float64 `json:"parse_seconds"`
+	AnalyzeSeconds float64 `json:"analyze_seconds"`
+	TotalSeconds   float64 `json:"total_seconds"`
+}
+
+// Prometheus renders the metrics in the Prometheus text exposition format.
+func (m RunMetrics) Prometheus() string {
+	var b strings.Builder
+	write := func(name, kind, help string, value any) {
+		fmt.Fprintf(&b, "# HELP fit_analyzer_%s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE fit_analyzer_%s %s\n", name, kind)
+		fmt.Fprintf(&b, "fit_analyzer_%s %v\n", name, value)
+	}
+	write("file_bytes", "gauge", "Size of the input FIT file in bytes.", m.FileBytes)
+	write("records", "gauge", "FIT records (definition and data) parsed.", m.Records)
+	write("warnings", "gauge", "Warnings emitted for the run.", m.Warnings)
+	write("parse_seconds", "gauge", "Time spent parsing the FIT file.", m.ParseSeconds)
+	write("analyze_seconds", "gauge", "Time spent in activity analysis.", m.AnalyzeSeconds)
+	write("total_seconds", "gauge", "Wall time for the whole run.", m.TotalSeconds)
+	return b.String()
+}
+
+func secondsSince(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
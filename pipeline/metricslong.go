@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+)
+
+// metricUnitSuffixes maps JSON field name suffixes to the unit column of
+// metrics_long.csv. Longer suffixes come first so _w_per_kg wins over _kg.
+var metricUnitSuffixes = []struct {
+	suffix string
+	unit   string
+}{
+	{"_w_per_kg", "W/kg"},
+	{"_w_used", "W"},
+	{"_per_min", "1/min"},
+	{"_grams_estimate", "g"},
+	{"_kilojoules", "kJ"},
+	{"_seconds", "s"},
+	{"_meters", "m"},
+	{"_watts", "W"},
+	{"_hours", "h"},
+	{"_bpm", "bpm"},
+	{"_rpm", "rpm"},
+	{"_mps", "m/s"},
+	{"_pct", "%"},
+	{"_kj", "kJ"},
+	{"_kg", "kg"},
+	{"_w", "W"},
+	{"_s", "s"},
+	{"_m", "m"},
+}
+
+// marshalMetricsLong renders every numeric scalar of the activity summary and
+// the analysis as metric,value,unit rows, in struct field order. Metric names
+// are the JSON paths prefixed with summary. or analysis.; nil pointers and
+// zero-valued omitempty fields are skipped as they are in the JSON.
+func marshalMetricsLong(summary ActivitySummaryFile, analysis *analyzer.Analysis) ([]byte, error) {
+	var rows [][]string
+	rows = appendMetricRows(rows, "summary.", reflect.ValueOf(summary))
+	if analysis != nil {
+		rows = appendMetricRows(rows, "analysis.", reflect.ValueOf(*analysis))
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write([]string{"metric", "value", "unit"}); err != nil {
+		return nil, err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func appendMetricRows(rows [][]string, prefix string, v reflect.Value) [][]string {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			rows = append(rows, []string{prefix + name, formatFloat(fv.Float()), metricUnit(name)})
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			rows = append(rows, []string{prefix + name, strconv.FormatInt(fv.Int(), 10), metricUnit(name)})
+		case reflect.Struct:
+			if fv.Type() != reflect.TypeOf(time.Time{}) {
+				rows = appendMetricRows(rows, prefix+name+".", fv)
+			}
+		}
+	}
+	return rows
+}
+
+func metricUnit(name string) string {
+	if name == "calories" {
+		return "kcal"
+	}
+	for _, s := range metricUnitSuffixes {
+		if strings.HasSuffix(name, s.suffix) {
+			return s.unit
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
+	"github.com/tormoder/fit"
+)
+
+// isMonitoringFIT reports whether the file_id marks a monitoring (wellness)
+// file, which has no sessions or records to analyze as an activity.
+func isMonitoringFIT(data []byte) bool {
+	_, id, err := fit.DecodeHeaderAndFileID(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	return analyzer.IsMonitoringFileType(id.Type)
+}
+
+// runMonitoringBytes produces monitoring_summary.json plus the lossless
+// records.jsonl and manifest.json for a monitoring file. Activity artifacts
+// (canonical samples, laps, workout structure, ...) do not apply.
+func runMonitoringBytes(opts BytesOptions, want map[string]bool, bundle *llmexport.ParsedBundle, sourceName string, warnings []string, runStart time.Time, parseSeconds float64) (*BytesResult, error) {
+	files := make(map[string][]byte, 4)
+	records := bundle.Records
+
+	analyzeStart := time.Now()
+	summary, err := analyzer.AnalyzeMonitoringBytes(opts.FitData, sourceName, analyzer.MonitoringConfig{
+		HeartRateSamples: llmexport.MonitoringHeartRateSamples(records),
+		RestingHeartRate: llmexport.MonitoringRestingHeartRate(records),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("analyze monitoring bytes: %w", err)
+	}
+	analyzeSeconds := secondsSince(analyzeStart)
+
+	if want[ArtifactMonitoring] {
+		summaryJSON, err := llmexport.MarshalJSON(summary)
+		if err != nil {
+			return nil, fmt.Errorf("marshal monitoring summary: %w", err)
+		}
+		files["monitoring_summary.json"] = summaryJSON
+	}
+
+	if want[ArtifactRecords] {
+		recordsJSONL, err := llmexport.MarshalJSONL(records)
+		if err != nil {
+			return nil, fmt.Errorf("marshal records jsonl: %w", err)
+		}
+		files["records.jsonl"] = recordsJSONL
+	}
+
+	if want[ArtifactManifest] {
+		// RunBytes has already validated the layout.
+		layout, _ := resolveLayout(opts.Layout)
+		manifest, err := buildManifest(sourceName, opts.FitData, bundle, llmexport.MessageCounts(records), "", warnings, layout, opts.VerboseManifest)
+		if err != nil {
+			return nil, fmt.Errorf("build manifest: %w", err)
+		}
+		manifest.WorkoutStructurePath = ""
+		manifestJSON, err := llmexport.MarshalJSON(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("marshal manifest: %w", err)
+		}
+		files["manifest.json"] = manifestJSON
+	}
+
+	if opts.CopySource {
+		files["source.fit"] = append([]byte(nil), opts.FitData...)
+	}
+
+	warnings = dedupeStrings(warnings)
+	return &BytesResult{
+		Files:      files,
+		Monitoring: summary,
+		Warnings:   warnings,
+		Metrics: RunMetrics{
+			FileBytes:      len(opts.FitData),
+			Records:        len(records),
+			Warnings:       len(warnings),
+			ParseSeconds:   parseSeconds,
+			AnalyzeSeconds: analyzeSeconds,
+			TotalSeconds:   secondsSince(runStart),
+		},
+	}, nil
+}
@@ -4,6 +4,6 @@ package pipeline
 
 import "fmt"
 
-func marshalCanonicalParquet(_ []CanonicalSample) ([]byte, error) {
+func marshalCanonicalParquet(_ []CanonicalSample, _ string) ([]byte, error) {
 	return nil, fmt.Errorf("parquet generation is not available in js/wasm runtime")
 }
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"math"
+	"sort"
+
+	"github.com/tormoder/fit"
+)
+
+const (
+	// reconcileToleranceS and reconcileTolerancePct bound how far two
+	// durations may differ before reconciliation.json lists them; head units
+	// round timer totals and the last record rarely lands on the session end.
+	reconcileToleranceS   = 2.0
+	reconcileTolerancePct = 0.5
+)
+
+// buildReconciliation compares the session's elapsed/timer/moving times with
+// the record timestamp span and the timer time implied by timer start/stop
+// events. A timer still running after the last event is closed at the last
+// record. Each pair that should agree and differs by more than 2 s (or 0.5 %)
+// becomes a discrepancy with a likely cause.
+func buildReconciliation(activity *fit.ActivityFile, samples []CanonicalSample) ReconciliationFile {
+	out := ReconciliationFile{SampleCount: len(samples), Discrepancies: []ReconciliationDiscrepancy{}}
+	if len(samples) > 1 {
+		out.SampleSpanS = round1(samples[len(samples)-1].Timestamp.Sub(samples[0].Timestamp).Seconds())
+	}
+	if activity == nil {
+		return out
+	}
+
+	var elapsed, timer, moving float64
+	for _, session := range activity.Sessions {
+		if session == nil {
+			continue
+		}
+		elapsed += positiveSeconds(session.GetTotalElapsedTimeScaled())
+		timer += positiveSeconds(session.GetTotalTimerTimeScaled())
+		moving += positiveSeconds(session.GetTotalMovingTimeScaled())
+	}
+	out.SessionElapsedS = positivePtr(elapsed)
+	out.SessionTimerS = positivePtr(timer)
+	out.SessionMovingS = positivePtr(moving)
+
+	eventTimer, pauses, ok := eventTimerSeconds(activity.Events, samples)
+	if ok {
+		out.EventTimerS = floatPtr(round1(eventTimer))
+		out.TimerPauses = pauses
+	}
+
+	add := func(left string, l *float64, right string, r *float64, note string) {
+		if l == nil || r == nil {
+			return
+		}
+		diff := *l - *r
+		tolerance := math.Max(reconcileToleranceS, math.Max(*l, *r)*reconcileTolerancePct/100)
+		if math.Abs(diff) <= tolerance {
+			return
+		}
+		out.Discrepancies = append(out.Discrepancies, ReconciliationDiscrepancy{
+			Left: left, LeftS: *l, Right: right, RightS: *r, DiffS: round1(diff), Note: note,
+		})
+	}
+	span := positivePtr(out.SampleSpanS)
+	add("session_elapsed_s", out.SessionElapsedS, "sample_span_s", span,
+		"records do not cover the session; the file may be trimmed, merged or missing records at the start or end")
+	add("session_timer_s", out.SessionTimerS, "event_timer_s", out.EventTimerS,
+		"the head unit's timer disagrees with its own start/stop events; metrics based on timer time will differ")
+	if out.SessionMovingS != nil && out.SessionTimerS != nil && *out.SessionMovingS > *out.SessionTimerS {
+		add("session_moving_s", out.SessionMovingS, "session_timer_s", out.SessionTimerS,
+			"moving time exceeds timer time, which a consistent device cannot record")
+	}
+	if pauses == 0 {
+		add("session_timer_s", out.SessionTimerS, "sample_span_s", span,
+			"no timer pauses were recorded, yet timer time differs from the record span; auto-pause may have dropped records without events")
+	}
+	return out
+}
+
+// eventTimerSeconds sums the spans between timer start and stop events. It
+// reports false when the file has no timer events.
+func eventTimerSeconds(events []*fit.EventMsg, samples []CanonicalSample) (total float64, pauses int, ok bool) {
+	timerEvents := make([]*fit.EventMsg, 0, len(events))
+	for _, ev := range events {
+		if ev != nil && ev.Event == fit.EventTimer && !ev.Timestamp.IsZero() {
+			timerEvents = append(timerEvents, ev)
+		}
+	}
+	if len(timerEvents) == 0 {
+		return 0, 0, false
+	}
+	sort.SliceStable(timerEvents, func(i, j int) bool { return timerEvents[i].Timestamp.Before(timerEvents[j].Timestamp) })
+
+	running := false
+	start := timerEvents[0].Timestamp
+	for _, ev := range timerEvents {
+		switch ev.EventType {
+		case fit.EventTypeStart:
+			if !running {
+				running, start = true, ev.Timestamp
+			}
+		case fit.EventTypeStop, fit.EventTypeStopAll, fit.EventTypeStopDisable, fit.EventTypeStopDisableAll:
+			if running {
+				total += ev.Timestamp.Sub(start).Seconds()
+				running = false
+				pauses++
+			}
+		}
+	}
+	if running && len(samples) > 0 {
+		if end := samples[len(samples)-1].Timestamp; end.After(start) {
+			total += end.Sub(start).Seconds()
+		}
+	}
+	// The final stop ends the ride rather than pausing it.
+	if !running && pauses > 0 {
+		pauses--
+	}
+	return total, pauses, true
+}
+
+func positiveSeconds(v float64) float64 {
+	if math.IsNaN(v) || v <= 0 {
+		return 0
+	}
+	return v
+}
+
+func positivePtr(v float64) *float64 {
+	if v <= 0 {
+		return nil
+	}
+	return floatPtr(round1(v))
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"os"
@@ -14,76 +15,134 @@ import (
 	"time"
 
 	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/lucasjlepore/fit-analyzer/internal/npower"
 	"github.com/lucasjlepore/fit-analyzer/llmexport"
 	"github.com/tormoder/fit"
 )
 
 // Run executes the full fit_analyze pipeline and writes all required artifacts.
 func Run(opts Options) (*Result, error) {
+	runStart := time.Now()
 	if strings.TrimSpace(opts.FitPath) == "" {
 		return nil, fmt.Errorf("fit path is required")
 	}
 	if strings.TrimSpace(opts.OutDir) == "" {
 		return nil, fmt.Errorf("output directory is required")
 	}
+	layout, err := resolveLayout(opts.Layout)
+	if err != nil {
+		return nil, err
+	}
 	if err := ensureOutputDir(opts.OutDir, opts.Overwrite); err != nil {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(opts.FitPath)
-	if err != nil {
-		return nil, fmt.Errorf("read fit file: %w", err)
+	data := opts.FitData
+	if len(data) == 0 {
+		data, err = os.ReadFile(opts.FitPath)
+		if err != nil {
+			return nil, fmt.Errorf("read fit file: %w", err)
+		}
 	}
 
 	bytesResult, err := RunBytes(BytesOptions{
-		SourceFileName: filepath.Base(opts.FitPath),
-		FitData:        data,
-		FTPOverride:    opts.FTPOverride,
-		WeightKG:       opts.WeightKG,
-		Format:         opts.Format,
-		CopySource:     opts.CopySource,
+		SourceFileName:          filepath.Base(opts.FitPath),
+		FitData:                 data,
+		FTPOverride:             opts.FTPOverride,
+		WeightKG:                opts.WeightKG,
+		Format:                  opts.Format,
+		CopySource:              opts.CopySource,
+		SportOverride:           opts.SportOverride,
+		IncludeWork:             opts.IncludeWork,
+		Artifacts:               opts.Artifacts,
+		MinStructureConfidence:  opts.MinStructureConfidence,
+		ValidateSchema:          opts.ValidateSchema,
+		TimestampFormat:         opts.TimestampFormat,
+		ElapsedOrigin:           opts.ElapsedOrigin,
+		SmoothGradeWindowS:      opts.SmoothGradeWindowS,
+		StrictFTP:               opts.StrictFTP,
+		NPExcludeCoasting:       opts.NPExcludeCoasting,
+		TargetPowerRounding:     opts.TargetPowerRounding,
+		TargetPctRounding:       opts.TargetPctRounding,
+		ScalingAudit:            opts.ScalingAudit,
+		ExcludeLaps:             opts.ExcludeLaps,
+		FailOnWarnings:          opts.FailOnWarnings,
+		MetricsLong:             opts.MetricsLong,
+		GeoJSON:                 opts.GeoJSON,
+		GeoJSONPoints:           opts.GeoJSONPoints,
+		NPMinSamples:            opts.NPMinSamples,
+		Reconciliation:          opts.Reconciliation,
+		LapLabels:               opts.LapLabels,
+		MainSetGroupingPct:      opts.MainSetGroupingPct,
+		VerboseManifest:         opts.VerboseManifest,
+		MovementSpeedMPS:        opts.MovementSpeedMPS,
+		FTPFromCPModel:          opts.FTPFromCPModel,
+		CleanGPS:                opts.CleanGPS,
+		BestEffortDurationsS:    opts.BestEffortDurationsS,
+		Layout:                  layout,
+		StuckSensorMinSeconds:   opts.StuckSensorMinSeconds,
+		StuckSensorTolerancePct: opts.StuckSensorTolerancePct,
+		DecouplingVIThreshold:   opts.DecouplingVIThreshold,
+		UseMedianForAverages:    opts.UseMedianForAverages,
+		RepTargetTolerancePct:   opts.RepTargetTolerancePct,
+		PreferGPSDistance:       opts.PreferGPSDistance,
+		RecoveryHoursPerTSS:     opts.RecoveryHoursPerTSS,
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	canonicalName := canonicalArtifactName(bytesResult.Files)
-	if canonicalName == "" {
-		canonicalName = "canonical_samples." + formatExtension(strings.ToLower(strings.TrimSpace(opts.Format)))
+	outPath := func(name string) string {
+		if _, ok := bytesResult.Files[name]; !ok {
+			return ""
+		}
+		return filepath.Join(opts.OutDir, artifactRelPath(name, layout))
 	}
-	canonicalPath := filepath.Join(opts.OutDir, canonicalName)
 	result := &Result{
-		OutputDir:            opts.OutDir,
-		AnalysisPath:         filepath.Join(opts.OutDir, "analysis.json"),
-		ManifestPath:         filepath.Join(opts.OutDir, "manifest.json"),
-		RecordsPath:          filepath.Join(opts.OutDir, "records.jsonl"),
-		CanonicalSamplesPath: canonicalPath,
-		MessagesIndexPath:    filepath.Join(opts.OutDir, "messages_index.json"),
-		WorkoutStructurePath: filepath.Join(opts.OutDir, "workout_structure.json"),
-		ActivitySummaryPath:  filepath.Join(opts.OutDir, "activity_summary.json"),
-		Warnings:             append([]string(nil), bytesResult.Warnings...),
-	}
-	if _, ok := bytesResult.Files["lap_summary.json"]; ok {
-		result.LapSummaryPath = filepath.Join(opts.OutDir, "lap_summary.json")
-	}
-	if _, ok := bytesResult.Files["analysis.json"]; !ok {
-		result.AnalysisPath = ""
-	}
-	if _, ok := bytesResult.Files["source.fit"]; ok {
-		result.SourceCopyPath = filepath.Join(opts.OutDir, "source.fit")
+		OutputDir:             opts.OutDir,
+		AnalysisPath:          outPath("analysis.json"),
+		ManifestPath:          outPath("manifest.json"),
+		RecordsPath:           outPath("records.jsonl"),
+		CanonicalSamplesPath:  outPath(canonicalName),
+		MessagesIndexPath:     outPath("messages_index.json"),
+		WorkoutStructurePath:  outPath("workout_structure.json"),
+		LapSummaryPath:        outPath("lap_summary.json"),
+		ActivitySummaryPath:   outPath("activity_summary.json"),
+		LLMContextPath:        outPath("llm_context.md"),
+		AdherencePath:         outPath("adherence.json"),
+		TSSAccumulationPath:   outPath("tss_accumulation.json"),
+		TrackSimplifiedPath:   outPath("track_simplified.json"),
+		EventsPath:            outPath("events.json"),
+		MonitoringSummaryPath: outPath("monitoring_summary.json"),
+		ScalingAuditPath:      outPath("scaling_audit.json"),
+		MetricsLongPath:       outPath("metrics_long.csv"),
+		GeoJSONPath:           outPath("activity.geojson"),
+		ReconciliationPath:    outPath("reconciliation.json"),
+		FTPSources:            bytesResult.FTPSources,
+		FTPUsed:               bytesResult.FTPUsed,
+		AnalysisFTPW:          analysisFTP(bytesResult.Analysis),
+		SourceCopyPath:        outPath("source.fit"),
+		Warnings:              append([]string(nil), bytesResult.Warnings...),
+		Metrics:               bytesResult.Metrics,
 	}
 
 	for name, content := range bytesResult.Files {
-		path := filepath.Join(opts.OutDir, name)
+		path := filepath.Join(opts.OutDir, artifactRelPath(name, layout))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("create %s: %w", filepath.Dir(path), err)
+		}
 		if err := os.WriteFile(path, content, 0o644); err != nil {
 			return nil, fmt.Errorf("write %s: %w", name, err)
 		}
 	}
+	result.Metrics.TotalSeconds = secondsSince(runStart)
 	return result, nil
 }
 
 // RunBytes executes fit analysis fully in memory and returns file payloads.
 func RunBytes(opts BytesOptions) (*BytesResult, error) {
+	runStart := time.Now()
 	if len(opts.FitData) == 0 {
 		return nil, fmt.Errorf("fit bytes are required")
 	}
@@ -94,6 +153,22 @@ func RunBytes(opts BytesOptions) (*BytesResult, error) {
 	if format != "parquet" && format != "csv" {
 		return nil, fmt.Errorf("unsupported format %q (expected parquet|csv)", format)
 	}
+	want, err := resolveArtifacts(opts.Artifacts)
+	if err != nil {
+		return nil, err
+	}
+	timestampFormat, err := resolveTimestampFormat(opts.TimestampFormat)
+	if err != nil {
+		return nil, err
+	}
+	elapsedOrigin, err := resolveElapsedOrigin(opts.ElapsedOrigin)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := resolveLayout(opts.Layout)
+	if err != nil {
+		return nil, err
+	}
 
 	sourceName := strings.TrimSpace(opts.SourceFileName)
 	if sourceName == "" {
@@ -107,74 +182,207 @@ func RunBytes(opts BytesOptions) (*BytesResult, error) {
 	if opts.FTPOverride < 0 {
 		warnings = append(warnings, "ftp override must be non-negative; ignoring provided value")
 	}
+	if opts.FTPOverride > 0 && (opts.FTPOverride < minPlausibleFTPW || opts.FTPOverride > maxPlausibleFTPW) {
+		if opts.StrictFTP {
+			return nil, fmt.Errorf("ftp override %.0f W is outside plausible range %.0f-%.0f W", opts.FTPOverride, minPlausibleFTPW, maxPlausibleFTPW)
+		}
+		warnings = append(warnings, fmt.Sprintf("ftp override %.0f W is outside plausible range %.0f-%.0f W, likely a typo; IF/TSS are likely wrong", opts.FTPOverride, minPlausibleFTPW, maxPlausibleFTPW))
+	}
 	if opts.WeightKG < 0 {
 		warnings = append(warnings, "weight_kg must be non-negative; W/kg metrics omitted")
 	}
 
+	parseStart := time.Now()
 	bundle, err := llmexport.ParseBytes(opts.FitData)
 	if err != nil {
 		return nil, err
 	}
+	parseSeconds := secondsSince(parseStart)
 	warnings = append(warnings, llmexport.BuildWarningsFromBundle(bundle)...)
+	if isMonitoringFIT(opts.FitData) {
+		result, err := runMonitoringBytes(opts, want, bundle, sourceName, warnings, runStart, parseSeconds)
+		if err != nil {
+			return nil, err
+		}
+		if err := failOnWarnings(result.Warnings, opts.FailOnWarnings); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
 
 	records := bundle.Records
-	samples, err := buildCanonicalSamples(records)
+	samples, outOfOrder, duplicates, err := buildCanonicalSamples(records)
 	if err != nil {
 		return nil, fmt.Errorf("build canonical samples: %w", err)
 	}
+	if outOfOrder > 0 {
+		warnings = append(warnings, fmt.Sprintf("record timestamps went backwards %d times; canonical samples re-sorted by timestamp", outOfOrder))
+	}
+	if duplicates > 0 {
+		warnings = append(warnings, fmt.Sprintf("merged %d duplicate record messages sharing a timestamp with another record", duplicates))
+	}
+	moveStart := movementStartIndex(samples, opts.MovementSpeedMPS)
+	switch {
+	case elapsedOrigin == ElapsedOriginMovement:
+		if moveStart >= 0 {
+			rebaseElapsed(samples, samples[moveStart].Timestamp)
+		} else {
+			warnings = append(warnings, "no movement or pedaling found; elapsed_s starts at the first record")
+		}
+	case elapsedOrigin != ElapsedOriginFirstRecord:
+		if origin, ok := elapsedOriginTime(records, elapsedOrigin); ok {
+			rebaseElapsed(samples, origin)
+		} else {
+			warnings = append(warnings, fmt.Sprintf("elapsed origin %s not found in file; elapsed_s starts at the first record", elapsedOrigin))
+		}
+	}
 	if len(samples) == 0 {
 		return nil, fmt.Errorf("no global message 20 record samples found")
 	}
+	hrSamples := llmexport.HeartRateSamples(records)
+	if merged := mergeHeartRateSamples(samples, hrSamples); merged > 0 {
+		warnings = append(warnings, fmt.Sprintf("heart rate filled from hr messages (global 132) for %d samples", merged))
+	}
+	if opts.IncludeWork {
+		fillSampleWork(samples)
+	}
+	if opts.SmoothGradeWindowS > 0 {
+		smoothGrade(samples, opts.SmoothGradeWindowS)
+	}
 
-	outputFormat := format
-	var canonical []byte
-	switch format {
-	case "csv":
-		canonical, err = marshalCanonicalCSV(samples)
+	if want[ArtifactCanonical] {
+		outputFormat := format
+		var canonical []byte
+		switch format {
+		case "csv":
+			canonical, err = marshalCanonicalCSV(samples, timestampFormat)
+			if err != nil {
+				return nil, fmt.Errorf("marshal canonical csv: %w", err)
+			}
+		case "parquet":
+			canonical, err = marshalCanonicalParquet(samples, timestampFormat)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("parquet unavailable: %v; falling back to csv", err))
+				canonical, err = marshalCanonicalCSV(samples, timestampFormat)
+				if err != nil {
+					return nil, fmt.Errorf("marshal canonical csv fallback: %w", err)
+				}
+				outputFormat = "csv"
+			}
+		}
+		files["canonical_samples."+formatExtension(outputFormat)] = canonical
+	}
+
+	messagesIndex, messageCounts := buildMessagesIndex(records)
+	if want[ArtifactIndex] {
+		indexJSON, err := llmexport.MarshalJSON(messagesIndex)
 		if err != nil {
-			return nil, fmt.Errorf("marshal canonical csv: %w", err)
+			return nil, fmt.Errorf("marshal messages index: %w", err)
 		}
-	case "parquet":
-		canonical, err = marshalCanonicalParquet(samples)
+		files["messages_index.json"] = indexJSON
+	}
+	if opts.ScalingAudit {
+		auditJSON, err := llmexport.MarshalJSON(buildScalingAudit(records))
 		if err != nil {
-			warnings = append(warnings, fmt.Sprintf("parquet unavailable: %v; falling back to csv", err))
-			canonical, err = marshalCanonicalCSV(samples)
-			if err != nil {
-				return nil, fmt.Errorf("marshal canonical csv fallback: %w", err)
-			}
-			outputFormat = "csv"
+			return nil, fmt.Errorf("marshal scaling audit: %w", err)
 		}
+		files["scaling_audit.json"] = auditJSON
 	}
-	files["canonical_samples."+formatExtension(outputFormat)] = canonical
 
-	indexJSON, err := llmexport.MarshalJSON(buildMessagesIndex(records))
+	activity, err := decodeActivityBytes(opts.FitData)
 	if err != nil {
-		return nil, fmt.Errorf("marshal messages index: %w", err)
+		return nil, fmt.Errorf("decode activity: %w", err)
+	}
+	// Rank the file's FTP sources before analysis so the analyzer computes
+	// IF/TSS and zones from the same FTP that becomes ftp_w_used.
+	sportProfile := llmexport.SportProfile(records)
+	ftpCandidates, ftpWarnings := collectFTPCandidates(records, activity, &analyzer.Analysis{
+		SportProfile:   sportProfile,
+		Best20MinPower: bestSamplePower(samples, 20*60),
+	}, opts.FTPOverride)
+	analyzerFTP, analyzerFTPSource := opts.FTPOverride, ""
+	if used := chooseFTPCandidate(ftpCandidates); analyzerFTP <= 0 && used != nil {
+		analyzerFTP, analyzerFTPSource = used.FTPW, used.Source
 	}
-	files["messages_index.json"] = indexJSON
 
+	analyzeStart := time.Now()
 	analysis, err := analyzer.AnalyzeBytes(opts.FitData, sourceName, analyzer.Config{
-		FTPWatts: opts.FTPOverride,
-		WeightKG: opts.WeightKG,
+		FTPWatts:                analyzerFTP,
+		FTPSource:               analyzerFTPSource,
+		FTPIsOverride:           opts.FTPOverride > 0,
+		WeightKG:                opts.WeightKG,
+		HeartRateSamples:        hrSamples,
+		DeveloperCadence:        llmexport.DeveloperCadenceSamples(records),
+		DeveloperApps:           llmexport.DeveloperApps(records),
+		DeviceZones:             llmexport.DevicePowerZones(records),
+		SportProfile:            sportProfile,
+		Weather:                 llmexport.Weather(records),
+		SportOverride:           opts.SportOverride,
+		MinStructureConfidence:  opts.MinStructureConfidence,
+		ExcludeLaps:             opts.ExcludeLaps,
+		LapLabels:               opts.LapLabels,
+		MainSetGroupingPct:      opts.MainSetGroupingPct,
+		FTPFromCPModel:          opts.FTPFromCPModel,
+		CleanGPS:                opts.CleanGPS,
+		BestEffortDurationsS:    opts.BestEffortDurationsS,
+		StuckSensorMinSeconds:   opts.StuckSensorMinSeconds,
+		StuckSensorTolerancePct: opts.StuckSensorTolerancePct,
+		DecouplingVIThreshold:   opts.DecouplingVIThreshold,
+		UseMedianForAverages:    opts.UseMedianForAverages,
+		RepTargetTolerancePct:   opts.RepTargetTolerancePct,
+		PreferGPSDistance:       opts.PreferGPSDistance,
+		RecoveryHoursPerTSS:     opts.RecoveryHoursPerTSS,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("analyze fit bytes: %w", err)
 	}
-	activity, err := decodeActivityBytes(opts.FitData)
-	if err != nil {
-		return nil, fmt.Errorf("decode activity: %w", err)
+	if opts.FTPOverride > 0 && analysis.IntensityFactor > 0 && (analysis.IntensityFactor < minOverrideIF || analysis.IntensityFactor > maxOverrideIF) {
+		warnings = append(warnings, fmt.Sprintf("ftp override %.0f W implies IF %.2f, outside %.1f-%.1f; the FTP looks inconsistent with this ride", opts.FTPOverride, analysis.IntensityFactor, minOverrideIF, maxOverrideIF))
 	}
-	analysisJSON, err := llmexport.MarshalJSON(analysis)
-	if err != nil {
-		return nil, fmt.Errorf("marshal analysis: %w", err)
+	analyzeSeconds := secondsSince(analyzeStart)
+	analysis.PedalPowerPhase = llmexport.PedalPowerPhase(records)
+	analysis.DeviceTimeInZone = llmexport.DeviceTimeInZone(records)
+	if analysis.SessionNote != "" {
+		warnings = append(warnings, analysis.SessionNote)
+	}
+	if analysis.DistanceNote != "" {
+		warnings = append(warnings, analysis.DistanceNote)
+	}
+	if analysis.PowerSource == analyzer.PowerSourceEstimated {
+		warnings = append(warnings, "power appears estimated (no power meter in device_info); IF/TSS are approximate")
+	}
+	for _, b := range analysis.Batteries {
+		if b.EndStatus == "Low" || b.EndStatus == "Critical" {
+			warnings = append(warnings, fmt.Sprintf("device %d (%s) battery ended %s", b.DeviceIndex, b.Device, strings.ToLower(b.EndStatus)))
+		}
+	}
+	for _, channel := range analysis.StuckSensors {
+		warnings = append(warnings, fmt.Sprintf("%s stayed constant over a long active stretch; likely sensor fault, averages may be corrupted", channel))
+	}
+	if analysis.GPSGlitchCount > 0 {
+		warnings = append(warnings, fmt.Sprintf("gps glitches detected: %d fixes imply implausible speed", analysis.GPSGlitchCount))
+	}
+	if want[ArtifactAnalysis] {
+		analysisJSON, err := llmexport.MarshalJSON(analysis)
+		if err != nil {
+			return nil, fmt.Errorf("marshal analysis: %w", err)
+		}
+		files["analysis.json"] = analysisJSON
 	}
-	files["analysis.json"] = analysisJSON
 
-	ftpCandidates := collectFTPCandidates(records, activity, analysis, opts.FTPOverride)
+	if analyzerFTP <= 0 {
+		if c, ok := analyzerFTPCandidate(analysis, 0); ok {
+			ftpCandidates = rankFTPCandidates(append(ftpCandidates, c))
+		}
+	}
+	warnings = append(warnings, ftpWarnings...)
 	ftpUsed := chooseFTPCandidate(ftpCandidates)
 
 	lapSummary := buildLapSummary(activity, samples)
-	if len(lapSummary.Laps) > 0 {
+	if w := lapAlignmentWarning(analysis, lapSummary); w != "" {
+		warnings = append(warnings, w)
+	}
+	if want[ArtifactLaps] && len(lapSummary.Laps) > 0 {
 		lapJSON, err := llmexport.MarshalJSON(lapSummary)
 		if err != nil {
 			return nil, fmt.Errorf("marshal lap summary: %w", err)
@@ -182,65 +390,230 @@ func RunBytes(opts BytesOptions) (*BytesResult, error) {
 		files["lap_summary.json"] = lapJSON
 	}
 
-	steps := buildWorkoutSteps(records, analysis, samples, lapSummary, ftpUsed)
-	for i := range steps {
-		ftp := 0.0
-		if ftpUsed != nil {
-			ftp = ftpUsed.FTPW
+	steps := BuildWorkoutSteps(records, analysis, samples, lapSummary, SummaryOptions{
+		FTP:                 ftpUsed,
+		TargetPowerRounding: opts.TargetPowerRounding,
+		TargetPctRounding:   opts.TargetPctRounding,
+		TargetTolerancePct:  opts.RepTargetTolerancePct,
+	})
+	workout := WorkoutStructureFile{
+		FTPSources:                 ftpCandidates,
+		FTPWUsed:                   ftpUsed,
+		FTPSpread:                  buildFTPSpread(ftpCandidates, ftpUsed),
+		StructureConfidence:        analysis.WorkoutStructure.Confidence,
+		StructureConfidenceFactors: analysis.WorkoutStructure.ConfidenceFactors,
+		StructureSuppressed:        analysis.WorkoutStructure.Suppressed,
+		Steps:                      steps,
+	}
+	if want[ArtifactWorkout] {
+		workoutJSON, err := llmexport.MarshalJSON(workout)
+		if err != nil {
+			return nil, fmt.Errorf("marshal workout structure: %w", err)
 		}
-		enrichStepCompliance(&steps[i], samples, ftp)
+		files["workout_structure.json"] = workoutJSON
 	}
-	workout := WorkoutStructureFile{
-		FTPSources: ftpCandidates,
-		FTPWUsed:   ftpUsed,
-		Steps:      steps,
+
+	if want[ArtifactAdherence] {
+		if adherence := WorkoutAdherence(steps); adherence != nil {
+			adherenceJSON, err := llmexport.MarshalJSON(adherence)
+			if err != nil {
+				return nil, fmt.Errorf("marshal adherence: %w", err)
+			}
+			files["adherence.json"] = adherenceJSON
+		}
 	}
-	workoutJSON, err := llmexport.MarshalJSON(workout)
-	if err != nil {
-		return nil, fmt.Errorf("marshal workout structure: %w", err)
+
+	if want[ArtifactTSS] {
+		if tss := BuildTSSAccumulation(samples, analysis.FTPWatts, analysis.TrainingStress); tss != nil {
+			tssJSON, err := llmexport.MarshalJSON(tss)
+			if err != nil {
+				return nil, fmt.Errorf("marshal tss accumulation: %w", err)
+			}
+			files["tss_accumulation.json"] = tssJSON
+		}
 	}
-	files["workout_structure.json"] = workoutJSON
 
-	activitySummary := buildActivitySummary(samples, ftpUsed, analysis.ElapsedSeconds, opts.WeightKG, warnings)
+	positionRecords := activity.Records
+	if opts.CleanGPS {
+		positionRecords = analyzer.WithoutGPSGlitches(activity.Records, analysis.GPSGlitchTimes)
+	}
+	if want[ArtifactTrack] {
+		if track := simplifiedTrack(positionRecords, trackMaxPoints); track != nil {
+			trackJSON, err := llmexport.MarshalJSON(track)
+			if err != nil {
+				return nil, fmt.Errorf("marshal simplified track: %w", err)
+			}
+			files["track_simplified.json"] = trackJSON
+		}
+	}
+	if opts.GeoJSON {
+		if collection := buildActivityGeoJSON(positionRecords, sourceName, opts.GeoJSONPoints); collection != nil {
+			geoJSON, err := llmexport.MarshalJSON(collection)
+			if err != nil {
+				return nil, fmt.Errorf("marshal activity.geojson: %w", err)
+			}
+			files["activity.geojson"] = geoJSON
+		}
+	}
+	if opts.Reconciliation {
+		reconciliationJSON, err := llmexport.MarshalJSON(buildReconciliation(activity, samples))
+		if err != nil {
+			return nil, fmt.Errorf("marshal reconciliation: %w", err)
+		}
+		files["reconciliation.json"] = reconciliationJSON
+	}
+	if want[ArtifactEvents] {
+		if events := llmexport.Events(records); len(events) > 0 {
+			eventsJSON, err := llmexport.MarshalJSON(EventsFile{Events: events})
+			if err != nil {
+				return nil, fmt.Errorf("marshal events: %w", err)
+			}
+			files["events.json"] = eventsJSON
+		}
+	}
+
+	summarySamples, summaryDuration := samples, analysis.ElapsedSeconds
+	var moveOffset *float64
+	if moveStart >= 0 {
+		offset := samples[moveStart].Timestamp.Sub(samples[0].Timestamp).Seconds()
+		moveOffset = &offset
+		// With the movement_start origin the summary skips the pre-roll too.
+		if elapsedOrigin == ElapsedOriginMovement && moveStart > 0 {
+			summarySamples = samples[moveStart:]
+			summaryDuration = math.Max(0, summaryDuration-offset)
+		}
+	}
+	activitySummary := buildActivitySummary(summarySamples, ftpUsed, summaryDuration, opts.WeightKG, opts.NPExcludeCoasting, opts.NPMinSamples, warnings)
+	activitySummary.MoveStartOffsetS = moveOffset
+	if opts.WeightKG > 0 {
+		activitySummary.PowerZones = analysis.PowerZones
+	}
 	warnings = dedupeStrings(append(warnings, activitySummary.Warnings...))
-	activityJSON, err := llmexport.MarshalJSON(activitySummary)
-	if err != nil {
-		return nil, fmt.Errorf("marshal activity summary: %w", err)
+	if want[ArtifactSummary] {
+		activityJSON, err := llmexport.MarshalJSON(activitySummary)
+		if err != nil {
+			return nil, fmt.Errorf("marshal activity summary: %w", err)
+		}
+		files["activity_summary.json"] = activityJSON
+	}
+	if opts.MetricsLong {
+		metricsCSV, err := marshalMetricsLong(activitySummary, analysis)
+		if err != nil {
+			return nil, fmt.Errorf("marshal metrics_long.csv: %w", err)
+		}
+		files["metrics_long.csv"] = metricsCSV
 	}
-	files["activity_summary.json"] = activityJSON
 
-	summaryMD := analyzer.BuildTrainingSummaryMarkdown(analysis)
-	if summaryMD != "" {
-		files["training_summary.md"] = append([]byte(summaryMD), '\n')
+	if want[ArtifactMarkdown] {
+		summaryMD := analyzer.BuildTrainingSummaryMarkdown(analysis)
+		if summaryMD != "" {
+			files["training_summary.md"] = append([]byte(summaryMD), '\n')
+		}
 	}
 
-	recordsJSONL, err := llmexport.MarshalJSONL(records)
-	if err != nil {
-		return nil, fmt.Errorf("marshal records jsonl: %w", err)
+	if want[ArtifactContext] {
+		contextMD := BuildLLMContextMarkdown(analysis, activitySummary, workout, lapSummary, samples)
+		files["llm_context.md"] = append([]byte(contextMD), '\n')
 	}
-	files["records.jsonl"] = recordsJSONL
 
-	manifest, err := buildManifest(sourceName, opts.FitData, bundle, warnings)
-	if err != nil {
-		return nil, fmt.Errorf("build manifest: %w", err)
+	if want[ArtifactRecords] {
+		recordsJSONL, err := llmexport.MarshalJSONL(records)
+		if err != nil {
+			return nil, fmt.Errorf("marshal records jsonl: %w", err)
+		}
+		files["records.jsonl"] = recordsJSONL
 	}
-	manifestJSON, err := llmexport.MarshalJSON(manifest)
-	if err != nil {
-		return nil, fmt.Errorf("marshal manifest: %w", err)
+
+	if want[ArtifactManifest] {
+		manifest, err := buildManifest(sourceName, opts.FitData, bundle, messageCounts, analysis.PowerSource, warnings, layout, opts.VerboseManifest)
+		if err != nil {
+			return nil, fmt.Errorf("build manifest: %w", err)
+		}
+		manifestJSON, err := llmexport.MarshalJSON(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("marshal manifest: %w", err)
+		}
+		files["manifest.json"] = manifestJSON
+	}
+
+	if opts.ValidateSchema {
+		if errs := ValidateArtifacts(files); len(errs) > 0 {
+			return nil, fmt.Errorf("artifact schema validation failed: %w", errors.Join(errs...))
+		}
 	}
-	files["manifest.json"] = manifestJSON
 
 	if opts.CopySource {
 		files["source.fit"] = append([]byte(nil), opts.FitData...)
 	}
 
+	warnings = dedupeStrings(warnings)
+	if err := failOnWarnings(warnings, opts.FailOnWarnings); err != nil {
+		return nil, err
+	}
 	return &BytesResult{
-		Files:    files,
-		Analysis: analysis,
-		Warnings: dedupeStrings(warnings),
+		Files:      files,
+		Analysis:   analysis,
+		Warnings:   warnings,
+		FTPSources: ftpCandidates,
+		FTPUsed:    ftpUsed,
+		Metrics: RunMetrics{
+			FileBytes:      len(opts.FitData),
+			Records:        len(records),
+			Warnings:       len(warnings),
+			ParseSeconds:   parseSeconds,
+			AnalyzeSeconds: analyzeSeconds,
+			TotalSeconds:   secondsSince(runStart),
+		},
 	}, nil
 }
 
+// failOnWarnings returns an error listing every warning that contains one of
+// the patterns, so callers can gate on specific data-quality problems.
+func failOnWarnings(warnings, patterns []string) error {
+	var errs []error
+	for _, w := range warnings {
+		for _, pattern := range patterns {
+			if pattern = strings.TrimSpace(pattern); pattern != "" && strings.Contains(w, pattern) {
+				errs = append(errs, errors.New(w))
+				break
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("warnings treated as errors: %w", errors.Join(errs...))
+}
+
+// resolveArtifacts validates requested artifact names. An empty list selects all.
+func resolveArtifacts(names []string) (map[string]bool, error) {
+	want := make(map[string]bool, len(ArtifactNames))
+	if len(names) == 0 {
+		for _, name := range ArtifactNames {
+			want[name] = true
+		}
+		return want, nil
+	}
+	known := make(map[string]bool, len(ArtifactNames))
+	for _, name := range ArtifactNames {
+		known[name] = true
+	}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown artifact %q (expected one of %s)", name, strings.Join(ArtifactNames, ","))
+		}
+		want[name] = true
+	}
+	if len(want) == 0 {
+		return nil, fmt.Errorf("no artifacts selected")
+	}
+	return want, nil
+}
+
 func formatExtension(format string) string {
 	if format == "csv" {
 		return "csv"
@@ -271,7 +644,17 @@ func ensureOutputDir(path string, overwrite bool) error {
 	return nil
 }
 
-func buildManifest(sourceName string, fitBytes []byte, bundle *llmexport.ParsedBundle, warnings []string) (llmexport.Manifest, error) {
+// buildManifest describes the export; its artifact paths are relative to
+// manifest.json's own directory in the given output layout.
+func buildManifest(sourceName string, fitBytes []byte, bundle *llmexport.ParsedBundle, messageCounts map[uint16]int, powerSource string, warnings []string, layout string, verbose bool) (llmexport.Manifest, error) {
+	manifestDir := filepath.Dir(artifactRelPath("manifest.json", layout))
+	relPath := func(name string) string {
+		rel, err := filepath.Rel(manifestDir, artifactRelPath(name, layout))
+		if err != nil {
+			return name
+		}
+		return filepath.ToSlash(rel)
+	}
 	manifest := llmexport.Manifest{
 		FormatVersion:        llmexport.ExportFormatVersion,
 		GeneratedAt:          time.Now().UTC(),
@@ -282,13 +665,15 @@ func buildManifest(sourceName string, fitBytes []byte, bundle *llmexport.ParsedB
 		Header:               bundle.Header,
 		HeaderCRC:            bundle.HeaderCRC,
 		FileCRC:              bundle.FileCRC,
-		RecordsPath:          "records.jsonl",
-		WorkoutStructurePath: "workout_structure.json",
+		RecordsPath:          relPath("records.jsonl"),
+		WorkoutStructurePath: relPath("workout_structure.json"),
+		PowerSource:          powerSource,
 		RecordCount:          len(bundle.Records),
 		DefinitionCount:      bundle.DefinitionCount,
 		DataMessageCount:     bundle.DataMessageCount,
 		LeftoverBytes:        bundle.LeftoverBytesCount,
 		FileIdProjection:     llmexport.ProjectFileIDFromBytes(fitBytes),
+		MessageCounts:        llmexport.NamedMessageCounts(messageCounts),
 		SchemaDescription: llmexport.SchemaDetails{
 			RecordType: "JSONL line-per-FIT-record preserving original order and byte offsets",
 			Notes: []string{
@@ -302,6 +687,10 @@ func buildManifest(sourceName string, fitBytes []byte, bundle *llmexport.ParsedB
 		},
 		Warnings: dedupeStrings(warnings),
 	}
+	if verbose {
+		layout := bundle.RawLayout
+		manifest.RawLayout = &layout
+	}
 	return manifest, nil
 }
 
@@ -313,9 +702,24 @@ func decodeActivityBytes(data []byte) (*fit.ActivityFile, error) {
 	return decoded.Activity()
 }
 
-func buildCanonicalSamples(records []llmexport.RecordEnvelope) ([]CanonicalSample, error) {
+// BuildCanonicalSamples converts parsed records (from llmexport.ParseBytes)
+// into the timestamp-ordered canonical sample stream written to
+// canonical_samples.*, for tools that parse FIT data themselves.
+func BuildCanonicalSamples(records []llmexport.RecordEnvelope) ([]CanonicalSample, error) {
+	samples, _, _, err := buildCanonicalSamples(records)
+	return samples, err
+}
+
+// buildCanonicalSamples returns record samples ordered by timestamp, along with
+// how many records were earlier than their predecessor in file order and how
+// many were merged into another record with the same timestamp. Duplicates
+// are merged after sorting, so they need not be adjacent in the file. Samples
+// keep their original record index and file offset after sorting; a merged
+// sample keeps those of the first record in file order.
+func buildCanonicalSamples(records []llmexport.RecordEnvelope) ([]CanonicalSample, int, int, error) {
 	out := make([]CanonicalSample, 0, 4096)
-	var firstTS time.Time
+	outOfOrder := 0
+	duplicates := 0
 	for _, rec := range records {
 		if rec.RecordKind != "data" || rec.GlobalMessageNum != 20 || rec.Data == nil {
 			continue
@@ -323,7 +727,7 @@ func buildCanonicalSamples(records []llmexport.RecordEnvelope) ([]CanonicalSampl
 
 		flat := rec.Data.Flat
 		if flat == nil {
-			flat = recFlatFromFields(rec.Data.Fields)
+			flat = RecordFlatFromFields(rec.Data.Fields)
 		}
 		if flat == nil || flat.TimestampUTC == "" {
 			continue
@@ -332,14 +736,13 @@ func buildCanonicalSamples(records []llmexport.RecordEnvelope) ([]CanonicalSampl
 		if err != nil {
 			continue
 		}
-		if firstTS.IsZero() {
-			firstTS = ts
+		if n := len(out); n > 0 && ts.Before(out[n-1].Timestamp) {
+			outOfOrder++
 		}
 
 		out = append(out, CanonicalSample{
 			TSUTCISO:     ts.UTC().Format(time.RFC3339),
 			Timestamp:    ts,
-			ElapsedS:     ts.Sub(firstTS).Seconds(),
 			PowerW:       flat.PowerW,
 			HRBPM:        flat.HRBPM,
 			CadenceRPM:   flat.CadenceRPM,
@@ -355,10 +758,89 @@ func buildCanonicalSamples(records []llmexport.RecordEnvelope) ([]CanonicalSampl
 			RecordIndex:  rec.RecordIndex,
 		})
 	}
-	return out, nil
+	if outOfOrder > 0 {
+		sort.SliceStable(out, func(i, j int) bool {
+			return out[i].Timestamp.Before(out[j].Timestamp)
+		})
+	}
+	merged := out[:0]
+	for _, s := range out {
+		if n := len(merged); n > 0 && s.Timestamp.Equal(merged[n-1].Timestamp) {
+			mergeDuplicateSample(&merged[n-1], s)
+			duplicates++
+			continue
+		}
+		merged = append(merged, s)
+	}
+	out = merged
+	if len(out) > 0 {
+		firstTS := out[0].Timestamp
+		for i := range out {
+			out[i].ElapsedS = out[i].Timestamp.Sub(firstTS).Seconds()
+		}
+	}
+	return out, outOfOrder, duplicates, nil
+}
+
+// mergeDuplicateSample folds a re-transmitted record's sample into the sample
+// already built for its timestamp. Values the sample lacks, or holds only as
+// invalid readings, are taken from the duplicate.
+func mergeDuplicateSample(s *CanonicalSample, dup CanonicalSample) {
+	if !s.ValidPower && dup.ValidPower {
+		s.PowerW, s.ValidPower = dup.PowerW, true
+	}
+	if !s.ValidHR && dup.ValidHR {
+		s.HRBPM, s.ValidHR = dup.HRBPM, true
+	}
+	if !s.ValidCadence && dup.ValidCadence {
+		s.CadenceRPM, s.ValidCadence = dup.CadenceRPM, true
+	}
+	if s.SpeedMPS == nil {
+		s.SpeedMPS = dup.SpeedMPS
+	}
+	if s.DistanceM == nil {
+		s.DistanceM = dup.DistanceM
+	}
+	if s.AltitudeM == nil {
+		s.AltitudeM = dup.AltitudeM
+	}
+	if s.TemperatureC == nil {
+		s.TemperatureC = dup.TemperatureC
+	}
+	if s.GradePct == nil {
+		s.GradePct = dup.GradePct
+	}
+}
+
+// mergeHeartRateSamples fills missing HR on canonical samples from hr-message
+// readings (sorted by time) via analyzer.HeartRateAt, so both fill the same
+// records. It returns the fill count.
+func mergeHeartRateSamples(samples []CanonicalSample, hr []analyzer.HeartRateSample) int {
+	if len(hr) == 0 {
+		return 0
+	}
+	merged := 0
+	for i := range samples {
+		if samples[i].ValidHR && samples[i].HRBPM != nil {
+			continue
+		}
+		bpm, ok := analyzer.HeartRateAt(hr, samples[i].Timestamp)
+		if !ok {
+			continue
+		}
+		samples[i].HRBPM = floatPtr(bpm)
+		samples[i].ValidHR = true
+		merged++
+	}
+	return merged
 }
 
-func recFlatFromFields(fields []llmexport.FieldValue) *llmexport.RecordFlat {
+// RecordFlatFromFields maps decoded record (global 20) fields to the
+// semantic fast-path values: timestamp=253, power=7, heart_rate=3,
+// cadence=4, speed=6, distance=5, altitude=2, temperature=13 and grade=9.
+// Invalid sentinels are dropped. It returns nil when the record has no
+// usable timestamp.
+func RecordFlatFromFields(fields []llmexport.FieldValue) *llmexport.RecordFlat {
 	m := make(map[uint8]llmexport.FieldValue, len(fields))
 	for _, f := range fields {
 		m[f.FieldNumber] = f
@@ -391,19 +873,21 @@ func recFlatFromFields(fields []llmexport.FieldValue) *llmexport.RecordFlat {
 		flat.CadenceRPM = v
 		flat.ValidCadence = true
 	}
-	if v := scaledOrDecodedFloat(m[6]); v != nil {
+	if v := scaledOrDecodedFloat(m[6]); v != nil && !m[6].Invalid {
 		flat.SpeedMPS = v
 	}
-	if v := scaledOrDecodedFloat(m[5]); v != nil {
+	if v := scaledOrDecodedFloat(m[5]); v != nil && !m[5].Invalid {
 		flat.DistanceM = v
 	}
-	if v := scaledOrDecodedFloat(m[2]); v != nil {
+	if v := scaledOrDecodedFloat(m[2]); v != nil && !m[2].Invalid {
 		flat.AltitudeM = v
 	}
-	if v := floatFromField(m[13]); v != nil {
+	// Temperature (sint8) and grade (sint16) are signed; their invalid
+	// sentinels are 0x7F and 0x7FFF, so negative values are real readings.
+	if v := floatFromField(m[13]); v != nil && !m[13].Invalid {
 		flat.TemperatureC = v
 	}
-	if v := scaledOrDecodedFloat(m[9]); v != nil {
+	if v := scaledOrDecodedFloat(m[9]); v != nil && !m[9].Invalid {
 		flat.GradePct = v
 	}
 	return flat
@@ -471,11 +955,19 @@ func floatAny(v any) *float64 {
 	}
 }
 
-func buildMessagesIndex(records []llmexport.RecordEnvelope) MessageIndexFile {
+// buildMessagesIndex maps local message types to their latest definitions and
+// returns, from the same pass, the data-message counts per global message
+// number for the manifest's message_counts.
+func buildMessagesIndex(records []llmexport.RecordEnvelope) (MessageIndexFile, map[uint16]int) {
 	localLatest := make(map[int]LocalMessageIndex)
 	reverseSets := make(map[string]map[int]struct{})
+	counts := make(map[uint16]int)
 
 	for _, rec := range records {
+		if rec.RecordKind == "data" {
+			counts[rec.GlobalMessageNum]++
+			continue
+		}
 		if rec.RecordKind != "definition" || rec.Definition == nil {
 			continue
 		}
@@ -526,13 +1018,22 @@ func buildMessagesIndex(records []llmexport.RecordEnvelope) MessageIndexFile {
 	return MessageIndexFile{
 		LocalMessageTypes: localList,
 		ReverseIndex:      reverse,
-	}
+	}, counts
 }
 
-func collectFTPCandidates(records []llmexport.RecordEnvelope, activity *fit.ActivityFile, analysis *analyzer.Analysis, ftpOverride float64) []FTPCandidate {
+// collectFTPCandidates gathers FTP values from the session, the device sport
+// profile, developer fields, the CLI override and the analyzer. Developer-field
+// values that fail plausibleDeveloperFTP are dropped with a warning.
+func collectFTPCandidates(records []llmexport.RecordEnvelope, activity *fit.ActivityFile, analysis *analyzer.Analysis, ftpOverride float64) ([]FTPCandidate, []string) {
 	candidates := make([]FTPCandidate, 0, 6)
+	var warnings []string
+	best20 := 0.0
+	if analysis != nil {
+		best20 = analysis.Best20MinPower
+	}
+	// File sources outside the plausible range are mis-decoded or stale.
 	add := func(c FTPCandidate) {
-		if c.FTPW <= 0 || c.FTPW > 600 {
+		if c.FTPW <= 0 || c.FTPW > maxPlausibleFTPW {
 			return
 		}
 		candidates = append(candidates, c)
@@ -540,7 +1041,7 @@ func collectFTPCandidates(records []llmexport.RecordEnvelope, activity *fit.Acti
 
 	if activity != nil && len(activity.Sessions) > 0 {
 		s := activity.Sessions[0]
-		if s.ThresholdPower != 0 && s.ThresholdPower != ^uint16(0) {
+		if s.ThresholdPower != 0 && !llmexport.IsInvalidUint16(s.ThresholdPower) {
 			add(FTPCandidate{
 				FTPW:       float64(s.ThresholdPower),
 				Source:     "zwift_setting",
@@ -551,91 +1052,145 @@ func collectFTPCandidates(records []llmexport.RecordEnvelope, activity *fit.Acti
 		}
 	}
 
+	if analysis != nil && analysis.SportProfile != nil && analysis.SportProfile.FTPWatts > 0 {
+		add(FTPCandidate{
+			FTPW:       analysis.SportProfile.FTPWatts,
+			Source:     "sport_profile",
+			Message:    "zones_target.functional_threshold_power",
+			Confidence: 0.97,
+			Reason:     "Device sport profile FTP (sport/zones_target messages)",
+		})
+	}
+
+	// Index only the FTP-named developer field descriptions, so records from
+	// data-heavy apps cost one map lookup per developer field, and report each
+	// distinct value once instead of once per record.
 	type devKey struct{ idx, field int }
 	type devDesc struct {
 		name    string
 		baseRaw int
 	}
-	descMap := make(map[devKey]devDesc)
+	type devValue struct {
+		key devKey
+		val float64
+	}
+	ftpFields := make(map[devKey]devDesc)
 	for _, rec := range records {
-		if rec.RecordKind != "data" || rec.Data == nil {
+		if rec.RecordKind != "data" || rec.Data == nil || rec.GlobalMessageNum != 206 {
 			continue
 		}
-		if rec.GlobalMessageNum == 206 {
-			fdIdx := int(fieldFloatValue(rec.Data.Fields, 0))
-			fieldNum := int(fieldFloatValue(rec.Data.Fields, 1))
-			baseRaw := int(fieldFloatValue(rec.Data.Fields, 2))
-			name := fieldStringValue(rec.Data.Fields, 3)
-			if fdIdx >= 0 && fieldNum >= 0 && name != "" {
-				descMap[devKey{idx: fdIdx, field: fieldNum}] = devDesc{name: strings.ToLower(name), baseRaw: baseRaw}
-			}
+		fdIdx := int(fieldFloatValue(rec.Data.Fields, 0))
+		fieldNum := int(fieldFloatValue(rec.Data.Fields, 1))
+		baseRaw := int(fieldFloatValue(rec.Data.Fields, 2))
+		name := strings.ToLower(fieldStringValue(rec.Data.Fields, 3))
+		if fdIdx >= 0 && fieldNum >= 0 && strings.Contains(name, "ftp") {
+			ftpFields[devKey{idx: fdIdx, field: fieldNum}] = devDesc{name: name, baseRaw: baseRaw}
 		}
 	}
+	seenDev := make(map[devValue]struct{})
 	for _, rec := range records {
+		if len(ftpFields) == 0 {
+			break
+		}
 		if rec.RecordKind != "data" || rec.Data == nil {
 			continue
 		}
 		for _, d := range rec.Data.DeveloperFields {
 			key := devKey{idx: int(d.DeveloperDataIdx), field: int(d.FieldNumber)}
-			desc, ok := descMap[key]
+			desc, ok := ftpFields[key]
 			if !ok {
 				continue
 			}
-			if !strings.Contains(desc.name, "ftp") {
+			val := llmexport.DecodeDeveloperNumeric(d, desc.baseRaw)
+			if val <= 0 {
 				continue
 			}
-			val := decodeDeveloperNumeric(d.DecodedByteValues, desc.baseRaw)
-			if val <= 0 {
+			if _, ok := seenDev[devValue{key, val}]; ok {
+				continue
+			}
+			seenDev[devValue{key, val}] = struct{}{}
+			message := fmt.Sprintf("developer_field[%d:%d](%s)", d.DeveloperDataIdx, d.FieldNumber, desc.name)
+			if reason := plausibleDeveloperFTP(val, best20); reason != "" {
+				warnings = append(warnings, fmt.Sprintf("ignored FTP %.0f W from %s: %s", val, message, reason))
 				continue
 			}
 			add(FTPCandidate{
 				FTPW:       val,
 				Source:     "developer_field",
-				Message:    fmt.Sprintf("developer_field[%d:%d](%s)", d.DeveloperDataIdx, d.FieldNumber, desc.name),
+				Message:    message,
 				Confidence: 0.80,
 				Reason:     "Developer field name matched FTP",
 			})
 		}
 	}
 
+	// The override skips the range check: RunBytes has already warned about
+	// (or, with StrictFTP, rejected) an implausible value, and the analyzer
+	// computes IF/TSS and zones from it, so ftp_w_used must be the same value.
 	if ftpOverride > 0 {
-		add(FTPCandidate{
+		candidates = append(candidates, FTPCandidate{
 			FTPW:       ftpOverride,
 			Source:     "unknown",
-			Message:    "cli:--ftp",
+			Message:    ftpOverrideMessage,
 			Confidence: 0.55,
 			Reason:     "CLI override provided",
 		})
 	}
-	if analysis != nil && analysis.FTPWatts > 0 {
-		candidate := FTPCandidate{
-			FTPW:       analysis.FTPWatts,
-			Source:     "analyzer",
-			Message:    "analyzer.ftp_watts",
-			Confidence: 0.60,
-			Reason:     "Analyzer supplied FTP candidate",
-		}
-		switch analysis.FTPSource {
-		case "estimated":
-			candidate.Source = "estimated"
-			candidate.Message = "analyzer.best_20min_estimate"
-			candidate.Reason = "Analyzer estimated FTP from best 20-minute power"
-		case "input":
-			if ftpOverride > 0 {
-				candidate.Source = "unknown"
-				candidate.Message = "analyzer.input_ftp"
-				candidate.Confidence = 0.55
-				candidate.Reason = "Analyzer used CLI override"
-			}
-		case "":
-		default:
-			candidate.Source = analysis.FTPSource
-			candidate.Message = "analyzer." + analysis.FTPSource
+	if c, ok := analyzerFTPCandidate(analysis, ftpOverride); ok {
+		add(c)
+	}
+	return rankFTPCandidates(candidates), dedupeStrings(warnings)
+}
+
+// analysisFTP returns the FTP the analyzer used, or 0 without an analysis
+// (e.g. monitoring files).
+func analysisFTP(analysis *analyzer.Analysis) float64 {
+	if analysis == nil {
+		return 0
+	}
+	return analysis.FTPWatts
+}
+
+// analyzerFTPCandidate describes the FTP the analyzer used, if any. It is not
+// range-checked, since IF/TSS and zones were already computed from it.
+func analyzerFTPCandidate(analysis *analyzer.Analysis, ftpOverride float64) (FTPCandidate, bool) {
+	if analysis == nil || analysis.FTPWatts <= 0 {
+		return FTPCandidate{}, false
+	}
+	candidate := FTPCandidate{
+		FTPW:       analysis.FTPWatts,
+		Source:     "analyzer",
+		Message:    "analyzer.ftp_watts",
+		Confidence: 0.60,
+		Reason:     "Analyzer supplied FTP candidate",
+	}
+	switch analysis.FTPSource {
+	case "estimated":
+		candidate.Source = "estimated"
+		candidate.Message = "analyzer.best_20min_estimate"
+		candidate.Reason = "Analyzer estimated FTP from best 20-minute power"
+	case "cp_model":
+		candidate.Source = "cp_model"
+		candidate.Message = "analyzer.cp_model"
+		candidate.Reason = "Analyzer estimated FTP as critical power from the 2-12 minute power curve"
+	case "input":
+		if ftpOverride > 0 {
+			candidate.Source = "unknown"
+			candidate.Message = "analyzer.input_ftp"
+			candidate.Confidence = 0.55
+			candidate.Reason = "Analyzer used CLI override"
 		}
-		add(candidate)
+	case "":
+	default:
+		candidate.Source = analysis.FTPSource
+		candidate.Message = "analyzer." + analysis.FTPSource
 	}
+	return candidate, true
+}
 
-	// Deterministic de-dup by source+message+rounded ftp.
+// rankFTPCandidates drops duplicate source+message+FTP entries and orders the
+// rest by ftpPriority, then confidence, FTP and message.
+func rankFTPCandidates(candidates []FTPCandidate) []FTPCandidate {
 	seen := make(map[string]struct{})
 	dedup := make([]FTPCandidate, 0, len(candidates))
 	for _, c := range candidates {
@@ -647,7 +1202,7 @@ func collectFTPCandidates(records []llmexport.RecordEnvelope, activity *fit.Acti
 		dedup = append(dedup, c)
 	}
 	sort.Slice(dedup, func(i, j int) bool {
-		pi, pj := ftpPriority(dedup[i].Source), ftpPriority(dedup[j].Source)
+		pi, pj := ftpPriority(dedup[i]), ftpPriority(dedup[j])
 		if pi != pj {
 			return pi > pj
 		}
@@ -662,8 +1217,45 @@ func collectFTPCandidates(records []llmexport.RecordEnvelope, activity *fit.Acti
 	return dedup
 }
 
-func ftpPriority(source string) int {
-	switch source {
+const (
+	minPlausibleFTPW = 50.0
+	maxPlausibleFTPW = 500.0
+	// minOverrideIF and maxOverrideIF bound the intensity factor an FTP
+	// override may imply before it is reported as inconsistent with the ride.
+	minOverrideIF = 0.3
+	maxOverrideIF = 1.3
+	// maxBest20ToFTP bounds best 20-minute power relative to FTP; nobody holds
+	// much more than ~1.3x FTP for 20 minutes, so a lower FTP is bad data.
+	maxBest20ToFTP = 1.3
+)
+
+// plausibleDeveloperFTP returns why a developer-field FTP is rejected, or ""
+// when it is usable. Developer fields are decoded heuristically, so values
+// outside 50-500 W or well below the ride's best 20-minute power are treated
+// as mis-decoded.
+func plausibleDeveloperFTP(ftp, best20 float64) string {
+	if ftp < minPlausibleFTPW || ftp > maxPlausibleFTPW {
+		return fmt.Sprintf("outside plausible range %.0f-%.0f W", minPlausibleFTPW, maxPlausibleFTPW)
+	}
+	if best20 > 0 && best20 > ftp*maxBest20ToFTP {
+		return fmt.Sprintf("inconsistent with best 20-minute power %.0f W", best20)
+	}
+	return ""
+}
+
+// ftpOverrideMessage marks the --ftp candidate.
+const ftpOverrideMessage = "cli:--ftp"
+
+// ftpPriority ranks FTP sources. An --ftp override outranks the file because
+// the analyzer computes IF/TSS and zones from it; among file sources the
+// device sport profile comes first.
+func ftpPriority(c FTPCandidate) int {
+	if c.Message == ftpOverrideMessage {
+		return 6
+	}
+	switch c.Source {
+	case "sport_profile":
+		return 5
 	case "zwift_setting":
 		return 4
 	case "developer_field":
@@ -682,10 +1274,61 @@ func chooseFTPCandidate(candidates []FTPCandidate) *FTPCandidate {
 		return nil
 	}
 	chosen := candidates[0]
-	chosen.Reason = fmt.Sprintf("Selected highest-priority/highest-confidence source: %s (%s)", chosen.Source, chosen.Message)
+	chosen.Reason = ftpRankingReason(candidates)
 	return &chosen
 }
 
+// ftpRankingReason explains which rankFTPCandidates rule put the first of the
+// ranked candidates ahead of the runner-up.
+func ftpRankingReason(ranked []FTPCandidate) string {
+	if len(ranked) == 0 {
+		return ""
+	}
+	top := ranked[0]
+	if top.Message == ftpOverrideMessage {
+		return "--ftp overrides every FTP found in the file"
+	}
+	if len(ranked) == 1 {
+		return fmt.Sprintf("%s is the only FTP source", top.Source)
+	}
+	next := ranked[1]
+	switch {
+	case ftpPriority(top) > ftpPriority(next):
+		return fmt.Sprintf("%s outranks %s by source priority (sport_profile > zwift_setting > developer_field > user_profile > others)", top.Source, next.Source)
+	case top.Confidence > next.Confidence:
+		return fmt.Sprintf("%s ties %s on source priority and has higher confidence (%.2f vs %.2f)", top.Source, next.Source, top.Confidence, next.Confidence)
+	default:
+		return fmt.Sprintf("%s ties %s on source priority and confidence; the higher FTP ranks first (%.0f vs %.0f W)", top.Source, next.Source, top.FTPW, next.FTPW)
+	}
+}
+
+// buildFTPSpread summarizes the candidate FTPs and where the used one ranks;
+// it returns nil without candidates.
+func buildFTPSpread(candidates []FTPCandidate, used *FTPCandidate) *FTPSpread {
+	if len(candidates) == 0 {
+		return nil
+	}
+	spread := &FTPSpread{
+		CandidateCount: len(candidates),
+		MinFTPW:        candidates[0].FTPW,
+		MaxFTPW:        candidates[0].FTPW,
+	}
+	for _, c := range candidates {
+		spread.MinFTPW = math.Min(spread.MinFTPW, c.FTPW)
+		spread.MaxFTPW = math.Max(spread.MaxFTPW, c.FTPW)
+	}
+	if used != nil {
+		spread.ChosenConfidenceRank = 1
+		for _, c := range candidates {
+			if c.Confidence > used.Confidence {
+				spread.ChosenConfidenceRank++
+			}
+		}
+	}
+	spread.SpreadW = spread.MaxFTPW - spread.MinFTPW
+	return spread
+}
+
 func fieldFloatValue(fields []llmexport.FieldValue, num uint8) float64 {
 	for _, f := range fields {
 		if f.FieldNumber == num {
@@ -708,20 +1351,6 @@ func fieldStringValue(fields []llmexport.FieldValue, num uint8) string {
 	return ""
 }
 
-func decodeDeveloperNumeric(values []int, baseRaw int) float64 {
-	if len(values) == 0 {
-		return 0
-	}
-	// Heuristic decoding for common uint16/uint32 fields.
-	if len(values) >= 2 && (baseRaw&0x1F) == 0x04 { // uint16
-		return float64(values[0] | (values[1] << 8))
-	}
-	if len(values) >= 4 && (baseRaw&0x1F) == 0x06 { // uint32
-		return float64(values[0] | (values[1] << 8) | (values[2] << 16) | (values[3] << 24))
-	}
-	return float64(values[0])
-}
-
 func buildLapSummary(activity *fit.ActivityFile, samples []CanonicalSample) LapSummaryFile {
 	if activity == nil || len(activity.Laps) == 0 {
 		return LapSummaryFile{}
@@ -733,22 +1362,28 @@ func buildLapSummary(activity *fit.ActivityFile, samples []CanonicalSample) LapS
 		}
 		start := lap.StartTime.UTC()
 		end := lap.Timestamp.UTC()
+		// Scaled getters return NaN for invalid fields, which would make the
+		// lap summary unmarshalable; treat both missing as zero.
 		elapsed := lap.GetTotalTimerTimeScaled()
-		if elapsed <= 0 {
+		if !(elapsed > 0) {
 			elapsed = lap.GetTotalElapsedTimeScaled()
 		}
+		if math.IsNaN(elapsed) {
+			elapsed = 0
+		}
 		startIdx := sampleIndexAtOrAfter(samples, start)
 		endIdx := sampleIndexAtOrBefore(samples, end)
 		laps = append(laps, LapSummary{
 			LapIndex:         i + 1,
-			StartTS:          start.Format(time.RFC3339),
-			EndTS:            end.Format(time.RFC3339),
+			StartTS:          start.UTC().Format(time.RFC3339),
+			EndTS:            end.UTC().Format(time.RFC3339),
 			ElapsedS:         elapsed,
 			AvgPowerW:        float64(safeU16(lap.AvgPower)),
 			MaxPowerW:        float64(safeU16(lap.MaxPower)),
 			AvgHRBPM:         float64(safeU8(lap.AvgHeartRate)),
 			MaxHRBPM:         float64(safeU8(lap.MaxHeartRate)),
 			AvgCadenceRPM:    cadenceFromLapAny(lap.GetAvgCadence()),
+			Trigger:          analyzer.LapTriggerLabel(lap.LapTrigger),
 			StartSampleIndex: startIdx,
 			EndSampleIndex:   endIdx,
 		})
@@ -756,12 +1391,12 @@ func buildLapSummary(activity *fit.ActivityFile, samples []CanonicalSample) LapS
 	return LapSummaryFile{Laps: laps}
 }
 
-func buildWorkoutSteps(records []llmexport.RecordEnvelope, analysis *analyzer.Analysis, samples []CanonicalSample, lapSummary LapSummaryFile, ftpUsed *FTPCandidate) []WorkoutStep {
+func buildWorkoutSteps(records []llmexport.RecordEnvelope, analysis *analyzer.Analysis, samples []CanonicalSample, lapSummary LapSummaryFile, ftpUsed *FTPCandidate, powerRounding, pctRounding float64) []WorkoutStep {
 	if steps := buildWorkoutStepsFromWorkoutMessages(records, samples, ftpUsed); len(steps) > 0 {
 		return steps
 	}
-	if len(lapSummary.Laps) > 0 && analysis != nil && len(analysis.Laps) == len(lapSummary.Laps) {
-		return buildWorkoutStepsFromLaps(analysis, lapSummary, ftpUsed)
+	if len(lapSummary.Laps) > 0 && analysis != nil && !analysis.WorkoutStructure.Suppressed {
+		return buildWorkoutStepsFromLaps(analysis, lapSummary, ftpUsed, powerRounding, pctRounding)
 	}
 
 	if len(samples) == 0 {
@@ -798,9 +1433,8 @@ func buildWorkoutStepsFromWorkoutMessages(records []llmexport.RecordEnvelope, sa
 		return nil
 	}
 
-	startTS := samples[0].Timestamp
+	cursor := samples[0].Timestamp
 	steps := make([]WorkoutStep, 0, len(stepsRaw))
-	cursor := 0.0
 	for i, m := range stepsRaw {
 		step := WorkoutStep{
 			StepIndex: i + 1,
@@ -809,6 +1443,12 @@ func buildWorkoutStepsFromWorkoutMessages(records []llmexport.RecordEnvelope, sa
 		if name, ok := asString(m[0].Decoded); ok {
 			step.StepName = name
 		}
+		if f, ok := m[7]; ok {
+			step.Intensity = workoutStepIntensity(asFloatDefault(f.Decoded, -1))
+			if step.StepName == "" {
+				step.StepName = intensityStepName(step.Intensity)
+			}
+		}
 		durationType := int(asFloatDefault(m[1].Decoded, -1))
 		durationValue := asFloatDefault(m[2].Decoded, 0)
 		if durationType == 0 || durationType == 28 || durationType == 31 {
@@ -826,12 +1466,16 @@ func buildWorkoutStepsFromWorkoutMessages(records []llmexport.RecordEnvelope, sa
 
 		configureTargetFromWorkoutValues(&step, targetType, targetValue, targetLow, targetHigh, ftpUsed)
 
-		stepStart := startTS.Add(time.Duration(cursor * float64(time.Second)))
+		stepStart := cursor
 		step.StartTSUTC = stepStart.UTC().Format(time.RFC3339)
 		if step.DurationS != nil {
-			cursor += *step.DurationS
+			cursor = cursor.Add(time.Duration(*step.DurationS * float64(time.Second)))
+		} else if step.DistanceM != nil {
+			if end, ok := distanceStepEnd(samples, stepStart, *step.DistanceM); ok {
+				cursor = end
+			}
 		}
-		stepEnd := startTS.Add(time.Duration(cursor * float64(time.Second)))
+		stepEnd := cursor
 		step.EndTSUTC = stepEnd.UTC().Format(time.RFC3339)
 		step.StartSampleIndex = sampleIndexAtOrAfter(samples, stepStart)
 		step.EndSampleIndex = sampleIndexAtOrBefore(samples, stepEnd)
@@ -841,6 +1485,63 @@ func buildWorkoutStepsFromWorkoutMessages(records []llmexport.RecordEnvelope, sa
 	return steps
 }
 
+// distanceStepEnd resolves the end of a distance-duration step by walking the
+// samples' cumulative distance from the step start until dist meters are
+// covered. It reports false when the samples carry no distance.
+func distanceStepEnd(samples []CanonicalSample, start time.Time, dist float64) (time.Time, bool) {
+	i := sampleIndexAtOrAfter(samples, start)
+	for ; i < len(samples) && samples[i].DistanceM == nil; i++ {
+	}
+	if i >= len(samples) {
+		return time.Time{}, false
+	}
+	target := *samples[i].DistanceM + dist
+	last := i
+	for ; i < len(samples); i++ {
+		if samples[i].DistanceM == nil {
+			continue
+		}
+		last = i
+		if *samples[i].DistanceM >= target {
+			break
+		}
+	}
+	return samples[last].Timestamp, true
+}
+
+// workoutStepIntensity decodes the FIT intensity enum (workout_step field 7).
+func workoutStepIntensity(v float64) string {
+	switch int(v) {
+	case 0:
+		return "active"
+	case 1:
+		return "rest"
+	case 2:
+		return "warmup"
+	case 3:
+		return "cooldown"
+	case 4:
+		return "recovery"
+	case 5:
+		return "interval"
+	case 6:
+		return "other"
+	}
+	return ""
+}
+
+// intensityStepName names an unnamed workout step after its intensity, using
+// the same vocabulary as lap labels so "active" and "interval" become "work".
+func intensityStepName(intensity string) string {
+	switch intensity {
+	case "active", "interval":
+		return "work"
+	case "other":
+		return ""
+	}
+	return intensity
+}
+
 func configureTargetFromWorkoutValues(step *WorkoutStep, targetType int, targetValue, low, high float64, ftpUsed *FTPCandidate) {
 	// target_type power for workout steps.
 	if targetType == 4 {
@@ -893,17 +1594,84 @@ func nonZeroOr(primary, fallback float64) float64 {
 	return fallback
 }
 
-func buildWorkoutStepsFromLaps(analysis *analyzer.Analysis, lapSummary LapSummaryFile, ftpUsed *FTPCandidate) []WorkoutStep {
+const (
+	// Default granularity of lap-derived step targets; overridden by
+	// BytesOptions.TargetPowerRounding and TargetPctRounding.
+	defaultTargetPowerRounding = 5.0
+	defaultTargetPctRounding   = 1.0
+
+	// defaultStepTargetTolerancePct is the ± band around a single-value step
+	// target (low == high, as lap-derived targets always are) counted as in
+	// target; it matches the analyzer's rep-level default.
+	defaultStepTargetTolerancePct = 5.0
+)
+
+// lapAlignmentWarning compares the analyzer's laps (labeled plus excluded)
+// with the lap summary by 1-based lap number. Lap-derived workout steps are
+// keyed by lap number, so a mismatch only leaves the unmatched summary laps
+// "unlabeled"; the warning says which laps those are.
+func lapAlignmentWarning(analysis *analyzer.Analysis, lapSummary LapSummaryFile) string {
+	if analysis == nil || len(lapSummary.Laps) == 0 {
+		return ""
+	}
+	analyzed := make(map[int]bool, len(analysis.Laps)+len(analysis.ExcludedLaps))
+	for _, lap := range analysis.Laps {
+		analyzed[lap.Index] = true
+	}
+	for _, n := range analysis.ExcludedLaps {
+		analyzed[n] = true
+	}
+	summarized := make(map[int]bool, len(lapSummary.Laps))
+	var unlabeled []string
+	for _, lap := range lapSummary.Laps {
+		summarized[lap.LapIndex] = true
+		if !analyzed[lap.LapIndex] {
+			unlabeled = append(unlabeled, strconv.Itoa(lap.LapIndex))
+		}
+	}
+	missing := 0
+	for n := range analyzed {
+		if !summarized[n] {
+			missing++
+		}
+	}
+	if len(unlabeled) == 0 && missing == 0 {
+		return ""
+	}
+	msg := fmt.Sprintf("analyzer found %d laps but lap summary has %d", len(analyzed), len(lapSummary.Laps))
+	if len(unlabeled) > 0 {
+		msg += fmt.Sprintf("; laps %s have no analyzer label and are exported as unlabeled steps", strings.Join(unlabeled, ","))
+	}
+	return msg
+}
+
+// buildWorkoutStepsFromLaps turns laps into steps whose targets are the lap
+// averages rounded to powerRounding watts and pctRounding percent of FTP.
+// Laps excluded from analysis are kept as steps named "excluded", and laps the
+// analyzer did not see at all as "unlabeled" (see lapAlignmentWarning). Step
+// names use the (possibly renamed) lap label; targets follow its canonical kind.
+func buildWorkoutStepsFromLaps(analysis *analyzer.Analysis, lapSummary LapSummaryFile, ftpUsed *FTPCandidate, powerRounding, pctRounding float64) []WorkoutStep {
+	labels := make(map[int]analyzer.LapSummary, len(analysis.Laps)+len(analysis.ExcludedLaps))
+	for _, lap := range analysis.Laps {
+		labels[lap.Index] = lap
+	}
+	for _, n := range analysis.ExcludedLaps {
+		labels[n] = analyzer.LapSummary{Label: "excluded"}
+	}
 	steps := make([]WorkoutStep, 0, len(lapSummary.Laps))
 	for i, lap := range lapSummary.Laps {
-		label := analysis.Laps[i].Label
+		labeled, ok := labels[lap.LapIndex]
+		if !ok {
+			labeled.Label = "unlabeled"
+		}
+		kind := labeled.LabelKind()
 		step := WorkoutStep{
 			StepIndex:        i + 1,
-			StepName:         label,
+			StepName:         labeled.Label,
 			DurationS:        floatPtr(lap.ElapsedS),
 			TargetType:       "power_w",
-			TargetLowW:       floatPtr(roundToNearest(lap.AvgPowerW, 5)),
-			TargetHighW:      floatPtr(roundToNearest(lap.AvgPowerW, 5)),
+			TargetLowW:       floatPtr(roundToNearest(lap.AvgPowerW, powerRounding)),
+			TargetHighW:      floatPtr(roundToNearest(lap.AvgPowerW, powerRounding)),
 			StartTSUTC:       lap.StartTS,
 			EndTSUTC:         lap.EndTS,
 			StartSampleIndex: lap.StartSampleIndex,
@@ -912,12 +1680,12 @@ func buildWorkoutStepsFromLaps(analysis *analyzer.Analysis, lapSummary LapSummar
 		}
 		if ftpUsed != nil && ftpUsed.FTPW > 0 {
 			pct := (lap.AvgPowerW / ftpUsed.FTPW) * 100
-			if label == "work" || label == "recovery" {
+			if kind == "work" || kind == "recovery" {
 				step.TargetType = "percent_ftp"
-				step.TargetLowPctFTP = floatPtr(roundToNearest(pct, 1))
-				step.TargetHighPctFTP = floatPtr(roundToNearest(pct, 1))
-				step.TargetLowW = floatPtr(roundToNearest(lap.AvgPowerW, 5))
-				step.TargetHighW = floatPtr(roundToNearest(lap.AvgPowerW, 5))
+				step.TargetLowPctFTP = floatPtr(roundToNearest(pct, pctRounding))
+				step.TargetHighPctFTP = floatPtr(roundToNearest(pct, pctRounding))
+				step.TargetLowW = floatPtr(roundToNearest(lap.AvgPowerW, powerRounding))
+				step.TargetHighW = floatPtr(roundToNearest(lap.AvgPowerW, powerRounding))
 			}
 		}
 		steps = append(steps, step)
@@ -947,7 +1715,10 @@ func applyFTPConversions(step *WorkoutStep, ftp float64) {
 	}
 }
 
-func enrichStepCompliance(step *WorkoutStep, samples []CanonicalSample, ftp float64) {
+// enrichStepCompliance fills the step's observed power and time in target.
+// A single-value target is widened to ±tolerancePct so steady riding at the
+// target counts as compliant.
+func enrichStepCompliance(step *WorkoutStep, samples []CanonicalSample, ftp, tolerancePct float64) {
 	if len(samples) == 0 || step.StartSampleIndex < 0 || step.EndSampleIndex < step.StartSampleIndex || step.EndSampleIndex >= len(samples) {
 		return
 	}
@@ -972,6 +1743,9 @@ func enrichStepCompliance(step *WorkoutStep, samples []CanonicalSample, ftp floa
 			highW = ftp * (*step.TargetHighPctFTP) / 100.0
 		}
 	}
+	if lowW > 0 && lowW == highW {
+		lowW, highW = lowW*(1-tolerancePct/100.0), highW*(1+tolerancePct/100.0)
+	}
 
 	for _, s := range segment {
 		if s.PowerW == nil || !s.ValidPower {
@@ -990,7 +1764,7 @@ func enrichStepCompliance(step *WorkoutStep, samples []CanonicalSample, ftp floa
 
 	avg := avgFloat(powers)
 	step.ObservedAvgPowerW = floatPtr(avg)
-	np := normalizedPowerFromFloats(powers)
+	np := npower.Normalized(resamplePower1Hz(segment, nil))
 	step.ObservedNPW = floatPtr(np)
 	sd := stddevFloat(powers, avg)
 	step.PowerStdDev = floatPtr(sd)
@@ -1000,7 +1774,7 @@ func enrichStepCompliance(step *WorkoutStep, samples []CanonicalSample, ftp floa
 	}
 }
 
-func buildActivitySummary(samples []CanonicalSample, ftpUsed *FTPCandidate, fallbackDuration float64, weightKG float64, warnings []string) ActivitySummaryFile {
+func buildActivitySummary(samples []CanonicalSample, ftpUsed *FTPCandidate, fallbackDuration float64, weightKG float64, excludeCoasting bool, npMinSamples int, warnings []string) ActivitySummaryFile {
 	power := make([]float64, 0, len(samples))
 	hr := make([]float64, 0, len(samples))
 	cad := make([]float64, 0, len(samples))
@@ -1023,21 +1797,40 @@ func buildActivitySummary(samples []CanonicalSample, ftpUsed *FTPCandidate, fall
 	if duration <= 0 {
 		duration = float64(len(samples))
 	}
-	np := normalizedPowerFromFloats(power)
+	power1Hz := resamplePower1Hz(samples, nil)
+	np := npower.Normalized(power1Hz)
+	npPedaling := npower.Normalized(resamplePower1Hz(samples, func(s CanonicalSample) bool { return !isCoasting(s) }))
 	workKJ := totalWorkKJ(samples)
 
 	summary := ActivitySummaryFile{
 		DurationS:     duration,
 		AvgPowerW:     avgFloat(power),
 		NPW:           np,
+		NPWPedaling:   npPedaling,
 		MaxPowerW:     maxFloat(power),
 		AvgHRBPM:      avgFloat(hr),
 		MaxHRBPM:      maxFloat(hr),
 		AvgCadenceRPM: avgFloat(cad),
 		MaxCadenceRPM: maxFloat(cad),
 		TotalWorkKJ:   workKJ,
+		CoastingPct:   coastingPct(samples),
 		Warnings:      append([]string(nil), warnings...),
 	}
+	if summary.AvgPowerW > 0 {
+		summary.PowerSmoothnessCV = stddevFloat(power, summary.AvgPowerW) / summary.AvgPowerW
+	}
+	summary.PowerRollingSD30W = rollingStdDevMean(power1Hz, npower.WindowSeconds)
+	if npMinSamples < npower.WindowSeconds {
+		npMinSamples = npower.WindowSeconds
+	}
+	summary.NPReliable = len(power1Hz) >= npMinSamples
+	if !summary.NPReliable && len(power1Hz) > 0 {
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("np_w is unreliable: only %d s of power (minimum %d s); values below the %d s window are the plain average", len(power1Hz), npMinSamples, npower.WindowSeconds))
+	}
+	summary.SampleRateSegments = detectSampleRateSegments(samples)
+	if len(summary.SampleRateSegments) > 1 {
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("sample rate changes within file (%d segments); do not assume a single sample interval", len(summary.SampleRateSegments)))
+	}
 	if weightKG > 0 {
 		summary.WeightKG = floatPtr(weightKG)
 		summary.AvgPowerWPerKG = floatPtr(summary.AvgPowerW / weightKG)
@@ -1051,6 +1844,14 @@ func buildActivitySummary(samples []CanonicalSample, ftpUsed *FTPCandidate, fall
 
 	ftp := ftpUsed.FTPW
 	summary.FTPWUsed = floatPtr(ftp)
+	if weightKG > 0 {
+		summary.FTPWPerKG = floatPtr(ftp / weightKG)
+	}
+	summary.IFNPBasis = "all_samples"
+	if excludeCoasting {
+		np = npPedaling
+		summary.IFNPBasis = "pedaling"
+	}
 	ifv := np / ftp
 	summary.IF = floatPtr(ifv)
 	tss := (duration / 3600.0) * ifv * ifv * 100.0
@@ -1062,21 +1863,56 @@ func buildActivitySummary(samples []CanonicalSample, ftpUsed *FTPCandidate, fall
 	return summary
 }
 
+// isCoasting reports a zero-power sample while moving. Samples without speed
+// (e.g. trainers that omit it) count as moving, so their zeros are coasting;
+// zeros recorded while stopped stay in both NP variants.
+func isCoasting(s CanonicalSample) bool {
+	if s.PowerW == nil || *s.PowerW != 0 {
+		return false
+	}
+	return s.SpeedMPS == nil || *s.SpeedMPS > 0
+}
+
+// coastingPct returns the share of moving time spent not pedaling: samples
+// with valid zero cadence or valid zero power. Each sample counts for the gap
+// to the next one (up to npower.MaxHoldSeconds, else 1 s), and a sample is moving
+// unless it reports zero speed. Only samples with valid power or cadence count,
+// so it returns nil without those sensors or without moving time.
+func coastingPct(samples []CanonicalSample) *float64 {
+	var moving, coasting float64
+	for i, s := range samples {
+		if s.SpeedMPS != nil && *s.SpeedMPS <= 0 {
+			continue
+		}
+		if !(s.ValidPower && s.PowerW != nil) && !(s.ValidCadence && s.CadenceRPM != nil) {
+			continue
+		}
+		hold := 1.0
+		if i+1 < len(samples) {
+			if dt := samples[i+1].ElapsedS - s.ElapsedS; dt > 0 && dt <= npower.MaxHoldSeconds {
+				hold = dt
+			}
+		}
+		moving += hold
+		zeroCadence := s.ValidCadence && s.CadenceRPM != nil && *s.CadenceRPM == 0
+		zeroPower := s.ValidPower && s.PowerW != nil && *s.PowerW == 0
+		if zeroCadence || zeroPower {
+			coasting += hold
+		}
+	}
+	if moving == 0 {
+		return nil
+	}
+	return floatPtr(coasting / moving * 100)
+}
+
 func totalWorkKJ(samples []CanonicalSample) float64 {
 	if len(samples) == 0 {
 		return 0
 	}
 	work := 0.0
 	for i := 1; i < len(samples); i++ {
-		prev := samples[i-1]
-		if prev.PowerW == nil || !prev.ValidPower {
-			continue
-		}
-		delta := samples[i].Timestamp.Sub(prev.Timestamp).Seconds()
-		if delta <= 0 || delta > 5 {
-			delta = 1
-		}
-		work += (*prev.PowerW) * delta
+		work += intervalWorkJ(samples[i-1], samples[i])
 	}
 	if work == 0 {
 		for _, s := range samples {
@@ -1088,32 +1924,125 @@ func totalWorkKJ(samples []CanonicalSample) float64 {
 	return work / 1000.0
 }
 
-func normalizedPowerFromFloats(power []float64) float64 {
-	if len(power) == 0 {
-		return 0
+const (
+	// sampleRateWindow is the number of inter-sample intervals per median window.
+	sampleRateWindow = 30
+	// minSampleRateSegmentS folds shorter regimes into their predecessor.
+	minSampleRateSegmentS = 300.0
+)
+
+// detectSampleRateSegments splits the session into sampling regimes (e.g. 1Hz
+// vs smart recording). Each window of intervals is reduced to its median
+// rounded to 0.5s; adjacent windows with the same median are merged, and
+// segments shorter than minSampleRateSegmentS are folded into the previous one.
+func detectSampleRateSegments(samples []CanonicalSample) []SampleRateSegment {
+	if len(samples) < 2 {
+		return nil
 	}
-	if len(power) < 30 {
-		return avgFloat(power)
+	var segments []SampleRateSegment
+	for start := 0; start < len(samples)-1; start += sampleRateWindow {
+		end := start + sampleRateWindow
+		if end > len(samples)-1 {
+			end = len(samples) - 1
+		}
+		intervals := make([]float64, 0, end-start)
+		for i := start; i < end; i++ {
+			d := samples[i+1].Timestamp.Sub(samples[i].Timestamp).Seconds()
+			if d > 0 {
+				intervals = append(intervals, d)
+			}
+		}
+		if len(intervals) == 0 {
+			continue
+		}
+		sort.Float64s(intervals)
+		median := math.Round(intervals[len(intervals)/2]*2) / 2
+		if median == 0 {
+			median = 0.5
+		}
+		seg := SampleRateSegment{
+			StartS:          samples[start].ElapsedS,
+			EndS:            samples[end].ElapsedS,
+			MedianIntervalS: median,
+		}
+		if n := len(segments); n > 0 && segments[n-1].MedianIntervalS == median {
+			segments[n-1].EndS = seg.EndS
+			continue
+		}
+		segments = append(segments, seg)
 	}
-	window := 30
-	sum := 0.0
-	for i := 0; i < window; i++ {
-		sum += power[i]
+
+	merged := make([]SampleRateSegment, 0, len(segments))
+	for _, seg := range segments {
+		n := len(merged)
+		if n > 0 && (seg.EndS-seg.StartS < minSampleRateSegmentS || merged[n-1].MedianIntervalS == seg.MedianIntervalS) {
+			merged[n-1].EndS = seg.EndS
+			continue
+		}
+		merged = append(merged, seg)
 	}
-	totalFourth := 0.0
-	count := 0
-	for i := window - 1; i < len(power); i++ {
-		if i >= window {
-			sum += power[i] - power[i-window]
+	if len(merged) > 1 && merged[0].EndS-merged[0].StartS < minSampleRateSegmentS {
+		merged[1].StartS = merged[0].StartS
+		merged = merged[1:]
+	}
+	return merged
+}
+
+// intervalWorkJ is the energy between two consecutive samples, holding the
+// earlier sample's power. Gaps over 5s (or non-increasing timestamps) count as 1s.
+func intervalWorkJ(prev, cur CanonicalSample) float64 {
+	if prev.PowerW == nil || !prev.ValidPower {
+		return 0
+	}
+	delta := cur.Timestamp.Sub(prev.Timestamp).Seconds()
+	if delta <= 0 || delta > 5 {
+		delta = 1
+	}
+	return (*prev.PowerW) * delta
+}
+
+// fillSampleWork sets WorkJ on every sample so a cumulative sum matches totalWorkKJ.
+func fillSampleWork(samples []CanonicalSample) {
+	for i := range samples {
+		w := 0.0
+		if i > 0 {
+			w = intervalWorkJ(samples[i-1], samples[i])
 		}
-		roll := sum / float64(window)
-		totalFourth += math.Pow(roll, 4)
-		count++
+		samples[i].WorkJ = floatPtr(w)
 	}
-	if count == 0 {
-		return avgFloat(power)
+}
+
+func hasWorkColumn(samples []CanonicalSample) bool {
+	return len(samples) > 0 && samples[0].WorkJ != nil
+}
+
+// NormalizedPowerFromSamples computes NP after resampling valid power to 1 Hz
+// from the sample times, so smart-recorded or mixed-rate files weight each
+// reading by the time it covers rather than by its count. The analyzer
+// resamples records the same way.
+func NormalizedPowerFromSamples(samples []CanonicalSample) float64 {
+	return npower.Normalized(resamplePower1Hz(samples, nil))
+}
+
+// resamplePower1Hz resamples the valid power readings with
+// npower.Resample1Hz: readings within a second are averaged and gaps of up to
+// npower.MaxHoldSeconds hold the last value. When include is non-nil,
+// rejected samples still advance time but emit nothing.
+func resamplePower1Hz(samples []CanonicalSample, include func(CanonicalSample) bool) []float64 {
+	seconds := make([]float64, 0, len(samples))
+	watts := make([]float64, 0, len(samples))
+	var skip []bool
+	for _, s := range samples {
+		if s.PowerW == nil || !s.ValidPower {
+			continue
+		}
+		seconds = append(seconds, s.ElapsedS)
+		watts = append(watts, *s.PowerW)
+		if include != nil {
+			skip = append(skip, !include(s))
+		}
 	}
-	return math.Pow(totalFourth/float64(count), 0.25)
+	return npower.Resample1Hz(seconds, watts, skip)
 }
 
 func avgFloat(values []float64) float64 {
@@ -1152,6 +2081,30 @@ func stddevFloat(values []float64, mean float64) float64 {
 	return math.Sqrt(sum / float64(len(values)))
 }
 
+// rollingStdDevMean averages the population standard deviation of every
+// full window of values; it returns 0 when there is no full window.
+func rollingStdDevMean(values []float64, window int) float64 {
+	if window <= 0 || len(values) < window {
+		return 0
+	}
+	var sum, sumSq, total float64
+	for i, v := range values {
+		sum += v
+		sumSq += v * v
+		if i >= window {
+			old := values[i-window]
+			sum -= old
+			sumSq -= old * old
+		}
+		if i+1 < window {
+			continue
+		}
+		mean := sum / float64(window)
+		total += math.Sqrt(math.Max(0, sumSq/float64(window)-mean*mean))
+	}
+	return total / float64(len(values)-window+1)
+}
+
 func writeJSON(path string, v any) error {
 	f, err := os.Create(path)
 	if err != nil {
@@ -1164,40 +2117,28 @@ func writeJSON(path string, v any) error {
 }
 
 func writeCanonicalCSV(path string, samples []CanonicalSample) error {
-	out, err := marshalCanonicalCSV(samples)
+	out, err := marshalCanonicalCSV(samples, TimestampRFC3339)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(path, out, 0o644)
 }
 
-func marshalCanonicalCSV(samples []CanonicalSample) ([]byte, error) {
+func marshalCanonicalCSV(samples []CanonicalSample, timestampFormat string) ([]byte, error) {
 	var buf bytes.Buffer
 	w := csv.NewWriter(&buf)
-	header := []string{
-		"ts_utc_iso", "elapsed_s", "power_w", "hr_bpm", "cadence_rpm", "speed_mps", "distance_m", "altitude_m", "temperature_c", "grade_pct",
-		"valid_power", "valid_hr", "valid_cadence", "file_offset", "record_index",
+	cols := canonicalColumns(samples, timestampFormat)
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.name
 	}
 	if err := w.Write(header); err != nil {
 		return nil, err
 	}
+	row := make([]string, len(cols))
 	for _, s := range samples {
-		row := []string{
-			s.TSUTCISO,
-			formatFloat(s.ElapsedS),
-			formatFloatPtr(s.PowerW),
-			formatFloatPtr(s.HRBPM),
-			formatFloatPtr(s.CadenceRPM),
-			formatFloatPtr(s.SpeedMPS),
-			formatFloatPtr(s.DistanceM),
-			formatFloatPtr(s.AltitudeM),
-			formatFloatPtr(s.TemperatureC),
-			formatFloatPtr(s.GradePct),
-			strconv.FormatBool(s.ValidPower),
-			strconv.FormatBool(s.ValidHR),
-			strconv.FormatBool(s.ValidCadence),
-			strconv.FormatInt(s.FileOffset, 10),
-			strconv.Itoa(s.RecordIndex),
+		for i, c := range cols {
+			row[i] = c.csv(s)
 		}
 		if err := w.Write(row); err != nil {
 			return nil, err
@@ -1211,7 +2152,7 @@ func marshalCanonicalCSV(samples []CanonicalSample) ([]byte, error) {
 }
 
 func writeCanonicalParquet(path string, samples []CanonicalSample) error {
-	out, err := marshalCanonicalParquet(samples)
+	out, err := marshalCanonicalParquet(samples, TimestampRFC3339)
 	if err != nil {
 		return err
 	}
@@ -1255,25 +2196,27 @@ func sampleIndexAtOrBefore(samples []CanonicalSample, ts time.Time) int {
 }
 
 func safeU16(v uint16) uint16 {
-	if v == ^uint16(0) {
+	if llmexport.IsInvalidUint16(v) {
 		return 0
 	}
 	return v
 }
 
 func safeU8(v uint8) uint8 {
-	if v == ^uint8(0) {
+	if llmexport.IsInvalidUint8(v) {
 		return 0
 	}
 	return v
 }
 
+// cadenceFromLapAny reads a lap cadence field, returning 0 for the invalid
+// sentinels (0xFF, 0xFFFF) like the analyzer's cadenceFromAny.
 func cadenceFromLapAny(v any) float64 {
 	switch x := v.(type) {
 	case uint8:
-		return float64(x)
+		return float64(safeU8(x))
 	case uint16:
-		return float64(x)
+		return float64(safeU16(x))
 	case float64:
 		return x
 	default:
@@ -1,14 +1,25 @@
 package pipeline
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/lucasjlepore/fit-analyzer/internal/fittest"
+	"github.com/lucasjlepore/fit-analyzer/internal/npower"
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
+	"github.com/tormoder/fit"
 )
 
 func TestRunOnKnownZwiftFIT(t *testing.T) {
@@ -108,6 +119,69 @@ func TestRunOnKnownZwiftFIT(t *testing.T) {
 	}
 }
 
+func TestRunAnalyzesFitDataWithoutReadingPath(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	outDir := filepath.Join(t.TempDir(), "out")
+	res, err := Run(Options{
+		FitPath:    "downloaded.fit",
+		FitData:    data,
+		OutDir:     outDir,
+		Format:     "csv",
+		Overwrite:  true,
+		CopySource: true,
+	})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	copied, err := os.ReadFile(res.SourceCopyPath)
+	if err != nil {
+		t.Fatalf("read source copy: %v", err)
+	}
+	if !bytes.Equal(copied, data) {
+		t.Fatal("source copy should match the supplied FitData")
+	}
+}
+
+func TestRunNestedLayoutManifestPathsResolve(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	for _, layout := range []string{LayoutFlat, LayoutNested} {
+		res, err := Run(Options{
+			FitPath:   "intervals.fit",
+			FitData:   data,
+			OutDir:    filepath.Join(t.TempDir(), "out"),
+			Format:    "csv",
+			Overwrite: true,
+			Layout:    layout,
+		})
+		if err != nil {
+			t.Fatalf("%s: Run() error: %v", layout, err)
+		}
+		raw, err := os.ReadFile(res.ManifestPath)
+		if err != nil {
+			t.Fatalf("%s: read manifest: %v", layout, err)
+		}
+		var manifest llmexport.Manifest
+		if err := json.Unmarshal(raw, &manifest); err != nil {
+			t.Fatalf("%s: decode manifest: %v", layout, err)
+		}
+		dir := filepath.Dir(res.ManifestPath)
+		for path, want := range map[string]string{
+			manifest.RecordsPath:          res.RecordsPath,
+			manifest.WorkoutStructurePath: res.WorkoutStructurePath,
+		} {
+			if got := filepath.Join(dir, filepath.FromSlash(path)); got != want {
+				t.Fatalf("%s: manifest path %q resolves to %s, want %s", layout, path, got, want)
+			}
+		}
+	}
+}
+
 func TestRunBytesProducesArtifacts(t *testing.T) {
 	fitPath := "/Users/lucaslepore/Downloads/Zwift_W1_5x4_110.fit"
 	data, err := os.ReadFile(fitPath)
@@ -134,6 +208,7 @@ func TestRunBytesProducesArtifacts(t *testing.T) {
 		"workout_structure.json",
 		"activity_summary.json",
 		"training_summary.md",
+		"llm_context.md",
 		"canonical_samples.csv",
 		"source.fit",
 	}
@@ -144,8 +219,132 @@ func TestRunBytesProducesArtifacts(t *testing.T) {
 	}
 }
 
+func TestRunBytesReportsMetrics(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+
+	m := res.Metrics
+	if m.FileBytes != len(data) || m.Records == 0 || m.Warnings != len(res.Warnings) {
+		t.Fatalf("unexpected metrics %+v for %d bytes and %d warnings", m, len(data), len(res.Warnings))
+	}
+	if m.ParseSeconds < 0 || m.AnalyzeSeconds < 0 || m.TotalSeconds < m.ParseSeconds+m.AnalyzeSeconds {
+		t.Fatalf("stage timings do not fit in the total: %+v", m)
+	}
+
+	text := m.Prometheus()
+	for _, want := range []string{
+		"# HELP fit_analyzer_file_bytes ",
+		"# TYPE fit_analyzer_file_bytes gauge\n",
+		fmt.Sprintf("fit_analyzer_file_bytes %d\n", len(data)),
+		fmt.Sprintf("fit_analyzer_records %d\n", m.Records),
+		fmt.Sprintf("fit_analyzer_warnings %d\n", m.Warnings),
+		"# TYPE fit_analyzer_total_seconds gauge\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("prometheus output missing %q:\n%s", want, text)
+		}
+	}
+	if n := strings.Count(text, "# TYPE "); n != 6 {
+		t.Fatalf("expected 6 metrics, got %d:\n%s", n, text)
+	}
+}
+
+func TestRunBytesLLMContextMarkdown(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv", FTPOverride: 280})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	md := string(res.Files["llm_context.md"])
+	for _, section := range []string{
+		"# Activity Context\n",
+		"## Summary\n",
+		"- FTP: 280 W | IF ",
+		"## Workout Steps (planned vs observed)\n| # | Step | Duration | Target |",
+		"| 2 | work | 4:00 | 107% FTP |",
+		"## Laps\n| Lap | Duration | Avg W |",
+		"| 2 | 4:00 | 300 | 306 |",
+		"## Best Efforts\n- 0:05: ",
+		"- 20:00: ",
+	} {
+		if !strings.Contains(md, section) {
+			t.Fatalf("llm_context.md missing %q:\n%s", section, md)
+		}
+	}
+
+	var ws WorkoutStructureFile
+	if err := json.Unmarshal(res.Files["workout_structure.json"], &ws); err != nil {
+		t.Fatalf("decode workout_structure.json: %v", err)
+	}
+	var laps LapSummaryFile
+	if err := json.Unmarshal(res.Files["lap_summary.json"], &laps); err != nil {
+		t.Fatalf("decode lap_summary.json: %v", err)
+	}
+	// Table rows are steps and laps only (plus two header rows per table); no
+	// per-sample rows or timestamps make it into the document.
+	rows := 0
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(line, "|") {
+			rows++
+		}
+		if strings.Contains(line, "ts_utc_iso") || strings.Contains(line, "2026-03-02T") {
+			t.Fatalf("raw sample data in llm_context.md: %q", line)
+		}
+	}
+	if want := len(ws.Steps) + len(laps.Laps) + 4; rows != want {
+		t.Fatalf("expected %d table rows for %d steps and %d laps, got %d:\n%s", want, len(ws.Steps), len(laps.Laps), rows, md)
+	}
+}
+
+func TestRunBytesManifestMessageCounts(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	var manifest llmexport.Manifest
+	if err := json.Unmarshal(res.Files["manifest.json"], &manifest); err != nil {
+		t.Fatalf("decode manifest.json: %v", err)
+	}
+	bundle, err := llmexport.ParseBytes(data)
+	if err != nil {
+		t.Fatalf("ParseBytes() error: %v", err)
+	}
+	want := llmexport.MessageCountList(bundle.Records)
+	if len(manifest.MessageCounts) != len(want) {
+		t.Fatalf("message counts %+v want %+v", manifest.MessageCounts, want)
+	}
+	total := 0
+	for i, c := range manifest.MessageCounts {
+		if c != want[i] {
+			t.Fatalf("message count %d: %+v want %+v", i, c, want[i])
+		}
+		total += c.Count
+	}
+	if total != manifest.DataMessageCount {
+		t.Fatalf("counts sum to %d, manifest has %d data messages", total, manifest.DataMessageCount)
+	}
+	for _, c := range manifest.MessageCounts {
+		if c.GlobalMessageNum == 20 && (c.GlobalMessageName == "" || c.Count < 3000) {
+			t.Fatalf("expected named record counts for the 55-minute ride, got %+v", c)
+		}
+	}
+}
+
 func TestCollectFTPCandidatesIncludesAnalyzerEstimate(t *testing.T) {
-	candidates := collectFTPCandidates(nil, nil, &analyzer.Analysis{
+	candidates, _ := collectFTPCandidates(nil, nil, &analyzer.Analysis{
 		FTPWatts:  247,
 		FTPSource: "estimated",
 	}, 0)
@@ -168,7 +367,7 @@ func TestBuildActivitySummaryDoesNotWarnWhenFTPIsOmitted(t *testing.T) {
 		ElapsedS:   0,
 		PowerW:     floatPtr(200),
 		ValidPower: true,
-	}}, nil, 3600, 0, nil)
+	}}, nil, 3600, 0, false, 0, nil)
 
 	for _, warning := range summary.Warnings {
 		if warning == "ftp_w_used unavailable: IF and tss_like omitted" {
@@ -176,3 +375,3642 @@ func TestBuildActivitySummaryDoesNotWarnWhenFTPIsOmitted(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildCanonicalSamplesFromParsedRecords(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	file := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i < 3; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = uint16(200 + i)
+			rec.HeartRate = 140
+			rec.Temperature = -4
+			if i != 1 {
+				rec.Cadence = 90
+			}
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+	bundle, err := llmexport.ParseBytes(file)
+	if err != nil {
+		t.Fatalf("ParseBytes() error: %v", err)
+	}
+	samples, err := BuildCanonicalSamples(bundle.Records)
+	if err != nil {
+		t.Fatalf("BuildCanonicalSamples() error: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(samples))
+	}
+	for i, s := range samples {
+		if !s.Timestamp.Equal(start.Add(time.Duration(i)*time.Second)) || s.ElapsedS != float64(i) {
+			t.Fatalf("sample %d: timestamp %v elapsed %v", i, s.Timestamp, s.ElapsedS)
+		}
+		if s.PowerW == nil || *s.PowerW != float64(200+i) || s.HRBPM == nil || *s.HRBPM != 140 {
+			t.Fatalf("sample %d: unexpected power/hr %+v", i, s)
+		}
+		if s.TemperatureC == nil || *s.TemperatureC != -4 {
+			t.Fatalf("sample %d: negative temperature lost: %+v", i, s)
+		}
+		if s.ValidCadence != (i != 1) {
+			t.Fatalf("sample %d: valid_cadence %t", i, s.ValidCadence)
+		}
+	}
+}
+
+func TestRecordFlatFromFieldsMapsRecordFields(t *testing.T) {
+	ts := "2026-03-01T07:00:00Z"
+	flat := RecordFlatFromFields([]llmexport.FieldValue{
+		{FieldNumber: 253, Timestamp: &llmexport.TimeProjection{UTC: ts}},
+		{FieldNumber: 7, Decoded: uint16(250)},
+		{FieldNumber: 3, Decoded: uint8(0xFF), Invalid: true},
+		{FieldNumber: 6, Decoded: uint16(8500), Scaled: 8.5},
+		{FieldNumber: 9, Decoded: int16(-250), Scaled: -2.5},
+	})
+	if flat == nil || flat.TimestampUTC != ts {
+		t.Fatalf("expected timestamp %s, got %+v", ts, flat)
+	}
+	if flat.PowerW == nil || *flat.PowerW != 250 || !flat.ValidPower {
+		t.Fatalf("expected valid power 250, got %+v", flat)
+	}
+	if flat.HRBPM != nil || flat.ValidHR {
+		t.Fatalf("invalid heart rate should be dropped, got %+v", flat)
+	}
+	if flat.SpeedMPS == nil || *flat.SpeedMPS != 8.5 || flat.GradePct == nil || *flat.GradePct != -2.5 {
+		t.Fatalf("expected scaled speed and grade, got %+v", flat)
+	}
+
+	if RecordFlatFromFields([]llmexport.FieldValue{{FieldNumber: 7, Decoded: uint16(250)}}) != nil {
+		t.Fatal("expected nil without a timestamp field")
+	}
+}
+
+func TestBuildCanonicalSamplesSortsBackwardsTimestamps(t *testing.T) {
+	record := func(index int, ts string) llmexport.RecordEnvelope {
+		return llmexport.RecordEnvelope{
+			RecordIndex:      index,
+			FileOffset:       int64(100 + index),
+			RecordKind:       "data",
+			GlobalMessageNum: 20,
+			Data:             &llmexport.DataRecord{Flat: &llmexport.RecordFlat{TimestampUTC: ts}},
+		}
+	}
+	samples, outOfOrder, _, err := buildCanonicalSamples([]llmexport.RecordEnvelope{
+		record(0, "2026-02-26T23:00:05Z"),
+		record(1, "2026-02-26T23:00:03Z"),
+		record(2, "2026-02-26T23:00:06Z"),
+	})
+	if err != nil {
+		t.Fatalf("buildCanonicalSamples error: %v", err)
+	}
+	if outOfOrder != 1 {
+		t.Fatalf("expected 1 out-of-order record, got %d", outOfOrder)
+	}
+	wantIndex := []int{1, 0, 2}
+	wantElapsed := []float64{0, 2, 3}
+	for i, s := range samples {
+		if s.RecordIndex != wantIndex[i] || s.FileOffset != int64(100+wantIndex[i]) {
+			t.Fatalf("sample %d: expected record %d, got %d", i, wantIndex[i], s.RecordIndex)
+		}
+		if s.ElapsedS != wantElapsed[i] {
+			t.Fatalf("sample %d: elapsed %v want %v", i, s.ElapsedS, wantElapsed[i])
+		}
+	}
+}
+
+func TestBuildCanonicalSamplesMergesDuplicateTimestamps(t *testing.T) {
+	record := func(index int, ts string, flat llmexport.RecordFlat) llmexport.RecordEnvelope {
+		flat.TimestampUTC = ts
+		return llmexport.RecordEnvelope{
+			RecordIndex:      index,
+			FileOffset:       int64(100 + index),
+			RecordKind:       "data",
+			GlobalMessageNum: 20,
+			Data:             &llmexport.DataRecord{Flat: &flat},
+		}
+	}
+	samples, _, duplicates, err := buildCanonicalSamples([]llmexport.RecordEnvelope{
+		record(0, "2026-02-26T23:00:00Z", llmexport.RecordFlat{HRBPM: floatPtr(140), ValidHR: true}),
+		record(1, "2026-02-26T23:00:00Z", llmexport.RecordFlat{PowerW: floatPtr(250), ValidPower: true, HRBPM: floatPtr(150), ValidHR: true}),
+		record(2, "2026-02-26T23:00:01Z", llmexport.RecordFlat{PowerW: floatPtr(260), ValidPower: true}),
+	})
+	if err != nil {
+		t.Fatalf("buildCanonicalSamples error: %v", err)
+	}
+	if duplicates != 1 || len(samples) != 2 {
+		t.Fatalf("expected 1 duplicate and 2 samples, got %d and %d", duplicates, len(samples))
+	}
+	first := samples[0]
+	if first.RecordIndex != 0 || first.FileOffset != 100 {
+		t.Fatalf("merged sample should keep first record position, got %d@%d", first.RecordIndex, first.FileOffset)
+	}
+	if !first.ValidPower || *first.PowerW != 250 {
+		t.Fatalf("merged sample should take power from duplicate, got %+v", first.PowerW)
+	}
+	if *first.HRBPM != 140 {
+		t.Fatalf("merged sample should keep first valid hr, got %v", *first.HRBPM)
+	}
+}
+
+func TestRunBytesMergesNonAdjacentDuplicateTimestamps(t *testing.T) {
+	start := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i < 10; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = 200
+			if i > 0 {
+				rec.HeartRate = 140
+			}
+			activity.Records = append(activity.Records, rec)
+		}
+		// A late re-transmission of the first second, far from it in the file.
+		dup := fit.NewRecordMsg()
+		dup.Timestamp = start
+		dup.Power = 1000
+		dup.HeartRate = 100
+		activity.Records = append(activity.Records, dup)
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "dup.fit", FitData: data, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes error: %v", err)
+	}
+	found := false
+	for _, w := range res.Warnings {
+		if strings.Contains(w, "merged 1 duplicate record") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected duplicate merge warning, got %v", res.Warnings)
+	}
+	lines := strings.Split(strings.TrimSpace(string(res.Files["canonical_samples.csv"])), "\n")
+	if len(lines) != 11 {
+		t.Fatalf("expected header and 10 samples, got %d lines", len(lines))
+	}
+	if res.Analysis.MaxPowerWatts != 200 {
+		t.Fatalf("analyzer should keep the first record's power, got max %v", res.Analysis.MaxPowerWatts)
+	}
+	if res.Analysis.AvgHeartRate != 136 {
+		t.Fatalf("analyzer should fill hr from the duplicate, got avg %v", res.Analysis.AvgHeartRate)
+	}
+}
+
+func TestRunBytesWorkColumnSumsToTotalWork(t *testing.T) {
+	// 200 W at 1 Hz, a 2 s smart-recording gap held at 250 W, then a 60 s
+	// pause that counts as a single second.
+	start := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for _, p := range []struct {
+			offset int
+			watts  uint16
+		}{{0, 200}, {1, 200}, {2, 250}, {4, 200}, {64, 300}, {65, 300}} {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(p.offset) * time.Second)
+			rec.Power = p.watts
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+	workColumn := func(include bool) ([]string, []string) {
+		res, err := RunBytes(BytesOptions{SourceFileName: "work.fit", FitData: data, Format: "csv", IncludeWork: include})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		rows, err := csv.NewReader(bytes.NewReader(res.Files["canonical_samples.csv"])).ReadAll()
+		if err != nil {
+			t.Fatalf("read canonical_samples.csv: %v", err)
+		}
+		var summary ActivitySummaryFile
+		if err := json.Unmarshal(res.Files["activity_summary.json"], &summary); err != nil {
+			t.Fatalf("decode activity_summary.json: %v", err)
+		}
+		if summary.TotalWorkKJ != 1.4 {
+			t.Fatalf("total work %v kJ want 1.4", summary.TotalWorkKJ)
+		}
+		header := rows[0]
+		column := make([]string, 0, len(rows)-1)
+		for _, row := range rows[1:] {
+			column = append(column, row[len(row)-1])
+		}
+		return header, column
+	}
+	if header, _ := workColumn(false); header[len(header)-1] == "work_j" {
+		t.Fatal("work_j should only be written with IncludeWork")
+	}
+	header, column := workColumn(true)
+	if header[len(header)-1] != "work_j" {
+		t.Fatalf("work_j should be the last column, got %v", header)
+	}
+	want := []float64{0, 200, 200, 500, 200, 300}
+	for i, cell := range column {
+		if got, err := strconv.ParseFloat(cell, 64); err != nil || got != want[i] {
+			t.Fatalf("work_j %v want %v", column, want)
+		}
+	}
+}
+
+func TestValidateArtifactsReportsSchemaViolations(t *testing.T) {
+	summary := buildActivitySummary([]CanonicalSample{{
+		ElapsedS:   0,
+		PowerW:     floatPtr(200),
+		ValidPower: true,
+	}}, nil, 3600, 0, false, 0, nil)
+	valid, err := llmexport.MarshalJSON(summary)
+	if err != nil {
+		t.Fatalf("marshal activity summary: %v", err)
+	}
+	if errs := ValidateArtifacts(map[string][]byte{"activity_summary.json": valid, "notes.md": []byte("x")}); len(errs) != 0 {
+		t.Fatalf("expected valid activity summary, got %v", errs)
+	}
+
+	invalid := []byte(`{"duration_s":"long","avg_power_w":-1}`)
+	errs := ValidateArtifacts(map[string][]byte{"activity_summary.json": invalid})
+	if len(errs) == 0 {
+		t.Fatal("expected schema violations")
+	}
+	joined := fmt.Sprint(errs)
+	for _, want := range []string{`missing required property "np_w"`, "$.duration_s: expected number, got string", "$.avg_power_w: -1 is below minimum 0"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected violation %q in %s", want, joined)
+		}
+	}
+}
+
+func TestMarshalCanonicalCSVTimestampFormats(t *testing.T) {
+	ts := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
+	samples := []CanonicalSample{{TSUTCISO: ts.Format(time.RFC3339), Timestamp: ts}}
+	cases := []struct {
+		format string
+		first  string
+		last   string
+		epoch  int
+	}{
+		{format: TimestampRFC3339, first: "ts_utc_iso", last: "record_index", epoch: -1},
+		{format: TimestampEpochMS, first: "ts_epoch_ms", last: "record_index", epoch: 0},
+		{format: TimestampBoth, first: "ts_utc_iso", last: "ts_epoch_ms", epoch: 15},
+	}
+	for _, tc := range cases {
+		out, err := marshalCanonicalCSV(samples, tc.format)
+		if err != nil {
+			t.Fatalf("%s: marshal csv: %v", tc.format, err)
+		}
+		rows, err := csv.NewReader(strings.NewReader(string(out))).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: read csv: %v", tc.format, err)
+		}
+		header := rows[0]
+		if header[0] != tc.first || header[len(header)-1] != tc.last {
+			t.Fatalf("%s: unexpected header %v", tc.format, header)
+		}
+		if tc.epoch >= 0 && rows[1][tc.epoch] != "1772146800000" {
+			t.Fatalf("%s: unexpected epoch millis %q", tc.format, rows[1][tc.epoch])
+		}
+	}
+	if _, err := resolveTimestampFormat("unix"); err == nil {
+		t.Fatal("expected unsupported timestamp format error")
+	}
+}
+
+func TestElapsedOriginTimerStart(t *testing.T) {
+	start := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i < 3; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = 200
+			activity.Records = append(activity.Records, rec)
+		}
+		event := fit.NewEventMsg()
+		event.Timestamp = start.Add(time.Second)
+		event.Event = fit.EventTimer
+		event.EventType = fit.EventTypeStart
+		activity.Events = append(activity.Events, event)
+	})
+
+	bundle, err := llmexport.ParseBytes(data)
+	if err != nil {
+		t.Fatalf("ParseBytes error: %v", err)
+	}
+	samples, _, _, err := buildCanonicalSamples(bundle.Records)
+	if err != nil {
+		t.Fatalf("buildCanonicalSamples error: %v", err)
+	}
+	origin, ok := elapsedOriginTime(bundle.Records, ElapsedOriginTimerStart)
+	if !ok {
+		t.Fatal("expected timer start origin")
+	}
+	rebaseElapsed(samples, origin)
+	for i, want := range []float64{-1, 0, 1} {
+		if samples[i].ElapsedS != want {
+			t.Fatalf("sample %d: elapsed %v want %v", i, samples[i].ElapsedS, want)
+		}
+	}
+	if _, ok := elapsedOriginTime(bundle.Records[:0], ElapsedOriginTimerStart); ok {
+		t.Fatal("expected no origin without events")
+	}
+}
+
+func TestRunBytesMovementStartOriginSkipsPreRoll(t *testing.T) {
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		// 90 s standing with the head unit on (rolling the bike at 0.5 m/s), then
+		// 10 minutes at 200 W and 8 m/s.
+		start := time.Date(2026, 3, 4, 6, 0, 0, 0, time.UTC)
+		for i := 0; i <= 690; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power, rec.Speed = 0, 500
+			if i >= 90 {
+				rec.Power, rec.Speed = 200, 8000
+			}
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	summary := func(origin string) ActivitySummaryFile {
+		t.Helper()
+		res, err := RunBytes(BytesOptions{SourceFileName: "preroll.fit", FitData: data, Format: "csv", ElapsedOrigin: origin, ValidateSchema: true})
+		if err != nil {
+			t.Fatalf("RunBytes(%s) error: %v", origin, err)
+		}
+		var out ActivitySummaryFile
+		if err := json.Unmarshal(res.Files["activity_summary.json"], &out); err != nil {
+			t.Fatalf("decode activity_summary.json: %v", err)
+		}
+		if origin == ElapsedOriginMovement && !strings.Contains(string(res.Files["canonical_samples.csv"]), ",-90.000000,") {
+			t.Fatal("expected pre-roll samples at negative elapsed_s")
+		}
+		return out
+	}
+	def := summary("")
+	if def.MoveStartOffsetS == nil || *def.MoveStartOffsetS != 90 {
+		t.Fatalf("movement start offset %v want 90", def.MoveStartOffsetS)
+	}
+	if def.DurationS != 690 || def.AvgPowerW >= 200 {
+		t.Fatalf("default summary should span the pre-roll, got %v s at %v W", def.DurationS, def.AvgPowerW)
+	}
+	moved := summary(ElapsedOriginMovement)
+	if moved.DurationS != 600 || moved.AvgPowerW != 200 || moved.MoveStartOffsetS == nil || *moved.MoveStartOffsetS != 90 {
+		t.Fatalf("movement_start summary should skip the pre-roll, got %v s at %v W (offset %v)", moved.DurationS, moved.AvgPowerW, moved.MoveStartOffsetS)
+	}
+}
+
+func TestWorkoutAdherenceClassifiesSteps(t *testing.T) {
+	step := func(low, high, avg, tit, dur float64) WorkoutStep {
+		return WorkoutStep{
+			TargetLowW:        floatPtr(low),
+			TargetHighW:       floatPtr(high),
+			ObservedAvgPowerW: floatPtr(avg),
+			TimeInTargetPct:   floatPtr(tit),
+			DurationS:         floatPtr(dur),
+		}
+	}
+	report := WorkoutAdherence([]WorkoutStep{
+		step(240, 260, 250, 90, 240),
+		step(240, 260, 270, 40, 240),
+		step(100, 120, 90, 20, 120),
+		{StepName: "free ride"},
+	})
+	if report == nil {
+		t.Fatal("expected adherence report")
+	}
+	if report.StepsEvaluated != 3 || report.StepsHit != 1 || report.StepsOver != 1 || report.StepsUnder != 1 {
+		t.Fatalf("unexpected step counts: %+v", report)
+	}
+	if report.MeanTimeInTargetPct != 50 {
+		t.Fatalf("unexpected mean time in target: %v", report.MeanTimeInTargetPct)
+	}
+	if report.TargetEnergyKJ != 133.2 || report.ObservedEnergyKJ != 135.6 {
+		t.Fatalf("unexpected energy: target %v observed %v", report.TargetEnergyKJ, report.ObservedEnergyKJ)
+	}
+	if report.Verdict != "mixed" {
+		t.Fatalf("unexpected verdict %q", report.Verdict)
+	}
+	if WorkoutAdherence([]WorkoutStep{{StepName: "free ride"}}) != nil {
+		t.Fatal("expected nil report without targeted steps")
+	}
+}
+
+func TestBuildTSSAccumulationEndsAtSessionTSS(t *testing.T) {
+	samples := make([]CanonicalSample, 0, 901)
+	for i := 0; i <= 900; i++ {
+		power := 200.0
+		if i >= 300 && i < 600 {
+			power = 300
+		}
+		samples = append(samples, CanonicalSample{ElapsedS: float64(i), PowerW: floatPtr(power), ValidPower: true})
+	}
+	curve := BuildTSSAccumulation(samples, 250, 18.37)
+	if curve == nil {
+		t.Fatal("expected tss accumulation")
+	}
+	if len(curve.Buckets) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(curve.Buckets))
+	}
+	if got := curve.Buckets[len(curve.Buckets)-1].CumulativeTSS; got != 18.4 {
+		t.Fatalf("final bucket %v, want session TSS 18.4", got)
+	}
+	if curve.Buckets[1].TSS <= curve.Buckets[0].TSS {
+		t.Fatalf("expected harder middle bucket to accrue more load: %+v", curve.Buckets)
+	}
+	if BuildTSSAccumulation(samples, 0, 18.37) != nil {
+		t.Fatal("expected nil without FTP")
+	}
+}
+
+func TestBuildTSSAccumulationSkipsPauses(t *testing.T) {
+	// 5 min at 250 W, a 10 min stop, then 5 min more: the paused buckets
+	// must not accrue load from the sample before the stop.
+	var samples []CanonicalSample
+	for i := 0; i < 300; i++ {
+		samples = append(samples, CanonicalSample{ElapsedS: float64(i), PowerW: floatPtr(250), ValidPower: true})
+	}
+	for i := 900; i <= 1200; i++ {
+		samples = append(samples, CanonicalSample{ElapsedS: float64(i), PowerW: floatPtr(250), ValidPower: true})
+	}
+	curve := BuildTSSAccumulation(samples, 250, 16.6)
+	if curve == nil || len(curve.Buckets) != 4 {
+		t.Fatalf("expected 4 buckets, got %+v", curve)
+	}
+	if curve.Buckets[1].TSS != 0 || curve.Buckets[2].TSS != 0 {
+		t.Fatalf("paused buckets should accrue no load: %+v", curve.Buckets)
+	}
+	if curve.Buckets[0].TSS != curve.Buckets[3].TSS {
+		t.Fatalf("riding buckets should share the load evenly: %+v", curve.Buckets)
+	}
+}
+
+func TestAnalyzeFileWeightFillsWPerKGNotes(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "intervals.fit")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write fixture copy: %v", err)
+	}
+	// The config fitnotes builds from --ftp 280 --weight 70.
+	a, err := analyzer.AnalyzeFile(path, analyzer.Config{FTPWatts: 280, WeightKG: 70})
+	if err != nil {
+		t.Fatalf("AnalyzeFile error: %v", err)
+	}
+	if a.WeightKG != 70 || math.Abs(a.AvgPowerWPerKG-a.AvgPowerWatts/70) > 0.01 || a.NPWPerKG <= 0 || a.MaxPowerWPerKG <= 0 {
+		t.Fatalf("W/kg fields not filled: %+v", a)
+	}
+	want := fmt.Sprintf("W/kg %.2f avg / %.2f NP / %.2f max | Weight 70.0 kg", a.AvgPowerWPerKG, a.NPWPerKG, a.MaxPowerWPerKG)
+	if !strings.Contains(a.Notes, want) {
+		t.Fatalf("notes missing %q:\n%s", want, a.Notes)
+	}
+	if md := analyzer.BuildTrainingSummaryMarkdown(a); !strings.Contains(md, fmt.Sprintf("- NP W/kg: %.2f", a.NPWPerKG)) {
+		t.Fatalf("summary markdown missing NP W/kg:\n%s", md)
+	}
+}
+
+func TestAnalyzerEntryPointsShareDecodePath(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "intervals.fit")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write fixture copy: %v", err)
+	}
+	cfg := analyzer.Config{FTPWatts: 280}
+	fromFile, err := analyzer.AnalyzeFile(path, cfg)
+	if err != nil {
+		t.Fatalf("AnalyzeFile error: %v", err)
+	}
+	fromBytes, err := analyzer.AnalyzeBytes(data, "intervals.fit", cfg)
+	if err != nil {
+		t.Fatalf("AnalyzeBytes error: %v", err)
+	}
+	fromReader, err := analyzer.AnalyzeReader(bytes.NewReader(data), cfg)
+	if err != nil {
+		t.Fatalf("AnalyzeReader error: %v", err)
+	}
+	if fromFile.FilePath != path || fromBytes.FilePath != "intervals.fit" || fromReader.FilePath != "" {
+		t.Fatalf("unexpected file paths: %q %q %q", fromFile.FilePath, fromBytes.FilePath, fromReader.FilePath)
+	}
+	for _, a := range []*analyzer.Analysis{fromBytes, fromReader} {
+		if a.NormalizedPower != fromFile.NormalizedPower || a.TrainingStress != fromFile.TrainingStress || a.WorkoutStructure.CanonicalLabel != fromFile.WorkoutStructure.CanonicalLabel {
+			t.Fatalf("analysis differs from AnalyzeFile: NP %v/%v TSS %v/%v", a.NormalizedPower, fromFile.NormalizedPower, a.TrainingStress, fromFile.TrainingStress)
+		}
+	}
+
+	// A file_id-only activity fails identically from a path and from bytes.
+	empty := fittest.Encode(t, fit.FileTypeActivity, nil)
+	emptyPath := filepath.Join(t.TempDir(), "empty.fit")
+	if err := os.WriteFile(emptyPath, empty, 0o644); err != nil {
+		t.Fatalf("write empty fit: %v", err)
+	}
+	_, fileErr := analyzer.AnalyzeFile(emptyPath, cfg)
+	_, bytesErr := analyzer.AnalyzeBytes(empty, "empty.fit", cfg)
+	_, readerErr := analyzer.AnalyzeReader(bytes.NewReader(empty), cfg)
+	if fileErr == nil || bytesErr == nil || readerErr == nil {
+		t.Fatalf("expected errors for an activity without sessions or records: %v / %v / %v", fileErr, bytesErr, readerErr)
+	}
+	if fileErr.Error() != bytesErr.Error() || bytesErr.Error() != readerErr.Error() {
+		t.Fatalf("error mismatch: %q / %q / %q", fileErr, bytesErr, readerErr)
+	}
+}
+
+func TestRunBytesInputFTPOverridesDeviceFTPForZones(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 600; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = 200
+			activity.Records = append(activity.Records, rec)
+		}
+		session := fit.NewSessionMsg()
+		session.StartTime = start
+		session.Timestamp = start.Add(600 * time.Second)
+		session.TotalElapsedTime = 600000
+		session.TotalTimerTime = 600000
+		session.Sport = fit.SportCycling
+		session.ThresholdPower = 300
+		activity.Sessions = append(activity.Sessions, session)
+	})
+
+	zoneOf := func(ftp float64) (string, string) {
+		t.Helper()
+		res, err := RunBytes(BytesOptions{SourceFileName: "zones.fit", FitData: data, Format: "csv", FTPOverride: ftp})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		for _, z := range res.Analysis.PowerZones {
+			if z.Seconds > 0 {
+				return z.Zone, res.Analysis.ZoneSource
+			}
+		}
+		t.Fatalf("no zone time in %+v", res.Analysis.PowerZones)
+		return "", ""
+	}
+	// 200 W is 67% of the device's 300 W FTP but 100% of a 200 W --ftp.
+	if zone, source := zoneOf(0); zone != "Z2 Endurance" || source != "device_ftp" {
+		t.Fatalf("without --ftp expected Z2 from device_ftp, got %s from %s", zone, source)
+	}
+	if zone, source := zoneOf(200); zone != "Z4 Threshold" || source != "config_ftp" {
+		t.Fatalf("with --ftp expected Z4 from config_ftp, got %s from %s", zone, source)
+	}
+}
+
+func TestAnalyzeBytesZoneSourceOrder(t *testing.T) {
+	encode := func(threshold uint16) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+			for i := 0; i <= 600; i++ {
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+				rec.Power = 200
+				activity.Records = append(activity.Records, rec)
+			}
+			session := fit.NewSessionMsg()
+			session.StartTime = start
+			session.Timestamp = start.Add(600 * time.Second)
+			session.TotalElapsedTime = 600000
+			session.TotalTimerTime = 600000
+			session.Sport = fit.SportCycling
+			session.ThresholdPower = threshold
+			activity.Sessions = append(activity.Sessions, session)
+		})
+	}
+	withDevice, withoutDevice := encode(300), encode(0xFFFF)
+	zones := &analyzer.DevicePowerZones{FTPWatts: 300, HighBoundariesW: []float64{150, 250}}
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		cfg  analyzer.Config
+		want string
+	}{
+		{"device zones beat config FTP", withDevice, analyzer.Config{FTPWatts: 200, DeviceZones: zones}, "device_zones"},
+		{"device FTP beats config FTP", withDevice, analyzer.Config{FTPWatts: 200}, "device_ftp"},
+		{"file-ranked FTP is config", withDevice, analyzer.Config{FTPWatts: 200, FTPSource: "sport_profile", DeviceZones: zones}, "device_zones"},
+		{"override beats device zones", withDevice, analyzer.Config{FTPWatts: 200, FTPIsOverride: true, DeviceZones: zones}, "config_ftp"},
+		{"config FTP without device", withoutDevice, analyzer.Config{FTPWatts: 200}, "config_ftp"},
+		{"estimated without any FTP", withoutDevice, analyzer.Config{}, "estimated_ftp"},
+	} {
+		a, err := analyzer.AnalyzeBytes(tc.data, "zones.fit", tc.cfg)
+		if err != nil {
+			t.Fatalf("%s: AnalyzeBytes() error: %v", tc.name, err)
+		}
+		if a.ZoneSource != tc.want {
+			t.Fatalf("%s: zone source %q want %q", tc.name, a.ZoneSource, tc.want)
+		}
+	}
+}
+
+func TestRunBytesSynthesizesMissingSession(t *testing.T) {
+	start := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 60; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = 200
+			rec.HeartRate = 140
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "sessionless.fit",
+		FitData:        data,
+		Format:         "csv",
+	})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if a.SessionNote == "" {
+		t.Fatal("expected synthesized session note")
+	}
+	if !a.StartTime.Equal(start) || a.ElapsedSeconds != 60 {
+		t.Fatalf("unexpected start/duration: %v %v", a.StartTime, a.ElapsedSeconds)
+	}
+	if a.AvgPowerWatts != 200 || a.AvgHeartRate != 140 {
+		t.Fatalf("unexpected power/hr: %v %v", a.AvgPowerWatts, a.AvgHeartRate)
+	}
+	found := false
+	for _, w := range res.Warnings {
+		if w == a.SessionNote {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected session warning in %v", res.Warnings)
+	}
+}
+
+func TestAggregateSeasonTracksLoad(t *testing.T) {
+	day := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	report := AggregateSeason([]SummaryLine{
+		{StartTime: day, TSS: 70},
+		{StartTime: day.Add(10 * time.Hour), TSS: 14},
+		{StartTime: day.AddDate(0, 0, 2), TSS: 100},
+		{TSS: 500},
+	})
+	if report == nil {
+		t.Fatal("expected season report")
+	}
+	if report.Activities != 3 || len(report.Days) != 3 || report.TotalTSS != 184 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	first := report.Days[0]
+	if first.TSS != 84 || first.CTL != 2 || first.ATL != 12 || first.TSB != 0 {
+		t.Fatalf("unexpected first day: %+v", first)
+	}
+	rest := report.Days[1]
+	if rest.TSS != 0 || rest.TSB != -10 || rest.ATL >= first.ATL {
+		t.Fatalf("unexpected rest day: %+v", rest)
+	}
+	if AggregateSeason(nil) != nil {
+		t.Fatal("expected nil without activities")
+	}
+}
+
+func TestBuildCanonicalSamplesMergesMultiplexedRecordDefinitions(t *testing.T) {
+	const anchorRaw = uint32(1_100_000_000)
+	var data []byte
+	record := func(local byte, ts uint32, fields ...[]byte) {
+		data = append(data, local)
+		data = binary.LittleEndian.AppendUint32(data, ts)
+		for _, f := range fields {
+			data = append(data, f...)
+		}
+	}
+	u16 := func(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+
+	// Local 0: timestamp + power; local 1: timestamp + hr + cadence.
+	data = append(data, 0x40, 0, 0, 20, 0, 2, 253, 4, 0x86, 7, 2, 0x84)
+	data = append(data, 0x41, 0, 0, 20, 0, 3, 253, 4, 0x86, 3, 1, 0x02, 4, 1, 0x02)
+	record(0, anchorRaw, u16(200))
+	record(1, anchorRaw+1, []byte{140}, []byte{90})
+	// Redefine local 0 mid-stream with a different layout: hr before power.
+	data = append(data, 0x40, 0, 0, 20, 0, 3, 253, 4, 0x86, 3, 1, 0x02, 7, 2, 0x84)
+	record(0, anchorRaw+2, []byte{150}, u16(250))
+	record(1, anchorRaw+3, []byte{155}, []byte{95})
+
+	bundle, err := llmexport.ParseBytes(fittest.RawFIT(data))
+	if err != nil {
+		t.Fatalf("ParseBytes error: %v", err)
+	}
+	samples, _, _, err := buildCanonicalSamples(bundle.Records)
+	if err != nil {
+		t.Fatalf("buildCanonicalSamples error: %v", err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("expected 4 samples, got %d", len(samples))
+	}
+	value := func(p *float64) float64 {
+		if p == nil {
+			return -1
+		}
+		return *p
+	}
+	want := []struct{ power, hr, cad float64 }{
+		{200, -1, -1},
+		{-1, 140, 90},
+		{250, 150, -1},
+		{-1, 155, 95},
+	}
+	for i, w := range want {
+		s := samples[i]
+		if s.ElapsedS != float64(i) {
+			t.Fatalf("sample %d: elapsed %v", i, s.ElapsedS)
+		}
+		if value(s.PowerW) != w.power || value(s.HRBPM) != w.hr || value(s.CadenceRPM) != w.cad {
+			t.Fatalf("sample %d: power %v hr %v cadence %v, want %+v", i, value(s.PowerW), value(s.HRBPM), value(s.CadenceRPM), w)
+		}
+	}
+}
+
+func TestCanonicalSamplesKeepNegativeSignedFields(t *testing.T) {
+	const anchorRaw = uint32(1_100_000_000)
+	var data []byte
+	// timestamp, altitude (uint16, scale 5 offset 500), grade (sint16, scale
+	// 100), temperature (sint8).
+	data = append(data, 0x40, 0, 0, 20, 0, 4, 253, 4, 0x86, 2, 2, 0x84, 9, 2, 0x83, 13, 1, 0x01)
+	record := func(ts uint32, altitudeRaw uint16, gradeRaw int16, temp int8) {
+		data = append(data, 0)
+		data = binary.LittleEndian.AppendUint32(data, ts)
+		data = binary.LittleEndian.AppendUint16(data, altitudeRaw)
+		data = binary.LittleEndian.AppendUint16(data, uint16(gradeRaw))
+		data = append(data, byte(temp))
+	}
+	record(anchorRaw, 2450, -350, -5)
+	record(anchorRaw+1, 0xFFFF, 0x7FFF, 0x7F)
+
+	bundle, err := llmexport.ParseBytes(fittest.RawFIT(data))
+	if err != nil {
+		t.Fatalf("ParseBytes error: %v", err)
+	}
+	check := func(label string, samples []CanonicalSample) {
+		t.Helper()
+		if len(samples) != 2 {
+			t.Fatalf("%s: expected 2 samples, got %d", label, len(samples))
+		}
+		cold := samples[0]
+		if cold.TemperatureC == nil || *cold.TemperatureC != -5 {
+			t.Fatalf("%s: temperature %v, want -5", label, cold.TemperatureC)
+		}
+		if cold.GradePct == nil || *cold.GradePct != -3.5 {
+			t.Fatalf("%s: grade %v, want -3.5", label, cold.GradePct)
+		}
+		if cold.AltitudeM == nil || *cold.AltitudeM != -10 {
+			t.Fatalf("%s: altitude %v, want -10", label, cold.AltitudeM)
+		}
+		invalid := samples[1]
+		if invalid.TemperatureC != nil || invalid.GradePct != nil || invalid.AltitudeM != nil {
+			t.Fatalf("%s: expected invalid sentinels to be empty: %+v", label, invalid)
+		}
+	}
+
+	samples, _, _, err := buildCanonicalSamples(bundle.Records)
+	if err != nil {
+		t.Fatalf("buildCanonicalSamples error: %v", err)
+	}
+	check("flat", samples)
+
+	// Without the parser's flat projection the field fallback must agree.
+	for i := range bundle.Records {
+		if bundle.Records[i].Data != nil {
+			bundle.Records[i].Data.Flat = nil
+		}
+	}
+	samples, _, _, err = buildCanonicalSamples(bundle.Records)
+	if err != nil {
+		t.Fatalf("buildCanonicalSamples error: %v", err)
+	}
+	check("fields", samples)
+}
+
+func TestCollectFTPCandidatesRejectsImplausibleDeveloperFTP(t *testing.T) {
+	description := func(field uint8, name string) llmexport.RecordEnvelope {
+		return llmexport.RecordEnvelope{
+			RecordKind:       "data",
+			GlobalMessageNum: 206,
+			Data: &llmexport.DataRecord{Fields: []llmexport.FieldValue{
+				{FieldNumber: 0, Decoded: uint8(0)},
+				{FieldNumber: 1, Decoded: field},
+				{FieldNumber: 2, Decoded: uint8(0x84)},
+				{FieldNumber: 3, Decoded: name},
+			}},
+		}
+	}
+	value := func(field uint8, ftp int) llmexport.DeveloperFieldValue {
+		return llmexport.DeveloperFieldValue{FieldNumber: field, DecodedByteValues: []int{ftp & 0xFF, ftp >> 8}}
+	}
+	records := []llmexport.RecordEnvelope{
+		description(0, "FTP"),
+		description(1, "ftp_setting"),
+		description(2, "app_ftp"),
+		{
+			RecordKind:       "data",
+			GlobalMessageNum: 18,
+			Data: &llmexport.DataRecord{DeveloperFields: []llmexport.DeveloperFieldValue{
+				value(0, 265),
+				value(1, 580),
+				value(2, 150),
+			}},
+		},
+	}
+	candidates, warnings := collectFTPCandidates(records, nil, &analyzer.Analysis{Best20MinPower: 250}, 0)
+	if len(candidates) != 1 || candidates[0].FTPW != 265 || candidates[0].Source != "developer_field" {
+		t.Fatalf("expected only the 265 W developer FTP, got %+v", candidates)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("expected two rejection warnings, got %v", warnings)
+	}
+	if !strings.Contains(warnings[0], "580") || !strings.Contains(warnings[1], "best 20-minute power") {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+}
+
+func BenchmarkCollectFTPCandidatesManyDeveloperFields(b *testing.B) {
+	const fieldsPerRecord = 200
+	records := make([]llmexport.RecordEnvelope, 0, fieldsPerRecord+3600)
+	for field := 0; field < fieldsPerRecord; field++ {
+		name := fmt.Sprintf("metric_%d", field)
+		if field == fieldsPerRecord-1 {
+			name = "ftp"
+		}
+		records = append(records, llmexport.RecordEnvelope{
+			RecordKind:       "data",
+			GlobalMessageNum: 206,
+			Data: &llmexport.DataRecord{Fields: []llmexport.FieldValue{
+				{FieldNumber: 0, Decoded: uint8(0)},
+				{FieldNumber: 1, Decoded: uint8(field)},
+				{FieldNumber: 2, Decoded: uint8(0x84)},
+				{FieldNumber: 3, Decoded: name},
+			}},
+		})
+	}
+	devFields := make([]llmexport.DeveloperFieldValue, fieldsPerRecord)
+	for field := range devFields {
+		devFields[field] = llmexport.DeveloperFieldValue{FieldNumber: uint8(field), DecodedByteValues: []int{265 & 0xFF, 265 >> 8}}
+	}
+	for i := 0; i < 3600; i++ {
+		records = append(records, llmexport.RecordEnvelope{
+			RecordKind:       "data",
+			GlobalMessageNum: 20,
+			Data:             &llmexport.DataRecord{DeveloperFields: devFields},
+		})
+	}
+	analysis := &analyzer.Analysis{Best20MinPower: 250}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		candidates, _ := collectFTPCandidates(records, nil, analysis, 0)
+		if len(candidates) != 1 {
+			b.Fatalf("expected one developer FTP candidate, got %d", len(candidates))
+		}
+	}
+}
+
+func TestRunBytesFlagsStuckHeartRate(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 15*60; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = uint16(180 + (i%20)*3)
+			rec.HeartRate = 142
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "stuck.fit",
+		FitData:        data,
+		Format:         "csv",
+	})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if got := res.Analysis.StuckSensors; len(got) != 1 || got[0] != "heart_rate" {
+		t.Fatalf("unexpected stuck sensors: %v", got)
+	}
+	found := false
+	for _, w := range res.Warnings {
+		if strings.HasPrefix(w, "heart_rate stayed constant") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected stuck sensor warning in %v", res.Warnings)
+	}
+}
+
+func TestRunBytesStuckSensorsIgnoreSteadyERG(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	// Fifteen minutes of ERG at 200-201 W with HR settled at 142-143 bpm,
+	// then six minutes of a heart rate strap repeating 150 bpm.
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 21*60; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = uint16(200 + i%2)
+			rec.HeartRate = uint8(142 + (i/7)%2)
+			if i > 15*60 {
+				rec.HeartRate = 150
+			}
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	stuck := func(opts BytesOptions) []string {
+		t.Helper()
+		opts.SourceFileName, opts.FitData, opts.Format = "erg.fit", data, "csv"
+		res, err := RunBytes(opts)
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		return res.Analysis.StuckSensors
+	}
+	if got := stuck(BytesOptions{}); len(got) != 0 {
+		t.Fatalf("steady ERG power and HR should not look stuck, got %v", got)
+	}
+	if got := stuck(BytesOptions{StuckSensorMinSeconds: 300}); len(got) != 1 || got[0] != "heart_rate" {
+		t.Fatalf("a 300 s minimum should flag the repeated heart rate, got %v", got)
+	}
+}
+
+func TestRunBytesLabelsWalkingCyclesAsStrides(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 600; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Speed = 1400
+			rec.Distance = uint32(i * 140)
+			activity.Records = append(activity.Records, rec)
+		}
+		session := fit.NewSessionMsg()
+		session.StartTime = start
+		session.Timestamp = start.Add(600 * time.Second)
+		session.Sport = fit.SportWalking
+		session.TotalCycles = 540
+		activity.Sessions = append(activity.Sessions, session)
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "walk.fit", FitData: data})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if a := res.Analysis; a.TotalCycles != 540 || a.CycleUnit != "strides" {
+		t.Fatalf("walking total_cycles count strides, got %d %q", a.TotalCycles, a.CycleUnit)
+	}
+}
+
+func TestRunBytesSportOverride(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 600; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Speed = 3000
+			rec.Distance = uint32(i * 300)
+			activity.Records = append(activity.Records, rec)
+		}
+		session := fit.NewSessionMsg()
+		session.StartTime = start
+		session.Timestamp = start.Add(600 * time.Second)
+		session.Sport = fit.SportGeneric
+		session.TotalCycles = 900
+		activity.Sessions = append(activity.Sessions, session)
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "run.fit", FitData: data, SportOverride: "Running"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if a := res.Analysis; a.Sport != "Running" || a.SportSource != "override" || a.CycleUnit != "strides" {
+		t.Fatalf("override should make the generic file a run, got %s (%s) counting %s", a.Sport, a.SportSource, a.CycleUnit)
+	}
+	if _, err := RunBytes(BytesOptions{SourceFileName: "run.fit", FitData: data, SportOverride: "jogging"}); err == nil || !strings.Contains(err.Error(), "unknown sport override") {
+		t.Fatalf("expected an unknown sport error, got %v", err)
+	}
+}
+
+func TestRunBytesCategorizesClimbs(t *testing.T) {
+	// 1 km flat, then 2.5 km at 8% at 5 m/s and 300 W, then 1 km flat.
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 900; i++ {
+			dist := float64(i) * 5
+			alt, power := 100.0, uint16(180)
+			switch {
+			case dist > 3500:
+				alt = 300
+			case dist > 1000:
+				alt, power = 100+(dist-1000)*0.08, 300
+			}
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.PositionLat = fit.NewLatitudeDegrees(41.9 + dist/111195)
+			rec.PositionLong = fit.NewLongitudeDegrees(2.8)
+			rec.Distance = uint32(dist * 100)
+			rec.Altitude = uint16((alt + 500) * 5)
+			rec.Speed = 5000
+			rec.Power = power
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "climb.fit", FitData: data, WeightKG: 75})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	climbs := res.Analysis.Climbs
+	if len(climbs) != 1 {
+		t.Fatalf("expected one climb, got %+v", climbs)
+	}
+	// The climb runs on through the flat until the dip tolerance (200 m) is
+	// used up, which dilutes its grade, VAM and power a little.
+	c := climbs[0]
+	if c.Category != "Cat 3" || math.Abs(c.GainM-200) > 1 || c.LengthM < 2500 || c.LengthM > 2500+250 {
+		t.Fatalf("expected a 2.5 km, 200 m Cat 3 climb, got %+v", c)
+	}
+	if c.VAM < 1300 || c.VAM > 1440 || c.WPerKG < 3.8 || c.WPerKG > 4 {
+		t.Fatalf("expected ~1300-1440 m/h VAM at ~4 W/kg, got %v and %v", c.VAM, c.WPerKG)
+	}
+}
+
+func TestAnalyzeBytesGAPZonesSeparateFlatAndUphillRunning(t *testing.T) {
+	// 10 min flat then 10 min up a 5% grade, both at 3 m/s. Minetti's cost
+	// factor makes the uphill half worth about 3.9 m/s on the flat.
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 1200; i++ {
+			dist, alt := float64(i)*3, 100.0
+			if i > 600 {
+				alt += (dist - 1800) * 0.05
+			}
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Distance = uint32(dist * 100)
+			rec.Altitude = uint16((alt + 500) * 5)
+			rec.Speed = 3000
+			activity.Records = append(activity.Records, rec)
+		}
+		session := fit.NewSessionMsg()
+		session.StartTime = start
+		session.Timestamp = start.Add(1200 * time.Second)
+		session.Sport = fit.SportRunning
+		activity.Sessions = append(activity.Sessions, session)
+	})
+
+	a, err := analyzer.AnalyzeBytes(data, "hill.fit", analyzer.Config{ThresholdGAPMps: 4.4})
+	if err != nil {
+		t.Fatalf("AnalyzeBytes error: %v", err)
+	}
+	if a.ThresholdGAPSource != "input" || a.GradeAdjustedSpeedMps < 3.3 || a.GradeAdjustedSpeedMps > 3.6 {
+		t.Fatalf("expected input threshold and ~3.45 m/s average GAP, got %q %v", a.ThresholdGAPSource, a.GradeAdjustedSpeedMps)
+	}
+	seconds := map[string]float64{}
+	for _, z := range a.GAPZones {
+		seconds[z.Zone] = z.Seconds
+	}
+	// 3 m/s is 68% of threshold (Z1); 3.9 m/s GAP is 89% (Z3).
+	if math.Abs(seconds["Z1 Recovery"]-600) > 30 || math.Abs(seconds["Z3 Tempo"]-600) > 30 {
+		t.Fatalf("expected the flat half in Z1 and the climb in Z3, got %+v", a.GAPZones)
+	}
+
+	cycling, err := analyzer.AnalyzeBytes(data, "hill.fit", analyzer.Config{ThresholdGAPMps: 4.4, SportOverride: "cycling"})
+	if err != nil {
+		t.Fatalf("AnalyzeBytes error: %v", err)
+	}
+	if len(cycling.GAPZones) != 0 || cycling.GradeAdjustedSpeedMps != 0 {
+		t.Fatal("GAP is only computed for running")
+	}
+}
+
+func TestRunBytesVirtualActivityNotes(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	encode := func(subSport fit.SubSport) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			for i := 0; i <= 600; i++ {
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+				rec.Power = 200
+				rec.Speed = 9000
+				rec.Distance = uint32(i * 900)
+				activity.Records = append(activity.Records, rec)
+			}
+			session := fit.NewSessionMsg()
+			session.StartTime = start
+			session.Timestamp = start.Add(600 * time.Second)
+			session.Sport = fit.SportCycling
+			session.SubSport = subSport
+			activity.Sessions = append(activity.Sessions, session)
+		})
+	}
+	analyze := func(subSport fit.SubSport) (*analyzer.Analysis, string) {
+		res, err := RunBytes(BytesOptions{SourceFileName: "zwift.fit", FitData: encode(subSport), Format: "csv"})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		return res.Analysis, string(res.Files["training_summary.md"])
+	}
+
+	virtual, md := analyze(fit.SubSportVirtualActivity)
+	if !virtual.IsVirtual || !strings.Contains(virtual.Notes, "Virtual distance 5.4 km (simulated, device-reported)") {
+		t.Fatalf("virtual ride notes should flag simulated distance:\n%s", virtual.Notes)
+	}
+	if !strings.Contains(md, "- Distance: 5.4 km (virtual)") || strings.Contains(md, "- Elevation:") || strings.Contains(md, "- Speed:") {
+		t.Fatalf("virtual ride summary should skip elevation and speed commentary:\n%s", md)
+	}
+	road, md := analyze(fit.SubSportRoad)
+	if road.IsVirtual || !strings.Contains(md, "- Elevation:") {
+		t.Fatalf("road ride should keep elevation commentary:\n%s", md)
+	}
+}
+
+func TestRunBytesReportsBatteryVoltageDrop(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i, volts := range []uint16{4 * 256, 3 * 256} {
+			info := fit.NewDeviceInfoMsg()
+			info.Timestamp = start.Add(time.Duration(i) * 10 * time.Minute)
+			info.DeviceIndex = 0
+			info.BatteryVoltage = volts
+			activity.DeviceInfos = append(activity.DeviceInfos, info)
+		}
+		for i := 0; i <= 600; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = 200
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "battery.fit", FitData: data})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if a.BatteryVoltageDropPct == nil || *a.BatteryVoltageDropPct != 25 {
+		t.Fatalf("expected a 25%% voltage drop, got %v", a.BatteryVoltageDropPct)
+	}
+	if len(a.Batteries) != 1 || a.Batteries[0].StartVoltage != 4 || a.Batteries[0].EndVoltage != 3 {
+		t.Fatalf("unexpected batteries %+v", a.Batteries)
+	}
+}
+
+func TestRunBytesTreatsTrainerWithoutGPSAsIndoor(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		trainer := fit.NewDeviceInfoMsg()
+		trainer.Timestamp = start
+		trainer.SourceType = fit.SourceTypeAntplus
+		trainer.DeviceType = uint8(fit.AntplusDeviceTypeFitnessEquipment)
+		activity.DeviceInfos = append(activity.DeviceInfos, trainer)
+		for i := 0; i <= 15*60; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = uint16(200 + (i%20)*3)
+			rec.HeartRate = uint8(130 + i%15)
+			// ERG mode: the trainer reports a flat simulated speed.
+			rec.Speed = 9000
+			rec.Distance = uint32(i * 900)
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "trainer.fit", FitData: data})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if a.Environment != "indoor" || a.EnvironmentSource != "trainer_no_gps" {
+		t.Fatalf("expected indoor via trainer_no_gps, got %q (%q)", a.Environment, a.EnvironmentSource)
+	}
+	if len(a.StuckSensors) != 0 {
+		t.Fatalf("flat trainer speed should not be flagged stuck indoors, got %v", a.StuckSensors)
+	}
+}
+
+func TestRunBytesPrefersCrankCadenceOverTrainer(t *testing.T) {
+	encode := func(withCrank bool) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+			trainer := fit.NewDeviceInfoMsg()
+			trainer.Timestamp = start
+			trainer.DeviceIndex = 1
+			trainer.SourceType = fit.SourceTypeAntplus
+			trainer.DeviceType = uint8(fit.AntplusDeviceTypeFitnessEquipment)
+			activity.DeviceInfos = append(activity.DeviceInfos, trainer)
+			if withCrank {
+				meter := fit.NewDeviceInfoMsg()
+				meter.Timestamp = start
+				meter.DeviceIndex = 2
+				meter.SourceType = fit.SourceTypeAntplus
+				meter.DeviceType = uint8(fit.AntplusDeviceTypeBikePower)
+				meter.ProductName = "Crank PM"
+				// device_info repeats at the end of the file; it is one sensor.
+				again := *meter
+				again.Timestamp = start.Add(10 * time.Minute)
+				activity.DeviceInfos = append(activity.DeviceInfos, meter, &again)
+			}
+			for i := 0; i <= 10*60; i++ {
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+				rec.Power = uint16(200 + (i%20)*3)
+				rec.Cadence = uint8(88 + i%5)
+				activity.Records = append(activity.Records, rec)
+			}
+		})
+	}
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "dual.fit", FitData: encode(true), Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if a.CadenceSource != analyzer.CadenceSourceCrank || a.CadenceNote == "" {
+		t.Fatalf("expected crank cadence with a dual-sensor note, got %q (%q)", a.CadenceSource, a.CadenceNote)
+	}
+	if len(a.CadenceStreams) != 0 {
+		t.Fatalf("only one cadence stream was recorded, got %+v", a.CadenceStreams)
+	}
+	want := []analyzer.CadenceSensor{
+		{DeviceIndex: 1, Source: analyzer.CadenceSourceWheel},
+		{DeviceIndex: 2, Device: "Crank PM", Source: analyzer.CadenceSourceCrank},
+	}
+	if len(a.CadenceSensors) != len(want) || a.CadenceSensors[0] != want[0] || a.CadenceSensors[1] != want[1] {
+		t.Fatalf("cadence sensors %+v want %+v", a.CadenceSensors, want)
+	}
+
+	res, err = RunBytes(BytesOptions{SourceFileName: "trainer.fit", FitData: encode(false), Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if a := res.Analysis; a.CadenceSource != analyzer.CadenceSourceWheel || len(a.CadenceSensors) != 1 || a.CadenceNote == "" {
+		t.Fatalf("expected wheel cadence from the trainer alone, got %q %+v", a.CadenceSource, a.CadenceSensors)
+	}
+}
+
+func TestRunBytesQuadrantAnalysis(t *testing.T) {
+	// One minute in each quadrant at FTP 250 W, then a coasting minute that
+	// is not pedaling and must not count.
+	blocks := []struct {
+		power   uint16
+		cadence uint8
+	}{{300, 100}, {300, 70}, {100, 70}, {150, 100}, {0, 0}}
+	encode := func(withCadence bool) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+			for b, block := range blocks {
+				for i := 0; i < 60; i++ {
+					rec := fit.NewRecordMsg()
+					rec.Timestamp = start.Add(time.Duration(b*60+i) * time.Second)
+					rec.Power = block.power
+					if withCadence {
+						rec.Cadence = block.cadence
+					}
+					activity.Records = append(activity.Records, rec)
+				}
+			}
+		})
+	}
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "quadrants.fit", FitData: encode(true), Format: "csv", FTPOverride: 250})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	q := res.Analysis.QuadrantAnalysis
+	if q == nil {
+		t.Fatal("expected quadrant analysis")
+	}
+	if q.PedalingSampleCount != 240 {
+		t.Fatalf("expected 240 pedaling samples, got %d", q.PedalingSampleCount)
+	}
+	for name, pct := range map[string]float64{
+		"q1": q.HighForceHighVelPct,
+		"q2": q.HighForceLowVelPct,
+		"q3": q.LowForceLowVelPct,
+		"q4": q.LowForceHighVelPct,
+	} {
+		if pct != 25 {
+			t.Fatalf("%s: expected 25%%, got %.2f (%+v)", name, pct, q)
+		}
+	}
+	if q.ThresholdCadenceRPM != 90 || math.Abs(q.ThresholdAEPFN*q.ThresholdCPVMps-250) > 1 {
+		t.Fatalf("thresholds should put FTP at 90 rpm, got %+v", q)
+	}
+
+	res, err = RunBytes(BytesOptions{SourceFileName: "nocadence.fit", FitData: encode(false), Format: "csv", FTPOverride: 250})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if res.Analysis.QuadrantAnalysis != nil {
+		t.Fatalf("expected no quadrant analysis without cadence, got %+v", res.Analysis.QuadrantAnalysis)
+	}
+}
+
+func TestRunBytesReportsCrankAndWheelCadenceSeparately(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	file := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i, deviceType := range []fit.AntplusDeviceType{fit.AntplusDeviceTypeFitnessEquipment, fit.AntplusDeviceTypeBikePower} {
+			info := fit.NewDeviceInfoMsg()
+			info.Timestamp = start
+			info.DeviceIndex = fit.DeviceIndex(i + 1)
+			info.SourceType = fit.SourceTypeAntplus
+			info.DeviceType = uint8(deviceType)
+			activity.DeviceInfos = append(activity.DeviceInfos, info)
+		}
+	})
+	// A trainer app logs its own cadence as developer field 0 ("Trainer
+	// Cadence") next to the crank's record cadence.
+	raw := []byte{0x4D, 0, 0, 207, 0, 1, 3, 1, 0x02, 0x0D, 0}
+	raw = append(raw, 0x4E, 0, 0, 206, 0, 4, 0, 1, 0x02, 1, 1, 0x02, 2, 1, 0x02, 3, 16, 0x07)
+	raw = append(raw, 0x0E, 0, 0, 0x02)
+	raw = append(raw, append([]byte("Trainer Cadence"), 0)...)
+	raw = append(raw, 0x6C, 0, 0, 20, 0, 3, 253, 4, 0x86, 7, 2, 0x84, 4, 1, 0x02, 1, 0, 1, 0)
+	for i := 0; i < 600; i++ {
+		raw = append(raw, 0x0C)
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(start.Unix()-llmexport.FitEpoch.Unix())+uint32(i))
+		raw = binary.LittleEndian.AppendUint16(raw, 200)
+		raw = append(raw, 90, 80)
+	}
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "dual.fit", FitData: fittest.AppendRaw(file, raw), Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	want := []analyzer.CadenceStream{
+		{Source: analyzer.CadenceSourceCrank, Field: "record.cadence", Samples: 600, AvgRPM: 90, MaxRPM: 90},
+		{Source: analyzer.CadenceSourceWheel, Field: "developer_field", Samples: 600, AvgRPM: 80, MaxRPM: 80},
+	}
+	if len(a.CadenceStreams) != 2 || a.CadenceStreams[0] != want[0] || a.CadenceStreams[1] != want[1] {
+		t.Fatalf("cadence streams %+v want %+v", a.CadenceStreams, want)
+	}
+	if a.CadenceSource != analyzer.CadenceSourceCrank || a.AvgCadence != 90 {
+		t.Fatalf("pedaling cadence should stay on the crank stream, got %s at %v rpm", a.CadenceSource, a.AvgCadence)
+	}
+}
+
+func TestRunBytesBest20MinReliableUsesCoveredTime(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	// Smart recording every 2 s: fewer readings than seconds ridden.
+	ride := func(minutes int) *analyzer.Analysis {
+		data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			for i := 0; i <= minutes*60; i += 2 {
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+				rec.Power = 220
+				activity.Records = append(activity.Records, rec)
+			}
+		})
+		res, err := RunBytes(BytesOptions{SourceFileName: "smart.fit", FitData: data, Format: "csv"})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		return res.Analysis
+	}
+	if a := ride(21); !a.Best20MinReliable || a.Best20MinPower != 220 {
+		t.Fatalf("21 min of 2 s power should give a reliable best 20 min, got %v (%v)", a.Best20MinPower, a.Best20MinReliable)
+	}
+	if a := ride(19); a.Best20MinReliable {
+		t.Fatal("19 min of power cannot give a reliable best 20 min")
+	}
+}
+
+func TestRunBytesClassifiesPowerSource(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	encode := func(sensors ...fit.AntplusDeviceType) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			for i, deviceType := range sensors {
+				info := fit.NewDeviceInfoMsg()
+				info.Timestamp = start
+				info.DeviceIndex = fit.DeviceIndex(i + 1)
+				info.SourceType = fit.SourceTypeAntplus
+				info.DeviceType = uint8(deviceType)
+				activity.DeviceInfos = append(activity.DeviceInfos, info)
+			}
+			for i := 0; i < 600; i++ {
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+				rec.Power = 200
+				rec.HeartRate = 140
+				activity.Records = append(activity.Records, rec)
+			}
+		})
+	}
+	// An app's "Virtual Power" developer field description, with no sensors.
+	virtual := []byte{0x4D, 0, 0, 207, 0, 1, 3, 1, 0x02, 0x0D, 0}
+	virtual = append(virtual, 0x4E, 0, 0, 206, 0, 4, 0, 1, 0x02, 1, 1, 0x02, 2, 1, 0x02, 3, 16, 0x07)
+	virtual = append(virtual, 0x0E, 0, 0, 0x02)
+	virtual = append(virtual, []byte("Virtual Power\x00\x00\x00")...)
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"power meter", encode(fit.AntplusDeviceTypeHeartRate, fit.AntplusDeviceTypeBikePower), analyzer.PowerSourceMeter},
+		{"sensors without a meter", encode(fit.AntplusDeviceTypeHeartRate), analyzer.PowerSourceEstimated},
+		{"power developer field", fittest.AppendRaw(encode(), virtual), analyzer.PowerSourceEstimated},
+		{"no provenance", encode(), analyzer.PowerSourceUnknown},
+	} {
+		res, err := RunBytes(BytesOptions{SourceFileName: "power.fit", FitData: tc.data, Format: "csv"})
+		if err != nil {
+			t.Fatalf("%s: RunBytes() error: %v", tc.name, err)
+		}
+		if got := res.Analysis.PowerSource; got != tc.want {
+			t.Fatalf("%s: power source %q want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRunBytesRoutesMonitoringFiles(t *testing.T) {
+	data := fittest.Encode(t, fit.FileTypeMonitoringB, func(file *fit.File) {
+		monitoring, err := file.MonitoringB()
+		if err != nil {
+			t.Fatalf("monitoring accessor: %v", err)
+		}
+		start := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+		add := func(offset time.Duration, activityType fit.ActivityType, calories uint16, cycles uint32) {
+			m := fit.NewMonitoringMsg()
+			m.Timestamp = start.Add(offset)
+			m.ActivityType = activityType
+			m.Calories = calories
+			m.Cycles = cycles
+			monitoring.Monitorings = append(monitoring.Monitorings, m)
+		}
+		add(time.Hour, fit.ActivityTypeSedentary, 400, 0)
+		add(8*time.Hour, fit.ActivityTypeWalking, 120, 3000)
+		add(12*time.Hour, fit.ActivityTypeWalking, 250, 7500)
+		add(20*time.Hour, fit.ActivityTypeSedentary, 1500, 0)
+	})
+
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "wellness.fit",
+		FitData:        data,
+		Format:         "csv",
+	})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if res.Analysis != nil {
+		t.Fatal("expected no activity analysis for a monitoring file")
+	}
+	m := res.Monitoring
+	if m == nil || m.TotalSteps != 7500 || m.TotalCalories != 1750 || m.ActiveCalories != 250 {
+		t.Fatalf("unexpected monitoring summary: %+v", m)
+	}
+	if _, ok := res.Files["monitoring_summary.json"]; !ok {
+		t.Fatal("expected monitoring_summary.json")
+	}
+	if _, ok := res.Files["activity_summary.json"]; ok {
+		t.Fatal("unexpected activity artifact for a monitoring file")
+	}
+}
+
+func TestBuildActivitySummaryPedalingNPExcludesCoasting(t *testing.T) {
+	samples := make([]CanonicalSample, 0, 120)
+	for i := 0; i < 120; i++ {
+		power := 250.0
+		if i%2 == 1 {
+			power = 0
+		}
+		samples = append(samples, CanonicalSample{
+			ElapsedS:   float64(i),
+			PowerW:     floatPtr(power),
+			ValidPower: true,
+			SpeedMPS:   floatPtr(12),
+		})
+	}
+	ftp := &FTPCandidate{FTPW: 250, Source: "user_profile"}
+
+	all := buildActivitySummary(samples, ftp, 120, 0, false, 0, nil)
+	pedaling := buildActivitySummary(samples, ftp, 120, 0, true, 0, nil)
+	if math.Abs(all.NPWPedaling-250) > 1e-6 || all.NPW >= all.NPWPedaling {
+		t.Fatalf("unexpected NP values: np=%v pedaling=%v", all.NPW, all.NPWPedaling)
+	}
+	if all.IFNPBasis != "all_samples" || pedaling.IFNPBasis != "pedaling" {
+		t.Fatalf("unexpected IF basis: %q %q", all.IFNPBasis, pedaling.IFNPBasis)
+	}
+	if pedaling.IF == nil || math.Abs(*pedaling.IF-1) > 1e-6 {
+		t.Fatalf("expected pedaling IF of 1, got %v", pedaling.IF)
+	}
+}
+
+func TestBuildActivitySummaryCoastingPctUsesMovingTime(t *testing.T) {
+	samples := make([]CanonicalSample, 0, 100)
+	for i := 0; i < 100; i++ {
+		power, speed := 220.0, 10.0
+		switch {
+		case i >= 80:
+			power, speed = 0, 0 // stopped: not moving time
+		case i >= 60:
+			power = 0
+		}
+		samples = append(samples, CanonicalSample{
+			ElapsedS:   float64(i),
+			PowerW:     floatPtr(power),
+			ValidPower: true,
+			SpeedMPS:   floatPtr(speed),
+		})
+	}
+	summary := buildActivitySummary(samples, nil, 100, 0, false, 0, nil)
+	if summary.CoastingPct == nil || math.Abs(*summary.CoastingPct-25) > 1e-9 {
+		t.Fatalf("expected 25%% coasting of moving time, got %v", summary.CoastingPct)
+	}
+
+	// Moving samples without power or cadence say nothing about pedaling.
+	for i := range samples {
+		samples[i].ValidPower, samples[i].SpeedMPS = false, floatPtr(10)
+	}
+	if got := buildActivitySummary(samples, nil, 100, 0, false, 0, nil).CoastingPct; got != nil {
+		t.Fatalf("expected no coasting_pct without power or cadence, got %v", *got)
+	}
+}
+
+func TestBuildActivitySummarySampleRateSegments(t *testing.T) {
+	// 20 min at 1 Hz with a one-minute 2 s blip, then 20 min of 4 s smart
+	// recording.
+	start := time.Date(2026, 2, 26, 23, 0, 0, 0, time.UTC)
+	var samples []CanonicalSample
+	add := func(elapsed float64) {
+		samples = append(samples, CanonicalSample{
+			Timestamp:  start.Add(time.Duration(elapsed * float64(time.Second))),
+			ElapsedS:   elapsed,
+			PowerW:     floatPtr(200),
+			ValidPower: true,
+		})
+	}
+	for e := 0.0; e < 600; e++ {
+		add(e)
+	}
+	for e := 600.0; e < 660; e += 2 {
+		add(e)
+	}
+	for e := 660.0; e < 1200; e++ {
+		add(e)
+	}
+	for e := 1200.0; e <= 2400; e += 4 {
+		add(e)
+	}
+
+	summary := buildActivitySummary(samples, nil, 0, 0, false, 0, nil)
+	want := []SampleRateSegment{
+		{StartS: 0, EndS: 1200, MedianIntervalS: 1},
+		{StartS: 1200, EndS: 2400, MedianIntervalS: 4},
+	}
+	if len(summary.SampleRateSegments) != len(want) {
+		t.Fatalf("segments %+v want %+v", summary.SampleRateSegments, want)
+	}
+	for i, seg := range summary.SampleRateSegments {
+		if seg != want[i] {
+			t.Fatalf("segments %+v want %+v", summary.SampleRateSegments, want)
+		}
+	}
+	found := false
+	for _, w := range summary.Warnings {
+		found = found || strings.Contains(w, "sample rate changes within file (2 segments)")
+	}
+	if !found {
+		t.Fatalf("expected a sample rate warning, got %v", summary.Warnings)
+	}
+}
+
+func TestSmoothGradeWindowFollowsSampleRate(t *testing.T) {
+	grades := []*float64{floatPtr(0), nil, floatPtr(0), floatPtr(6), floatPtr(6), floatPtr(6)}
+	build := func(interval float64) []CanonicalSample {
+		samples := make([]CanonicalSample, len(grades))
+		for i, g := range grades {
+			samples[i] = CanonicalSample{ElapsedS: float64(i) * interval, GradePct: g}
+		}
+		return samples
+	}
+	// A 3 s window spans one neighbour each side at 1 Hz, as 6 s does at 0.5 Hz.
+	one, half := build(1), build(2)
+	smoothGrade(one, 3)
+	smoothGrade(half, 6)
+	// The missing sample stays empty and is left out of its neighbours' means.
+	want := []*float64{floatPtr(0), nil, floatPtr(3), floatPtr(4), floatPtr(6), floatPtr(6)}
+	text := func(v *float64) string {
+		if v == nil {
+			return "nil"
+		}
+		return fmt.Sprintf("%.2f", *v)
+	}
+	for _, samples := range [][]CanonicalSample{one, half} {
+		for i, s := range samples {
+			if text(s.GradePct) != text(want[i]) {
+				t.Fatalf("sample %d: grade %s want %s", i, text(s.GradePct), text(want[i]))
+			}
+			if s.GradeRawPct != grades[i] {
+				t.Fatalf("sample %d: raw grade should keep the original value", i)
+			}
+		}
+	}
+}
+
+func TestBuildActivitySummaryPowerSmoothness(t *testing.T) {
+	steady := make([]CanonicalSample, 0, 120)
+	surging := make([]CanonicalSample, 0, 120)
+	for i := 0; i < 120; i++ {
+		steady = append(steady, CanonicalSample{ElapsedS: float64(i), PowerW: floatPtr(200), ValidPower: true})
+		p := 100.0
+		if i%2 == 0 {
+			p = 300
+		}
+		surging = append(surging, CanonicalSample{ElapsedS: float64(i), PowerW: floatPtr(p), ValidPower: true})
+	}
+	s := buildActivitySummary(steady, nil, 120, 0, false, 0, nil)
+	if s.PowerSmoothnessCV != 0 || s.PowerRollingSD30W != 0 {
+		t.Fatalf("constant power should be perfectly smooth, got cv=%v sd30=%v", s.PowerSmoothnessCV, s.PowerRollingSD30W)
+	}
+	v := buildActivitySummary(surging, nil, 120, 0, false, 0, nil)
+	if math.Abs(v.PowerSmoothnessCV-0.5) > 1e-9 {
+		t.Fatalf("expected cv 0.5 for 100/300 W alternation, got %v", v.PowerSmoothnessCV)
+	}
+	if math.Abs(v.PowerRollingSD30W-100) > 1e-6 {
+		t.Fatalf("expected 30 s rolling stddev of 100 W, got %v", v.PowerRollingSD30W)
+	}
+}
+
+func TestBuildActivitySummaryFlagsShortFileNPAsUnreliable(t *testing.T) {
+	samples := make([]CanonicalSample, 0, 60)
+	for i := 0; i < 60; i++ {
+		samples = append(samples, CanonicalSample{ElapsedS: float64(i), PowerW: floatPtr(200), ValidPower: true})
+	}
+	short := buildActivitySummary(samples[:20], nil, 20, 0, false, 0, nil)
+	if short.NPReliable || len(short.Warnings) == 0 || !strings.Contains(short.Warnings[0], "np_w is unreliable") {
+		t.Fatalf("20 s of power should give an unreliable NP with a warning, got %v %v", short.NPReliable, short.Warnings)
+	}
+	if full := buildActivitySummary(samples, nil, 60, 0, false, 0, nil); !full.NPReliable {
+		t.Fatal("60 s of power should give a reliable NP by default")
+	}
+	if strict := buildActivitySummary(samples, nil, 60, 0, false, 120, nil); strict.NPReliable {
+		t.Fatal("60 s of power should be unreliable with a 120 s minimum")
+	}
+}
+
+func TestSportProfileFTPRanksFirst(t *testing.T) {
+	records := []llmexport.RecordEnvelope{
+		{RecordKind: "data", GlobalMessageNum: 12, Data: &llmexport.DataRecord{Fields: []llmexport.FieldValue{
+			{FieldNumber: 0, Decoded: uint8(2)},
+			{FieldNumber: 3, Decoded: "Road"},
+		}}},
+		{RecordKind: "data", GlobalMessageNum: 7, Data: &llmexport.DataRecord{Fields: []llmexport.FieldValue{
+			{FieldNumber: 1, Decoded: uint8(188)},
+			{FieldNumber: 3, Decoded: uint16(271)},
+		}}},
+	}
+	profile := llmexport.SportProfile(records)
+	if profile == nil || profile.Sport != "Cycling" || profile.Name != "Road" || profile.FTPWatts != 271 || profile.MaxHeartRateBPM != 188 {
+		t.Fatalf("unexpected sport profile: %+v", profile)
+	}
+
+	session := fit.NewSessionMsg()
+	session.ThresholdPower = 250
+	activity := &fit.ActivityFile{Sessions: []*fit.SessionMsg{session}}
+	candidates, _ := collectFTPCandidates(records, activity, &analyzer.Analysis{SportProfile: profile}, 0)
+	used := chooseFTPCandidate(candidates)
+	if used == nil || used.Source != "sport_profile" || used.FTPW != 271 {
+		t.Fatalf("expected sport profile FTP to be chosen, got %+v", used)
+	}
+	spread := buildFTPSpread(candidates, used)
+	if spread == nil || spread.CandidateCount != 2 || spread.MinFTPW != 250 || spread.MaxFTPW != 271 || spread.SpreadW != 21 || spread.ChosenConfidenceRank != 1 {
+		t.Fatalf("unexpected FTP spread: %+v", spread)
+	}
+	// A less confident sport profile still ranks first by source priority;
+	// the spread shows that a more confident candidate was passed over.
+	ranked := rankFTPCandidates([]FTPCandidate{
+		{FTPW: 271, Source: "sport_profile", Message: "zones_target.functional_threshold_power", Confidence: 0.70},
+		{FTPW: 260, Source: "zwift_setting", Message: "zwift.ftp", Confidence: 0.95},
+		{FTPW: 255, Source: "developer_field", Message: "dev.ftp", Confidence: 0.80},
+	})
+	if spread := buildFTPSpread(ranked, chooseFTPCandidate(ranked)); spread.ChosenConfidenceRank != 3 {
+		t.Fatalf("sport profile is the least confident candidate, got confidence rank %d", spread.ChosenConfidenceRank)
+	}
+	if llmexport.SportProfile(nil) != nil {
+		t.Fatal("expected nil profile without sport/zones_target messages")
+	}
+}
+
+func TestExplainFTPGivesRankingReason(t *testing.T) {
+	sources := rankFTPCandidates([]FTPCandidate{
+		{FTPW: 265, Source: "zwift_setting", Message: "zwift.ftp", Confidence: 0.9, Reason: "Zwift FTP field"},
+		{FTPW: 250, Source: "sport_profile", Message: "zones_target.functional_threshold_power", Confidence: 0.8, Reason: "Device sport profile"},
+	})
+	used := chooseFTPCandidate(sources)
+	out := ExplainFTP(sources, used, 250)
+	if !strings.Contains(out, "Why: sport_profile outranks zwift_setting by source priority") || strings.Contains(out, "Why: Device sport profile") {
+		t.Fatalf("Why should give the ranking reason:\n%s", out)
+	}
+	if strings.Contains(out, "Mismatch") {
+		t.Fatalf("analyzer FTP matches, no mismatch expected:\n%s", out)
+	}
+	if out := ExplainFTP(sources, used, 230); !strings.Contains(out, "Mismatch: the analyzer computed IF/TSS and zones with 230 W, not the 250 W used here") {
+		t.Fatalf("expected an analyzer mismatch line:\n%s", out)
+	}
+
+	tied := rankFTPCandidates([]FTPCandidate{
+		{FTPW: 240, Source: "developer_field", Message: "dev.a", Confidence: 0.5},
+		{FTPW: 245, Source: "developer_field", Message: "dev.b", Confidence: 0.7},
+	})
+	if out := ExplainFTP(tied, chooseFTPCandidate(tied), 0); !strings.Contains(out, "higher confidence (0.70 vs 0.50)") {
+		t.Fatalf("tie should be explained by confidence:\n%s", out)
+	}
+}
+
+func TestRunBytesAnalyzerUsesRankedFTP(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.AppendRaw(fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= 1200; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = 200
+			activity.Records = append(activity.Records, rec)
+		}
+		session := fit.NewSessionMsg()
+		session.StartTime = start
+		session.Timestamp = start.Add(1200 * time.Second)
+		session.TotalElapsedTime = 1200000
+		session.TotalTimerTime = 1200000
+		session.Sport = fit.SportCycling
+		session.ThresholdPower = 300
+		activity.Sessions = append(activity.Sessions, session)
+	}), fittest.ZonesTarget(190, 250))
+
+	for _, tc := range []struct {
+		override   float64
+		wantFTP    float64
+		wantSource string
+		wantUsed   string
+	}{
+		{0, 250, "sport_profile", "zones_target.functional_threshold_power"},
+		{220, 220, "input", ftpOverrideMessage},
+	} {
+		res, err := RunBytes(BytesOptions{SourceFileName: "profile.fit", FitData: data, Format: "csv", FTPOverride: tc.override})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		a := res.Analysis
+		if a.FTPWatts != tc.wantFTP || a.FTPSource != tc.wantSource {
+			t.Fatalf("override %v: analyzer FTP %v (%s) want %v (%s)", tc.override, a.FTPWatts, a.FTPSource, tc.wantFTP, tc.wantSource)
+		}
+		if res.FTPUsed == nil || res.FTPUsed.FTPW != tc.wantFTP || res.FTPUsed.Message != tc.wantUsed {
+			t.Fatalf("override %v: ftp used %+v want %v from %s", tc.override, res.FTPUsed, tc.wantFTP, tc.wantUsed)
+		}
+		var summary ActivitySummaryFile
+		if err := json.Unmarshal(res.Files["activity_summary.json"], &summary); err != nil {
+			t.Fatalf("decode activity_summary.json: %v", err)
+		}
+		if summary.FTPWUsed == nil || *summary.FTPWUsed != tc.wantFTP || summary.IF == nil || math.Abs(*summary.IF-a.IntensityFactor) > 0.01 {
+			t.Fatalf("override %v: summary FTP %v IF %v, analysis IF %.3f", tc.override, summary.FTPWUsed, summary.IF, a.IntensityFactor)
+		}
+	}
+}
+
+func TestRunBytesHeartRateZonesWeightSamplesByTime(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	data := fittest.AppendRaw(fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		// Five minutes at 1 s in Z1 (100 bpm) then five minutes smart-recorded
+		// every 5 s in Z5 (180 bpm): equal time, a fifth of the records.
+		add := func(offset int, hr uint8) {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(offset) * time.Second)
+			rec.Power = 200
+			rec.HeartRate = hr
+			activity.Records = append(activity.Records, rec)
+		}
+		for i := 0; i < 300; i++ {
+			add(i, 100)
+		}
+		for i := 300; i <= 600; i += 5 {
+			add(i, 180)
+		}
+	}), fittest.ZonesTarget(190, 250))
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "smart.fit", FitData: data, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	seconds := map[string]float64{}
+	for _, z := range res.Analysis.HeartRateZones {
+		seconds[z.Zone] = z.Seconds
+	}
+	if math.Abs(seconds["Z1 Very Light"]-300) > 1 || math.Abs(seconds["Z5 Maximum"]-300) > 1 {
+		t.Fatalf("expected ~300 s in Z1 and Z5, got %+v", res.Analysis.HeartRateZones)
+	}
+}
+
+//go:generate go run ./testdata/gen_intervals.go
+
+func TestRunBytesSyntheticIntervals(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "intervals.fit",
+		FitData:        data,
+		FTPOverride:    280,
+		Format:         "csv",
+	})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+
+	a := res.Analysis
+	if a.Intervals.WorkCount != 5 {
+		t.Fatalf("work count %d want 5", a.Intervals.WorkCount)
+	}
+	main := a.WorkoutStructure.MainSet
+	if main == nil {
+		t.Fatal("expected a main set")
+	}
+	if want := "5x4m @300W with 3m @120W recoveries"; main.Prescription != want {
+		t.Fatalf("prescription %q want %q", main.Prescription, want)
+	}
+	if sets := a.WorkoutStructure.MainSets; len(sets) != 1 || sets[0].Prescription != main.Prescription {
+		t.Fatalf("homogeneous reps should list the one main set, got %+v", sets)
+	}
+
+	var ws WorkoutStructureFile
+	if err := json.Unmarshal(res.Files["workout_structure.json"], &ws); err != nil {
+		t.Fatalf("decode workout_structure.json: %v", err)
+	}
+	work := 0
+	for _, step := range ws.Steps {
+		if step.StepName != "work" {
+			continue
+		}
+		work++
+		if step.ObservedAvgPowerW == nil || math.Abs(*step.ObservedAvgPowerW-300) > 1 {
+			t.Fatalf("step %d: observed power %v want ~300", step.StepIndex, step.ObservedAvgPowerW)
+		}
+		// Lap-derived targets are a single wattage; the ±6 W wobble stays
+		// inside the default ±5% band, so every rep second is on target (the
+		// step's inclusive end sample is the first recovery second).
+		if step.TimeInTargetPct == nil {
+			t.Fatalf("step %d: missing time in target", step.StepIndex)
+		}
+		if tit := *step.TimeInTargetPct; tit < 99 {
+			t.Fatalf("step %d: time in target %.1f%% want ~100%%", step.StepIndex, tit)
+		}
+	}
+	if work != 5 {
+		t.Fatalf("work steps %d want 5", work)
+	}
+}
+
+func TestRunBytesReportsRepTorque(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	main := res.Analysis.WorkoutStructure.MainSet
+	if main == nil || len(main.RepsDetail) != 5 {
+		t.Fatalf("expected 5 main-set reps, got %+v", main)
+	}
+
+	// ~300 W at 90 rpm is 60*300/(2π*90) ≈ 31.8 N·m.
+	sum := 0.0
+	for _, rep := range main.RepsDetail {
+		if math.Abs(rep.AvgTorqueNm-31.8) > 0.5 {
+			t.Fatalf("rep %d: torque %.2f N·m want ~31.8", rep.Rep, rep.AvgTorqueNm)
+		}
+		sum += rep.AvgTorqueNm
+	}
+	if want := sum / 5; math.Abs(main.AvgTorqueNm-want) > 0.01 {
+		t.Fatalf("set torque %.2f want rep average %.2f", main.AvgTorqueNm, want)
+	}
+}
+
+func TestRunBytesTargetToleranceAppliesToRepsAndSteps(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	run := func(tolerance float64) (repMin, stepMin float64) {
+		res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv", RepTargetTolerancePct: tolerance})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		repMin, stepMin = 100, 100
+		for _, rep := range res.Analysis.WorkoutStructure.MainSet.RepsDetail {
+			if rep.TimeInTargetPct == nil {
+				t.Fatalf("rep %d: missing time in target", rep.Rep)
+			}
+			repMin = math.Min(repMin, *rep.TimeInTargetPct)
+		}
+		var ws WorkoutStructureFile
+		if err := json.Unmarshal(res.Files["workout_structure.json"], &ws); err != nil {
+			t.Fatalf("decode workout_structure.json: %v", err)
+		}
+		for _, step := range ws.Steps {
+			if step.StepName == "work" && step.TimeInTargetPct != nil {
+				stepMin = math.Min(stepMin, *step.TimeInTargetPct)
+			}
+		}
+		return repMin, stepMin
+	}
+	// The reps wobble ±6 W (2%) around 300 W: inside the default ±5% band,
+	// mostly outside a ±1% one.
+	if rep, step := run(0); rep < 99 || step < 99 {
+		t.Fatalf("default tolerance: rep %.1f%% step %.1f%% in target, want ~100%%", rep, step)
+	}
+	if rep, step := run(1); rep > 75 || step > 75 {
+		t.Fatalf("1%% tolerance: rep %.1f%% step %.1f%% in target, want well below 100%%", rep, step)
+	}
+}
+
+func TestRunBytesTargetRounding(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	// targets maps step name to its power and %FTP targets (0 when the step
+	// has no %FTP target).
+	targets := func(powerRounding, pctRounding float64) map[string][2]float64 {
+		res, err := RunBytes(BytesOptions{
+			SourceFileName:      "intervals.fit",
+			FitData:             data,
+			Format:              "csv",
+			FTPOverride:         280,
+			TargetPowerRounding: powerRounding,
+			TargetPctRounding:   pctRounding,
+		})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		var ws WorkoutStructureFile
+		if err := json.Unmarshal(res.Files["workout_structure.json"], &ws); err != nil {
+			t.Fatalf("decode workout_structure.json: %v", err)
+		}
+		out := map[string][2]float64{}
+		for _, step := range ws.Steps {
+			if step.TargetLowW == nil {
+				t.Fatalf("step %d: missing power target", step.StepIndex)
+			}
+			got := [2]float64{*step.TargetLowW}
+			if step.TargetLowPctFTP != nil {
+				got[1] = *step.TargetLowPctFTP
+			}
+			out[step.StepName] = got
+		}
+		return out
+	}
+
+	// 300 W and 120 W are 107.1% and 42.9% of 280 W.
+	defaults := map[string][2]float64{"warmup": {150, 0}, "work": {300, 107}, "recovery": {120, 43}, "cooldown": {130, 0}}
+	coarse := map[string][2]float64{"warmup": {150, 0}, "work": {300, 105}, "recovery": {100, 45}, "cooldown": {150, 0}}
+	for _, tc := range []struct {
+		power, pct float64
+		want       map[string][2]float64
+	}{{0, 0, defaults}, {5, 1, defaults}, {50, 5, coarse}} {
+		got := targets(tc.power, tc.pct)
+		for name, want := range tc.want {
+			if got[name] != want {
+				t.Fatalf("rounding %.0f W / %.0f%%: %s target %v want %v", tc.power, tc.pct, name, got[name], want)
+			}
+		}
+	}
+}
+
+func TestRunBytesRecoveryHoursPerTSS(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	hours := func(perTSS float64) float64 {
+		res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv", FTPOverride: 280, RecoveryHoursPerTSS: perTSS})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		return res.Analysis.RecommendedRecoveryHours
+	}
+	base, doubled := hours(0), hours(0.48)
+	if base <= 0 || math.Abs(doubled-2*base) > 1 {
+		t.Fatalf("doubling hours per TSS should double recovery: %v -> %v", base, doubled)
+	}
+}
+
+func TestRunBytesPreferGPSDistance(t *testing.T) {
+	// Ten minutes north at about 8 m/s while a miscalibrated wheel sensor
+	// records half the distance.
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i < 600; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.PositionLat = fit.NewLatitudeDegrees(41.9 + float64(i)*0.000072)
+			rec.PositionLong = fit.NewLongitudeDegrees(2.8)
+			rec.Distance = uint32(i * 400)
+			rec.Power = 200
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+	distance := func(prefer bool) *analyzer.Analysis {
+		res, err := RunBytes(BytesOptions{SourceFileName: "gps.fit", FitData: data, Format: "csv", PreferGPSDistance: prefer})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		return res.Analysis
+	}
+	recorded, gps := distance(false), distance(true)
+	if math.Abs(recorded.DistanceMeters-2396) > 1 {
+		t.Fatalf("default should keep the recorded distance, got %v", recorded.DistanceMeters)
+	}
+	if gps.DistanceMetersGPS < 4700 || gps.DistanceMeters != gps.DistanceMetersGPS {
+		t.Fatalf("PreferGPSDistance should report the GPS distance %v, got %v", gps.DistanceMetersGPS, gps.DistanceMeters)
+	}
+}
+
+func TestAnalyzeBytesGPSDistanceSpeedAndNote(t *testing.T) {
+	// Ten moving minutes north at about 8 m/s with a five-minute stop in the
+	// middle; the wheel sensor records distance at ratio times the GPS rate.
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	encode := func(ratio float64, withPositions bool) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			for i := 0; i < 600; i++ {
+				offset := time.Duration(i) * time.Second
+				if i >= 300 {
+					offset += 5 * time.Minute
+				}
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(offset)
+				if withPositions {
+					rec.PositionLat = fit.NewLatitudeDegrees(41.9 + float64(i)*0.000072)
+					rec.PositionLong = fit.NewLongitudeDegrees(2.8)
+					rec.Distance = uint32(float64(i) * 800 * ratio)
+				}
+				rec.Power = 200
+				activity.Records = append(activity.Records, rec)
+			}
+			session := fit.NewSessionMsg()
+			session.StartTime = start
+			session.Timestamp = start.Add(15 * time.Minute)
+			session.TotalElapsedTime = 900000
+			session.TotalTimerTime = 600000
+			session.Sport = fit.SportCycling
+			if withPositions {
+				session.AvgSpeed = uint16(8000 * ratio)
+			}
+			activity.Sessions = append(activity.Sessions, session)
+		})
+	}
+	analyze := func(data []byte, prefer bool) *analyzer.Analysis {
+		a, err := analyzer.AnalyzeBytes(data, "gps.fit", analyzer.Config{PreferGPSDistance: prefer})
+		if err != nil {
+			t.Fatalf("AnalyzeBytes() error: %v", err)
+		}
+		return a
+	}
+
+	half := encode(0.5, true)
+	recorded := analyze(half, false)
+	if recorded.DistanceMetersGPS < 4700 || recorded.DistanceMetersGPS > 4900 {
+		t.Fatalf("expected ~4.8 km of GPS track, got %.0f m", recorded.DistanceMetersGPS)
+	}
+	if !strings.Contains(recorded.DistanceNote, "-50.") {
+		t.Fatalf("expected a -50%% divergence note, got %q", recorded.DistanceNote)
+	}
+	if recorded.AvgSpeedSource != "session" || math.Abs(recorded.AvgSpeedMps-4) > 0.01 {
+		t.Fatalf("default should keep the session speed, got %.2f from %q", recorded.AvgSpeedMps, recorded.AvgSpeedSource)
+	}
+
+	gps := analyze(half, true)
+	if gps.AvgSpeedSource != "gps_distance" || gps.DistanceMeters != gps.DistanceMetersGPS {
+		t.Fatalf("expected GPS distance and speed, got %.0f m from %q", gps.DistanceMeters, gps.AvgSpeedSource)
+	}
+	// The stop is excluded: 4.8 km over ten moving minutes, not fifteen.
+	if math.Abs(gps.AvgSpeedMps-gps.DistanceMetersGPS/600) > 0.01 {
+		t.Fatalf("GPS speed %.2f m/s should use moving time (want %.2f)", gps.AvgSpeedMps, gps.DistanceMetersGPS/600)
+	}
+
+	if close := analyze(encode(0.97, true), false); close.DistanceNote != "" {
+		t.Fatalf("a 3%% gap should not be noted, got %q", close.DistanceNote)
+	}
+	if none := analyze(encode(1, false), false); none.AvgSpeedMps != 0 || none.AvgSpeedSource != "" {
+		t.Fatalf("without any speed the source should be empty, got %.2f from %q", none.AvgSpeedMps, none.AvgSpeedSource)
+	}
+}
+
+func TestRunBytesMedianAveragesReportMeanFallback(t *testing.T) {
+	// Mostly coasting: 400 s at 0 W and 200 s at 300 W, so median power is 0.
+	start := time.Date(2026, 4, 7, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i < 600; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.HeartRate = uint8(120 + i%21)
+			if i >= 400 {
+				rec.Power = 300
+			} else {
+				rec.Power = 0
+			}
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "coast.fit", FitData: data, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if a := res.Analysis; a.AverageMethod != "" || math.Abs(a.AvgPowerWatts-100) > 0.5 {
+		t.Fatalf("default averages should be means, got %s %.1f W", a.AverageMethod, a.AvgPowerWatts)
+	}
+
+	res, err = RunBytes(BytesOptions{SourceFileName: "coast.fit", FitData: data, Format: "csv", UseMedianForAverages: true})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if a.AverageMethod != "median" || a.AvgHeartRate != a.MedianHeartRate {
+		t.Fatalf("expected median HR average, got %s %.1f (median %.1f)", a.AverageMethod, a.AvgHeartRate, a.MedianHeartRate)
+	}
+	if math.Abs(a.AvgPowerWatts-100) > 0.5 || len(a.AverageMeanFallback) != 1 || a.AverageMeanFallback[0] != "power" {
+		t.Fatalf("zero median power should fall back to the mean and say so, got %.1f W %v", a.AvgPowerWatts, a.AverageMeanFallback)
+	}
+	if !strings.Contains(a.Notes, "Median was 0 for power, so the mean is reported there.") {
+		t.Fatalf("notes should report the fallback:\n%s", a.Notes)
+	}
+}
+
+func TestRunBytesDecouplingVIThreshold(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, FTPOverride: 280, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if a := res.Analysis; a.DecouplingReliable || !strings.HasPrefix(a.DecouplingNote, "suppressed") {
+		t.Fatalf("interval session (VI %.2f) should suppress decoupling, got reliable=%v note %q", a.VariabilityIndex, a.DecouplingReliable, a.DecouplingNote)
+	}
+	res, err = RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, FTPOverride: 280, Format: "csv", DecouplingVIThreshold: 2})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if a := res.Analysis; !a.DecouplingReliable || a.DecouplingNote != "" || a.PowerHRDecoupling == 0 {
+		t.Fatalf("a 2.0 VI threshold should keep decoupling, got reliable=%v %.1f%% note %q", a.DecouplingReliable, a.PowerHRDecoupling, a.DecouplingNote)
+	}
+}
+
+func TestRunBytesZeroDecouplingIsReliable(t *testing.T) {
+	start := time.Date(2026, 4, 3, 7, 0, 0, 0, time.UTC)
+	var samples []CanonicalSample
+	for i := 0; i < 1800; i++ {
+		samples = append(samples, CanonicalSample{
+			Timestamp:  start.Add(time.Duration(i) * time.Second),
+			PowerW:     floatPtr(200),
+			ValidPower: true,
+			HRBPM:      floatPtr(140),
+			ValidHR:    true,
+		})
+	}
+	data, err := EncodeFIT(samples, EncodeMeta{})
+	if err != nil {
+		t.Fatalf("EncodeFIT error: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "steady.fit", FitData: data, FTPOverride: 250, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if !a.DecouplingReliable || a.PowerHRDecoupling != 0 || a.DecouplingNote != "" {
+		t.Fatalf("perfectly coupled ride should report a reliable 0%%, got reliable=%v %.2f%% note %q", a.DecouplingReliable, a.PowerHRDecoupling, a.DecouplingNote)
+	}
+	if !strings.Contains(a.Notes, "Power:HR decoupling: +0.0%") {
+		t.Fatalf("notes should report the 0%% decoupling:\n%s", a.Notes)
+	}
+}
+
+func TestWorkoutStepsLabelledByIntensity(t *testing.T) {
+	step := func(name string, intensity uint8) llmexport.RecordEnvelope {
+		fields := []llmexport.FieldValue{
+			{FieldNumber: 1, Decoded: uint8(0)},
+			{FieldNumber: 2, Decoded: uint32(60000)},
+			{FieldNumber: 7, Decoded: intensity},
+		}
+		if name != "" {
+			fields = append(fields, llmexport.FieldValue{FieldNumber: 0, Decoded: name})
+		}
+		return llmexport.RecordEnvelope{RecordKind: "data", GlobalMessageNum: 27, Data: &llmexport.DataRecord{Fields: fields}}
+	}
+	records := []llmexport.RecordEnvelope{step("", 2), step("Over-unders", 0), step("", 1), step("", 3)}
+	start := time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC)
+	samples := make([]CanonicalSample, 240)
+	for i := range samples {
+		samples[i].Timestamp = start.Add(time.Duration(i) * time.Second)
+	}
+
+	steps := buildWorkoutStepsFromWorkoutMessages(records, samples, nil)
+	want := []struct{ name, intensity string }{
+		{"warmup", "warmup"},
+		{"Over-unders", "active"},
+		{"rest", "rest"},
+		{"cooldown", "cooldown"},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("got %d steps want %d", len(steps), len(want))
+	}
+	for i, w := range want {
+		if steps[i].StepName != w.name || steps[i].Intensity != w.intensity {
+			t.Fatalf("step %d: got %q/%q want %q/%q", i+1, steps[i].StepName, steps[i].Intensity, w.name, w.intensity)
+		}
+	}
+}
+
+func TestWorkoutStepsResolveDistanceWindows(t *testing.T) {
+	step := func(durationType uint8, value uint32) llmexport.RecordEnvelope {
+		return llmexport.RecordEnvelope{RecordKind: "data", GlobalMessageNum: 27, Data: &llmexport.DataRecord{Fields: []llmexport.FieldValue{
+			{FieldNumber: 1, Decoded: durationType},
+			{FieldNumber: 2, Decoded: value},
+		}}}
+	}
+	// 60 s, then 1 km, then 30 s; the samples move at 4 m/s.
+	records := []llmexport.RecordEnvelope{step(0, 60000), step(1, 100000), step(0, 30000)}
+	start := time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC)
+	samples := make([]CanonicalSample, 400)
+	for i := range samples {
+		samples[i].Timestamp = start.Add(time.Duration(i) * time.Second)
+		samples[i].DistanceM = floatPtr(float64(i) * 4)
+	}
+
+	steps := buildWorkoutStepsFromWorkoutMessages(records, samples, nil)
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps want 3", len(steps))
+	}
+	wantIdx := [][2]int{{0, 60}, {60, 310}, {310, 340}}
+	for i, w := range wantIdx {
+		if steps[i].StartSampleIndex != w[0] || steps[i].EndSampleIndex != w[1] {
+			t.Fatalf("step %d: samples %d-%d want %d-%d", i+1, steps[i].StartSampleIndex, steps[i].EndSampleIndex, w[0], w[1])
+		}
+	}
+	if steps[1].DistanceM == nil || *steps[1].DistanceM != 1000 {
+		t.Fatalf("expected 1000 m distance step, got %v", steps[1].DistanceM)
+	}
+}
+
+func TestBuildScalingAuditSamplesScaledFields(t *testing.T) {
+	var records []llmexport.RecordEnvelope
+	for i := 0; i < 8; i++ {
+		records = append(records, llmexport.RecordEnvelope{RecordKind: "data", GlobalMessageNum: 20, Data: &llmexport.DataRecord{Fields: []llmexport.FieldValue{
+			{FieldNumber: 2, FieldName: "altitude", Units: "m", Decoded: uint16(2600 + i), Scaled: float64(2600+i)/5 - 500},
+			{FieldNumber: 7, FieldName: "power", Units: "w", Decoded: uint16(200)},
+		}}})
+	}
+	audit := buildScalingAudit(records)
+	if len(audit.Fields) != 1 {
+		t.Fatalf("expected only the scaled altitude field, got %+v", audit.Fields)
+	}
+	f := audit.Fields[0]
+	if f.GlobalMessageNum != 20 || f.FieldName != "altitude" || f.Occurrences != 8 || len(f.Samples) != scalingAuditSamplesPerField {
+		t.Fatalf("unexpected audit entry: %+v", f)
+	}
+	if f.Samples[0].RawDecoded != uint16(2600) || f.Samples[0].Scaled != 20.0 {
+		t.Fatalf("unexpected first sample: %+v", f.Samples[0])
+	}
+}
+
+func TestRunBytesAcrossDSTTransition(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skipf("tz database unavailable: %v", err)
+	}
+	// 2026-03-08 clocks in Los Angeles jump from 02:00 PST to 03:00 PDT
+	// (10:00 UTC). The ride starts 23:30 local the night before, so it also
+	// crosses local midnight, and runs three hours of wall time.
+	start := time.Date(2026, 3, 7, 23, 30, 0, 0, la)
+	const seconds = 3 * 3600
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i <= seconds; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = 180
+			activity.Records = append(activity.Records, rec)
+		}
+		lap := fit.NewLapMsg()
+		lap.StartTime = start
+		lap.Timestamp = start.Add(seconds * time.Second)
+		lap.TotalElapsedTime = seconds * 1000
+		lap.TotalTimerTime = seconds * 1000
+		lap.AvgPower = 180
+		activity.Laps = append(activity.Laps, lap)
+		// The head unit ends the ride on PDT (UTC-7).
+		activity.Activity = fit.NewActivityMsg()
+		activity.Activity.Timestamp = start.Add(seconds * time.Second)
+		activity.Activity.LocalTimestamp = activity.Activity.Timestamp.In(time.FixedZone("PDT", -7*3600))
+	})
+
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "dst.fit",
+		FitData:        data,
+		Format:         "csv",
+	})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if got := res.Analysis.ElapsedSeconds; got != seconds {
+		t.Fatalf("elapsed %v want %v", got, seconds)
+	}
+	if !res.Analysis.StartTime.Equal(start) {
+		t.Fatalf("start %v want %v", res.Analysis.StartTime, start)
+	}
+	if off := res.Analysis.UTCOffsetSeconds; off == nil || *off != -7*3600 {
+		t.Fatalf("utc offset %v want -25200", off)
+	}
+	if !strings.Contains(res.Analysis.Notes, "Start: 2026-03-08 00:30:00 UTC-07:00") {
+		t.Fatalf("notes should show the start in the file's local time:\n%s", res.Analysis.Notes)
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(res.Files["canonical_samples.csv"])).ReadAll()
+	if err != nil {
+		t.Fatalf("read canonical csv: %v", err)
+	}
+	if len(rows) != seconds+2 {
+		t.Fatalf("got %d rows want %d", len(rows), seconds+2)
+	}
+	for i, row := range rows[1:] {
+		want := start.Add(time.Duration(i) * time.Second).UTC().Format(time.RFC3339)
+		elapsed, err := strconv.ParseFloat(row[1], 64)
+		if err != nil || row[0] != want || elapsed != float64(i) {
+			t.Fatalf("row %d: ts %s elapsed %s want %s %d", i, row[0], row[1], want, i)
+		}
+	}
+
+	var laps LapSummaryFile
+	if err := json.Unmarshal(res.Files["lap_summary.json"], &laps); err != nil {
+		t.Fatalf("decode lap_summary.json: %v", err)
+	}
+	if len(laps.Laps) != 1 || laps.Laps[0].StartTS != "2026-03-08T07:30:00Z" || laps.Laps[0].EndTS != "2026-03-08T10:30:00Z" {
+		t.Fatalf("unexpected lap window: %+v", laps.Laps)
+	}
+
+	// Season days follow the file's offset: a ride starting 23:30 PST is on
+	// the local day, though it is already the next day in UTC. Without an
+	// offset the UTC day is used.
+	evening := time.Date(2026, 3, 6, 23, 30, 0, 0, la)
+	pst := -8 * 3600
+	report := AggregateSeason([]SummaryLine{{StartTime: evening, UTCOffsetSeconds: &pst, TSS: 100}})
+	if report == nil || report.StartDate != "2026-03-06" {
+		t.Fatalf("expected the ride on its local day, got %+v", report)
+	}
+	report = AggregateSeason([]SummaryLine{{StartTime: evening, TSS: 100}})
+	if report == nil || report.StartDate != "2026-03-07" {
+		t.Fatalf("expected the ride on its UTC day without an offset, got %+v", report)
+	}
+}
+
+func TestNormalizedPowerFromSamplesMatchesAcrossSampleRates(t *testing.T) {
+	// 20 minutes of 60 s surges at 400 W between 60 s at 100 W.
+	var oneHz, twoSecond []CanonicalSample
+	for i := 0; i < 1200; i++ {
+		power := 100.0
+		if (i/60)%2 == 0 {
+			power = 400
+		}
+		s := CanonicalSample{ElapsedS: float64(i), PowerW: floatPtr(power), ValidPower: true}
+		oneHz = append(oneHz, s)
+		if i%2 == 0 {
+			twoSecond = append(twoSecond, s)
+		}
+	}
+	np1 := NormalizedPowerFromSamples(oneHz)
+	np2 := NormalizedPowerFromSamples(twoSecond)
+	if np1 <= 250 || math.Abs(np1-np2) > 0.5 {
+		t.Fatalf("NP differs by sample rate: 1 Hz %.2f, 2 s %.2f", np1, np2)
+	}
+	if math.Abs(np1-npower.Normalized(recordPowers(oneHz))) > 1e-9 {
+		t.Fatal("1 Hz NP should match the count-based NP")
+	}
+
+	// A long pause is not filled with the last reading.
+	paused := append([]CanonicalSample(nil), oneHz[:600]...)
+	for _, s := range oneHz[600:] {
+		s.ElapsedS += 3600
+		paused = append(paused, s)
+	}
+	if got := NormalizedPowerFromSamples(paused); math.Abs(got-np1) > 1e-9 {
+		t.Fatalf("pause changed NP: %.2f want %.2f", got, np1)
+	}
+}
+
+func TestResamplePower1HzAveragesSubSecondReadings(t *testing.T) {
+	samples := []CanonicalSample{
+		{ElapsedS: 0, PowerW: floatPtr(100), ValidPower: true},
+		{ElapsedS: 0.5, PowerW: floatPtr(300), ValidPower: true},
+		{ElapsedS: 1, PowerW: floatPtr(150), ValidPower: true},
+		{ElapsedS: 4, PowerW: floatPtr(250), ValidPower: true},
+		{ElapsedS: 4.25, PowerW: floatPtr(260), ValidPower: true},
+		{ElapsedS: 4.75, PowerW: floatPtr(270), ValidPower: true},
+		{ElapsedS: 30, PowerW: floatPtr(400), ValidPower: true},
+	}
+	// Second 0 averages two readings; second 1 holds across 2-3; second 4
+	// averages three readings; the 25 s pause adds nothing.
+	want := []float64{200, 150, 150, 150, 260, 400}
+	got := resamplePower1Hz(samples, nil)
+	if len(got) != len(want) {
+		t.Fatalf("resampled %v want %v", got, want)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("resampled %v want %v", got, want)
+		}
+	}
+}
+
+func TestRunBytesSummaryNPMatchesAnalyzerNP(t *testing.T) {
+	// 2 s recording with 5 s dropouts and a 22 s pause: both sides must
+	// resample the same way.
+	start := time.Date(2026, 4, 6, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for sec := 0; sec < 2400; sec += 2 {
+			if sec%120 == 60 {
+				sec += 5
+			}
+			if sec >= 1200 && sec < 1220 {
+				continue
+			}
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(sec) * time.Second)
+			rec.Power = uint16(150 + 150*((sec/60)%2))
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+	res, err := RunBytes(BytesOptions{SourceFileName: "np.fit", FitData: data, FTPOverride: 250, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	var summary ActivitySummaryFile
+	if err := json.Unmarshal(res.Files["activity_summary.json"], &summary); err != nil {
+		t.Fatalf("decode activity_summary.json: %v", err)
+	}
+	if summary.NPW == 0 || math.Abs(summary.NPW-res.Analysis.NormalizedPower) > 0.01 {
+		t.Fatalf("summary NP %.2f differs from analyzer NP %.2f", summary.NPW, res.Analysis.NormalizedPower)
+	}
+}
+
+func recordPowers(samples []CanonicalSample) []float64 {
+	out := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		out = append(out, *s.PowerW)
+	}
+	return out
+}
+
+func TestRunBytesExcludeLapsDropsRepFromStructure(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	// Lap 4 is the second work rep.
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "intervals.fit",
+		FitData:        data,
+		FTPOverride:    280,
+		Format:         "csv",
+		ExcludeLaps:    []int{4, 99},
+	})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if a.Intervals.WorkCount != 4 {
+		t.Fatalf("work count %d want 4", a.Intervals.WorkCount)
+	}
+	if len(a.ExcludedLaps) != 1 || a.ExcludedLaps[0] != 4 {
+		t.Fatalf("excluded laps %v want [4]", a.ExcludedLaps)
+	}
+	for _, lap := range a.Laps {
+		if lap.Index == 4 {
+			t.Fatal("excluded lap should not be summarized")
+		}
+	}
+
+	var laps LapSummaryFile
+	if err := json.Unmarshal(res.Files["lap_summary.json"], &laps); err != nil {
+		t.Fatalf("decode lap_summary.json: %v", err)
+	}
+	var ws WorkoutStructureFile
+	if err := json.Unmarshal(res.Files["workout_structure.json"], &ws); err != nil {
+		t.Fatalf("decode workout_structure.json: %v", err)
+	}
+	if len(laps.Laps) != 12 || len(ws.Steps) != 12 {
+		t.Fatalf("expected all 12 laps exported, got %d laps %d steps", len(laps.Laps), len(ws.Steps))
+	}
+	if ws.Steps[3].StepName != "excluded" || ws.Steps[5].StepName != "work" {
+		t.Fatalf("unexpected step names around excluded lap: %q %q", ws.Steps[3].StepName, ws.Steps[5].StepName)
+	}
+}
+
+func TestRunBytesSplitsHeterogeneousMainSets(t *testing.T) {
+	// 10m warmup, 3x(5m @300W + 3m @120W), 4m easy, 5x(2m @320W + 2m @120W),
+	// 10m cooldown.
+	segments := []lapSegment{{600, 120}}
+	for i := 0; i < 3; i++ {
+		segments = append(segments, lapSegment{300, 300}, lapSegment{180, 120})
+	}
+	segments = append(segments, lapSegment{240, 120})
+	for i := 0; i < 5; i++ {
+		segments = append(segments, lapSegment{120, 320}, lapSegment{120, 120})
+	}
+	segments = append(segments, lapSegment{600, 120})
+	data := encodeLapSegments(t, segments)
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "sets.fit", FitData: data, FTPOverride: 280, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	ws := res.Analysis.WorkoutStructure
+	if len(ws.MainSets) != 2 {
+		t.Fatalf("expected 2 main sets, got %d (%s)", len(ws.MainSets), ws.CanonicalLabel)
+	}
+	if ws.MainSets[0].Reps != 3 || ws.MainSets[1].Reps != 5 {
+		t.Fatalf("unexpected set reps: %d, %d", ws.MainSets[0].Reps, ws.MainSets[1].Reps)
+	}
+	if ws.MainSet == nil || ws.MainSet.Reps != 8 {
+		t.Fatalf("main_set should summarize all 8 reps, got %+v", ws.MainSet)
+	}
+	if !strings.Contains(ws.CanonicalLabel, ws.MainSets[0].Prescription) || !strings.Contains(ws.CanonicalLabel, ws.MainSets[1].Prescription) {
+		t.Fatalf("label %q should name both sets", ws.CanonicalLabel)
+	}
+
+	res, err = RunBytes(BytesOptions{SourceFileName: "sets.fit", FitData: data, FTPOverride: 280, Format: "csv", MainSetGroupingPct: 200})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if ws := res.Analysis.WorkoutStructure; len(ws.MainSets) != 1 || ws.MainSet == nil || ws.MainSet.Reps != 8 {
+		t.Fatalf("a wide tolerance should keep one 8-rep set, got %+v", ws.MainSets)
+	}
+}
+
+func TestRunBytesSplitsMainSetsByPower(t *testing.T) {
+	// 10m warmup, 4x(4m @350W + 2m @120W), 4x(4m @250W + 2m @120W), 10m
+	// cooldown: equal rep durations, but two distinct intensities.
+	segments := []lapSegment{{600, 120}}
+	for _, watts := range []float64{350, 350, 350, 350, 250, 250, 250, 250} {
+		segments = append(segments, lapSegment{240, watts}, lapSegment{120, 120})
+	}
+	segments = append(segments, lapSegment{600, 120})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "power_sets.fit", FitData: encodeLapSegments(t, segments), FTPOverride: 280, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	ws := res.Analysis.WorkoutStructure
+	if len(ws.MainSets) != 2 || ws.MainSets[0].Reps != 4 || ws.MainSets[1].Reps != 4 {
+		t.Fatalf("expected two 4-rep sets, got %+v (%s)", ws.MainSets, ws.CanonicalLabel)
+	}
+	if math.Abs(ws.MainSets[0].WorkPowerWatts-350) > 2 || math.Abs(ws.MainSets[1].WorkPowerWatts-250) > 2 {
+		t.Fatalf("set powers %.0f/%.0f want 350/250", ws.MainSets[0].WorkPowerWatts, ws.MainSets[1].WorkPowerWatts)
+	}
+	if ws.MainSet == nil || ws.MainSet.Reps != 8 {
+		t.Fatalf("main_set should summarize all 8 reps, got %+v", ws.MainSet)
+	}
+}
+
+func TestRunBytesAutoLapsUsePowerSegments(t *testing.T) {
+	// 10m warmup, 5x(4m @300W + 3m @120W), 10m cooldown, but the device
+	// auto-lapped every 5 minutes, so laps cut across the intervals.
+	var watts []float64
+	add := func(seconds int, w float64) {
+		for i := 0; i < seconds; i++ {
+			watts = append(watts, w)
+		}
+	}
+	add(600, 150)
+	for i := 0; i < 5; i++ {
+		add(240, 300)
+		add(180, 120)
+	}
+	add(600, 130)
+	start := time.Date(2026, 4, 5, 7, 0, 0, 0, time.UTC)
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i, w := range watts {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			rec.Power = uint16(w)
+			activity.Records = append(activity.Records, rec)
+		}
+		for lapStart := 0; lapStart < len(watts); lapStart += 300 {
+			end := min(lapStart+300, len(watts))
+			total := 0.0
+			for _, w := range watts[lapStart:end] {
+				total += w
+			}
+			lap := fit.NewLapMsg()
+			lap.StartTime = start.Add(time.Duration(lapStart) * time.Second)
+			lap.Timestamp = start.Add(time.Duration(end) * time.Second)
+			lap.TotalElapsedTime = uint32((end - lapStart) * 1000)
+			lap.TotalTimerTime = lap.TotalElapsedTime
+			lap.AvgPower = uint16(total / float64(end-lapStart))
+			lap.LapTrigger = fit.LapTriggerTime
+			if end == len(watts) {
+				lap.LapTrigger = fit.LapTriggerSessionEnd
+			}
+			activity.Laps = append(activity.Laps, lap)
+		}
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "autolap.fit", FitData: data, FTPOverride: 280, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if !a.Intervals.AutoLaps || a.Intervals.Source != "power_samples" {
+		t.Fatalf("auto-lapped ride should take intervals from power samples, got %+v", a.Intervals)
+	}
+	if a.Intervals.WorkCount != 5 || math.Abs(a.Intervals.AvgWorkDurationSeconds-240) > 15 {
+		t.Fatalf("expected 5 ~4m reps, got %d x %.0fs", a.Intervals.WorkCount, a.Intervals.AvgWorkDurationSeconds)
+	}
+	ws := a.WorkoutStructure
+	if ws.MainSet == nil || ws.MainSet.Reps != 5 || ws.ConfidenceFactors["auto_laps"] != 0 {
+		t.Fatalf("sample-based structure should carry no auto-lap penalty: %s %+v", ws.CanonicalLabel, ws.ConfidenceFactors)
+	}
+	if len(a.Laps) != 11 {
+		t.Fatalf("recorded laps should still be reported, got %d", len(a.Laps))
+	}
+}
+
+// lapSegment is one constant-power lap for encodeLapSegments.
+type lapSegment struct {
+	seconds int
+	watts   float64
+}
+
+// encodeLapSegments writes a 1 Hz power-only FIT activity with one lap per
+// segment.
+func encodeLapSegments(t *testing.T, segments []lapSegment) []byte {
+	t.Helper()
+	start := time.Date(2026, 4, 2, 17, 0, 0, 0, time.UTC)
+	var samples []CanonicalSample
+	var lapStarts []time.Time
+	for _, seg := range segments {
+		lapStarts = append(lapStarts, start.Add(time.Duration(len(samples))*time.Second))
+		for i := 0; i < seg.seconds; i++ {
+			samples = append(samples, CanonicalSample{
+				Timestamp:  start.Add(time.Duration(len(samples)) * time.Second),
+				PowerW:     floatPtr(seg.watts),
+				ValidPower: true,
+			})
+		}
+	}
+	data, err := EncodeFIT(samples, EncodeMeta{LapStartTimes: lapStarts})
+	if err != nil {
+		t.Fatalf("EncodeFIT error: %v", err)
+	}
+	return data
+}
+
+func TestRunBytesDetectsBackToBackOpeners(t *testing.T) {
+	// 10m warmup with a stray 15s spike, 4x(15s @400W + 15s @120W) openers,
+	// optionally 5m easy, then 3x(5m @300W + 3m @120W) and 10m cooldown.
+	for _, easyGap := range []bool{true, false} {
+		segments := []lapSegment{{300, 150}, {15, 400}, {15, 120}, {300, 150}}
+		for i := 0; i < 4; i++ {
+			segments = append(segments, lapSegment{15, 400}, lapSegment{15, 120})
+		}
+		if easyGap {
+			segments = append(segments, lapSegment{300, 140})
+		}
+		for i := 0; i < 3; i++ {
+			segments = append(segments, lapSegment{300, 300}, lapSegment{180, 120})
+		}
+		segments = append(segments, lapSegment{600, 120})
+
+		res, err := RunBytes(BytesOptions{SourceFileName: "openers.fit", FitData: encodeLapSegments(t, segments), FTPOverride: 280, Format: "csv"})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		ws := res.Analysis.WorkoutStructure
+		if ws.Openers == nil || ws.Openers.Reps != 4 {
+			t.Fatalf("easy gap %v: expected 4 opener reps, got %+v", easyGap, ws.Openers)
+		}
+		if ws.Openers.OnDurationSeconds != 15 || ws.Openers.OffDurationSeconds != 15 {
+			t.Fatalf("easy gap %v: unexpected opener durations: %+v", easyGap, ws.Openers)
+		}
+		var openers, warmup *analyzer.WorkoutBlock
+		for i := range ws.Blocks {
+			switch ws.Blocks[i].BlockType {
+			case "openers":
+				openers = &ws.Blocks[i]
+			case "warmup":
+				warmup = &ws.Blocks[i]
+			}
+		}
+		// Laps 5-12 are the openers; the stray spike stays in the warmup.
+		if openers == nil || openers.StartLap != 5 || openers.EndLap != 12 {
+			t.Fatalf("easy gap %v: expected openers block on laps 5-12, got %+v", easyGap, openers)
+		}
+		if warmup == nil || warmup.StartLap != 1 || warmup.EndLap != 4 {
+			t.Fatalf("easy gap %v: expected warmup block on laps 1-4, got %+v", easyGap, warmup)
+		}
+	}
+}
+
+func TestRunBytesLapLabelsRenameOutputOnly(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	opts := BytesOptions{
+		SourceFileName: "intervals.fit",
+		FitData:        data,
+		FTPOverride:    280,
+		Format:         "csv",
+		LapLabels:      map[string]string{"work": "effort", "recovery": "rest"},
+	}
+	res, err := RunBytes(opts)
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if a.Intervals.WorkCount != 5 || a.WorkoutStructure.MainSet == nil {
+		t.Fatalf("renaming labels must not change detection, got %d work laps", a.Intervals.WorkCount)
+	}
+	if lap := a.Laps[1]; lap.Label != "effort" || lap.CanonicalLabel != "work" || lap.LabelKind() != "work" {
+		t.Fatalf("expected lap 2 renamed effort (work), got %+v", lap)
+	}
+	var ws WorkoutStructureFile
+	if err := json.Unmarshal(res.Files["workout_structure.json"], &ws); err != nil {
+		t.Fatalf("decode workout_structure.json: %v", err)
+	}
+	work, rest := ws.Steps[1], ws.Steps[2]
+	if work.StepName != "effort" || rest.StepName != "rest" {
+		t.Fatalf("unexpected step names %q %q", work.StepName, rest.StepName)
+	}
+	if work.TargetType != "percent_ftp" || rest.TargetType != "percent_ftp" {
+		t.Fatalf("renamed work/recovery steps should keep %%FTP targets, got %q %q", work.TargetType, rest.TargetType)
+	}
+
+	opts.LapLabels = map[string]string{"sprint": "go"}
+	if _, err := RunBytes(opts); err == nil || !strings.Contains(err.Error(), "unknown lap label") {
+		t.Fatalf("expected unknown lap label error, got %v", err)
+	}
+}
+
+func TestRunBytesStructureConfidenceFactorsSumToConfidence(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "intervals.fit",
+		FitData:        data,
+	})
+	if err != nil {
+		t.Fatalf("RunBytes error: %v", err)
+	}
+	var ws WorkoutStructureFile
+	if err := json.Unmarshal(res.Files["workout_structure.json"], &ws); err != nil {
+		t.Fatalf("decode workout_structure.json: %v", err)
+	}
+	if ws.StructureConfidenceFactors["base"] != 0.25 || ws.StructureConfidenceFactors["main_set"] != 0.36 {
+		t.Fatalf("expected base and main_set factors, got %v", ws.StructureConfidenceFactors)
+	}
+	sum := 0.0
+	for _, v := range ws.StructureConfidenceFactors {
+		sum += v
+	}
+	if math.Abs(sum-ws.StructureConfidence) > 1e-9 {
+		t.Fatalf("factors sum to %v, confidence is %v", sum, ws.StructureConfidence)
+	}
+}
+
+func TestRunBytesEstimatesCarbAndFatGrams(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "intervals.fit",
+		FitData:        data,
+		FTPOverride:    250,
+	})
+	if err != nil {
+		t.Fatalf("RunBytes error: %v", err)
+	}
+	a := res.Analysis
+	if a.CarbGrams <= 0 || a.FatGrams <= 0 {
+		t.Fatalf("expected carb and fat estimates, got %v g / %v g", a.CarbGrams, a.FatGrams)
+	}
+	kcal := a.CarbGrams*4.1 + a.FatGrams*9.4
+	wantKcal := a.WorkKilojoules / 0.24 / 4.184
+	if math.Abs(kcal-wantKcal)/wantKcal > 0.1 {
+		t.Fatalf("substrate energy %.0f kcal should match work-derived %.0f kcal", kcal, wantKcal)
+	}
+}
+
+func TestBuildWorkoutStepsKeepsLapStepsWhenLapCountsDiffer(t *testing.T) {
+	analysis := &analyzer.Analysis{
+		Laps: []analyzer.LapSummary{
+			{Index: 1, Label: "warmup"},
+			{Index: 3, Label: "work"},
+		},
+	}
+	lapSummary := LapSummaryFile{Laps: []LapSummary{
+		{LapIndex: 1, AvgPowerW: 150},
+		{LapIndex: 2, AvgPowerW: 180},
+		{LapIndex: 3, AvgPowerW: 300},
+	}}
+
+	warning := lapAlignmentWarning(analysis, lapSummary)
+	if !strings.Contains(warning, "analyzer found 2 laps but lap summary has 3") || !strings.Contains(warning, "laps 2 have no analyzer label") {
+		t.Fatalf("unexpected alignment warning: %q", warning)
+	}
+	steps := buildWorkoutSteps(nil, analysis, nil, lapSummary, nil, 5, 1)
+	if len(steps) != 3 || steps[0].Source != "lap" {
+		t.Fatalf("expected 3 lap-derived steps, got %+v", steps)
+	}
+	want := []string{"warmup", "unlabeled", "work"}
+	for i, step := range steps {
+		if step.StepName != want[i] {
+			t.Fatalf("step %d: name %q want %q", i, step.StepName, want[i])
+		}
+	}
+
+	analysis.Laps = append(analysis.Laps, analyzer.LapSummary{Index: 2, Label: "recovery"})
+	if w := lapAlignmentWarning(analysis, lapSummary); w != "" {
+		t.Fatalf("aligned laps should not warn, got %q", w)
+	}
+}
+
+func TestBuildReconciliationComparesSessionEventsAndSamples(t *testing.T) {
+	start := time.Date(2026, 4, 2, 6, 0, 0, 0, time.UTC)
+	samples := make([]CanonicalSample, 0, 601)
+	for i := 0; i <= 700; i++ {
+		if i > 300 && i < 400 {
+			continue // paused
+		}
+		samples = append(samples, CanonicalSample{Timestamp: start.Add(time.Duration(i) * time.Second), ElapsedS: float64(i)})
+	}
+	timerEvent := func(offset int, eventType fit.EventType) *fit.EventMsg {
+		ev := fit.NewEventMsg()
+		ev.Timestamp = start.Add(time.Duration(offset) * time.Second)
+		ev.Event = fit.EventTimer
+		ev.EventType = eventType
+		return ev
+	}
+	session := fit.NewSessionMsg()
+	session.TotalElapsedTime = 700 * 1000
+	session.TotalTimerTime = 600 * 1000
+	activity := &fit.ActivityFile{
+		Sessions: []*fit.SessionMsg{session},
+		Events: []*fit.EventMsg{
+			timerEvent(0, fit.EventTypeStart),
+			timerEvent(300, fit.EventTypeStop),
+			timerEvent(400, fit.EventTypeStart),
+			timerEvent(700, fit.EventTypeStopAll),
+		},
+	}
+
+	rec := buildReconciliation(activity, samples)
+	if rec.EventTimerS == nil || *rec.EventTimerS != 600 || rec.TimerPauses != 1 || rec.SampleSpanS != 700 {
+		t.Fatalf("unexpected reconciliation totals: %+v", rec)
+	}
+	if len(rec.Discrepancies) != 0 {
+		t.Fatalf("consistent file should reconcile cleanly, got %+v", rec.Discrepancies)
+	}
+
+	session.TotalTimerTime = 650 * 1000
+	rec = buildReconciliation(activity, samples)
+	if len(rec.Discrepancies) != 1 || rec.Discrepancies[0].Left != "session_timer_s" || rec.Discrepancies[0].Right != "event_timer_s" || rec.Discrepancies[0].DiffS != 50 {
+		t.Fatalf("expected one session vs event timer discrepancy of 50 s, got %+v", rec.Discrepancies)
+	}
+}
+
+func TestRunBytesCleanGPSDropsGlitchesFromExportedTrack(t *testing.T) {
+	// Ten minutes north at about 8 m/s with one fix teleported 5 km east.
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	const fixes, glitch = 600, 300
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i < fixes; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+			lng := 2.8
+			if i == glitch {
+				lng += 0.065
+			}
+			rec.PositionLat = fit.NewLatitudeDegrees(41.9 + float64(i)*0.000072)
+			rec.PositionLong = fit.NewLongitudeDegrees(lng)
+			rec.Power = 200
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	run := func(clean bool) (*BytesResult, GeoJSONFeatureCollection) {
+		t.Helper()
+		res, err := RunBytes(BytesOptions{SourceFileName: "glitch.fit", FitData: data, Format: "csv", GeoJSON: true, CleanGPS: clean})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		var collection GeoJSONFeatureCollection
+		if err := json.Unmarshal(res.Files["activity.geojson"], &collection); err != nil {
+			t.Fatalf("unmarshal activity.geojson: %v", err)
+		}
+		return res, collection
+	}
+	raw, rawTrack := run(false)
+	clean, cleanTrack := run(true)
+	if raw.Analysis.GPSGlitchCount != 1 || clean.Analysis.GPSGlitchCount != 1 {
+		t.Fatalf("expected one glitch either way, got %d and %d", raw.Analysis.GPSGlitchCount, clean.Analysis.GPSGlitchCount)
+	}
+	if got := rawTrack.Features[0].Properties["point_count"]; got != float64(fixes) {
+		t.Fatalf("without --clean-gps the track keeps every fix, got %v", got)
+	}
+	if got := cleanTrack.Features[0].Properties["point_count"]; got != float64(fixes-1) {
+		t.Fatalf("with --clean-gps the glitch should be dropped, got %v", got)
+	}
+	for _, c := range cleanTrack.Features[0].Geometry.Coordinates.([]any) {
+		if lng := c.([]any)[0].(float64); lng > 2.81 {
+			t.Fatalf("cleaned track still contains the teleported fix %v", c)
+		}
+	}
+}
+
+func TestSimplifiedTrackHitsPointBudget(t *testing.T) {
+	fix := func(lat, lng float64) *fit.RecordMsg {
+		rec := fit.NewRecordMsg()
+		rec.PositionLat = fit.NewLatitudeDegrees(lat)
+		rec.PositionLong = fit.NewLongitudeDegrees(lng)
+		return rec
+	}
+	var straight, winding []*fit.RecordMsg
+	for i := 0; i < 3000; i++ {
+		straight = append(straight, fix(41.9+float64(i)*0.0001, 2.8))
+		winding = append(winding, fix(41.9+float64(i)*0.0001, 2.8+0.001*math.Sin(float64(i)/10)))
+	}
+	winding = append(winding, fit.NewRecordMsg()) // no fix: skipped
+
+	if got := simplifiedTrack(straight, trackMaxPoints); len(got) != 2 {
+		t.Fatalf("a straight line should reduce to its endpoints, got %d points", len(got))
+	}
+	got := simplifiedTrack(winding, trackMaxPoints)
+	if len(got) > trackMaxPoints || len(got) < trackMaxPoints*9/10 {
+		t.Fatalf("expected close to %d points without exceeding it, got %d", trackMaxPoints, len(got))
+	}
+	if got[0] != [2]float64{41.9, 2.8} || got[len(got)-1][0] != roundCoord(41.9+2999*0.0001) {
+		t.Fatalf("simplification must keep the endpoints, got %v ... %v", got[0], got[len(got)-1])
+	}
+	if simplifiedTrack(winding[:1], trackMaxPoints) != nil {
+		t.Fatal("expected nil with fewer than two fixes")
+	}
+}
+
+func TestBuildActivityGeoJSONUsesLngLatOrder(t *testing.T) {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	record := func(offset int, lat, lng float64, power uint16) *fit.RecordMsg {
+		rec := fit.NewRecordMsg()
+		rec.Timestamp = start.Add(time.Duration(offset) * time.Second)
+		rec.PositionLat = fit.NewLatitudeDegrees(lat)
+		rec.PositionLong = fit.NewLongitudeDegrees(lng)
+		rec.Power = power
+		return rec
+	}
+	noFix := fit.NewRecordMsg()
+	noFix.Timestamp = start.Add(time.Second)
+	records := []*fit.RecordMsg{record(0, 45.5, -73.6, 200), noFix, record(2, 45.501, -73.601, 0xFFFF)}
+
+	if buildActivityGeoJSON(records[:2], "ride.fit", false) != nil {
+		t.Fatal("expected nil collection with fewer than two positions")
+	}
+	collection := buildActivityGeoJSON(records, "ride.fit", true)
+	if collection == nil || collection.Type != "FeatureCollection" || len(collection.Features) != 3 {
+		t.Fatalf("expected track plus 2 point features, got %+v", collection)
+	}
+	line := collection.Features[0].Geometry.Coordinates.([][2]float64)
+	if collection.Features[0].Geometry.Type != "LineString" || len(line) != 2 || line[0][0] != -73.6 || line[0][1] != 45.5 {
+		t.Fatalf("expected [lng, lat] LineString, got %v", line)
+	}
+	if p := collection.Features[1].Properties; p["power_w"] != uint16(200) {
+		t.Fatalf("first point should carry power, got %v", p)
+	}
+	if _, ok := collection.Features[2].Properties["power_w"]; ok {
+		t.Fatal("invalid power should be omitted")
+	}
+}
+
+func TestBuildLapSummaryDropsInvalidLapFields(t *testing.T) {
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	lap := fit.NewLapMsg()
+	lap.StartTime = start
+	lap.Timestamp = start.Add(5 * time.Minute)
+	lap.AvgPower = 210
+	// NewLapMsg leaves cadence, heart rate and both durations at their
+	// invalid sentinels.
+	summary := buildLapSummary(&fit.ActivityFile{Laps: []*fit.LapMsg{lap}}, nil)
+	if len(summary.Laps) != 1 {
+		t.Fatalf("expected 1 lap, got %d", len(summary.Laps))
+	}
+	got := summary.Laps[0]
+	if got.AvgCadenceRPM != 0 || got.AvgHRBPM != 0 || got.ElapsedS != 0 || got.AvgPowerW != 210 {
+		t.Fatalf("invalid lap fields should read as 0, got %+v", got)
+	}
+	if _, err := llmexport.MarshalJSON(summary); err != nil {
+		t.Fatalf("marshal lap summary: %v", err)
+	}
+}
+
+func TestExportedSummaryBuildersMatchPipelineArtifacts(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv", FTPOverride: 250})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	var wantLaps LapSummaryFile
+	var wantWorkout WorkoutStructureFile
+	var wantSummary ActivitySummaryFile
+	for name, v := range map[string]any{"lap_summary.json": &wantLaps, "workout_structure.json": &wantWorkout, "activity_summary.json": &wantSummary} {
+		if err := json.Unmarshal(res.Files[name], v); err != nil {
+			t.Fatalf("unmarshal %s: %v", name, err)
+		}
+	}
+
+	bundle, err := llmexport.ParseBytes(data)
+	if err != nil {
+		t.Fatalf("parse fixture: %v", err)
+	}
+	samples, err := BuildCanonicalSamples(bundle.Records)
+	if err != nil {
+		t.Fatalf("BuildCanonicalSamples error: %v", err)
+	}
+	activity, err := decodeActivityBytes(data)
+	if err != nil {
+		t.Fatalf("decode activity: %v", err)
+	}
+	opts := SummaryOptions{FTP: res.FTPUsed}
+
+	laps := BuildLapSummary(activity, samples)
+	lapsJSON, _ := json.Marshal(laps)
+	wantLapsJSON, _ := json.Marshal(wantLaps)
+	if len(laps.Laps) == 0 || string(lapsJSON) != string(wantLapsJSON) {
+		t.Fatalf("BuildLapSummary differs from lap_summary.json:\n got %s\nwant %s", lapsJSON, wantLapsJSON)
+	}
+	steps := BuildWorkoutSteps(bundle.Records, res.Analysis, samples, laps, opts)
+	stepsJSON, _ := json.Marshal(steps)
+	wantStepsJSON, _ := json.Marshal(wantWorkout.Steps)
+	if len(steps) == 0 || string(stepsJSON) != string(wantStepsJSON) {
+		t.Fatalf("BuildWorkoutSteps differs from workout_structure.json steps:\n got %s\nwant %s", stepsJSON, wantStepsJSON)
+	}
+	summary := BuildActivitySummary(samples, opts)
+	if summary.NPW != wantSummary.NPW || summary.TSSLike == nil || wantSummary.TSSLike == nil || math.Abs(*summary.TSSLike-*wantSummary.TSSLike) > 0.5 {
+		t.Fatalf("BuildActivitySummary NP/TSS %v/%v, want %v/%v", summary.NPW, summary.TSSLike, wantSummary.NPW, wantSummary.TSSLike)
+	}
+}
+
+func TestEncodeFITRoundTripsCanonicalSamples(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	bundle, err := llmexport.ParseBytes(data)
+	if err != nil {
+		t.Fatalf("parse fixture: %v", err)
+	}
+	samples, err := BuildCanonicalSamples(bundle.Records)
+	if err != nil {
+		t.Fatalf("BuildCanonicalSamples error: %v", err)
+	}
+	// Trim the warmup and keep the five work/recovery pairs as laps.
+	trimmed := samples[600 : 600+5*420]
+	var lapStarts []time.Time
+	for i := 0; i < len(trimmed); i += 210 {
+		lapStarts = append(lapStarts, trimmed[i].Timestamp)
+	}
+
+	encoded, err := EncodeFIT(trimmed, EncodeMeta{Sport: "cycling", LapStartTimes: lapStarts})
+	if err != nil {
+		t.Fatalf("EncodeFIT error: %v", err)
+	}
+	reparsed, err := llmexport.ParseBytes(encoded)
+	if err != nil {
+		t.Fatalf("parse encoded fit: %v", err)
+	}
+	if !reparsed.FileCRC.Valid || !reparsed.HeaderCRC.Valid {
+		t.Fatalf("encoded fit should carry valid CRCs, got header %+v file %+v", reparsed.HeaderCRC, reparsed.FileCRC)
+	}
+	activity, err := decodeActivityBytes(encoded)
+	if err != nil {
+		t.Fatalf("decode encoded activity: %v", err)
+	}
+	if len(activity.Records) != len(trimmed) || len(activity.Laps) != 10 || len(activity.Sessions) != 1 {
+		t.Fatalf("expected %d records, 10 laps, 1 session; got %d, %d, %d", len(trimmed), len(activity.Records), len(activity.Laps), len(activity.Sessions))
+	}
+	if got := activity.Sessions[0].TotalTimerTime; got != uint32((len(trimmed)-1)*1000) {
+		t.Fatalf("session timer %d ms, want %d", got, (len(trimmed)-1)*1000)
+	}
+	roundTrip, err := BuildCanonicalSamples(reparsed.Records)
+	if err != nil {
+		t.Fatalf("BuildCanonicalSamples on encoded fit: %v", err)
+	}
+	if *roundTrip[0].PowerW != *trimmed[0].PowerW || *roundTrip[0].HRBPM != *trimmed[0].HRBPM {
+		t.Fatalf("first sample changed: %v/%v want %v/%v", *roundTrip[0].PowerW, *roundTrip[0].HRBPM, *trimmed[0].PowerW, *trimmed[0].HRBPM)
+	}
+}
+
+func TestRunBytesPowerCurveMatchesBestEfforts(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, FTPOverride: 280, Format: "csv"})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	// The fixture lasts 55 minutes, so 3600 s and longer are skipped.
+	want := []int{1, 5, 15, 30, 60, 120, 300, 600, 1200}
+	if len(a.PowerCurve) != len(want) {
+		t.Fatalf("power curve %+v, want durations %v", a.PowerCurve, want)
+	}
+	if len(a.BestEfforts) != len(a.PowerCurve) {
+		t.Fatalf("best efforts %+v should read every curve point %+v", a.BestEfforts, a.PowerCurve)
+	}
+	for i, p := range a.PowerCurve {
+		if p.DurationSeconds != want[i] {
+			t.Fatalf("point %d: duration %d want %d", i, p.DurationSeconds, want[i])
+		}
+		if i > 0 && p.WattsBest > a.PowerCurve[i-1].WattsBest {
+			t.Fatalf("power curve must not rise with duration: %+v", a.PowerCurve)
+		}
+		if e := a.BestEfforts[i]; e.DurationSeconds != p.DurationSeconds || e.Watts != p.WattsBest {
+			t.Fatalf("%d s: curve %v W, best effort %+v", p.DurationSeconds, p.WattsBest, e)
+		}
+	}
+	if p := a.PowerCurve[4]; math.Abs(p.WattsBest-300) > 15 {
+		t.Fatalf("best 60 s %v W, want about 300 W", p.WattsBest)
+	}
+	if md := string(res.Files["training_summary.md"]); !strings.Contains(md, "- Power curve: 1s ") {
+		t.Fatalf("markdown should list the power curve:\n%s", md)
+	}
+}
+
+func TestRunBytesBestEffortsUseSecondsNotSamples(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	// Four readings per second: 30 s at 400 W then 90 s at 100 W.
+	data := fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+		for i := 0; i < 120*4; i++ {
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = start.Add(time.Duration(i/4) * time.Second)
+			rec.Power = 100
+			if i < 30*4 {
+				rec.Power = 400
+			}
+			activity.Records = append(activity.Records, rec)
+		}
+	})
+
+	res, err := RunBytes(BytesOptions{SourceFileName: "4hz.fit", FitData: data, Format: "csv", BestEffortDurationsS: []int{10, 60}})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	efforts := res.Analysis.BestEfforts
+	if len(efforts) != 2 || efforts[0].DurationSeconds != 10 || efforts[1].DurationSeconds != 60 {
+		t.Fatalf("expected only the requested 10 s and 60 s efforts, got %+v", efforts)
+	}
+	if efforts[0].Watts != 400 || efforts[1].Watts != 250 {
+		t.Fatalf("best 10 s %v W want 400, best 60 s %v W want 250", efforts[0].Watts, efforts[1].Watts)
+	}
+	onCurve := false
+	for _, p := range res.Analysis.PowerCurve {
+		onCurve = onCurve || p.DurationSeconds == 10
+	}
+	if !onCurve {
+		t.Fatalf("requested 10 s duration should join the power curve: %+v", res.Analysis.PowerCurve)
+	}
+}
+
+func TestEstimateCriticalPowerFitsHyperbolicModel(t *testing.T) {
+	// P(t) = CP + W'/t with CP 250 W and W' 20 kJ; 60 s and 1200 s fall
+	// outside the 2-12 min window and must not skew the fit.
+	var curve []analyzer.PowerCurvePoint
+	for _, d := range []int{60, 120, 300, 600, 1200} {
+		watts := 250 + 20000/float64(d)
+		if d == 60 || d == 1200 {
+			watts += 100
+		}
+		curve = append(curve, analyzer.PowerCurvePoint{DurationSeconds: d, WattsBest: watts})
+	}
+	cp, wprime, ok := analyzer.EstimateCriticalPower(curve)
+	if !ok || math.Abs(cp-250) > 1e-6 || math.Abs(wprime-20000) > 1e-3 {
+		t.Fatalf("got cp %v W' %v ok %v, want 250 W and 20000 J", cp, wprime, ok)
+	}
+	if _, _, ok := analyzer.EstimateCriticalPower(curve[:3]); ok {
+		t.Fatal("two usable points should not produce a fit")
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv", FTPFromCPModel: true})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	a := res.Analysis
+	if a.CriticalPower <= 0 || a.WPrimeJoules <= 0 {
+		t.Fatalf("expected a CP model fit, got CP %v W' %v", a.CriticalPower, a.WPrimeJoules)
+	}
+	if a.FTPSource != "cp_model" || a.FTPWatts != a.CriticalPower {
+		t.Fatalf("expected FTP from the CP model, got %v W (%s)", a.FTPWatts, a.FTPSource)
+	}
+}
+
+func TestRunBytesPowerZonesCarryWPerKGBands(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	res, err := RunBytes(BytesOptions{
+		SourceFileName: "intervals.fit",
+		FitData:        data,
+		FTPOverride:    280,
+		WeightKG:       70,
+		Format:         "csv",
+		ValidateSchema: true,
+	})
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+
+	a := res.Analysis
+	if a.FTPWPerKG != 4 {
+		t.Fatalf("ftp W/kg %v want 4", a.FTPWPerKG)
+	}
+	var threshold *analyzer.ZoneDuration
+	for i := range a.PowerZones {
+		if a.PowerZones[i].Zone == "Z4 Threshold" {
+			threshold = &a.PowerZones[i]
+		}
+	}
+	if threshold == nil || threshold.MinWPerKG != 3.6 || threshold.MaxWPerKG != 4.2 {
+		t.Fatalf("unexpected threshold zone band: %+v", threshold)
+	}
+	if top := a.PowerZones[len(a.PowerZones)-1]; top.MinWPerKG != 6 || top.MaxWPerKG != 0 {
+		t.Fatalf("top zone should be open-ended: %+v", top)
+	}
+
+	var summary ActivitySummaryFile
+	if err := json.Unmarshal(res.Files["activity_summary.json"], &summary); err != nil {
+		t.Fatalf("decode activity_summary.json: %v", err)
+	}
+	if summary.FTPWPerKG == nil || *summary.FTPWPerKG != 4 || len(summary.PowerZones) != len(a.PowerZones) {
+		t.Fatalf("summary missing W/kg zones: %v %d", summary.FTPWPerKG, len(summary.PowerZones))
+	}
+}
+
+func TestRunBytesMinStructureConfidenceSuppressesStructure(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	run := func(minConfidence float64) (*analyzer.Analysis, WorkoutStructureFile) {
+		res, err := RunBytes(BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv", MinStructureConfidence: minConfidence})
+		if err != nil {
+			t.Fatalf("RunBytes() error: %v", err)
+		}
+		var ws WorkoutStructureFile
+		if err := json.Unmarshal(res.Files["workout_structure.json"], &ws); err != nil {
+			t.Fatalf("decode workout_structure.json: %v", err)
+		}
+		return res.Analysis, ws
+	}
+	base, _ := run(0)
+	confidence := base.WorkoutStructure.Confidence
+	if confidence <= 0 || base.WorkoutStructure.Suppressed {
+		t.Fatalf("fixture should infer a structure, got confidence %v", confidence)
+	}
+
+	if a, ws := run(confidence); a.WorkoutStructure.Suppressed || a.WorkoutStructure.MainSet == nil || ws.StructureSuppressed {
+		t.Fatal("a threshold equal to the confidence should keep the structure")
+	}
+	a, ws := run(confidence + 0.01)
+	st := a.WorkoutStructure
+	if !st.Suppressed || st.MainSet != nil || len(st.Blocks) != 0 || !strings.HasPrefix(st.CanonicalLabel, "unstructured ride") {
+		t.Fatalf("expected a suppressed, unstructured label, got %+v", st)
+	}
+	if st.Confidence != confidence || !ws.StructureSuppressed || ws.StructureConfidence != confidence {
+		t.Fatalf("confidence should still be reported: analysis %v, workout_structure.json %v", st.Confidence, ws.StructureConfidence)
+	}
+	for _, step := range ws.Steps {
+		if step.StepName == "work" {
+			t.Fatalf("suppressed structure should not yield lap-derived work steps, got %+v", ws.Steps)
+		}
+	}
+}
+
+func TestRunBytesGeneratesOnlyRequestedArtifacts(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	opts := BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv", Artifacts: []string{" Summary", "workout"}}
+	res, err := RunBytes(opts)
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	var names []string
+	for name := range res.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "activity_summary.json,workout_structure.json" {
+		t.Fatalf("expected only the summary and workout artifacts, got %v", names)
+	}
+
+	opts.Artifacts = []string{"summary", "parquet"}
+	if _, err := RunBytes(opts); err == nil || !strings.Contains(err.Error(), `unknown artifact "parquet"`) {
+		t.Fatalf("expected an unknown artifact error, got %v", err)
+	}
+}
+
+func TestRunBytesFailOnWarningsMatchesSubstrings(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	opts := BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv"}
+
+	opts.FailOnWarnings = []string{"file CRC mismatch", "leftover trailing bytes"}
+	res, err := RunBytes(opts)
+	if err != nil {
+		t.Fatalf("unmatched patterns should not fail: %v", err)
+	}
+	matched := ""
+	for _, w := range res.Warnings {
+		if strings.Contains(w, "cadence stayed constant") {
+			matched = w
+			break
+		}
+	}
+	if matched == "" {
+		t.Fatalf("fixture should warn about constant cadence, got %v", res.Warnings)
+	}
+
+	opts.FailOnWarnings = []string{"file CRC mismatch", "cadence stayed constant"}
+	if _, err := RunBytes(opts); err == nil || !strings.Contains(err.Error(), matched) {
+		t.Fatalf("expected error listing the matched warning, got %v", err)
+	}
+}
+
+func TestRunBytesChecksFTPOverridePlausibility(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	opts := BytesOptions{SourceFileName: "intervals.fit", FitData: data, Format: "csv", FTPOverride: 2230}
+	res, err := RunBytes(opts)
+	if err != nil {
+		t.Fatalf("lenient mode should accept the override: %v", err)
+	}
+	want := "ftp override 2230 W is outside plausible range 50-500 W, likely a typo; IF/TSS are likely wrong"
+	found := false
+	for _, w := range res.Warnings {
+		if w == want {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected %q among %v", want, res.Warnings)
+	}
+	// A warned-about override is still used everywhere, not just by the
+	// analyzer.
+	if res.FTPUsed == nil || res.FTPUsed.FTPW != res.Analysis.FTPWatts || res.Analysis.FTPWatts != 2230 {
+		t.Fatalf("ftp_w_used %+v should match analyzer FTP %.0f", res.FTPUsed, res.Analysis.FTPWatts)
+	}
+	var summary ActivitySummaryFile
+	if err := json.Unmarshal(res.Files["activity_summary.json"], &summary); err != nil {
+		t.Fatalf("decode activity_summary.json: %v", err)
+	}
+	if summary.FTPWUsed == nil || *summary.FTPWUsed != 2230 || summary.IF == nil || *summary.IF > 0.2 {
+		t.Fatalf("activity summary should use the 2230 W override, got ftp %v IF %v", summary.FTPWUsed, summary.IF)
+	}
+
+	opts.StrictFTP = true
+	if _, err := RunBytes(opts); err == nil || !strings.Contains(err.Error(), "outside plausible range") {
+		t.Fatalf("strict mode should reject the override, got %v", err)
+	}
+	opts.FTPOverride = 280
+	if _, err := RunBytes(opts); err != nil {
+		t.Fatalf("strict mode should accept a plausible override: %v", err)
+	}
+}
+
+func TestRunBytesMetricsLongListsScalars(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "intervals.fit"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	opts := BytesOptions{SourceFileName: "intervals.fit", FitData: data, FTPOverride: 280, Format: "csv"}
+	res, err := RunBytes(opts)
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	if _, ok := res.Files["metrics_long.csv"]; ok {
+		t.Fatal("metrics_long.csv should be opt-in")
+	}
+
+	opts.MetricsLong = true
+	res, err = RunBytes(opts)
+	if err != nil {
+		t.Fatalf("RunBytes() error: %v", err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(res.Files["metrics_long.csv"])).ReadAll()
+	if err != nil {
+		t.Fatalf("read metrics_long.csv: %v", err)
+	}
+	if strings.Join(rows[0], ",") != "metric,value,unit" {
+		t.Fatalf("unexpected header %v", rows[0])
+	}
+	got := make(map[string][]string, len(rows))
+	for _, row := range rows[1:] {
+		got[row[0]] = row[1:]
+	}
+	if v := got["summary.ftp_w_used"]; len(v) != 2 || v[0] != "280.000000" || v[1] != "W" {
+		t.Fatalf("unexpected summary.ftp_w_used row: %v", v)
+	}
+	if v := got["analysis.intervals.work_count"]; len(v) != 2 || v[0] != "5" {
+		t.Fatalf("unexpected analysis.intervals.work_count row: %v", v)
+	}
+	if v := got["analysis.avg_heart_rate_bpm"]; len(v) != 2 || v[1] != "bpm" {
+		t.Fatalf("unexpected analysis.avg_heart_rate_bpm row: %v", v)
+	}
+
+	again, err := RunBytes(opts)
+	if err != nil || !bytes.Equal(again.Files["metrics_long.csv"], res.Files["metrics_long.csv"]) {
+		t.Fatalf("metrics_long.csv not deterministic: %v", err)
+	}
+}
+
+func TestMergeHeartRateSamplesMatchesAnalyzerTolerance(t *testing.T) {
+	start := time.Date(2026, 4, 4, 7, 0, 0, 0, time.UTC)
+	samples := make([]CanonicalSample, 4)
+	for i := range samples {
+		samples[i].Timestamp = start.Add(time.Duration(i*10) * time.Second)
+	}
+	samples[3].HRBPM, samples[3].ValidHR = floatPtr(150), true
+	hr := []analyzer.HeartRateSample{
+		{Timestamp: start, BPM: 120},                               // exact
+		{Timestamp: start.Add(11 * time.Second), BPM: 125},         // 1 s off
+		{Timestamp: start.Add(21500 * time.Millisecond), BPM: 130}, // 1.5 s off
+		{Timestamp: start.Add(30 * time.Second), BPM: 140},         // record HR wins
+	}
+	if merged := mergeHeartRateSamples(samples, hr); merged != 2 {
+		t.Fatalf("merged %d want 2", merged)
+	}
+	for i, s := range samples {
+		got, _ := analyzer.HeartRateAt(hr, s.Timestamp)
+		if i < 2 && (s.HRBPM == nil || *s.HRBPM != got) {
+			t.Fatalf("sample %d HR %v want analyzer's %v", i, s.HRBPM, got)
+		}
+	}
+	if samples[2].ValidHR || *samples[3].HRBPM != 150 {
+		t.Fatalf("unexpected fills: %+v", samples[2:])
+	}
+}
+
+func TestMergeByTimestamp(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	type channels struct{ power, hr, cadence bool }
+	encode := func(offsetS, seconds int, ch channels, power uint16) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			for i := 0; i < seconds; i++ {
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(time.Duration(offsetS+i) * time.Second)
+				if ch.power {
+					rec.Power = power
+				}
+				if ch.hr {
+					rec.HeartRate = 140
+				}
+				if ch.cadence {
+					rec.Cadence = 90
+				}
+				activity.Records = append(activity.Records, rec)
+			}
+		})
+	}
+	watch := encode(0, 60, channels{hr: true}, 0)
+
+	tests := []struct {
+		name        string
+		secondary   []byte
+		wantErr     string
+		wantMatched int
+		wantPower   int
+		wantHR      int
+		wantCadence int
+		wantWarning string
+		wantWatts   uint16
+	}{
+		{
+			name:        "full overlap fills missing channels",
+			secondary:   encode(0, 60, channels{power: true, hr: true, cadence: true}, 250),
+			wantMatched: 60,
+			wantPower:   60,
+			wantCadence: 60,
+			wantWatts:   250,
+		},
+		{
+			name:        "one second skew still matches",
+			secondary:   encode(1, 60, channels{power: true}, 250),
+			wantMatched: 60,
+			wantPower:   60,
+			wantWatts:   250,
+		},
+		{
+			name:        "partial overlap warns",
+			secondary:   encode(40, 60, channels{power: true}, 250),
+			wantMatched: 21,
+			wantPower:   21,
+			wantWarning: "poor overlap",
+			wantWatts:   250,
+		},
+		{
+			name:      "gap between files fails",
+			secondary: encode(3600, 60, channels{power: true}, 250),
+			wantErr:   "do not overlap",
+		},
+		{
+			name:        "secondary without new channels warns",
+			secondary:   encode(0, 60, channels{hr: true}, 0),
+			wantMatched: 60,
+			wantWarning: "supplied no missing channels",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := MergeByTimestamp(watch, tc.secondary)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeByTimestamp() error: %v", err)
+			}
+			if res.PrimaryRecords != 60 || res.MatchedRecords != tc.wantMatched {
+				t.Fatalf("matched %d of %d, want %d of 60", res.MatchedRecords, res.PrimaryRecords, tc.wantMatched)
+			}
+			if res.FilledPower != tc.wantPower || res.FilledHR != tc.wantHR || res.FilledCadence != tc.wantCadence {
+				t.Fatalf("filled power/hr/cadence %d/%d/%d, want %d/%d/%d", res.FilledPower, res.FilledHR, res.FilledCadence, tc.wantPower, tc.wantHR, tc.wantCadence)
+			}
+			if got := strings.Join(res.Warnings, "; "); (tc.wantWarning == "") != (got == "") || !strings.Contains(got, tc.wantWarning) {
+				t.Fatalf("warnings %q, want %q", got, tc.wantWarning)
+			}
+			merged, err := decodeActivityBytes(res.Data)
+			if err != nil {
+				t.Fatalf("decode merged fit: %v", err)
+			}
+			last := merged.Records[len(merged.Records)-1]
+			if tc.wantWatts > 0 && last.Power != tc.wantWatts {
+				t.Fatalf("merged power %d, want %d", last.Power, tc.wantWatts)
+			}
+			if last.HeartRate != 140 {
+				t.Fatalf("primary heart rate should be kept, got %d", last.HeartRate)
+			}
+		})
+	}
+}
+
+func TestMergeByTimestampPrefersPrimaryChannels(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	encode := func(power uint16, hr uint8) []byte {
+		return fittest.EncodeActivity(t, func(activity *fit.ActivityFile) {
+			for i := 0; i < 30; i++ {
+				rec := fit.NewRecordMsg()
+				rec.Timestamp = start.Add(time.Duration(i) * time.Second)
+				rec.Power = power
+				rec.HeartRate = hr
+				activity.Records = append(activity.Records, rec)
+			}
+		})
+	}
+	// The primary's own power wins; only its missing heart rate is filled.
+	res, err := MergeByTimestamp(encode(200, 0xFF), encode(250, 150))
+	if err != nil {
+		t.Fatalf("MergeByTimestamp() error: %v", err)
+	}
+	if res.FilledPower != 0 || res.FilledHR != 30 {
+		t.Fatalf("filled power %d hr %d, want 0 and 30", res.FilledPower, res.FilledHR)
+	}
+	merged, err := decodeActivityBytes(res.Data)
+	if err != nil {
+		t.Fatalf("decode merged fit: %v", err)
+	}
+	for _, rec := range merged.Records {
+		if rec.Power != 200 || rec.HeartRate != 150 {
+			t.Fatalf("merged record power %d hr %d, want 200 and 150", rec.Power, rec.HeartRate)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
+	"github.com/tormoder/fit"
+)
+
+// scalingAuditSamplesPerField bounds how many values each field contributes
+// to scaling_audit.json.
+const scalingAuditSamplesPerField = 5
+
+// buildScalingAudit collects the first valid scaled values of each field, in
+// message and field number order.
+func buildScalingAudit(records []llmexport.RecordEnvelope) ScalingAuditFile {
+	type key struct {
+		global uint16
+		field  uint8
+	}
+	byKey := make(map[key]*ScalingAuditField)
+	for _, rec := range records {
+		if rec.RecordKind != "data" || rec.Data == nil {
+			continue
+		}
+		for _, f := range rec.Data.Fields {
+			if f.Scaled == nil || f.Invalid || f.DecodeError != "" {
+				continue
+			}
+			k := key{rec.GlobalMessageNum, f.FieldNumber}
+			entry, ok := byKey[k]
+			if !ok {
+				entry = &ScalingAuditField{
+					GlobalMessageNum:  int(rec.GlobalMessageNum),
+					GlobalMessageName: fmt.Sprint(fit.MesgNum(rec.GlobalMessageNum)),
+					FieldNumber:       int(f.FieldNumber),
+					FieldName:         f.FieldName,
+					Units:             f.Units,
+				}
+				byKey[k] = entry
+			}
+			entry.Occurrences++
+			if len(entry.Samples) < scalingAuditSamplesPerField {
+				entry.Samples = append(entry.Samples, ScalingAuditSample{RawDecoded: f.Decoded, Scaled: f.Scaled})
+			}
+		}
+	}
+
+	out := ScalingAuditFile{Fields: make([]ScalingAuditField, 0, len(byKey))}
+	for _, entry := range byKey {
+		out.Fields = append(out.Fields, *entry)
+	}
+	sort.Slice(out.Fields, func(i, j int) bool {
+		a, b := out.Fields[i], out.Fields[j]
+		if a.GlobalMessageNum != b.GlobalMessageNum {
+			return a.GlobalMessageNum < b.GlobalMessageNum
+		}
+		return a.FieldNumber < b.FieldNumber
+	})
+	return out
+}
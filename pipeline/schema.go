@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+//go:embed schemas/*.schema.json
+var schemaFS embed.FS
+
+// jsonSchema is the JSON Schema subset used by the embedded artifact schemas:
+// type, required, properties, items, additionalProperties, minimum and local
+// "#/$defs/<name>" references.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 any                    `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Items                *jsonSchema            `json:"items"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Minimum              *float64               `json:"minimum"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+}
+
+// artifactSchemas maps artifact file names to their embedded schema files.
+var artifactSchemas = map[string]string{
+	"activity_summary.json":  "schemas/activity_summary.schema.json",
+	"adherence.json":         "schemas/adherence.schema.json",
+	"lap_summary.json":       "schemas/lap_summary.schema.json",
+	"messages_index.json":    "schemas/messages_index.schema.json",
+	"workout_structure.json": "schemas/workout_structure.schema.json",
+}
+
+// ValidateArtifacts checks each JSON artifact that has a documented schema
+// against it and returns one error per violation. Files without a schema are
+// ignored, so the full RunBytes file map can be passed as-is.
+func ValidateArtifacts(files map[string][]byte) []error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if _, ok := artifactSchemas[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		schema, err := loadArtifactSchema(artifactSchemas[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(files[name]))
+		dec.UseNumber()
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid json: %w", name, err))
+			continue
+		}
+		for _, msg := range validateSchema(schema, schema, doc, "$") {
+			errs = append(errs, fmt.Errorf("%s: %s", name, msg))
+		}
+	}
+	return errs
+}
+
+func loadArtifactSchema(path string) (*jsonSchema, error) {
+	data, err := schemaFS.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read schema: %w", err)
+	}
+	var s jsonSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	return &s, nil
+}
+
+func validateSchema(root, s *jsonSchema, v any, path string) []string {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/$defs/")
+		def, ok := root.Defs[name]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unresolved schema reference %q", path, s.Ref)}
+		}
+		return validateSchema(root, def, v, path)
+	}
+
+	if types := schemaTypes(s.Type); len(types) > 0 {
+		actual := jsonTypeOf(v)
+		matched := false
+		for _, t := range types {
+			if t == actual || (t == "number" && actual == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, "|"), actual)}
+		}
+	}
+
+	var out []string
+	switch x := v.(type) {
+	case map[string]any:
+		for _, key := range s.Required {
+			if _, ok := x[key]; !ok {
+				out = append(out, fmt.Sprintf("%s: missing required property %q", path, key))
+			}
+		}
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := s.Properties[key]
+			if child == nil {
+				child = s.AdditionalProperties
+			}
+			out = append(out, validateSchema(root, child, x[key], path+"."+key)...)
+		}
+	case []any:
+		for i, item := range x {
+			out = append(out, validateSchema(root, s.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case json.Number:
+		if s.Minimum != nil {
+			if f, err := x.Float64(); err == nil && f < *s.Minimum {
+				out = append(out, fmt.Sprintf("%s: %v is below minimum %v", path, f, *s.Minimum))
+			}
+		}
+	}
+	return out
+}
+
+func schemaTypes(t any) []string {
+	switch x := t.(type) {
+	case string:
+		return []string{x}
+	case []any:
+		out := make([]string, 0, len(x))
+		for _, v := range x {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func jsonTypeOf(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := x.Float64(); err == nil && f == math.Trunc(f) && !strings.ContainsAny(x.String(), ".eE") {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
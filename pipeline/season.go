@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+)
+
+const (
+	ctlTimeConstantDays = 42.0
+	atlTimeConstantDays = 7.0
+	seasonDateLayout    = "2006-01-02"
+)
+
+// SummaryLine is the per-activity summary used to aggregate many rides. One
+// line per activity; several lines on the same day are summed. Days are local
+// to the file's UTC offset when it recorded one, else UTC days.
+type SummaryLine struct {
+	SourceFile       string    `json:"source_file"`
+	StartTime        time.Time `json:"start_time"`
+	UTCOffsetSeconds *int      `json:"utc_offset_seconds,omitempty"`
+	TSS              float64   `json:"tss"`
+}
+
+// SeasonReport is the daily fitness (CTL), fatigue (ATL) and form (TSB)
+// series across a set of activities.
+type SeasonReport struct {
+	StartDate  string      `json:"start_date"`
+	EndDate    string      `json:"end_date"`
+	Activities int         `json:"activities"`
+	TotalTSS   float64     `json:"total_tss"`
+	Days       []SeasonDay `json:"days"`
+}
+
+// SeasonDay is one calendar day of the training-load model.
+type SeasonDay struct {
+	Date string  `json:"date"`
+	TSS  float64 `json:"tss"`
+	CTL  float64 `json:"ctl"`
+	ATL  float64 `json:"atl"`
+	TSB  float64 `json:"tsb"`
+}
+
+// SummaryLineFromAnalysis builds the aggregation line for one analysis.
+func SummaryLineFromAnalysis(a *analyzer.Analysis) SummaryLine {
+	return SummaryLine{
+		SourceFile:       a.FilePath,
+		StartTime:        a.StartTime,
+		UTCOffsetSeconds: a.UTCOffsetSeconds,
+		TSS:              a.TrainingStress,
+	}
+}
+
+// AggregateSeason runs the exponentially weighted training-load model over
+// daily TSS totals: CTL and ATL move toward each day's TSS by 1/42 and 1/7 of
+// the gap, and TSB is the previous day's CTL minus ATL, i.e. form going into
+// the day. Days without activities count as zero TSS. Lines without a start
+// time or with negative TSS are skipped; it returns nil when none remain.
+// Both loads start at zero, so early values understate fitness until roughly
+// six weeks of history are included.
+func AggregateSeason(summaries []SummaryLine) *SeasonReport {
+	daily := make(map[string]float64)
+	activities := 0
+	for _, line := range summaries {
+		if line.StartTime.IsZero() || line.TSS < 0 || math.IsNaN(line.TSS) {
+			continue
+		}
+		daily[line.StartTime.In(analyzer.LocalZone(line.UTCOffsetSeconds)).Format(seasonDateLayout)] += line.TSS
+		activities++
+	}
+	if activities == 0 {
+		return nil
+	}
+	dates := make([]string, 0, len(daily))
+	for d := range daily {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+	first, _ := time.Parse(seasonDateLayout, dates[0])
+	last, _ := time.Parse(seasonDateLayout, dates[len(dates)-1])
+
+	report := &SeasonReport{
+		StartDate:  dates[0],
+		EndDate:    dates[len(dates)-1],
+		Activities: activities,
+	}
+	ctl, atl := 0.0, 0.0
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		date := day.Format(seasonDateLayout)
+		tss := daily[date]
+		tsb := ctl - atl
+		ctl += (tss - ctl) / ctlTimeConstantDays
+		atl += (tss - atl) / atlTimeConstantDays
+		report.TotalTSS += tss
+		report.Days = append(report.Days, SeasonDay{
+			Date: date,
+			TSS:  round1(tss),
+			CTL:  round1(ctl),
+			ATL:  round1(atl),
+			TSB:  round1(tsb),
+		})
+	}
+	report.TotalTSS = round1(report.TotalTSS)
+	return report
+}
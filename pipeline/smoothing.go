@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"math"
+	"sort"
+)
+
+// smoothGrade replaces GradePct with a centered moving average over windowS
+// seconds and keeps the device value in GradeRawPct. The window is converted
+// to a sample count from the median sample interval so 1 Hz and smart-recorded
+// files get the same time span. Samples without grade stay empty and are not
+// counted in their neighbours' averages.
+func smoothGrade(samples []CanonicalSample, windowS int) {
+	if windowS <= 0 || len(samples) == 0 {
+		return
+	}
+	raw := make([]*float64, len(samples))
+	for i := range samples {
+		raw[i] = samples[i].GradePct
+		samples[i].GradeRawPct = samples[i].GradePct
+	}
+
+	half := sampleWindow(samples, float64(windowS)) / 2
+	for i := range samples {
+		if raw[i] == nil {
+			continue
+		}
+		sum := 0.0
+		n := 0
+		for j := max(0, i-half); j <= min(len(samples)-1, i+half); j++ {
+			if raw[j] != nil {
+				sum += *raw[j]
+				n++
+			}
+		}
+		v := sum / float64(n)
+		samples[i].GradePct = &v
+	}
+}
+
+// sampleWindow converts a duration to a sample count using the median
+// interval between consecutive samples.
+func sampleWindow(samples []CanonicalSample, windowS float64) int {
+	intervals := make([]float64, 0, len(samples))
+	for i := 1; i < len(samples); i++ {
+		if dt := samples[i].ElapsedS - samples[i-1].ElapsedS; dt > 0 {
+			intervals = append(intervals, dt)
+		}
+	}
+	if len(intervals) == 0 {
+		return 1
+	}
+	sort.Float64s(intervals)
+	median := intervals[len(intervals)/2]
+	return max(1, int(math.Round(windowS/median)))
+}
+
+func hasGradeRawColumn(samples []CanonicalSample) bool {
+	for _, s := range samples {
+		if s.GradeRawPct != nil {
+			return true
+		}
+	}
+	return false
+}
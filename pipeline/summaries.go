@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
+	"github.com/tormoder/fit"
+)
+
+// SummaryOptions configures BuildActivitySummary and BuildWorkoutSteps for
+// callers recomputing individual artifacts outside Run/RunBytes. The zero
+// value matches the pipeline defaults without an FTP or weight.
+type SummaryOptions struct {
+	FTP                 *FTPCandidate // FTP for IF/TSS and %FTP targets, e.g. WorkoutStructureFile.FTPWUsed; nil means unknown
+	WeightKG            float64       // adds W/kg fields when positive
+	NPExcludeCoasting   bool          // base IF/TSS on np_w_pedaling instead of np_w
+	NPMinSamples        int           // 1 Hz power seconds needed for np_reliable; values below 30 mean 30
+	TargetPowerRounding float64       // lap-derived step targets round to this many watts; 0 means 5
+	TargetPctRounding   float64       // lap-derived step targets round to this many % FTP; 0 means 1
+	TargetTolerancePct  float64       // ± band around single-value step targets for time in target; 0 means 5
+}
+
+// BuildActivitySummary computes activity_summary.json from canonical samples
+// (from BuildCanonicalSamples), taking the duration from the samples' elapsed
+// time. Power zones come from the analyzer and are not filled in here.
+func BuildActivitySummary(samples []CanonicalSample, opts SummaryOptions) ActivitySummaryFile {
+	return buildActivitySummary(samples, opts.FTP, 0, opts.WeightKG, opts.NPExcludeCoasting, opts.NPMinSamples, nil)
+}
+
+// BuildLapSummary computes lap_summary.json from the activity's lap messages,
+// mapping each lap onto its first and last canonical sample index.
+func BuildLapSummary(activity *fit.ActivityFile, samples []CanonicalSample) LapSummaryFile {
+	return buildLapSummary(activity, samples)
+}
+
+// BuildWorkoutSteps computes the workout_structure.json steps the way the
+// pipeline does: from planned workout_step messages in records when present,
+// else from laps when the analysis kept its inferred structure, else one
+// step spanning the activity. Steps are enriched with observed power and
+// target compliance against opts.FTP.
+func BuildWorkoutSteps(records []llmexport.RecordEnvelope, analysis *analyzer.Analysis, samples []CanonicalSample, laps LapSummaryFile, opts SummaryOptions) []WorkoutStep {
+	powerRounding, pctRounding := opts.TargetPowerRounding, opts.TargetPctRounding
+	if powerRounding <= 0 {
+		powerRounding = defaultTargetPowerRounding
+	}
+	if pctRounding <= 0 {
+		pctRounding = defaultTargetPctRounding
+	}
+	steps := buildWorkoutSteps(records, analysis, samples, laps, opts.FTP, powerRounding, pctRounding)
+	ftp := 0.0
+	if opts.FTP != nil {
+		ftp = opts.FTP.FTPW
+	}
+	tolerance := opts.TargetTolerancePct
+	if tolerance <= 0 {
+		tolerance = defaultStepTargetTolerancePct
+	}
+	for i := range steps {
+		enrichStepCompliance(&steps[i], samples, ftp, tolerance)
+	}
+	return steps
+}
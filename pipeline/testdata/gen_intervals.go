@@ -0,0 +1,114 @@
+//go:build ignore
+
+// gen_intervals writes intervals.fit, a synthetic indoor interval ride used by
+// the pipeline tests: 10m warmup, 5x4m work with 3m recoveries, 10m cooldown.
+// Each segment is one lap and every second carries a record.
+//
+// Regenerate with: go run ./testdata/gen_intervals.go (from pipeline/).
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tormoder/fit"
+)
+
+type segment struct {
+	seconds int
+	power   uint16
+	hr      uint8
+}
+
+func main() {
+	segments := []segment{{600, 150, 120}}
+	for i := 0; i < 5; i++ {
+		segments = append(segments, segment{240, 300, 160}, segment{180, 120, 130})
+	}
+	segments = append(segments, segment{600, 130, 115})
+
+	header := fit.NewHeader(fit.V20, true)
+	file, err := fit.NewFile(fit.FileTypeActivity, header)
+	if err != nil {
+		log.Fatalf("new fit file: %v", err)
+	}
+	file.FileId.TimeCreated = time.Date(2026, 3, 2, 17, 0, 0, 0, time.UTC)
+	activity, err := file.Activity()
+	if err != nil {
+		log.Fatalf("activity accessor: %v", err)
+	}
+
+	start := file.FileId.TimeCreated
+	ts := start
+	var distance float64
+	var totalPower, totalHR, count int
+	for _, seg := range segments {
+		lapStart := ts
+		var lapPower, lapHR, lapMaxPower int
+		for s := 0; s < seg.seconds; s++ {
+			// Deterministic ±6 W wobble so the stream is not perfectly flat.
+			power := int(seg.power) + (s%5-2)*3
+			hr := int(seg.hr) + min(s/30, 8)
+			speed := 8.0 + float64(power)/100.0
+			distance += speed
+
+			rec := fit.NewRecordMsg()
+			rec.Timestamp = ts
+			rec.Power = uint16(power)
+			rec.HeartRate = uint8(hr)
+			rec.Cadence = 90
+			rec.Speed = uint16(speed * 1000)
+			rec.Distance = uint32(distance * 100)
+			activity.Records = append(activity.Records, rec)
+
+			lapPower += power
+			lapHR += hr
+			lapMaxPower = max(lapMaxPower, power)
+			ts = ts.Add(time.Second)
+		}
+		lap := fit.NewLapMsg()
+		lap.StartTime = lapStart
+		lap.Timestamp = ts
+		lap.TotalElapsedTime = uint32(seg.seconds * 1000)
+		lap.TotalTimerTime = uint32(seg.seconds * 1000)
+		lap.AvgPower = uint16(lapPower / seg.seconds)
+		lap.MaxPower = uint16(lapMaxPower)
+		lap.AvgHeartRate = uint8(lapHR / seg.seconds)
+		lap.AvgCadence = 90
+		lap.LapTrigger = fit.LapTriggerManual
+		activity.Laps = append(activity.Laps, lap)
+
+		totalPower += lapPower
+		totalHR += lapHR
+		count += seg.seconds
+	}
+
+	session := fit.NewSessionMsg()
+	session.StartTime = start
+	session.Timestamp = ts
+	session.Sport = fit.SportCycling
+	session.SubSport = fit.SubSportIndoorCycling
+	session.TotalElapsedTime = uint32(count * 1000)
+	session.TotalTimerTime = uint32(count * 1000)
+	session.TotalDistance = uint32(distance * 100)
+	session.AvgPower = uint16(totalPower / count)
+	session.AvgHeartRate = uint8(totalHR / count)
+	session.NumLaps = uint16(len(activity.Laps))
+	activity.Sessions = append(activity.Sessions, session)
+
+	act := fit.NewActivityMsg()
+	act.Timestamp = ts
+	act.NumSessions = 1
+	activity.Activity = act
+
+	var buf bytes.Buffer
+	if err := fit.Encode(&buf, file, binary.LittleEndian); err != nil {
+		log.Fatalf("encode fit: %v", err)
+	}
+	if err := os.WriteFile("testdata/intervals.fit", buf.Bytes(), 0o644); err != nil {
+		log.Fatalf("write fixture: %v", err)
+	}
+}
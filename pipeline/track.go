@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"math"
+
+	"github.com/tormoder/fit"
+)
+
+const (
+	// trackMaxPoints caps track_simplified.json for lightweight previews.
+	trackMaxPoints = 500
+	// earthRadiusM is the mean Earth radius used for the local projection.
+	earthRadiusM = 6371000.0
+)
+
+// simplifiedTrack returns the GPS track as [lat, lng] pairs simplified with
+// Douglas-Peucker to at most maxPoints. The tolerance is found by bisection so
+// the output lands as close to maxPoints as possible without exceeding it.
+// Coordinates are rounded to 5 decimals (about 1 m). It returns nil when the
+// file has fewer than two valid positions.
+func simplifiedTrack(records []*fit.RecordMsg, maxPoints int) [][2]float64 {
+	points := make([][2]float64, 0, len(records))
+	for _, rec := range records {
+		if rec == nil || rec.PositionLat.Invalid() || rec.PositionLong.Invalid() {
+			continue
+		}
+		points = append(points, [2]float64{rec.PositionLat.Degrees(), rec.PositionLong.Degrees()})
+	}
+	if len(points) < 2 {
+		return nil
+	}
+
+	keep := douglasPeucker(points, 0)
+	if maxPoints >= 2 && countKept(keep) > maxPoints {
+		lo, hi := 0.0, 1.0
+		for countKept(douglasPeucker(points, hi)) > maxPoints {
+			hi *= 2
+		}
+		for i := 0; i < 40; i++ {
+			mid := (lo + hi) / 2
+			if countKept(douglasPeucker(points, mid)) > maxPoints {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		keep = douglasPeucker(points, hi)
+	}
+
+	out := make([][2]float64, 0, countKept(keep))
+	for i, p := range points {
+		if keep[i] {
+			out = append(out, [2]float64{roundCoord(p[0]), roundCoord(p[1])})
+		}
+	}
+	return out
+}
+
+// douglasPeucker marks the points kept at toleranceM, measuring perpendicular
+// distance in a local equirectangular projection. It is iterative so long
+// tracks cannot overflow the stack.
+func douglasPeucker(points [][2]float64, toleranceM float64) []bool {
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	cosLat := math.Cos(points[0][0] * math.Pi / 180)
+	project := func(p [2]float64) (float64, float64) {
+		return p[1] * math.Pi / 180 * earthRadiusM * cosLat, p[0] * math.Pi / 180 * earthRadiusM
+	}
+
+	type span struct{ first, last int }
+	stack := []span{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if s.last-s.first < 2 {
+			continue
+		}
+		ax, ay := project(points[s.first])
+		bx, by := project(points[s.last])
+		maxDist, maxIdx := -1.0, -1
+		for i := s.first + 1; i < s.last; i++ {
+			px, py := project(points[i])
+			if d := segmentDistance(px, py, ax, ay, bx, by); d > maxDist {
+				maxDist, maxIdx = d, i
+			}
+		}
+		if maxDist > toleranceM {
+			keep[maxIdx] = true
+			stack = append(stack, span{s.first, maxIdx}, span{maxIdx, s.last})
+		}
+	}
+	return keep
+}
+
+func segmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lenSq := dx*dx + dy*dy
+	if lenSq == 0 {
+		return math.Hypot(px-ax, py-ay)
+	}
+	t := math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/lenSq))
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+func countKept(keep []bool) int {
+	n := 0
+	for _, k := range keep {
+		if k {
+			n++
+		}
+	}
+	return n
+}
+
+func roundCoord(v float64) float64 {
+	return math.Round(v*1e5) / 1e5
+}
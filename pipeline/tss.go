@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"math"
+
+	"github.com/lucasjlepore/fit-analyzer/internal/npower"
+)
+
+// tssBucketSeconds is the bucket width of tss_accumulation.json.
+const tssBucketSeconds = 300
+
+// TSSAccumulationFile shows where training load accrued across the ride.
+type TSSAccumulationFile struct {
+	FTPW          float64     `json:"ftp_w"`
+	BucketSeconds int         `json:"bucket_seconds"`
+	SessionTSS    float64     `json:"session_tss"`
+	Buckets       []TSSBucket `json:"buckets"`
+}
+
+// TSSBucket is one fixed-width elapsed-time bucket of load.
+type TSSBucket struct {
+	StartS        float64 `json:"start_s"`
+	EndS          float64 `json:"end_s"`
+	TSS           float64 `json:"tss"`
+	CumulativeTSS float64 `json:"cumulative_tss"`
+}
+
+// BuildTSSAccumulation integrates (power/FTP)^2 per sample into 5-minute
+// buckets and scales the cumulative curve so the final bucket equals
+// sessionTSS, which is NP-based and so differs slightly from a raw per-second
+// integral. Samples are weighted by the gap to the next sample; as in NP
+// resampling, a gap longer than npower.MaxHoldSeconds is a pause, and the
+// sample before it counts for one second only, so pauses do not accrue load.
+// It returns nil when FTP or session TSS is unknown or no sample has power.
+func BuildTSSAccumulation(samples []CanonicalSample, ftp, sessionTSS float64) *TSSAccumulationFile {
+	if ftp <= 0 || sessionTSS <= 0 || len(samples) == 0 {
+		return nil
+	}
+	origin := samples[0].ElapsedS
+	last := samples[len(samples)-1].ElapsedS - origin
+	count := max(int(math.Ceil(last/tssBucketSeconds)), 1)
+	raw := make([]float64, count)
+	total := 0.0
+	for i, s := range samples {
+		if !s.ValidPower || s.PowerW == nil || i+1 >= len(samples) {
+			continue
+		}
+		dt := samples[i+1].ElapsedS - s.ElapsedS
+		if dt <= 0 {
+			continue
+		}
+		if dt > npower.MaxHoldSeconds {
+			dt = 1
+		}
+		ratio := *s.PowerW / ftp
+		load := ratio * ratio * dt / 3600.0 * 100
+		idx := min(int((s.ElapsedS-origin)/tssBucketSeconds), count-1)
+		raw[idx] += load
+		total += load
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	out := &TSSAccumulationFile{
+		FTPW:          round1(ftp),
+		BucketSeconds: tssBucketSeconds,
+		SessionTSS:    round1(sessionTSS),
+		Buckets:       make([]TSSBucket, 0, count),
+	}
+	scale := sessionTSS / total
+	cumulative := 0.0
+	prev := 0.0
+	for i, load := range raw {
+		cumulative += load * scale
+		rounded := round1(cumulative)
+		if i == count-1 {
+			rounded = out.SessionTSS
+		}
+		out.Buckets = append(out.Buckets, TSSBucket{
+			StartS:        origin + float64(i*tssBucketSeconds),
+			EndS:          origin + math.Min(float64((i+1)*tssBucketSeconds), last),
+			TSS:           round1(rounded - prev),
+			CumulativeTSS: rounded,
+		})
+		prev = rounded
+	}
+	return out
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -4,49 +4,180 @@ import (
 	"time"
 
 	"github.com/lucasjlepore/fit-analyzer/analyzer"
+	"github.com/lucasjlepore/fit-analyzer/llmexport"
 )
 
 // Options configures the fit_analyze pipeline.
 type Options struct {
-	FitPath     string
-	OutDir      string
-	FTPOverride float64
-	WeightKG    float64
-	Format      string // parquet|csv
-	Overwrite   bool
-	CopySource  bool
+	FitPath                 string
+	FitData                 []byte // when set, analyzed instead of reading FitPath, which then only names the source
+	OutDir                  string
+	FTPOverride             float64
+	WeightKG                float64
+	Format                  string // parquet|csv
+	Overwrite               bool
+	CopySource              bool
+	SportOverride           string
+	IncludeWork             bool
+	Artifacts               []string
+	MinStructureConfidence  float64
+	ValidateSchema          bool
+	TimestampFormat         string // rfc3339|epoch_ms|both
+	ElapsedOrigin           string // first_record|timer_start|file_start|movement_start
+	SmoothGradeWindowS      int
+	Layout                  string // flat|nested
+	StrictFTP               bool
+	NPExcludeCoasting       bool
+	TargetPowerRounding     float64
+	TargetPctRounding       float64
+	ScalingAudit            bool
+	ExcludeLaps             []int
+	FailOnWarnings          []string
+	MetricsLong             bool
+	GeoJSON                 bool
+	GeoJSONPoints           bool
+	NPMinSamples            int
+	Reconciliation          bool
+	LapLabels               map[string]string
+	MainSetGroupingPct      float64
+	VerboseManifest         bool
+	MovementSpeedMPS        float64
+	FTPFromCPModel          bool
+	CleanGPS                bool
+	BestEffortDurationsS    []int
+	StuckSensorMinSeconds   float64
+	StuckSensorTolerancePct float64
+	DecouplingVIThreshold   float64
+	UseMedianForAverages    bool
+	RepTargetTolerancePct   float64
+	PreferGPSDistance       bool
+	RecoveryHoursPerTSS     float64
 }
 
 // BytesOptions configures in-memory pipeline execution (web/WASM-safe).
 type BytesOptions struct {
-	SourceFileName string
-	FitData        []byte
-	FTPOverride    float64
-	WeightKG       float64
-	Format         string // parquet|csv
-	CopySource     bool
+	SourceFileName          string
+	FitData                 []byte
+	FTPOverride             float64
+	WeightKG                float64
+	Format                  string // parquet|csv
+	CopySource              bool
+	SportOverride           string
+	IncludeWork             bool
+	Artifacts               []string // subset of ArtifactNames; empty means all
+	MinStructureConfidence  float64
+	ValidateSchema          bool     // fail when a JSON artifact violates its embedded schema
+	TimestampFormat         string   // canonical sample timestamps: rfc3339 (default)|epoch_ms|both
+	ElapsedOrigin           string   // elapsed_s zero point: first_record (default)|timer_start|file_start|movement_start
+	SmoothGradeWindowS      int      // centered moving-average window for grade_pct in seconds; 0 disables
+	StrictFTP               bool     // reject an FTPOverride outside 50-500 W instead of warning
+	NPExcludeCoasting       bool     // base activity summary IF/TSS on np_w_pedaling instead of np_w
+	TargetPowerRounding     float64  // lap-derived step targets round to this many watts; 0 means 5
+	TargetPctRounding       float64  // lap-derived step targets round to this many % FTP; 0 means 1
+	ScalingAudit            bool     // emit scaling_audit.json with raw vs scaled samples per field (debug)
+	ExcludeLaps             []int    // 1-based laps ignored by interval/structure detection; still exported
+	FailOnWarnings          []string // fail when a warning contains any of these substrings
+	MetricsLong             bool     // emit metrics_long.csv (metric,value,unit) for BI tools
+	GeoJSON                 bool     // emit activity.geojson (track LineString) for web mapping tools
+	GeoJSONPoints           bool     // also add one Point feature per fix with power/hr to activity.geojson
+	NPMinSamples            int      // 1 Hz power seconds needed for np_reliable; values below 30 mean 30
+	Reconciliation          bool     // emit reconciliation.json comparing session, sample and timer-event durations
+	MainSetGroupingPct      float64  // rep duration/power tolerance for splitting the main set into sets; 0 means 25
+	VerboseManifest         bool     // add raw_layout (header bytes, data/CRC offsets, CRC bytes) to manifest.json
+	MovementSpeedMPS        float64  // speed above which a sample counts as moving for movement_start; 0 means 1.0
+	FTPFromCPModel          bool     // without an FTP, estimate it as critical power (ftp_source cp_model) instead of 95% of best 20 min
+	CleanGPS                bool     // drop GPS fixes flagged as glitches from climbs, track_simplified.json and activity.geojson
+	BestEffortDurationsS    []int    // best-effort durations in seconds, strictly ascending; empty reports every power curve point
+	Layout                  string   // output layout manifest.json paths are relative to: flat (default)|nested
+	StuckSensorMinSeconds   float64  // seconds a channel must hold constant to count as stuck; 0 means 600
+	StuckSensorTolerancePct float64  // cadence/speed spread allowed in a stuck stretch, % of its lowest value; 0 means 1 (power and HR must repeat exactly)
+	DecouplingVIThreshold   float64  // variability index above which power:HR decoupling is suppressed; 0 means 1.10
+	UseMedianForAverages    bool     // report median power, HR and cadence as the averages
+	RepTargetTolerancePct   float64  // ± % around main-set rep and step targets for time in target; 0 means 5
+	PreferGPSDistance       bool     // report distance and speed from the GPS track outdoors
+	RecoveryHoursPerTSS     float64  // recommended recovery hours per TSS point; 0 means 0.24
+
+	// LapLabels renames canonical lap labels (e.g. work->effort) in
+	// analysis.json and lap-derived workout steps; see analyzer.Config.LapLabels.
+	LapLabels map[string]string
+}
+
+// Artifact names accepted by Options.Artifacts and BytesOptions.Artifacts.
+const (
+	ArtifactCanonical  = "canonical"  // canonical_samples.parquet|csv
+	ArtifactIndex      = "index"      // messages_index.json
+	ArtifactAnalysis   = "analysis"   // analysis.json
+	ArtifactLaps       = "laps"       // lap_summary.json
+	ArtifactWorkout    = "workout"    // workout_structure.json
+	ArtifactSummary    = "summary"    // activity_summary.json
+	ArtifactMarkdown   = "markdown"   // training_summary.md
+	ArtifactContext    = "context"    // llm_context.md
+	ArtifactAdherence  = "adherence"  // adherence.json
+	ArtifactTSS        = "tss"        // tss_accumulation.json
+	ArtifactTrack      = "track"      // track_simplified.json
+	ArtifactEvents     = "events"     // events.json
+	ArtifactMonitoring = "monitoring" // monitoring_summary.json (monitoring files only)
+	ArtifactRecords    = "records"    // records.jsonl
+	ArtifactManifest   = "manifest"   // manifest.json
+)
+
+// ArtifactNames lists every selectable artifact in output order.
+var ArtifactNames = []string{
+	ArtifactCanonical,
+	ArtifactIndex,
+	ArtifactAnalysis,
+	ArtifactLaps,
+	ArtifactWorkout,
+	ArtifactAdherence,
+	ArtifactTSS,
+	ArtifactTrack,
+	ArtifactEvents,
+	ArtifactMonitoring,
+	ArtifactSummary,
+	ArtifactMarkdown,
+	ArtifactContext,
+	ArtifactRecords,
+	ArtifactManifest,
 }
 
 // Result returns generated output paths.
 type Result struct {
-	OutputDir            string   `json:"output_dir"`
-	AnalysisPath         string   `json:"analysis_path,omitempty"`
-	ManifestPath         string   `json:"manifest_path"`
-	RecordsPath          string   `json:"records_path"`
-	SourceCopyPath       string   `json:"source_copy_path,omitempty"`
-	CanonicalSamplesPath string   `json:"canonical_samples_path"`
-	MessagesIndexPath    string   `json:"messages_index_path"`
-	WorkoutStructurePath string   `json:"workout_structure_path"`
-	LapSummaryPath       string   `json:"lap_summary_path,omitempty"`
-	ActivitySummaryPath  string   `json:"activity_summary_path"`
-	Warnings             []string `json:"warnings,omitempty"`
+	OutputDir             string         `json:"output_dir"`
+	AnalysisPath          string         `json:"analysis_path,omitempty"`
+	ManifestPath          string         `json:"manifest_path"`
+	RecordsPath           string         `json:"records_path"`
+	SourceCopyPath        string         `json:"source_copy_path,omitempty"`
+	CanonicalSamplesPath  string         `json:"canonical_samples_path"`
+	MessagesIndexPath     string         `json:"messages_index_path"`
+	WorkoutStructurePath  string         `json:"workout_structure_path"`
+	LapSummaryPath        string         `json:"lap_summary_path,omitempty"`
+	ActivitySummaryPath   string         `json:"activity_summary_path"`
+	LLMContextPath        string         `json:"llm_context_path,omitempty"`
+	AdherencePath         string         `json:"adherence_path,omitempty"`
+	TSSAccumulationPath   string         `json:"tss_accumulation_path,omitempty"`
+	TrackSimplifiedPath   string         `json:"track_simplified_path,omitempty"`
+	EventsPath            string         `json:"events_path,omitempty"`
+	MonitoringSummaryPath string         `json:"monitoring_summary_path,omitempty"`
+	ScalingAuditPath      string         `json:"scaling_audit_path,omitempty"`
+	MetricsLongPath       string         `json:"metrics_long_path,omitempty"`
+	GeoJSONPath           string         `json:"geojson_path,omitempty"`
+	ReconciliationPath    string         `json:"reconciliation_path,omitempty"`
+	FTPSources            []FTPCandidate `json:"ftp_sources,omitempty"`
+	FTPUsed               *FTPCandidate  `json:"ftp_used,omitempty"`
+	AnalysisFTPW          float64        `json:"analysis_ftp_w,omitempty"` // FTP the analyzer used for IF/TSS and zones
+	Warnings              []string       `json:"warnings,omitempty"`
+	Metrics               RunMetrics     `json:"metrics"`
 }
 
 // BytesResult returns generated in-memory artifact payloads.
 type BytesResult struct {
-	Files    map[string][]byte  `json:"files"`
-	Analysis *analyzer.Analysis `json:"analysis,omitempty"`
-	Warnings []string           `json:"warnings,omitempty"`
+	Files      map[string][]byte           `json:"files"`
+	Analysis   *analyzer.Analysis          `json:"analysis,omitempty"`
+	Monitoring *analyzer.MonitoringSummary `json:"monitoring,omitempty"`
+	FTPSources []FTPCandidate              `json:"ftp_sources,omitempty"`
+	FTPUsed    *FTPCandidate               `json:"ftp_used,omitempty"`
+	Warnings   []string                    `json:"warnings,omitempty"`
+	Metrics    RunMetrics                  `json:"metrics"`
 }
 
 // CanonicalSample represents one global message 20 sample row.
@@ -67,6 +198,8 @@ type CanonicalSample struct {
 	ValidCadence bool      `json:"valid_cadence"`
 	FileOffset   int64     `json:"file_offset"`
 	RecordIndex  int       `json:"record_index"`
+	WorkJ        *float64  `json:"work_j,omitempty"`
+	GradeRawPct  *float64  `json:"grade_raw_pct,omitempty"`
 }
 
 // MessageIndexFile contains local/global message mapping metadata.
@@ -90,26 +223,68 @@ type MessageFieldMeta struct {
 	InvalidRule string `json:"invalid_rule,omitempty"`
 }
 
+// ScalingAuditFile lists raw/scaled value pairs for every semantic field that
+// has a scaler, so unit conversions can be spot-checked against known values.
+type ScalingAuditFile struct {
+	Fields []ScalingAuditField `json:"fields"`
+}
+
+// ScalingAuditField holds sample conversions for one message/field pair.
+type ScalingAuditField struct {
+	GlobalMessageNum  int                  `json:"global_message_num"`
+	GlobalMessageName string               `json:"global_message_name"`
+	FieldNumber       int                  `json:"field_number"`
+	FieldName         string               `json:"field_name"`
+	Units             string               `json:"units,omitempty"`
+	Occurrences       int                  `json:"occurrences"`
+	Samples           []ScalingAuditSample `json:"samples"`
+}
+
+// ScalingAuditSample is one decoded value alongside its scaled counterpart.
+type ScalingAuditSample struct {
+	RawDecoded any `json:"raw_decoded"`
+	Scaled     any `json:"scaled"`
+}
+
 // WorkoutStructureFile is the semantic workout plan/execution output.
+// StructureConfidenceFactors sums to StructureConfidence, one entry per
+// inference heuristic that fired.
 type WorkoutStructureFile struct {
-	FTPSources []FTPCandidate `json:"ftp_sources"`
-	FTPWUsed   *FTPCandidate  `json:"ftp_w_used,omitempty"`
-	Steps      []WorkoutStep  `json:"steps,omitempty"`
+	FTPSources                 []FTPCandidate     `json:"ftp_sources"`
+	FTPWUsed                   *FTPCandidate      `json:"ftp_w_used,omitempty"`
+	FTPSpread                  *FTPSpread         `json:"ftp_spread,omitempty"`
+	StructureConfidence        float64            `json:"structure_confidence"`
+	StructureConfidenceFactors map[string]float64 `json:"structure_confidence_factors,omitempty"`
+	StructureSuppressed        bool               `json:"structure_suppressed,omitempty"`
+	Steps                      []WorkoutStep      `json:"steps,omitempty"`
 }
 
 // FTPCandidate is one FTP source hypothesis.
 type FTPCandidate struct {
 	FTPW       float64 `json:"ftp_w"`
-	Source     string  `json:"source"` // zwift_setting|user_profile|developer_field|unknown
+	Source     string  `json:"source"` // sport_profile|zwift_setting|user_profile|developer_field|unknown
 	Message    string  `json:"message"`
 	Confidence float64 `json:"confidence"`
 	Reason     string  `json:"reason,omitempty"`
 }
 
+// FTPSpread summarizes how far the FTP candidates disagree.
+type FTPSpread struct {
+	CandidateCount int     `json:"candidate_count"`
+	MinFTPW        float64 `json:"min_ftp_w"`
+	MaxFTPW        float64 `json:"max_ftp_w"`
+	SpreadW        float64 `json:"spread_w"`
+	// ChosenConfidenceRank is ftp_w_used's 1-based rank among the candidates
+	// ordered by confidence alone (ties share a rank); above 1 means source
+	// priority chose it over a more confident candidate. 0 when none was used.
+	ChosenConfidenceRank int `json:"chosen_confidence_rank"`
+}
+
 // WorkoutStep describes one workout prescription step.
 type WorkoutStep struct {
 	StepIndex         int      `json:"step_index"`
 	StepName          string   `json:"step_name,omitempty"`
+	Intensity         string   `json:"intensity,omitempty"` // workout_step intensity: active|rest|warmup|cooldown|recovery|interval|other
 	DurationS         *float64 `json:"duration_s,omitempty"`
 	DistanceM         *float64 `json:"distance_m,omitempty"`
 	TargetType        string   `json:"target_type"` // power_w|percent_ftp|power_range_w
@@ -128,6 +303,35 @@ type WorkoutStep struct {
 	PowerStdDev       *float64 `json:"power_stddev,omitempty"`
 }
 
+// EventsFile is the decoded event (global 21) timeline.
+type EventsFile struct {
+	Events []llmexport.Event `json:"events"`
+}
+
+// ReconciliationFile compares the durations the head unit recorded with the
+// ones derivable from samples and timer events, for reconciliation.json.
+type ReconciliationFile struct {
+	SessionElapsedS *float64                    `json:"session_elapsed_s,omitempty"`
+	SessionTimerS   *float64                    `json:"session_timer_s,omitempty"`
+	SessionMovingS  *float64                    `json:"session_moving_s,omitempty"`
+	SampleSpanS     float64                     `json:"sample_span_s"` // first to last record timestamp
+	SampleCount     int                         `json:"sample_count"`
+	EventTimerS     *float64                    `json:"event_timer_s,omitempty"` // summed timer start->stop spans
+	TimerPauses     int                         `json:"timer_pauses"`
+	Discrepancies   []ReconciliationDiscrepancy `json:"discrepancies"`
+}
+
+// ReconciliationDiscrepancy is one pair of durations that should agree but
+// differ by more than the tolerance.
+type ReconciliationDiscrepancy struct {
+	Left   string  `json:"left"`
+	LeftS  float64 `json:"left_s"`
+	Right  string  `json:"right"`
+	RightS float64 `json:"right_s"`
+	DiffS  float64 `json:"diff_s"` // left - right
+	Note   string  `json:"note"`
+}
+
 // LapSummaryFile contains lap-level aggregate data.
 type LapSummaryFile struct {
 	Laps []LapSummary `json:"laps"`
@@ -144,27 +348,45 @@ type LapSummary struct {
 	AvgHRBPM         float64 `json:"avg_hr_bpm"`
 	MaxHRBPM         float64 `json:"max_hr_bpm"`
 	AvgCadenceRPM    float64 `json:"avg_cadence_rpm"`
+	Trigger          string  `json:"trigger,omitempty"`
 	StartSampleIndex int     `json:"start_sample_index"`
 	EndSampleIndex   int     `json:"end_sample_index"`
 }
 
 // ActivitySummaryFile contains one-session aggregate metrics.
 type ActivitySummaryFile struct {
-	DurationS      float64  `json:"duration_s"`
-	AvgPowerW      float64  `json:"avg_power_w"`
-	NPW            float64  `json:"np_w"`
-	MaxPowerW      float64  `json:"max_power_w"`
-	AvgHRBPM       float64  `json:"avg_hr_bpm"`
-	MaxHRBPM       float64  `json:"max_hr_bpm"`
-	AvgCadenceRPM  float64  `json:"avg_cadence_rpm"`
-	MaxCadenceRPM  float64  `json:"max_cadence_rpm"`
-	TotalWorkKJ    float64  `json:"total_work_kj"`
-	FTPWUsed       *float64 `json:"ftp_w_used,omitempty"`
-	WeightKG       *float64 `json:"weight_kg,omitempty"`
-	AvgPowerWPerKG *float64 `json:"avg_power_w_per_kg,omitempty"`
-	NPWPerKG       *float64 `json:"np_w_per_kg,omitempty"`
-	MaxPowerWPerKG *float64 `json:"max_power_w_per_kg,omitempty"`
-	IF             *float64 `json:"if,omitempty"`
-	TSSLike        *float64 `json:"tss_like,omitempty"`
-	Warnings       []string `json:"warnings,omitempty"`
+	DurationS          float64                 `json:"duration_s"`
+	MoveStartOffsetS   *float64                `json:"movement_start_offset_s,omitempty"` // first moving/pedaling sample after the first record
+	AvgPowerW          float64                 `json:"avg_power_w"`
+	NPW                float64                 `json:"np_w"`
+	NPWPedaling        float64                 `json:"np_w_pedaling"`
+	NPReliable         bool                    `json:"np_reliable"` // false when np_w is a short-file fallback
+	MaxPowerW          float64                 `json:"max_power_w"`
+	AvgHRBPM           float64                 `json:"avg_hr_bpm"`
+	MaxHRBPM           float64                 `json:"max_hr_bpm"`
+	AvgCadenceRPM      float64                 `json:"avg_cadence_rpm"`
+	MaxCadenceRPM      float64                 `json:"max_cadence_rpm"`
+	TotalWorkKJ        float64                 `json:"total_work_kj"`
+	CoastingPct        *float64                `json:"coasting_pct,omitempty"`     // moving time with zero cadence or power
+	PowerSmoothnessCV  float64                 `json:"power_smoothness_cv"`        // stddev/mean of valid power
+	PowerRollingSD30W  float64                 `json:"power_rolling_stddev_30s_w"` // mean 30 s rolling stddev
+	FTPWUsed           *float64                `json:"ftp_w_used,omitempty"`
+	WeightKG           *float64                `json:"weight_kg,omitempty"`
+	AvgPowerWPerKG     *float64                `json:"avg_power_w_per_kg,omitempty"`
+	NPWPerKG           *float64                `json:"np_w_per_kg,omitempty"`
+	MaxPowerWPerKG     *float64                `json:"max_power_w_per_kg,omitempty"`
+	FTPWPerKG          *float64                `json:"ftp_w_per_kg,omitempty"`
+	PowerZones         []analyzer.ZoneDuration `json:"power_zones,omitempty"` // with W/kg bands; only when weight is known
+	IF                 *float64                `json:"if,omitempty"`
+	IFNPBasis          string                  `json:"if_np_basis,omitempty"` // all_samples|pedaling
+	TSSLike            *float64                `json:"tss_like,omitempty"`
+	SampleRateSegments []SampleRateSegment     `json:"sample_rate_segments,omitempty"`
+	Warnings           []string                `json:"warnings,omitempty"`
+}
+
+// SampleRateSegment is a contiguous span recorded at one sampling regime.
+type SampleRateSegment struct {
+	StartS          float64 `json:"start_s"`
+	EndS            float64 `json:"end_s"`
+	MedianIntervalS float64 `json:"median_interval_s"`
 }
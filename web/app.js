@@ -4,6 +4,11 @@ const fileInput = document.getElementById("file-input");
 const fileMeta = document.getElementById("file-meta");
 const ftpInput = document.getElementById("ftp-input");
 const weightInput = document.getElementById("weight-input");
+const cleanGPSInput = document.getElementById("clean-gps-input");
+const bestEffortsInput = document.getElementById("best-efforts-input");
+const targetToleranceInput = document.getElementById("target-tolerance-input");
+const recoveryHoursInput = document.getElementById("recovery-hours-input");
+const preferGPSDistanceInput = document.getElementById("prefer-gps-distance-input");
 const analyzeBtn = document.getElementById("analyze-btn");
 const downloadBtn = document.getElementById("download-btn");
 const copyBtn = document.getElementById("copy-btn");
@@ -72,6 +77,13 @@ function positiveNumber(input) {
   return Number.isFinite(value) && value > 0 ? value : 0;
 }
 
+function positiveIntegerList(input) {
+  return input.value
+    .split(",")
+    .map((part) => Number(part.trim()))
+    .filter((value) => Number.isInteger(value) && value > 0);
+}
+
 function nonNegativeInteger(input) {
   const value = Number(input.value);
   return Number.isFinite(value) && value >= 0 ? Math.round(value) : 0;
@@ -835,6 +847,11 @@ async function runAnalysis() {
       source_file_name: selectedFile.name,
       ftp_w: positiveNumber(ftpInput),
       weight_kg: positiveNumber(weightInput),
+      clean_gps: cleanGPSInput.checked,
+      best_effort_durations_s: positiveIntegerList(bestEffortsInput),
+      target_tolerance_pct: positiveNumber(targetToleranceInput),
+      prefer_gps_distance: preferGPSDistanceInput.checked,
+      recovery_hours_per_tss: positiveNumber(recoveryHoursInput),
       format: "csv",
     });
 
@@ -16,11 +16,16 @@ import (
 
 // AnalyzeOptions configures one in-browser analysis run.
 type AnalyzeOptions struct {
-	SourceFileName string
-	FitData        []byte
-	FTPWatts       float64
-	WeightKG       float64
-	Format         string
+	SourceFileName        string
+	FitData               []byte
+	FTPWatts              float64
+	WeightKG              float64
+	Format                string
+	CleanGPS              bool
+	BestEffortsS          []int
+	RepTargetTolerancePct float64
+	PreferGPSDistance     bool
+	RecoveryHoursPerTSS   float64
 }
 
 // AnalyzeResult packages analyzer output and downloadable artifacts for the UI.
@@ -71,12 +76,17 @@ func AnalyzeBytes(opts AnalyzeOptions) (*AnalyzeResult, error) {
 	}
 
 	result, err := pipeline.RunBytes(pipeline.BytesOptions{
-		SourceFileName: opts.SourceFileName,
-		FitData:        opts.FitData,
-		FTPOverride:    opts.FTPWatts,
-		WeightKG:       opts.WeightKG,
-		Format:         format,
-		CopySource:     true,
+		SourceFileName:        opts.SourceFileName,
+		FitData:               opts.FitData,
+		FTPOverride:           opts.FTPWatts,
+		WeightKG:              opts.WeightKG,
+		Format:                format,
+		CopySource:            true,
+		CleanGPS:              opts.CleanGPS,
+		BestEffortDurationsS:  opts.BestEffortsS,
+		RepTargetTolerancePct: opts.RepTargetTolerancePct,
+		PreferGPSDistance:     opts.PreferGPSDistance,
+		RecoveryHoursPerTSS:   opts.RecoveryHoursPerTSS,
 	})
 	if err != nil {
 		return nil, err